@@ -0,0 +1,168 @@
+// Package cache caches chunk reads from a slow, typically remote, chunk
+// store.
+//
+// A Store keeps recently read chunks in a size-bounded LRU cache and
+// deduplicates concurrent fetches of the same chunk. For sequential
+// reassembly, Sequential returns a view of the Store that prefetches the
+// chunks following each read chunk of a manifest, so that reading a blob is
+// not bound by the latency of fetching each chunk in turn.
+//
+// A WriteThrough puts chunks in a bounded local disk cache and uploads them
+// to a remote store in the background, for clients with unreliable uplinks.
+package cache
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// Store is a manifest.Store that caches the chunks read from another
+// Store. It is safe for concurrent use.
+type Store struct {
+	backend  manifest.Store
+	maxBytes int64
+
+	mu       sync.Mutex
+	size     int64
+	lru      *list.List // of *entry, most recently used first
+	entries  map[string]*list.Element
+	inflight map[string]*fetch
+}
+
+type entry struct {
+	digest string
+	data   []byte
+}
+
+// fetch is a Get from the backend that other callers may wait for.
+type fetch struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// New returns a Store caching up to maxBytes of chunk data read from
+// backend. Chunks larger than maxBytes are not cached.
+func New(backend manifest.Store, maxBytes int64) *Store {
+	return &Store{
+		backend:  backend,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		inflight: map[string]*fetch{},
+	}
+}
+
+// Has reports whether the chunk is cached or stored in the backend.
+func (s *Store) Has(digest string) bool {
+	s.mu.Lock()
+	_, ok := s.entries[digest]
+	s.mu.Unlock()
+	return ok || s.backend.Has(digest)
+}
+
+// Get returns the contents of a chunk, from the cache if possible. The
+// returned slice is shared with the cache and must not be modified.
+func (s *Store) Get(digest string) ([]byte, error) {
+	s.mu.Lock()
+	if e, ok := s.entries[digest]; ok {
+		s.lru.MoveToFront(e)
+		s.mu.Unlock()
+		return e.Value.(*entry).data, nil
+	}
+	f, ok := s.inflight[digest]
+	if !ok {
+		f = s.startFetch(digest)
+	}
+	s.mu.Unlock()
+	<-f.done
+	return f.data, f.err
+}
+
+// Prefetch starts fetching the given chunks into the cache in the
+// background, skipping those already cached or being fetched. Errors are
+// discarded; a later Get fetches the chunk again.
+func (s *Store) Prefetch(digests ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, digest := range digests {
+		if _, ok := s.entries[digest]; ok {
+			continue
+		}
+		if _, ok := s.inflight[digest]; !ok {
+			s.startFetch(digest)
+		}
+	}
+}
+
+// Len returns the number of cached chunks and their total size in bytes.
+func (s *Store) Len() (chunks int, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len(), s.size
+}
+
+// startFetch fetches a chunk from the backend in a new goroutine. s.mu must
+// be held.
+func (s *Store) startFetch(digest string) *fetch {
+	f := &fetch{done: make(chan struct{})}
+	s.inflight[digest] = f
+	go func() {
+		f.data, f.err = s.backend.Get(digest)
+		s.mu.Lock()
+		delete(s.inflight, digest)
+		if f.err == nil {
+			s.add(digest, f.data)
+		}
+		s.mu.Unlock()
+		close(f.done)
+	}()
+	return f
+}
+
+// add caches a chunk, evicting the least recently used chunks as needed.
+// s.mu must be held.
+func (s *Store) add(digest string, data []byte) {
+	if int64(len(data)) > s.maxBytes {
+		return
+	}
+	if _, ok := s.entries[digest]; ok {
+		return
+	}
+	s.entries[digest] = s.lru.PushFront(&entry{digest: digest, data: data})
+	s.size += int64(len(data))
+	for s.size > s.maxBytes {
+		e := s.lru.Remove(s.lru.Back()).(*entry)
+		delete(s.entries, e.digest)
+		s.size -= int64(len(e.data))
+	}
+}
+
+// Sequential returns a view of s for reading the chunks of m in order, for
+// example with manifest.NewRangeReader. Each Get of a chunk of m prefetches
+// the ahead chunks that follow it in m.
+func (s *Store) Sequential(m *manifest.Manifest, ahead int) manifest.Store {
+	next := make(map[string]int, len(m.Chunks))
+	for i := len(m.Chunks) - 1; i >= 0; i-- {
+		next[m.Chunks[i].Digest] = i + 1
+	}
+	return &sequential{Store: s, chunks: m.Chunks, next: next, ahead: ahead}
+}
+
+// sequential is the view returned by Store.Sequential.
+type sequential struct {
+	*Store
+	chunks manifest.ChunkList
+	// next maps each digest to the index following its first occurrence.
+	next  map[string]int
+	ahead int
+}
+
+func (q *sequential) Get(digest string) ([]byte, error) {
+	if i, ok := q.next[digest]; ok && q.ahead > 0 {
+		q.Prefetch(q.chunks[i:min(i+q.ahead, len(q.chunks))].Digests()...)
+	}
+	return q.Store.Get(digest)
+}
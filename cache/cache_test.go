@@ -0,0 +1,117 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// countingStore is a map-backed store that counts Gets per digest.
+type countingStore struct {
+	mu     sync.Mutex
+	chunks map[string][]byte
+	gets   map[string]int
+}
+
+func (s *countingStore) Has(digest string) bool {
+	_, ok := s.chunks[digest]
+	return ok
+}
+
+func (s *countingStore) Get(digest string) ([]byte, error) {
+	s.mu.Lock()
+	s.gets[digest]++
+	s.mu.Unlock()
+	data, ok := s.chunks[digest]
+	if !ok {
+		return nil, fmt.Errorf("chunk %s: %w", digest, os.ErrNotExist)
+	}
+	return data, nil
+}
+
+func (s *countingStore) count(digest string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.gets[digest]
+}
+
+func TestStore(t *testing.T) {
+	backend := &countingStore{chunks: map[string][]byte{
+		"a": bytes.Repeat([]byte{1}, 100),
+		"b": bytes.Repeat([]byte{2}, 100),
+		"c": bytes.Repeat([]byte{3}, 100),
+		"d": bytes.Repeat([]byte{4}, 300),
+	}, gets: map[string]int{}}
+	s := New(backend, 250)
+
+	for range 3 {
+		if data, err := s.Get("a"); err != nil || !bytes.Equal(data, backend.chunks["a"]) {
+			t.Fatalf("Get(a) = %x, %v", data, err)
+		}
+	}
+	if n := backend.count("a"); n != 1 {
+		t.Errorf("backend got %d Gets of a, want 1", n)
+	}
+
+	// Caching c evicts the least recently used chunk, b.
+	s.Get("b")
+	s.Get("a")
+	s.Get("c")
+	if chunks, size := s.Len(); chunks != 2 || size != 200 {
+		t.Errorf("Len() = %d, %d, want 2, 200", chunks, size)
+	}
+	s.Get("a")
+	s.Get("b")
+	if got := [2]int{backend.count("a"), backend.count("b")}; got != [2]int{1, 2} {
+		t.Errorf("backend Gets of a, b = %v, want [1 2]", got)
+	}
+
+	// Chunks larger than the cache are not cached.
+	s.Get("d")
+	if _, size := s.Len(); size > 250 {
+		t.Errorf("cache holds %d bytes, want at most 250", size)
+	}
+
+	if _, err := s.Get("missing"); err == nil {
+		t.Error("Get() of missing chunk succeeded")
+	}
+	if !s.Has("d") || s.Has("missing") {
+		t.Error("Has() is wrong")
+	}
+}
+
+func TestStore_Sequential(t *testing.T) {
+	data := make([]byte, 200000)
+	rand.New(rand.NewSource(1)).Read(data)
+	m, err := manifest.Build(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &countingStore{chunks: map[string][]byte{}, gets: map[string]int{}}
+	for _, c := range m.Chunks {
+		backend.chunks[c.Digest] = data[c.Offset : c.Offset+c.Length]
+	}
+	s := New(backend, 1<<20)
+	rr, err := manifest.NewRangeReader(m, s.Sequential(m, 4), 0, m.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(rr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("read data differs")
+	}
+	for _, c := range m.Chunks {
+		if n := backend.count(c.Digest); n != 1 {
+			t.Errorf("backend got %d Gets of chunk at %d, want 1", n, c.Offset)
+		}
+	}
+}
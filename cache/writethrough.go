@@ -0,0 +1,325 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/buildbuddy-io/fastcdc2020/fsstore"
+)
+
+// Remote is a chunk store that WriteThrough uploads to.
+type Remote interface {
+	Has(digest string) bool
+	Get(digest string) ([]byte, error)
+	Put(digest string, data []byte) error
+}
+
+// WriteThroughOptions configures a WriteThrough.
+type WriteThroughOptions struct {
+	// MaxBytes bounds the size of the local cache. Chunks that have not been
+	// uploaded yet are never evicted, so the cache may exceed MaxBytes while
+	// uploads lag behind.
+	MaxBytes int64
+	// Workers is the number of concurrent uploads (defaults to 4).
+	Workers int
+	// MinBackoff and MaxBackoff bound the exponential backoff between
+	// retries of a failed upload (default to 100ms and 30s).
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// ErrClosed is returned by WriteThrough.Put after Close.
+var ErrClosed = errors.New("store is closed")
+
+// WriteThrough is a chunk store that writes chunks to a bounded local disk
+// cache and uploads them to a remote store in the background, retrying
+// failed uploads with backoff. Reads are served from the local cache when
+// possible. It is safe for concurrent use.
+//
+// Chunks found in the local cache when the WriteThrough is created are
+// uploaded unless the remote already has them, so uploads interrupted by a
+// crash or by Close resume on the next start.
+type WriteThrough struct {
+	local  *fsstore.Store
+	remote Remote
+	opts   WriteThroughOptions
+
+	mu      sync.Mutex
+	cond    *sync.Cond // signaled when the queue or pending set changes
+	size    int64
+	lru     *list.List // of *diskEntry, most recently used first
+	entries map[string]*list.Element
+	queue   []string
+	pending map[string]bool // queued or being uploaded
+	lastErr error
+	closed  bool
+
+	stop    chan struct{}
+	workers sync.WaitGroup
+}
+
+type diskEntry struct {
+	digest string
+	size   int64
+}
+
+// NewWriteThrough returns a WriteThrough caching chunks in local and
+// uploading them to remote.
+func NewWriteThrough(local *fsstore.Store, remote Remote, opts WriteThroughOptions) (*WriteThrough, error) {
+	if opts.MaxBytes <= 0 {
+		return nil, errors.New("MaxBytes must be positive")
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(30*time.Second, opts.MinBackoff)
+	}
+	w := &WriteThrough{
+		local:   local,
+		remote:  remote,
+		opts:    opts,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+		pending: map[string]bool{},
+		stop:    make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	err := local.Walk(func(digest string, size int64) error {
+		w.entries[digest] = w.lru.PushBack(&diskEntry{digest: digest, size: size})
+		w.size += size
+		w.enqueue(digest)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for range opts.Workers {
+		w.workers.Add(1)
+		go w.uploadLoop()
+	}
+	return w, nil
+}
+
+// Has reports whether the chunk is cached locally or stored remotely.
+func (w *WriteThrough) Has(digest string) bool {
+	w.mu.Lock()
+	_, ok := w.entries[digest]
+	w.mu.Unlock()
+	return ok || w.remote.Has(digest)
+}
+
+// Get returns a chunk from the local cache, or fetches it from the remote
+// store and caches it.
+func (w *WriteThrough) Get(digest string) ([]byte, error) {
+	w.mu.Lock()
+	e, ok := w.entries[digest]
+	if ok {
+		w.lru.MoveToFront(e)
+	}
+	w.mu.Unlock()
+	if ok {
+		if data, err := w.local.Get(digest); err == nil {
+			return data, nil
+		}
+	}
+	data, err := w.remote.Get(digest)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.local.Put(digest, data); err == nil {
+		w.mu.Lock()
+		w.add(digest, int64(len(data)))
+		w.mu.Unlock()
+	}
+	return data, nil
+}
+
+// Put writes a chunk to the local cache and queues it for upload. It
+// returns once the chunk is on local disk.
+func (w *WriteThrough) Put(digest string, data []byte) error {
+	w.mu.Lock()
+	closed := w.closed
+	_, ok := w.entries[digest]
+	w.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	if ok {
+		return nil
+	}
+	if err := w.local.Put(digest, data); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enqueue(digest)
+	w.add(digest, int64(len(data)))
+	return nil
+}
+
+// Pending returns the number of chunks waiting to be uploaded.
+func (w *WriteThrough) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
+
+// Flush waits until every chunk Put so far has been uploaded, or until ctx
+// is done. In the latter case it returns the context's error along with the
+// last upload error, if any.
+func (w *WriteThrough) Flush(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.cond.Broadcast()
+	})
+	defer stop()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.pending) > 0 {
+		if err := ctx.Err(); err != nil {
+			if w.lastErr != nil {
+				return fmt.Errorf("%w (last upload error: %v)", err, w.lastErr)
+			}
+			return err
+		}
+		w.cond.Wait()
+	}
+	return nil
+}
+
+// Close stops accepting new chunks, drains pending uploads as Flush does,
+// and stops the upload workers. Chunks left pending when ctx is done stay in
+// the local cache and are uploaded by the next WriteThrough using it.
+func (w *WriteThrough) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	err := w.Flush(ctx)
+	close(w.stop)
+	w.mu.Lock()
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	w.workers.Wait()
+	return err
+}
+
+// enqueue queues a chunk for upload. w.mu must be held.
+func (w *WriteThrough) enqueue(digest string) {
+	if w.pending[digest] {
+		return
+	}
+	w.pending[digest] = true
+	w.queue = append(w.queue, digest)
+	w.cond.Broadcast()
+}
+
+// add records a chunk in the local cache and evicts the least recently used
+// uploaded chunks while the cache is over its bound. w.mu must be held.
+func (w *WriteThrough) add(digest string, size int64) {
+	if e, ok := w.entries[digest]; ok {
+		w.lru.MoveToFront(e)
+	} else {
+		w.entries[digest] = w.lru.PushFront(&diskEntry{digest: digest, size: size})
+		w.size += size
+	}
+	w.evict()
+}
+
+// evict removes uploaded chunks from the local cache, least recently used
+// first, until it fits its bound. w.mu must be held.
+func (w *WriteThrough) evict() {
+	for e := w.lru.Back(); e != nil && w.size > w.opts.MaxBytes; {
+		prev := e.Prev()
+		de := e.Value.(*diskEntry)
+		if !w.pending[de.digest] && w.local.Delete(de.digest) == nil {
+			w.lru.Remove(e)
+			delete(w.entries, de.digest)
+			w.size -= de.size
+		}
+		e = prev
+	}
+}
+
+// uploadLoop uploads queued chunks until the WriteThrough is closed.
+func (w *WriteThrough) uploadLoop() {
+	defer w.workers.Done()
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.stopped() {
+			w.cond.Wait()
+		}
+		if w.stopped() {
+			w.mu.Unlock()
+			return
+		}
+		digest := w.queue[0]
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+
+		if !w.upload(digest) {
+			return
+		}
+		w.mu.Lock()
+		delete(w.pending, digest)
+		w.evict()
+		w.cond.Broadcast()
+		w.mu.Unlock()
+	}
+}
+
+// upload uploads a chunk unless the remote already has it, retrying with
+// backoff. It returns false if the WriteThrough was closed first.
+func (w *WriteThrough) upload(digest string) bool {
+	backoff := w.opts.MinBackoff
+	for {
+		err := w.tryUpload(digest)
+		if err == nil {
+			return true
+		}
+		w.mu.Lock()
+		w.lastErr = err
+		w.mu.Unlock()
+		select {
+		case <-w.stop:
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, w.opts.MaxBackoff)
+	}
+}
+
+func (w *WriteThrough) tryUpload(digest string) error {
+	if w.remote.Has(digest) {
+		return nil
+	}
+	data, err := w.local.Get(digest)
+	if err != nil {
+		return err
+	}
+	return w.remote.Put(digest, data)
+}
+
+// stopped reports whether the upload workers should exit.
+func (w *WriteThrough) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
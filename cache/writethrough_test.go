@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/buildbuddy-io/fastcdc2020/fsstore"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// flakyRemote is an in-memory Remote whose Puts fail while failing is set.
+type flakyRemote struct {
+	mu      sync.Mutex
+	chunks  map[string][]byte
+	failing bool
+	puts    int
+}
+
+func (r *flakyRemote) Has(digest string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.chunks[digest]
+	return ok
+}
+
+func (r *flakyRemote) Get(digest string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, ok := r.chunks[digest]
+	if !ok {
+		return nil, fmt.Errorf("chunk %s: %w", digest, os.ErrNotExist)
+	}
+	return data, nil
+}
+
+func (r *flakyRemote) Put(digest string, data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.puts++
+	if r.failing {
+		return errors.New("uplink down")
+	}
+	r.chunks[digest] = bytes.Clone(data)
+	return nil
+}
+
+func (r *flakyRemote) setFailing(failing bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failing = failing
+}
+
+func TestWriteThrough(t *testing.T) {
+	dir := t.TempDir()
+	local, err := fsstore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := &flakyRemote{chunks: map[string][]byte{}, failing: true}
+	opts := WriteThroughOptions{MaxBytes: 250, Workers: 2, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	w, err := NewWriteThrough(local, remote, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var digests []string
+	for i := range 5 {
+		data := bytes.Repeat([]byte{byte(i)}, 100)
+		digest := manifest.Digest(data)
+		digests = append(digests, digest)
+		if err := w.Put(digest, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// While the uplink is down nothing is evicted, and Flush times out.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := w.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Flush() = %v, want deadline exceeded", err)
+	}
+	if n := w.Pending(); n != 5 {
+		t.Errorf("Pending() = %d, want 5", n)
+	}
+	for _, d := range digests {
+		if !local.Has(d) {
+			t.Errorf("chunk %s evicted before upload", d)
+		}
+	}
+
+	// Close stops before everything is uploaded; a new WriteThrough resumes.
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := w.Close(ctx); err == nil {
+		t.Error("Close() with failing uploads succeeded")
+	}
+	if err := w.Put(digests[0], nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Put() after Close = %v, want %v", err, ErrClosed)
+	}
+	remote.setFailing(false)
+	w, err = NewWriteThrough(local, remote, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range digests {
+		if !remote.Has(d) {
+			t.Errorf("chunk %s not uploaded", d)
+		}
+	}
+
+	// Once uploaded, the local cache shrinks to its bound and evicted chunks
+	// are fetched back from the remote.
+	var size int64
+	local.Walk(func(_ string, n int64) error {
+		size += n
+		return nil
+	})
+	if size > opts.MaxBytes {
+		t.Errorf("local cache holds %d bytes, want at most %d", size, opts.MaxBytes)
+	}
+	for i, d := range digests {
+		data, err := w.Get(d)
+		if err != nil || !bytes.Equal(data, bytes.Repeat([]byte{byte(i)}, 100)) {
+			t.Errorf("Get(%s) = %v", d, err)
+		}
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
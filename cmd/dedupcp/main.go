@@ -0,0 +1,217 @@
+// Command dedupcp snapshots a directory into a content-addressed chunk store
+// and restores it.
+//
+// Usage:
+//
+//	dedupcp snapshot [-avg size] [-cache file] -store dir -o snapshot.json src
+//	dedupcp restore -store dir -i snapshot.json dst
+//
+// A snapshot chunks every regular file under src with FastCDC, stores each
+// distinct chunk once in the store directory, and writes the tree of file
+// manifests as JSON. Snapshotting similar directories into the same store
+// only adds the chunks that changed. Restore reassembles the files from the
+// store, verifying each against its digest. File modes, symlinks, and empty
+// directories are not recorded.
+//
+// With -cache, snapshot remembers the manifest of every file by device,
+// inode, size, and modification time, and skips chunking files that have not
+// changed since the previous snapshot with the same cache file and -avg.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/buildbuddy-io/fastcdc2020/fsstore"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "snapshot":
+		err = snapshotCmd(os.Args[2:])
+	case "restore":
+		err = restoreCmd(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dedupcp:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dedupcp snapshot [-avg size] [-cache file] -store dir -o snapshot.json src")
+	fmt.Fprintln(os.Stderr, "       dedupcp restore -store dir -i snapshot.json dst")
+	os.Exit(2)
+}
+
+func snapshotCmd(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	avg := fs.Int("avg", 64<<10, "average chunk size in bytes")
+	storeDir := fs.String("store", "", "chunk store directory")
+	out := fs.String("o", "", "snapshot file to write")
+	cachePath := fs.String("cache", "", "file cache of manifests by file identity, created if missing")
+	fs.Parse(args)
+	if *storeDir == "" || *out == "" || fs.NArg() != 1 {
+		usage()
+	}
+	store, err := fsstore.Open(*storeDir)
+	if err != nil {
+		return err
+	}
+	var cache *manifest.FileCache
+	if *cachePath != "" {
+		cache, err = manifest.LoadFileCache(*cachePath)
+		if errors.Is(err, os.ErrNotExist) {
+			cache, err = manifest.NewFileCache(), nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	tree, stats, err := snapshot(fs.Arg(0), store, *avg, cache)
+	if err != nil {
+		return err
+	}
+	if cache != nil {
+		cache.Prune()
+		if err := cache.Save(*cachePath); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(tree, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d files, %d bytes, %d new bytes stored\n", len(tree), stats.Bytes, stats.NewBytes)
+	return nil
+}
+
+func restoreCmd(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	storeDir := fs.String("store", "", "chunk store directory")
+	in := fs.String("i", "", "snapshot file to read")
+	fs.Parse(args)
+	if *storeDir == "" || *in == "" || fs.NArg() != 1 {
+		usage()
+	}
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	var tree manifest.Tree
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return fmt.Errorf("%s: %w", *in, err)
+	}
+	store, err := fsstore.Open(*storeDir)
+	if err != nil {
+		return err
+	}
+	return restore(tree, store, fs.Arg(0))
+}
+
+// snapshotStats summarizes a snapshot.
+type snapshotStats struct {
+	// Bytes is the total size of the files.
+	Bytes int64
+	// NewBytes is the size of the chunks that were not already stored.
+	NewBytes int64
+}
+
+// snapshot chunks every regular file under src into store and returns the
+// tree of their manifests. Files found in cache, if not nil, are not chunked.
+func snapshot(src string, store *fsstore.Store, averageSize int, cache *manifest.FileCache) (manifest.Tree, snapshotStats, error) {
+	tc, err := manifest.NewTreeChunker(averageSize, 0)
+	if err != nil {
+		return nil, snapshotStats{}, err
+	}
+	if cache != nil {
+		tc.SetCache(cache)
+	}
+	var (
+		newBytes atomic.Int64
+		seen     sync.Map // digests of the chunks stored by this snapshot
+	)
+	tree, err := tc.ChunkAndPut(os.DirFS(src), ".", func(digest string, data []byte) error {
+		if store.Has(digest) {
+			return nil
+		}
+		// Files are chunked concurrently, so a chunk shared by several of
+		// them may not be stored yet when the others check for it.
+		if _, dup := seen.LoadOrStore(digest, true); dup {
+			return nil
+		}
+		newBytes.Add(int64(len(data)))
+		return store.Put(digest, data)
+	})
+	if err != nil {
+		return nil, snapshotStats{}, err
+	}
+	stats := snapshotStats{NewBytes: newBytes.Load()}
+	for _, m := range tree {
+		stats.Bytes += m.Size
+	}
+	return tree, stats, nil
+}
+
+// restore writes every file of tree under dst, reading chunks from store.
+func restore(tree manifest.Tree, store *fsstore.Store, dst string) error {
+	for path, m := range tree {
+		if !filepath.IsLocal(path) {
+			return fmt.Errorf("refusing to restore non-local path %q", path)
+		}
+		if err := restoreFile(filepath.Join(dst, filepath.FromSlash(path)), m, store); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func restoreFile(name string, m *manifest.Manifest, store *fsstore.Store) error {
+	if missing := m.Chunks.Missing(store); len(missing) > 0 {
+		return fmt.Errorf("%d chunks missing from store, first %s", len(missing), missing[0])
+	}
+	h, err := m.DigestFunction.New()
+	if err != nil {
+		return err
+	}
+	rr, err := manifest.NewRangeReader(m, store, 0, m.Size)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.MultiWriter(f, h), rr)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != m.Digest {
+		return errors.New("restored file does not match its digest")
+	}
+	return nil
+}
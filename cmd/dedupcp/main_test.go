@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/fsstore"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	src := t.TempDir()
+	rng := rand.New(rand.NewSource(1))
+	files := map[string][]byte{}
+	for _, name := range []string{"a", "dir/b", "dir/sub/c", "empty"} {
+		data := make([]byte, rng.Intn(200000))
+		rng.Read(data)
+		files[name] = data
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := fsstore.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, stats, err := snapshot(src, store, 4096, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree) != len(files) || stats.NewBytes == 0 {
+		t.Errorf("snapshot of %d files = %d files, %+v", len(files), len(tree), stats)
+	}
+
+	// A second snapshot of unchanged files stores nothing new.
+	if _, stats, err := snapshot(src, store, 4096, nil); err != nil || stats.NewBytes != 0 {
+		t.Errorf("second snapshot stored %d new bytes, %v", stats.NewBytes, err)
+	}
+
+	// A snapshot using the cache of a previous one has the same manifests.
+	cache := manifest.NewFileCache()
+	for range 2 {
+		cached, _, err := snapshot(src, store, 4096, cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, m := range tree {
+			if cached[name].Digest != m.Digest {
+				t.Errorf("%s: manifest with cache differs", name)
+			}
+		}
+	}
+	if cache.Len() != len(files) {
+		t.Errorf("cache holds %d files, want %d", cache.Len(), len(files))
+	}
+
+	dst := t.TempDir()
+	if err := restore(tree, store, dst); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("restored %s differs: %v", name, err)
+		}
+	}
+
+	tree["../escape"] = tree["a"]
+	if err := restore(tree, store, dst); err == nil {
+		t.Error("restore of non-local path succeeded")
+	}
+}
+
+func TestSnapshot_SharedChunks(t *testing.T) {
+	src := t.TempDir()
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+	for i := range 16 {
+		if err := os.WriteFile(filepath.Join(src, fmt.Sprint(i)), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := fsstore.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, stats, err := snapshot(src, store, 4096, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NewBytes != int64(len(data)) {
+		t.Errorf("snapshot of identical files stored %d new bytes, want %d", stats.NewBytes, len(data))
+	}
+}
+
+func TestRestore_DigestFunction(t *testing.T) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(2)).Read(data)
+	m, err := manifest.DigestSHA512.Build(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := fsstore.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range m.Chunks {
+		if err := store.Put(c.Digest, data[c.Offset:c.Offset+c.Length]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst := t.TempDir()
+	if err := restore(manifest.Tree{"f": m}, store, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dst, "f")); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("restored SHA-512 file differs: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+// Command fastcdc inspects how data chunks with FastCDC.
+//
+// Usage:
+//
+//	fastcdc <command> [flags] [args]
+//
+// The commands are:
+//
+//	stats   chunk files under a grid of parameters and report chunk counts,
+//	        size distribution, and dedup ratio for each combination
+//	vectors emit chunk boundary test vectors for a file as JSON, for
+//	        checking other implementations against this one
+//	verify  re-chunk a file and report where it diverges from a manifest
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// command is a subcommand. run returns an error for usage mistakes wrapped
+// in usageError, which are reported with the command's usage.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"stats", statsUsage, runStats},
+	{"vectors", vectorsUsage, runVectors},
+	{"verify", verifyUsage, runVerify},
+}
+
+// usageError reports a mistake in the command line.
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	for _, cmd := range commands {
+		if cmd.name != os.Args[1] {
+			continue
+		}
+		err := cmd.run(os.Args[2:], os.Stdout)
+		if _, ok := err.(usageError); ok {
+			fmt.Fprintf(os.Stderr, "fastcdc %s: %v\nusage: %s\n", cmd.name, err, cmd.usage)
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "fastcdc %s: %v\n", cmd.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	usage()
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: fastcdc <command> [flags] [args]")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "       %s\n", cmd.usage)
+	}
+	os.Exit(2)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+	"github.com/buildbuddy-io/fastcdc2020/tuner"
+)
+
+const statsUsage = "fastcdc stats [-avg 256k,512k,1m] [-norm 0..3] [-format table|csv|json] path..."
+
+func runStats(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	avgFlag := fs.String("avg", "16k,64k,256k,1m", "comma-separated average chunk sizes")
+	normFlag := fs.String("norm", "0..3", "normalization levels, as a list or a lo..hi range")
+	format := fs.String("format", "table", "output format: table, csv, or json")
+	if err := fs.Parse(args); err != nil {
+		return usageError{err.Error()}
+	}
+	if fs.NArg() == 0 {
+		return usageError{"no paths given"}
+	}
+	grid, err := parseGrid(*avgFlag, *normFlag)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+	if *format != "table" && *format != "csv" && *format != "json" {
+		return usageError{fmt.Sprintf("unknown format %q", *format)}
+	}
+
+	var results []tuner.Result
+	for _, avg := range grid.AverageSizes {
+		for _, norm := range grid.Normalizations {
+			p := tuner.Params{AverageSize: avg, Normalization: norm}
+			tree, err := chunkPaths(fs.Args(), p)
+			if err != nil {
+				return err
+			}
+			results = append(results, tuner.NewResult(p, tree, tuner.Objective{}))
+		}
+	}
+	return writeStats(stdout, *format, results)
+}
+
+// chunkPaths chunks every regular file under paths and returns their
+// manifests, keyed by path.
+func chunkPaths(paths []string, p tuner.Params) (manifest.Tree, error) {
+	tc, err := manifest.NewTreeChunker(p.AverageSize, 0, p.Options()...)
+	if err != nil {
+		return nil, fmt.Errorf("average size %d, normalization %d: %w", p.AverageSize, p.Normalization, err)
+	}
+	tree := manifest.Tree{}
+	for _, path := range paths {
+		dir, root := path, "."
+		if info, err := os.Stat(path); err != nil {
+			return nil, err
+		} else if !info.IsDir() {
+			dir, root = filepath.Split(path)
+		}
+		sub, err := tc.Chunk(os.DirFS(filepath.Join(dir, ".")), root)
+		if err != nil {
+			return nil, err
+		}
+		for name, m := range sub {
+			tree[filepath.Join(dir, name)] = m
+		}
+	}
+	return tree, nil
+}
+
+func writeStats(w io.Writer, format string, results []tuner.Result) error {
+	header := []string{"avg", "norm", "files", "chunks", "unique_chunks", "bytes", "unique_bytes", "dedup_ratio", "mean_size", "stddev_size"}
+	row := func(r tuner.Result) []string {
+		return []string{
+			strconv.Itoa(r.AverageSize),
+			strconv.Itoa(r.Normalization),
+			strconv.Itoa(r.Files),
+			strconv.Itoa(r.Chunks),
+			strconv.Itoa(r.UniqueChunks),
+			strconv.FormatInt(r.TotalBytes, 10),
+			strconv.FormatInt(r.UniqueBytes, 10),
+			strconv.FormatFloat(r.DedupRatio, 'f', 4, 64),
+			strconv.FormatFloat(r.MeanChunkSize, 'f', 0, 64),
+			strconv.FormatFloat(r.StdDevChunkSize, 'f', 0, 64),
+		}
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		for _, r := range results {
+			cw.Write(row(r))
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+		for _, r := range results {
+			fmt.Fprintln(tw, strings.Join(row(r), "\t")+"\t")
+		}
+		return tw.Flush()
+	}
+}
+
+// parseGrid parses the -avg and -norm flags.
+func parseGrid(avgs, norms string) (tuner.Grid, error) {
+	var grid tuner.Grid
+	for _, s := range strings.Split(avgs, ",") {
+		size, err := parseSize(s)
+		if err != nil {
+			return grid, err
+		}
+		grid.AverageSizes = append(grid.AverageSizes, size)
+	}
+	if lo, hi, ok := strings.Cut(norms, ".."); ok {
+		l, err1 := strconv.Atoi(lo)
+		h, err2 := strconv.Atoi(hi)
+		if err1 != nil || err2 != nil || l > h {
+			return grid, fmt.Errorf("invalid normalization range %q", norms)
+		}
+		for n := l; n <= h; n++ {
+			grid.Normalizations = append(grid.Normalizations, n)
+		}
+		return grid, nil
+	}
+	for _, s := range strings.Split(norms, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return grid, fmt.Errorf("invalid normalization level %q", s)
+		}
+		grid.Normalizations = append(grid.Normalizations, n)
+	}
+	return grid, nil
+}
+
+// parseSize parses a size in bytes with an optional k, m, or g suffix for
+// powers of 1024.
+func parseSize(s string) (int, error) {
+	shift := 0
+	switch strings.ToLower(s[len(s)-min(len(s), 1):]) {
+	case "k":
+		shift = 10
+	case "m":
+		shift = 20
+	case "g":
+		shift = 30
+	}
+	if shift > 0 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n << shift, nil
+}
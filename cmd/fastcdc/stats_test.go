@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseGrid(t *testing.T) {
+	grid, err := parseGrid("256k,512K,1m,100", "0..3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{256 << 10, 512 << 10, 1 << 20, 100}; !reflect.DeepEqual(grid.AverageSizes, want) {
+		t.Errorf("AverageSizes = %v, want %v", grid.AverageSizes, want)
+	}
+	if want := []int{0, 1, 2, 3}; !reflect.DeepEqual(grid.Normalizations, want) {
+		t.Errorf("Normalizations = %v, want %v", grid.Normalizations, want)
+	}
+	if grid, err := parseGrid("1k", "1,3"); err != nil || !reflect.DeepEqual(grid.Normalizations, []int{1, 3}) {
+		t.Errorf("parseGrid() with norm list = %v, %v", grid, err)
+	}
+	for _, bad := range [][2]string{{"", "0"}, {"1x", "0"}, {"-1k", "0"}, {"1k", "3..1"}, {"1k", "a"}} {
+		if _, err := parseGrid(bad[0], bad[1]); err == nil {
+			t.Errorf("parseGrid(%q, %q) succeeded", bad[0], bad[1])
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+	// Two copies of the same file dedup to one.
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := runStats([]string{"-avg", "4k,8k", "-norm", "1..2", "-format", "csv", dir}, &out); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("got %d CSV records, want header and 4 rows", len(records))
+	}
+	for _, r := range records[1:] {
+		if r[2] != "2" || r[5] != "200000" || r[6] != "100000" || r[7] != "0.5000" {
+			t.Errorf("row %v, want 2 files, 200000 bytes, 100000 unique, ratio 0.5", r)
+		}
+	}
+
+	// A single file path works too.
+	out.Reset()
+	if err := runStats([]string{"-avg", "4k", "-norm", "2", filepath.Join(dir, "a")}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() == 0 {
+		t.Error("no table output")
+	}
+
+	var ue usageError
+	if err := runStats([]string{"-format", "xml", dir}, &out); !errors.As(err, &ue) {
+		t.Errorf("runStats() with bad format = %v, want usage error", err)
+	}
+	if err := runStats(nil, &out); !errors.As(err, &ue) {
+		t.Errorf("runStats() without paths = %v, want usage error", err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/buildbuddy-io/fastcdc2020/conformance"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+const vectorsUsage = "fastcdc vectors [-avg 4k,16k] [-norm 0..3] file"
+
+func runVectors(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("vectors", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	avgFlag := fs.String("avg", "4k,16k,64k", "comma-separated average chunk sizes")
+	normFlag := fs.String("norm", "0..3", "normalization levels, as a list or a lo..hi range")
+	if err := fs.Parse(args); err != nil {
+		return usageError{err.Error()}
+	}
+	if fs.NArg() != 1 {
+		return usageError{"want one file"}
+	}
+	grid, err := parseGrid(*avgFlag, *normFlag)
+	if err != nil {
+		return usageError{err.Error()}
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	out := conformance.File{
+		File:   filepath.Base(fs.Arg(0)),
+		Size:   int64(len(data)),
+		Digest: manifest.Digest(data),
+	}
+	for _, avg := range grid.AverageSizes {
+		for _, norm := range grid.Normalizations {
+			v, err := chunkVector(data, avg, norm)
+			if err != nil {
+				return err
+			}
+			out.Vectors = append(out.Vectors, v)
+		}
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// chunkVector chunks data with the given average size and normalization level
+// and the default minimum and maximum sizes.
+func chunkVector(data []byte, avg, norm int) (conformance.Vector, error) {
+	return conformance.Generate(data, conformance.Vector{AverageSize: avg, MinSize: avg / 4, MaxSize: avg * 4, Normalization: norm})
+}
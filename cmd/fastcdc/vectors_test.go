@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/conformance"
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+func TestVectors(t *testing.T) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(3)).Read(data)
+	file := filepath.Join(t.TempDir(), "input.bin")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runVectors([]string{"-avg", "4k,8k", "-norm", "1,2", file}, &out); err != nil {
+		t.Fatal(err)
+	}
+	var vf conformance.File
+	if err := json.Unmarshal(out.Bytes(), &vf); err != nil {
+		t.Fatal(err)
+	}
+	if vf.File != "input.bin" || vf.Size != int64(len(data)) || vf.Digest != manifest.Digest(data) || len(vf.Vectors) != 4 {
+		t.Fatalf("vector file = %s %d %s with %d vectors", vf.File, vf.Size, vf.Digest, len(vf.Vectors))
+	}
+	for _, v := range vf.Vectors {
+		m, err := manifest.Build(bytes.NewReader(data), v.AverageSize,
+			fastcdc.WithMinSize(v.MinSize), fastcdc.WithMaxSize(v.MaxSize), fastcdc.WithNormalization(v.Normalization))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(v.Chunks) != len(m.Chunks) {
+			t.Fatalf("avg %d norm %d: %d chunks, want %d", v.AverageSize, v.Normalization, len(v.Chunks), len(m.Chunks))
+		}
+		for i, c := range v.Chunks {
+			want := m.Chunks[i]
+			if c.Offset != want.Offset || c.Length != want.Length || c.Fingerprint == nil || *c.Fingerprint != want.Fingerprint || c.Digest != want.Digest {
+				t.Errorf("avg %d norm %d chunk %d = %+v, want %+v", v.AverageSize, v.Normalization, i, c, want)
+			}
+		}
+	}
+}
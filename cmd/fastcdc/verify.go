@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+const verifyUsage = "fastcdc verify [-avg size] [-min size] [-max size] [-norm level] manifest.json file"
+
+// errMismatch is returned when a file does not match its manifest.
+var errMismatch = errors.New("file does not match manifest")
+
+func runVerify(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cf := addChunkerFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return usageError{err.Error()}
+	}
+	if fs.NArg() != 2 {
+		return usageError{"want a manifest and a file"}
+	}
+	avg, opts, err := cf.options()
+	if err != nil {
+		return usageError{err.Error()}
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	want := &manifest.Manifest{}
+	if err := json.Unmarshal(data, want); err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	f, err := os.Open(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	got, err := want.DigestFunction.Build(f, avg, opts...)
+	if err != nil {
+		return err
+	}
+
+	if msg := compareManifests(want, got); msg != "" {
+		fmt.Fprintln(stdout, msg)
+		return errMismatch
+	}
+	fmt.Fprintf(stdout, "OK: %d chunks, %d bytes match\n", len(got.Chunks), got.Size)
+	return nil
+}
+
+// compareManifests describes the first divergence of got from want, or
+// returns "" if they match.
+func compareManifests(want, got *manifest.Manifest) string {
+	for i := range min(len(want.Chunks), len(got.Chunks)) {
+		w, g := want.Chunks[i], got.Chunks[i]
+		switch {
+		case w.Offset != g.Offset:
+			return fmt.Sprintf("chunk %d: manifest offset %d, file offset %d", i, w.Offset, g.Offset)
+		case w.Length != g.Length:
+			return fmt.Sprintf("diverges at offset %d: chunk %d ends at %d in manifest, %d in file", w.Offset, i, w.Offset+w.Length, g.Offset+g.Length)
+		case w.Digest != g.Digest:
+			return fmt.Sprintf("diverges at offset %d: chunk %d has digest %s in manifest, %s in file", w.Offset, i, w.Digest, g.Digest)
+		}
+	}
+	if len(want.Chunks) != len(got.Chunks) || want.Size != got.Size {
+		return fmt.Sprintf("diverges at offset %d: manifest has %d chunks and %d bytes, file has %d chunks and %d bytes",
+			min(want.Size, got.Size), len(want.Chunks), want.Size, len(got.Chunks), got.Size)
+	}
+	if want.Digest != got.Digest {
+		return fmt.Sprintf("blob digest %s in manifest, %s in file", want.Digest, got.Digest)
+	}
+	return ""
+}
+
+// chunkerFlags are the flags that configure a chunker.
+type chunkerFlags struct {
+	avg, min, max *string
+	norm          *int
+}
+
+func addChunkerFlags(fs *flag.FlagSet) *chunkerFlags {
+	return &chunkerFlags{
+		avg:  fs.String("avg", "64k", "average chunk size"),
+		min:  fs.String("min", "", "minimum chunk size (default avg/4)"),
+		max:  fs.String("max", "", "maximum chunk size (default avg*4)"),
+		norm: fs.Int("norm", -1, "normalization level (default 2)"),
+	}
+}
+
+// options returns the average size and options selected by the flags.
+func (cf *chunkerFlags) options() (int, []fastcdc.Option, error) {
+	avg, err := parseSize(*cf.avg)
+	if err != nil {
+		return 0, nil, err
+	}
+	var opts []fastcdc.Option
+	if *cf.min != "" {
+		size, err := parseSize(*cf.min)
+		if err != nil {
+			return 0, nil, err
+		}
+		opts = append(opts, fastcdc.WithMinSize(size))
+	}
+	if *cf.max != "" {
+		size, err := parseSize(*cf.max)
+		if err != nil {
+			return 0, nil, err
+		}
+		opts = append(opts, fastcdc.WithMaxSize(size))
+	}
+	if *cf.norm >= 0 {
+		opts = append(opts, fastcdc.WithNormalization(*cf.norm))
+	}
+	return avg, opts, nil
+}
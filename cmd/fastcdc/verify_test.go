@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 200000)
+	rand.New(rand.NewSource(2)).Read(data)
+	file := filepath.Join(dir, "blob")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := manifest.Build(bytes.NewReader(data), 8192, fastcdc.WithNormalization(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestFile := filepath.Join(dir, "manifest.json")
+	if err := os.WriteFile(manifestFile, enc, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runVerify([]string{"-avg", "8k", "-norm", "1", manifestFile, file}, &out); err != nil {
+		t.Fatalf("runVerify() = %v, output %q", err, out.String())
+	}
+	if !strings.HasPrefix(out.String(), "OK") {
+		t.Errorf("output = %q, want OK", out.String())
+	}
+
+	// Different parameters or contents diverge at a reported offset.
+	out.Reset()
+	if err := runVerify([]string{"-avg", "8k", "-norm", "2", manifestFile, file}, &out); !errors.Is(err, errMismatch) {
+		t.Errorf("runVerify() with other parameters = %v, want mismatch", err)
+	}
+	data[100000]++
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := runVerify([]string{"-avg", "8k", "-norm", "1", manifestFile, file}, &out); !errors.Is(err, errMismatch) {
+		t.Errorf("runVerify() of modified file = %v, want mismatch", err)
+	}
+	var off int64
+	if _, err := fmt.Sscanf(out.String(), "diverges at offset %d:", &off); err != nil || off > 100000 || off < 100000-4*8192 {
+		t.Errorf("output = %q, want divergence shortly before offset 100000", out.String())
+	}
+}
+
+func TestVerify_DigestFunction(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 200000)
+	rand.New(rand.NewSource(3)).Read(data)
+	file := filepath.Join(dir, "blob")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := manifest.DigestSHA512.Build(bytes.NewReader(data), 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifestFile := filepath.Join(dir, "manifest.json")
+	if err := os.WriteFile(manifestFile, enc, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := runVerify([]string{"-avg", "8k", manifestFile, file}, &out); err != nil {
+		t.Fatalf("runVerify() of SHA-512 manifest = %v, output %q", err, out.String())
+	}
+}
@@ -0,0 +1,128 @@
+//go:build js && wasm
+
+// Command fastcdcjs exposes FastCDC chunk boundaries to JavaScript, so that
+// browser-side uploads can split data exactly as a Go server does.
+//
+// Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o fastcdc.wasm ./cmd/fastcdcjs
+//
+// and run it with the wasm_exec.js support file from $(go env GOROOT)/lib/wasm.
+// Once running, it defines the global function
+//
+//	fastcdcChunk(data, averageSize, options)
+//
+// where data is a Uint8Array and options is an optional object with the
+// fields minSize, maxSize, normalization, and seed, as for the fastcdc
+// options of the same names. The seed is a decimal string, since JavaScript
+// numbers cannot hold every uint64. It returns {chunks: [{offset, length,
+// cut}, ...]}, or {error: message} if the arguments are invalid.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"syscall/js"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+func main() {
+	register()
+	select {}
+}
+
+// register defines fastcdcChunk in the global scope.
+func register() {
+	js.Global().Set("fastcdcChunk", js.FuncOf(chunkJS))
+}
+
+func chunkJS(this js.Value, args []js.Value) any {
+	chunks, err := chunk(args)
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	return map[string]any{"chunks": chunks}
+}
+
+// chunk splits the data in args and returns the chunks as JavaScript
+// objects.
+func chunk(args []js.Value) ([]any, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, errors.New("usage: fastcdcChunk(data, averageSize[, options])")
+	}
+	if !args[0].InstanceOf(js.Global().Get("Uint8Array")) {
+		return nil, errors.New("data must be a Uint8Array")
+	}
+	if args[1].Type() != js.TypeNumber {
+		return nil, errors.New("averageSize must be a number")
+	}
+	var opts []fastcdc.Option
+	if len(args) == 3 && !args[2].IsUndefined() && !args[2].IsNull() {
+		var err error
+		if opts, err = options(args[2]); err != nil {
+			return nil, err
+		}
+	}
+
+	data := make([]byte, args[0].Length())
+	js.CopyBytesToGo(data, args[0])
+	chunker, err := fastcdc.NewChunker(bytes.NewReader(data), args[1].Int(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []any
+	for {
+		c, err := chunker.Next()
+		if err == io.EOF {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, map[string]any{
+			"offset": c.Offset,
+			"length": c.Length,
+			"cut":    c.Cut.String(),
+		})
+	}
+}
+
+// options converts a JavaScript options object to fastcdc options.
+func options(v js.Value) ([]fastcdc.Option, error) {
+	if v.Type() != js.TypeObject {
+		return nil, errors.New("options must be an object")
+	}
+	var opts []fastcdc.Option
+	for _, f := range []struct {
+		name string
+		opt  func(int) fastcdc.Option
+	}{
+		{"minSize", fastcdc.WithMinSize},
+		{"maxSize", fastcdc.WithMaxSize},
+		{"normalization", fastcdc.WithNormalization},
+	} {
+		field := v.Get(f.name)
+		if field.IsUndefined() {
+			continue
+		}
+		if field.Type() != js.TypeNumber {
+			return nil, fmt.Errorf("%s must be a number", f.name)
+		}
+		opts = append(opts, f.opt(field.Int()))
+	}
+	if seed := v.Get("seed"); !seed.IsUndefined() {
+		if seed.Type() != js.TypeString {
+			return nil, errors.New("seed must be a decimal string")
+		}
+		n, err := strconv.ParseUint(seed.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid seed: %v", err)
+		}
+		opts = append(opts, fastcdc.WithSeed(n))
+	}
+	return opts, nil
+}
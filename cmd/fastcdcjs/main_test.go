@@ -0,0 +1,63 @@
+//go:build js && wasm
+
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"syscall/js"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+func TestChunk(t *testing.T) {
+	register()
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	array := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(array, data)
+
+	chunker, err := fastcdc.NewChunker(bytes.NewReader(data), 16384, fastcdc.WithMinSize(4096), fastcdc.WithSeed(1<<63+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []fastcdc.Chunk
+	for {
+		c, err := chunker.Next()
+		if err != nil {
+			break
+		}
+		want = append(want, c)
+	}
+
+	options := js.Global().Get("Object").New()
+	options.Set("minSize", 4096)
+	options.Set("seed", "9223372036854775809")
+	result := js.Global().Call("fastcdcChunk", array, 16384, options)
+	if msg := result.Get("error"); !msg.IsUndefined() {
+		t.Fatal(msg.String())
+	}
+	chunks := result.Get("chunks")
+	if chunks.Length() != len(want) {
+		t.Fatalf("got %d chunks, want %d", chunks.Length(), len(want))
+	}
+	for i, w := range want {
+		c := chunks.Index(i)
+		if c.Get("offset").Int() != w.Offset || c.Get("length").Int() != w.Length || c.Get("cut").String() != w.Cut.String() {
+			t.Errorf("chunk %d = %d/%d/%s, want %d/%d/%v", i, c.Get("offset").Int(), c.Get("length").Int(), c.Get("cut").String(), w.Offset, w.Length, w.Cut)
+		}
+	}
+
+	for _, args := range [][]any{
+		{array},
+		{"data", 16384},
+		{array, 1000},
+		{array, 16384, map[string]any{"seed": 1}},
+		{array, 16384, map[string]any{"minSize": "4096"}},
+	} {
+		if result := js.Global().Call("fastcdcChunk", args...); result.Get("error").IsUndefined() {
+			t.Errorf("fastcdcChunk(%v) succeeded", args)
+		}
+	}
+}
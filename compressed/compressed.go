@@ -0,0 +1,177 @@
+// Package compressed chunks compressed blobs by their decompressed contents.
+//
+// Compression spreads the effect of any change across the rest of its
+// stream, so chunking compressed bytes finds almost no duplicates between
+// two versions of a blob. This package detects compressed input, chunks the
+// decompressed stream instead, and records how the blob was compressed next
+// to the manifest of its contents. Chunks can optionally be recompressed
+// individually when stored, so that storage stays compact without giving up
+// deduplication, and a Store compresses every chunk it holds with a
+// pluggable Codec. Where data must stay compressed end to end, Rsyncable
+// compresses it so that the compressed bytes themselves deduplicate.
+package compressed
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// Compression values reported in Blob.Compression.
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ErrUnsupportedCompression is returned for blobs compressed with a format
+// that cannot be decompressed, such as zstd.
+var ErrUnsupportedCompression = errors.New("unsupported compression")
+
+// Blob describes a possibly compressed blob by the chunks of its contents.
+type Blob struct {
+	// Compression is the compression format of the blob.
+	Compression string `json:"compression,omitempty"`
+	// CompressedSize is the size of the blob as read.
+	CompressedSize int64 `json:"compressedSize"`
+	// CompressedDigest is the hex-encoded SHA-256 digest of the blob as
+	// read.
+	CompressedDigest string `json:"compressedDigest"`
+	// GzipHeader is the header of the first gzip member, with the file name,
+	// modification time, and OS recorded by the compressor.
+	GzipHeader *gzip.Header `json:"gzipHeader,omitempty"`
+	// Contents is the manifest of the decompressed contents, or of the blob
+	// itself if it is not compressed.
+	Contents *manifest.Manifest `json:"contents"`
+}
+
+// Build chunks the decompressed contents of the blob read from r. Gzip
+// blobs, including multi-member ones, are decompressed; other blobs are
+// chunked as is, except zstd ones, which fail with
+// ErrUnsupportedCompression. The averageSize and options configure the
+// chunker as for fastcdc.NewChunker.
+func Build(r io.Reader, averageSize int, opts ...fastcdc.Option) (*Blob, error) {
+	return BuildAndPut(r, averageSize, nil, opts...)
+}
+
+// BuildAndPut is Build, additionally passing every chunk of the contents to
+// put, if not nil, with its digest. Chunk data passed to put is only valid
+// until put returns.
+func BuildAndPut(r io.Reader, averageSize int, put func(digest string, data []byte) error, opts ...fastcdc.Option) (*Blob, error) {
+	raw := &countingHash{Hash: sha256.New()}
+	br := bufio.NewReader(io.TeeReader(r, raw))
+
+	blob := &Blob{}
+	var contents io.Reader = br
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		blob.Compression = CompressionGzip
+		header := zr.Header
+		blob.GzipHeader = &header
+		contents = zr
+	case bytes.HasPrefix(magic, zstdMagic):
+		return nil, ErrUnsupportedCompression
+	}
+
+	chunker, err := fastcdc.NewChunker(contents, averageSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	m := &manifest.Manifest{}
+	contentsHash := sha256.New()
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c := manifest.NewChunk(chunk)
+		if put != nil {
+			if err := put(c.Digest, chunk.Data); err != nil {
+				return nil, err
+			}
+		}
+		contentsHash.Write(chunk.Data)
+		m.Chunks = append(m.Chunks, c)
+		m.Size += c.Length
+	}
+	m.Digest = hex.EncodeToString(contentsHash.Sum(nil))
+	blob.Contents = m
+
+	// Count and hash whatever follows the compressed stream, too.
+	if _, err := io.Copy(io.Discard, br); err != nil {
+		return nil, err
+	}
+	blob.CompressedSize = raw.n
+	blob.CompressedDigest = hex.EncodeToString(raw.Sum(nil))
+	return blob, nil
+}
+
+// countingHash is a hash that counts the bytes written to it.
+type countingHash struct {
+	hash.Hash
+	n int64
+}
+
+func (h *countingHash) Write(p []byte) (int, error) {
+	h.n += int64(len(p))
+	return h.Hash.Write(p)
+}
+
+// Recompress returns a put function for BuildAndPut or
+// manifest.TreeChunker.ChunkAndPut that gzip-compresses every chunk at the
+// given level before passing it to put. Chunks keep the digest of their
+// uncompressed contents, so they deduplicate as before; read them back
+// through a RecompressedStore.
+func Recompress(put func(digest string, data []byte) error, level int) (func(digest string, data []byte) error, error) {
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		return nil, err
+	}
+	return func(digest string, data []byte) error {
+		var buf bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&buf, level)
+		zw.Write(data)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		return put(digest, buf.Bytes())
+	}, nil
+}
+
+// RecompressedStore reads chunks stored through Recompress, decompressing
+// them.
+type RecompressedStore struct {
+	manifest.Store
+}
+
+// Get returns the decompressed contents of the chunk with the given digest.
+func (s RecompressedStore) Get(digest string) ([]byte, error) {
+	data, err := s.Store.Get(digest)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(zr)
+}
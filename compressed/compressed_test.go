@@ -0,0 +1,140 @@
+package compressed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// memStore is a Store backed by a map.
+type memStore map[string][]byte
+
+func (s memStore) Has(digest string) bool {
+	_, ok := s[digest]
+	return ok
+}
+
+func (s memStore) Get(digest string) ([]byte, error) {
+	data, ok := s[digest]
+	if !ok {
+		return nil, fmt.Errorf("chunk %s: %w", digest, os.ErrNotExist)
+	}
+	return data, nil
+}
+
+func (s memStore) Put(digest string, data []byte) error {
+	s[digest] = append([]byte(nil), data...)
+	return nil
+}
+
+func gzipped(t *testing.T, data []byte, level int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Name = "data.bin"
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBuild(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	plain, err := manifest.Build(bytes.NewReader(data), 16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same contents compressed at different levels have different bytes
+	// but the same chunks.
+	for _, level := range []int{gzip.BestSpeed, gzip.BestCompression} {
+		blob := gzipped(t, data, level)
+		b, err := Build(bytes.NewReader(blob), 16<<10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Compression != CompressionGzip {
+			t.Errorf("level %d: Compression = %q, want %q", level, b.Compression, CompressionGzip)
+		}
+		if b.CompressedSize != int64(len(blob)) || b.CompressedDigest != manifest.Digest(blob) {
+			t.Errorf("level %d: compressed blob is %d bytes %s, want %d bytes %s", level, b.CompressedSize, b.CompressedDigest, len(blob), manifest.Digest(blob))
+		}
+		if b.GzipHeader == nil || b.GzipHeader.Name != "data.bin" {
+			t.Errorf("level %d: GzipHeader = %+v, want name data.bin", level, b.GzipHeader)
+		}
+		if b.Contents.Digest != plain.Digest || len(b.Contents.Chunks) != len(plain.Chunks) {
+			t.Fatalf("level %d: contents differ from the uncompressed manifest", level)
+		}
+		for i, c := range b.Contents.Chunks {
+			if c != plain.Chunks[i] {
+				t.Errorf("level %d: chunk %d = %+v, want %+v", level, i, c, plain.Chunks[i])
+			}
+		}
+	}
+
+	// Uncompressed blobs are chunked as is.
+	b, err := Build(bytes.NewReader(data), 16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Compression != CompressionNone || b.GzipHeader != nil || b.Contents.Digest != plain.Digest || b.CompressedDigest != plain.Digest {
+		t.Errorf("uncompressed blob: got %+v", b)
+	}
+}
+
+func TestBuild_Zstd(t *testing.T) {
+	blob := []byte{0x28, 0xb5, 0x2f, 0xfd, 0, 0, 0, 0}
+	if _, err := Build(bytes.NewReader(blob), 4096); err != ErrUnsupportedCompression {
+		t.Errorf("expected ErrUnsupportedCompression, got %v", err)
+	}
+}
+
+func TestRecompress(t *testing.T) {
+	if _, err := Recompress(nil, 42); err == nil {
+		t.Error("expected an error for an invalid level")
+	}
+
+	data := bytes.Repeat([]byte("compressible contents "), 1<<14)
+	store := memStore{}
+	put, err := Recompress(func(digest string, data []byte) error {
+		store[digest] = bytes.Clone(data)
+		return nil
+	}, gzip.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := BuildAndPut(bytes.NewReader(gzipped(t, data, gzip.DefaultCompression)), 4096, put)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored int
+	for _, data := range store {
+		stored += len(data)
+	}
+	if stored >= len(data)/4 {
+		t.Errorf("stored %d bytes for %d bytes of contents", stored, len(data))
+	}
+
+	r, err := manifest.NewRangeReader(b.Contents, RecompressedStore{store}, 0, b.Contents.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("reassembled contents differ")
+	}
+}
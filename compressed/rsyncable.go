@@ -0,0 +1,58 @@
+package compressed
+
+import (
+	"compress/gzip"
+	"io"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+// NewWriterFunc returns a compressor writing one self-contained compressed
+// stream to w, finished by Close.
+type NewWriterFunc func(w io.Writer) (io.WriteCloser, error)
+
+// GzipWriter returns a NewWriterFunc writing gzip members at the given
+// level.
+func GzipWriter(level int) NewWriterFunc {
+	return func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, level)
+	}
+}
+
+// Rsyncable compresses src to dst like gzip --rsyncable, but with
+// content-defined boundaries: src is chunked with the given average size and
+// options, and every chunk is compressed as its own stream by a compressor
+// from newWriter. An unchanged chunk therefore compresses to the same bytes
+// in every version of src, so the compressed output deduplicates almost as
+// well as src itself.
+//
+// Concatenated gzip members, like concatenated zstd frames, decompress as
+// one stream, so any decompressor reads the output. Each chunk costs the
+// overhead of a stream header and trailer and loses the context of the
+// chunks before it, so average sizes of tens of kilobytes or more keep the
+// compression ratio close to compressing src whole.
+func Rsyncable(dst io.Writer, src io.Reader, newWriter NewWriterFunc, averageSize int, opts ...fastcdc.Option) error {
+	chunker, err := fastcdc.NewChunker(src, averageSize, opts...)
+	if err != nil {
+		return err
+	}
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		zw, err := newWriter(dst)
+		if err != nil {
+			return err
+		}
+		if _, err := zw.Write(chunk.Data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+}
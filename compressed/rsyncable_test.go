@@ -0,0 +1,69 @@
+package compressed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// words returns n bytes of compressible text.
+func words(n int, seed int64) []byte {
+	vocabulary := strings.Fields("the quick brown fox jumps over a lazy dog while chunk boundaries stay put")
+	rng := rand.New(rand.NewSource(seed))
+	var buf bytes.Buffer
+	for buf.Len() < n {
+		buf.WriteString(vocabulary[rng.Intn(len(vocabulary))])
+		buf.WriteByte(' ')
+	}
+	return buf.Bytes()[:n]
+}
+
+func TestRsyncable(t *testing.T) {
+	v1 := words(1<<20, 1)
+	v2 := slices.Concat(v1[:len(v1)/2], []byte("an edit in the middle"), v1[len(v1)/2:])
+
+	compress := func(data []byte) []byte {
+		var buf bytes.Buffer
+		if err := Rsyncable(&buf, bytes.NewReader(data), GzipWriter(gzip.DefaultCompression), 16<<10); err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatal("output does not decompress to the input")
+		}
+		return buf.Bytes()
+	}
+	shared := func(a, b []byte) float64 {
+		ma, err := manifest.Build(bytes.NewReader(a), 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mb, err := manifest.Build(bytes.NewReader(b), 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return float64(manifest.Diff(ma, mb).SharedBytes) / float64(mb.Size)
+	}
+
+	r1, r2 := compress(v1), compress(v2)
+	if s := shared(r1, r2); s < 0.9 {
+		t.Errorf("rsyncable outputs share %.2f of their bytes, want at least 0.9", s)
+	}
+	g1, g2 := gzipped(t, v1, gzip.DefaultCompression), gzipped(t, v2, gzip.DefaultCompression)
+	if s := shared(g1, g2); s > 0.6 {
+		t.Errorf("plain gzip outputs share %.2f of their bytes; the test data does not exercise Rsyncable", s)
+	}
+}
@@ -0,0 +1,146 @@
+package compressed
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ChunkStore is the store holding compressed chunks. *fsstore.Store and
+// pack.ChunkStore implement ChunkStore.
+type ChunkStore interface {
+	Has(digest string) bool
+	Get(digest string) ([]byte, error)
+	Put(digest string, data []byte) error
+}
+
+// Codec compresses individual chunks for a Store.
+type Codec interface {
+	// ID identifies the codec in stored chunks. It must not be zero, which
+	// marks chunks stored uncompressed.
+	ID() byte
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// codecNone is the ID of chunks stored uncompressed.
+const codecNone = 0
+
+// CodecFlate is the ID of the codec returned by Flate.
+const CodecFlate = 1
+
+type flateCodec struct {
+	level int
+}
+
+// Flate returns a Codec compressing chunks with DEFLATE at the given level,
+// as for flate.NewWriter.
+func Flate(level int) (Codec, error) {
+	if _, err := flate.NewWriter(io.Discard, level); err != nil {
+		return nil, err
+	}
+	return flateCodec{level: level}, nil
+}
+
+func (c flateCodec) ID() byte { return CodecFlate }
+
+func (c flateCodec) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, _ := flate.NewWriter(&buf, c.level)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c flateCodec) Decompress(data []byte) ([]byte, error) {
+	return io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+}
+
+// Store is a ChunkStore that compresses chunks on Put and decompresses them
+// on Get. Chunks keep the digest of their uncompressed contents. Each stored
+// chunk starts with the ID of the codec that compressed it, so that chunks
+// written with other codecs stay readable once the codec is added with
+// AddCodec; chunks that compression does not make smaller are stored
+// uncompressed. It is safe for concurrent use.
+type Store struct {
+	store ChunkStore
+	codec Codec
+
+	mu     sync.RWMutex
+	codecs map[byte]Codec
+}
+
+// NewStore returns a Store compressing the chunks it stores in store with
+// codec.
+func NewStore(store ChunkStore, codec Codec) (*Store, error) {
+	s := &Store{store: store, codec: codec, codecs: map[byte]Codec{}}
+	if err := s.AddCodec(codec); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// AddCodec makes chunks compressed with c readable.
+func (s *Store) AddCodec(c Codec) error {
+	if c.ID() == codecNone {
+		return errors.New("codec ID 0 is reserved for uncompressed chunks")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.codecs[c.ID()] = c
+	return nil
+}
+
+// Has reports whether a chunk is stored.
+func (s *Store) Has(digest string) bool {
+	return s.store.Has(digest)
+}
+
+// Get returns the decompressed contents of a stored chunk. Chunks
+// compressed with a codec that has not been added fail with
+// ErrUnsupportedCompression.
+func (s *Store) Get(digest string) ([]byte, error) {
+	data, err := s.store.Get(digest)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("chunk %s: missing codec ID", digest)
+	}
+	id, data := data[0], data[1:]
+	if id == codecNone {
+		return data, nil
+	}
+	s.mu.RLock()
+	c := s.codecs[id]
+	s.mu.RUnlock()
+	if c == nil {
+		return nil, fmt.Errorf("chunk %s: %w: codec %d", digest, ErrUnsupportedCompression, id)
+	}
+	data, err = c.Decompress(data)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", digest, err)
+	}
+	return data, nil
+}
+
+// Put compresses a chunk and stores it.
+func (s *Store) Put(digest string, data []byte) error {
+	compressed, err := s.codec.Compress(data)
+	if err != nil {
+		return err
+	}
+	id := s.codec.ID()
+	if len(compressed) >= len(data) {
+		id, compressed = codecNone, data
+	}
+	buf := make([]byte, 1+len(compressed))
+	buf[0] = id
+	copy(buf[1:], compressed)
+	return s.store.Put(digest, buf)
+}
@@ -0,0 +1,82 @@
+package compressed
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// renumbered is a Codec with another ID, to test reading chunks written with
+// other codecs.
+type renumbered struct {
+	Codec
+}
+
+func (renumbered) ID() byte { return 42 }
+
+func TestStore(t *testing.T) {
+	if _, err := Flate(42); err == nil {
+		t.Error("expected an error for an invalid flate level")
+	}
+	codec, err := Flate(flate.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := memStore{}
+	s, err := NewStore(store, codec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := bytes.Repeat([]byte("compressible "), 1000)
+	random := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(random)
+	for _, tc := range []struct {
+		name string
+		data []byte
+		id   byte
+	}{
+		{"text", text, CodecFlate},
+		{"random", random, codecNone},
+		{"empty", nil, codecNone},
+	} {
+		if err := s.Put(tc.name, tc.data); err != nil {
+			t.Fatal(err)
+		}
+		if !s.Has(tc.name) {
+			t.Errorf("%s: Has() = false after Put", tc.name)
+		}
+		if id := store[tc.name][0]; id != tc.id {
+			t.Errorf("%s: stored with codec %d, want %d", tc.name, id, tc.id)
+		}
+		if got, err := s.Get(tc.name); err != nil || !bytes.Equal(got, tc.data) {
+			t.Errorf("%s: Get() = %d bytes, %v, want %d bytes", tc.name, len(got), err, len(tc.data))
+		}
+	}
+	if n := len(store["text"]); n >= len(text)/10 {
+		t.Errorf("text stored in %d bytes, want well under %d", n, len(text))
+	}
+	if n := len(store["random"]); n != len(random)+1 {
+		t.Errorf("random data stored in %d bytes, want %d", n, len(random)+1)
+	}
+
+	// Chunks written with another codec need it to be added.
+	other := memStore{}
+	if s, err := NewStore(other, renumbered{codec}); err != nil {
+		t.Fatal(err)
+	} else if err := s.Put("a", text); err != nil {
+		t.Fatal(err)
+	}
+	store["a"] = other["a"]
+	if _, err := s.Get("a"); !errors.Is(err, ErrUnsupportedCompression) {
+		t.Errorf("Get() with an unknown codec = %v, want ErrUnsupportedCompression", err)
+	}
+	if err := s.AddCodec(renumbered{codec}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get("a"); err != nil || !bytes.Equal(got, text) {
+		t.Errorf("Get() after AddCodec = %d bytes, %v", len(got), err)
+	}
+}
@@ -0,0 +1,153 @@
+// Package conformance checks chunkers against published test vectors.
+//
+// A vector file lists the chunk boundaries of one input file under one or
+// more sets of chunking parameters, in a JSON format shared with the
+// "fastcdc vectors" command. The package tests run this implementation
+// against every vector file in testdata, which holds the vectors of the
+// remote-apis FastCDC specification and of fastcdc-rs, and against any
+// vector files in the directory named by the FASTCDC_VECTORS environment
+// variable:
+//
+//	FASTCDC_VECTORS=/path/to/vectors go test github.com/buildbuddy-io/fastcdc2020/conformance
+//
+// Other implementations can use vector files produced by "fastcdc vectors"
+// to check their compatibility with this one.
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// File is a vector file.
+type File struct {
+	// Source describes where the vectors come from.
+	Source string `json:"source,omitempty"`
+	// File is the path of the input, relative to the vector file.
+	File string `json:"file"`
+	// Size and Digest are the size and hex SHA-256 digest of the input.
+	Size   int64  `json:"size"`
+	Digest string `json:"sha256"`
+
+	Vectors []Vector `json:"vectors"`
+}
+
+// Vector lists the chunks of the input under one set of parameters. Min and
+// max sizes are always explicit so that implementations need not agree on
+// defaults.
+type Vector struct {
+	AverageSize   int    `json:"avg"`
+	MinSize       int    `json:"min"`
+	MaxSize       int    `json:"max"`
+	Normalization int    `json:"norm"`
+	Seed          uint64 `json:"seed,omitempty"`
+	// ExactScan selects the canonical single-byte FastCDC definition, as
+	// with fastcdc.WithExactScan.
+	ExactScan bool `json:"exact,omitempty"`
+
+	Chunks []Chunk `json:"chunks"`
+}
+
+// Chunk is one chunk of a Vector. Fingerprint and Digest are optional, for
+// vectors from implementations that do not publish them.
+type Chunk struct {
+	Offset      int64   `json:"offset"`
+	Length      int64   `json:"length"`
+	Fingerprint *uint64 `json:"fingerprint,omitempty"`
+	Digest      string  `json:"sha256,omitempty"`
+}
+
+// Options returns the fastcdc options selecting v's parameters. The average
+// size is passed to fastcdc.NewChunker separately.
+func (v Vector) Options() []fastcdc.Option {
+	opts := []fastcdc.Option{
+		fastcdc.WithMinSize(v.MinSize),
+		fastcdc.WithMaxSize(v.MaxSize),
+		fastcdc.WithNormalization(v.Normalization),
+	}
+	if v.Seed != 0 {
+		opts = append(opts, fastcdc.WithSeed(v.Seed))
+	}
+	if v.ExactScan {
+		opts = append(opts, fastcdc.WithExactScan())
+	}
+	return opts
+}
+
+// Generate returns v with its chunks replaced by those this implementation
+// produces for data.
+func Generate(data []byte, v Vector) (Vector, error) {
+	chunker, err := fastcdc.NewChunker(bytes.NewReader(data), v.AverageSize, v.Options()...)
+	if err != nil {
+		return v, fmt.Errorf("average size %d, normalization %d: %w", v.AverageSize, v.Normalization, err)
+	}
+	v.Chunks = []Chunk{}
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return v, nil
+		}
+		if err != nil {
+			return v, err
+		}
+		fp := chunk.Fingerprint
+		v.Chunks = append(v.Chunks, Chunk{
+			Offset:      int64(chunk.Offset),
+			Length:      int64(chunk.Length),
+			Fingerprint: &fp,
+			Digest:      manifest.Digest(chunk.Data),
+		})
+	}
+}
+
+// Check chunks data with v's parameters and reports the first chunk that
+// differs from v, comparing fingerprints and digests where v has them.
+func Check(data []byte, v Vector) error {
+	got, err := Generate(data, v)
+	if err != nil {
+		return err
+	}
+	for i := range min(len(v.Chunks), len(got.Chunks)) {
+		want, g := v.Chunks[i], got.Chunks[i]
+		switch {
+		case want.Offset != g.Offset || want.Length != g.Length:
+			return fmt.Errorf("chunk %d: got offset %d length %d, want offset %d length %d", i, g.Offset, g.Length, want.Offset, want.Length)
+		case want.Fingerprint != nil && *want.Fingerprint != *g.Fingerprint:
+			return fmt.Errorf("chunk %d at %d: got fingerprint %d, want %d", i, g.Offset, *g.Fingerprint, *want.Fingerprint)
+		case want.Digest != "" && want.Digest != g.Digest:
+			return fmt.Errorf("chunk %d at %d: got digest %s, want %s", i, g.Offset, g.Digest, want.Digest)
+		}
+	}
+	if len(v.Chunks) != len(got.Chunks) {
+		return fmt.Errorf("got %d chunks, want %d", len(got.Chunks), len(v.Chunks))
+	}
+	return nil
+}
+
+// Load reads the vector file at path and its input, verifying the input's
+// size and digest.
+func Load(path string) (*File, []byte, error) {
+	enc, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	f := &File{}
+	if err := json.Unmarshal(enc, f); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(path), filepath.FromSlash(f.File)))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(data)) != f.Size || manifest.Digest(data) != f.Digest {
+		return nil, nil, fmt.Errorf("%s: input %s does not match its size and digest", path, f.File)
+	}
+	return f, data, nil
+}
@@ -0,0 +1,96 @@
+package conformance
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVectors(t *testing.T) {
+	for _, path := range vectorFiles(t) {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			f, data, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range f.Vectors {
+				if err := Check(data, v); err != nil {
+					t.Errorf("avg %d min %d max %d norm %d seed %d: %v", v.AverageSize, v.MinSize, v.MaxSize, v.Normalization, v.Seed, err)
+				}
+			}
+		})
+	}
+}
+
+// TestVectors_ExactScan checks that the exact-scan compatibility mode finds
+// the same boundaries as the vectors. Only boundaries and digests are
+// compared, as its fingerprints are computed differently.
+func TestVectors_ExactScan(t *testing.T) {
+	for _, path := range vectorFiles(t) {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			f, data, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, v := range f.Vectors {
+				if v.ExactScan {
+					continue
+				}
+				v.ExactScan = true
+				v.Chunks = append([]Chunk(nil), v.Chunks...)
+				for i := range v.Chunks {
+					v.Chunks[i].Fingerprint = nil
+				}
+				if err := Check(data, v); err != nil {
+					t.Errorf("avg %d min %d max %d norm %d seed %d: %v", v.AverageSize, v.MinSize, v.MaxSize, v.Normalization, v.Seed, err)
+				}
+			}
+		})
+	}
+}
+
+// vectorFiles returns the bundled vector files and those in the directory
+// named by FASTCDC_VECTORS.
+func vectorFiles(t *testing.T) []string {
+	t.Helper()
+	paths, err := filepath.Glob("testdata/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir := os.Getenv("FASTCDC_VECTORS"); dir != "" {
+		extra, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, extra...)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no vector files")
+	}
+	return paths
+}
+
+func TestCheck(t *testing.T) {
+	f, data, err := Load("testdata/remote-apis.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := f.Vectors[0]
+	v.Chunks = append([]Chunk(nil), v.Chunks...)
+	v.Chunks[2].Digest = v.Chunks[1].Digest
+	if err := Check(data, v); err == nil {
+		t.Error("Check accepted a wrong digest")
+	}
+	v.Chunks = v.Chunks[:3]
+	if err := Check(data, v); err == nil {
+		t.Error("Check accepted missing chunks")
+	}
+
+	got, err := Generate(data, f.Vectors[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(data, got); err != nil {
+		t.Errorf("Check(Generate) = %v", err)
+	}
+}
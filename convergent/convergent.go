@@ -0,0 +1,74 @@
+// Package convergent derives per-chunk keys for convergent encryption.
+//
+// Convergent encryption encrypts each chunk with a key derived from its own
+// contents, so identical chunks produce identical ciphertexts and still
+// deduplicate. Deriving keys from the plaintext alone would let anyone who
+// can guess a chunk confirm that a repository stores it. Keys derived here
+// therefore also depend on a repository secret: chunks deduplicate within a
+// repository, but ciphertexts and key material are unrelated across
+// repositories with different secrets.
+//
+// Since every key encrypts exactly one plaintext, an AEAD can safely be used
+// with a fixed nonce under a derived key.
+package convergent
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// MinSecretSize is the minimum size of a repository secret in bytes.
+const MinSecretSize = 32
+
+// KeySize is the size of derived keys in bytes, e.g. for AES-256-GCM.
+const KeySize = 32
+
+const (
+	keyInfo = "fastcdc2020 convergent chunk key"
+	idInfo  = "fastcdc2020 convergent chunk id"
+)
+
+// KeyDeriver derives chunk keys and storage identifiers from chunk digests
+// and a repository secret. It is safe for concurrent use.
+type KeyDeriver struct {
+	secret []byte
+}
+
+// NewKeyDeriver returns a KeyDeriver for the given repository secret, which
+// must be at least MinSecretSize bytes of uniformly random data.
+func NewKeyDeriver(secret []byte) (*KeyDeriver, error) {
+	if len(secret) < MinSecretSize {
+		return nil, errors.New("convergent secret must be at least 32 bytes")
+	}
+	return &KeyDeriver{secret: append([]byte(nil), secret...)}, nil
+}
+
+// Key returns the encryption key for the chunk with the given plaintext
+// digest, e.g. a manifest.Chunk Digest.
+func (k *KeyDeriver) Key(digest string) ([]byte, error) {
+	return hkdf.Key(sha256.New, []byte(digest), k.secret, keyInfo, KeySize)
+}
+
+// ID returns the identifier under which the encrypted chunk with the given
+// plaintext digest should be stored. Unlike the plaintext digest, it reveals
+// nothing about the chunk to those without the repository secret, and it is
+// independent of the chunk key.
+func (k *KeyDeriver) ID(digest string) ([]byte, error) {
+	return hkdf.Key(sha256.New, []byte(digest), k.secret, idInfo, sha256.Size)
+}
+
+// KeyForChunk returns the encryption key and storage identifier for a chunk,
+// computing its digest as manifest.Digest does.
+func (k *KeyDeriver) KeyForChunk(data []byte) (key, id []byte, err error) {
+	digest := manifest.Digest(data)
+	if key, err = k.Key(digest); err != nil {
+		return nil, nil, err
+	}
+	if id, err = k.ID(digest); err != nil {
+		return nil, nil, err
+	}
+	return key, id, nil
+}
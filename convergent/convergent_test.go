@@ -0,0 +1,86 @@
+package convergent
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+func TestKeyDeriver(t *testing.T) {
+	secretA := bytes.Repeat([]byte{1}, MinSecretSize)
+	secretB := bytes.Repeat([]byte{2}, MinSecretSize)
+	a, err := NewKeyDeriver(secretA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewKeyDeriver(secretB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunk := []byte("some chunk contents")
+	keyA1, idA1, err := a.KeyForChunk(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyA1) != KeySize {
+		t.Errorf("key size = %d, want %d", len(keyA1), KeySize)
+	}
+
+	// Identical chunks get identical keys within a repository...
+	keyA2, err := a.Key(manifest.Digest(chunk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idA2, err := a.ID(manifest.Digest(chunk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(keyA1, keyA2) || !bytes.Equal(idA1, idA2) {
+		t.Error("derivation is not deterministic")
+	}
+	if bytes.Equal(keyA1, idA1) {
+		t.Error("storage id must differ from the key")
+	}
+
+	// ...but unrelated ones across repositories and chunks.
+	keyB, idB, err := b.KeyForChunk(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(keyA1, keyB) || bytes.Equal(idA1, idB) {
+		t.Error("keys must differ between repository secrets")
+	}
+	keyOther, _, err := a.KeyForChunk([]byte("other chunk"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(keyA1, keyOther) {
+		t.Error("keys must differ between chunks")
+	}
+
+	// Ciphertexts of identical chunks deduplicate under a fixed nonce.
+	seal := func(key []byte) []byte {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return aead.Seal(nil, make([]byte, aead.NonceSize()), chunk, nil)
+	}
+	if !bytes.Equal(seal(keyA1), seal(keyA2)) {
+		t.Error("ciphertexts of identical chunks differ")
+	}
+}
+
+func TestNewKeyDeriver_ShortSecret(t *testing.T) {
+	if _, err := NewKeyDeriver(make([]byte, MinSecretSize-1)); err == nil {
+		t.Error("expected error for short secret")
+	}
+}
@@ -0,0 +1,171 @@
+// Package encrypted encrypts chunks at rest with AES-GCM.
+//
+// A Store wraps a chunk store, sealing every chunk on Put and opening it on
+// Get. Nonces are derived from the chunk digest under the key, so a chunk
+// stored twice under the same key encrypts to the same bytes and still
+// deduplicates, while the same chunk under different keys does not. Each
+// stored chunk names the key that sealed it, so keys can be rotated: new
+// chunks are sealed with the current key, and chunks sealed with earlier
+// keys stay readable as long as those keys are added with AddKey.
+//
+// Chunks are stored under their plaintext digests, which tell anyone who can
+// list the store whether it holds a chunk they can guess. The convergent
+// package derives storage identifiers that do not.
+package encrypted
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// KeySize is the size of keys in bytes.
+const KeySize = 32
+
+const (
+	version    = 1
+	encInfo    = "fastcdc2020 chunk encryption key"
+	nonceInfo  = "fastcdc2020 chunk nonce key"
+	maxKeyID   = 255
+	headerSize = 2 // version and key ID length
+)
+
+// ErrUnknownKey is returned by Get for chunks sealed with a key that has
+// not been added.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// ChunkStore is the store holding encrypted chunks. *fsstore.Store and
+// pack.ChunkStore implement ChunkStore.
+type ChunkStore interface {
+	Has(digest string) bool
+	Get(digest string) ([]byte, error)
+	Put(digest string, data []byte) error
+}
+
+// key is a key with the subkeys derived from it.
+type key struct {
+	id       string
+	aead     cipher.AEAD
+	nonceKey []byte
+}
+
+func newKey(id string, k []byte) (*key, error) {
+	if id == "" || len(id) > maxKeyID {
+		return nil, fmt.Errorf("key ID must be 1 to %d bytes", maxKeyID)
+	}
+	if len(k) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes", KeySize)
+	}
+	encKey, err := hkdf.Key(sha256.New, k, nil, encInfo, KeySize)
+	if err != nil {
+		return nil, err
+	}
+	nonceKey, err := hkdf.Key(sha256.New, k, nil, nonceInfo, sha256.Size)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &key{id: id, aead: aead, nonceKey: nonceKey}, nil
+}
+
+// nonce returns the nonce for the chunk with the given digest.
+func (k *key) nonce(digest string) []byte {
+	mac := hmac.New(sha256.New, k.nonceKey)
+	mac.Write([]byte(digest))
+	return mac.Sum(nil)[:k.aead.NonceSize()]
+}
+
+// Store is a ChunkStore that encrypts chunks on Put and decrypts them on
+// Get. Chunks keep the digest of their plaintext, which is authenticated
+// along with their contents, so a chunk moved to another digest fails to
+// decrypt. It is safe for concurrent use.
+type Store struct {
+	store ChunkStore
+	cur   *key
+
+	mu   sync.RWMutex
+	keys map[string]*key
+}
+
+// New returns a Store encrypting the chunks it stores in store with the
+// given KeySize-byte key, identified by keyID in the stored chunks. The key
+// should be uniformly random.
+func New(store ChunkStore, keyID string, k []byte) (*Store, error) {
+	cur, err := newKey(keyID, k)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{store: store, cur: cur, keys: map[string]*key{keyID: cur}}, nil
+}
+
+// AddKey makes chunks sealed with an earlier key readable.
+func (s *Store) AddKey(keyID string, k []byte) error {
+	added, err := newKey(keyID, k)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if keyID == s.cur.id {
+		return fmt.Errorf("key %q is the current key", keyID)
+	}
+	s.keys[keyID] = added
+	return nil
+}
+
+// Has reports whether a chunk is stored, under any key.
+func (s *Store) Has(digest string) bool {
+	return s.store.Has(digest)
+}
+
+// Get returns the decrypted contents of a stored chunk.
+func (s *Store) Get(digest string) ([]byte, error) {
+	sealed, err := s.store.Get(digest)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < headerSize || sealed[0] != version || len(sealed) < headerSize+int(sealed[1]) {
+		return nil, fmt.Errorf("chunk %s: invalid encryption header", digest)
+	}
+	id := string(sealed[headerSize : headerSize+int(sealed[1])])
+	s.mu.RLock()
+	k := s.keys[id]
+	s.mu.RUnlock()
+	if k == nil {
+		return nil, fmt.Errorf("chunk %s: %w %q", digest, ErrUnknownKey, id)
+	}
+	sealed = sealed[headerSize+len(id):]
+	n := k.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, fmt.Errorf("chunk %s: invalid encryption header", digest)
+	}
+	data, err := k.aead.Open(nil, sealed[:n], sealed[n:], []byte(digest))
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", digest, err)
+	}
+	return data, nil
+}
+
+// Put encrypts a chunk with the current key and stores it.
+func (s *Store) Put(digest string, data []byte) error {
+	k := s.cur
+	nonce := k.nonce(digest)
+	buf := make([]byte, 0, headerSize+len(k.id)+len(nonce)+len(data)+k.aead.Overhead())
+	buf = append(buf, version, byte(len(k.id)))
+	buf = append(buf, k.id...)
+	buf = append(buf, nonce...)
+	buf = k.aead.Seal(buf, nonce, data, []byte(digest))
+	return s.store.Put(digest, buf)
+}
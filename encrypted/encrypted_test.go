@@ -0,0 +1,138 @@
+package encrypted
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// memStore is a ChunkStore backed by a map.
+type memStore map[string][]byte
+
+func (s memStore) Has(digest string) bool {
+	_, ok := s[digest]
+	return ok
+}
+
+func (s memStore) Get(digest string) ([]byte, error) {
+	data, ok := s[digest]
+	if !ok {
+		return nil, fmt.Errorf("chunk %s: %w", digest, os.ErrNotExist)
+	}
+	return data, nil
+}
+
+func (s memStore) Put(digest string, data []byte) error {
+	s[digest] = append([]byte(nil), data...)
+	return nil
+}
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestStore(t *testing.T) {
+	if _, err := New(memStore{}, "k1", make([]byte, 16)); err == nil {
+		t.Error("expected an error for a short key")
+	}
+	if _, err := New(memStore{}, "", testKey(1)); err == nil {
+		t.Error("expected an error for an empty key ID")
+	}
+
+	store := memStore{}
+	s, err := New(store, "k1", testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("secret "), 100)
+	if err := s.Put("a", data); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Has("a") {
+		t.Error("Has() = false after Put")
+	}
+	if bytes.Contains(store["a"], []byte("secret")) {
+		t.Error("plaintext found in the stored chunk")
+	}
+	if got, err := s.Get("a"); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Get() = %d bytes, %v, want %d bytes", len(got), err, len(data))
+	}
+	if _, err := s.Get("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get(missing) = %v, want os.ErrNotExist", err)
+	}
+
+	// The same chunk under the same key is sealed identically, and under
+	// another key differently.
+	again := memStore{}
+	if s, err := New(again, "k1", testKey(1)); err != nil {
+		t.Fatal(err)
+	} else if err := s.Put("a", data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again["a"], store["a"]) {
+		t.Error("same chunk and key sealed differently")
+	}
+	other := memStore{}
+	if s, err := New(other, "k1", testKey(2)); err != nil {
+		t.Fatal(err)
+	} else if err := s.Put("a", data); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(other["a"], store["a"]) {
+		t.Error("same chunk sealed identically under different keys")
+	}
+
+	// Damaged chunks and chunks moved to another digest fail to decrypt.
+	store["b"] = store["a"]
+	if _, err := s.Get("b"); err == nil {
+		t.Error("Get() of a chunk stored under another digest: expected an error")
+	}
+	damaged := append([]byte(nil), store["a"]...)
+	damaged[len(damaged)-1] ^= 1
+	store["c"] = damaged
+	if _, err := s.Get("c"); err == nil {
+		t.Error("Get() of a damaged chunk: expected an error")
+	}
+	store["d"] = []byte{version}
+	if _, err := s.Get("d"); err == nil {
+		t.Error("Get() of a truncated chunk: expected an error")
+	}
+}
+
+func TestStore_Rotation(t *testing.T) {
+	store := memStore{}
+	old, err := New(store, "k1", testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Put("a", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(store, "k2", testKey(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("b", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("a"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Get() of a chunk sealed with a missing key = %v, want ErrUnknownKey", err)
+	}
+	if err := s.AddKey("k2", testKey(3)); err == nil {
+		t.Error("expected an error replacing the current key")
+	}
+	if err := s.AddKey("k1", testKey(1)); err != nil {
+		t.Fatal(err)
+	}
+	for digest, want := range map[string]string{"a": "old", "b": "new"} {
+		if got, err := s.Get(digest); err != nil || string(got) != want {
+			t.Errorf("Get(%s) = %q, %v, want %q", digest, got, err, want)
+		}
+	}
+	if _, err := old.Get("b"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Get() of a chunk sealed with a newer key = %v, want ErrUnknownKey", err)
+	}
+}
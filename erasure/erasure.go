@@ -0,0 +1,352 @@
+// Package erasure adds Reed-Solomon redundancy to a chunk store.
+//
+// A Store groups the chunks written through it, k at a time, and writes m
+// parity chunks for every group. Any k of the k+m chunks of a group
+// reconstruct the others, so a group survives the loss of any m of its
+// chunks; placed on different disks or nodes, for example with the shard
+// package, the chunks of a group survive as many failures for a fraction of
+// the space of m+1 replicas. Get reconstructs chunks that are missing or
+// damaged in the underlying store transparently.
+//
+// Parity chunks are stored like any other chunk, under the hex-encoded
+// digest of their contents, and chunk digests must be of the same kind, as
+// in the manifest package, so that damaged chunks can be detected. Digests
+// are SHA-256 unless SetDigestFunction selects another function.
+// Which chunks form a group is not recorded in the chunk store: callers
+// persist Groups and restore them with AddGroups.
+package erasure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// ChunkStore is the store holding data and parity chunks.
+// *fsstore.Store and pack.ChunkStore implement ChunkStore.
+type ChunkStore interface {
+	Has(digest string) bool
+	Get(digest string) ([]byte, error)
+	Put(digest string, data []byte) error
+}
+
+// ErrTooManyLost is returned when a chunk cannot be reconstructed because
+// too few chunks of its group are readable.
+var ErrTooManyLost = errors.New("too many chunks of group lost")
+
+// Group records the chunks protected together.
+type Group struct {
+	// Data lists the digests of the data chunks.
+	Data []string `json:"data"`
+	// Lengths holds the length of each data chunk. Parity is computed over
+	// the data chunks padded with zeros to the longest of them.
+	Lengths []int64 `json:"lengths"`
+	// Parity lists the digests of the parity chunks.
+	Parity []string `json:"parity"`
+	// DigestFunction is the function of the digests of the group. The zero
+	// value means SHA-256.
+	DigestFunction manifest.DigestFunction `json:"digestFunction,omitzero"`
+}
+
+func (g *Group) validate() error {
+	switch {
+	case len(g.Data) == 0 || len(g.Parity) == 0:
+		return errors.New("group has no data or no parity chunks")
+	case len(g.Lengths) != len(g.Data):
+		return errors.New("group lengths do not match its data chunks")
+	case len(g.Data)+len(g.Parity) > 256:
+		return errors.New("group has more than 256 chunks")
+	case !g.DigestFunction.Supported():
+		return fmt.Errorf("%w: %v", manifest.ErrUnsupportedDigestFunction, g.DigestFunction)
+	}
+	return nil
+}
+
+// matches reports whether data has the given digest under the digest
+// function of g.
+func (g *Group) matches(data []byte, digest string) bool {
+	got, err := g.DigestFunction.Digest(data)
+	return err == nil && got == digest
+}
+
+// shardLength returns the length of the parity chunks of g.
+func (g *Group) shardLength() int64 {
+	var n int64
+	for _, length := range g.Lengths {
+		n = max(n, length)
+	}
+	return n
+}
+
+// Store protects the chunks written through it with parity chunks in an
+// underlying ChunkStore. It is safe for concurrent use.
+//
+// Chunks are stored immediately, but only protected once their group is
+// complete or on Flush; until then, Store keeps a copy of them in memory.
+type Store struct {
+	store        ChunkStore
+	dataShards   int
+	parityShards int
+	digest       manifest.DigestFunction
+
+	mu      sync.Mutex
+	pending []pendingChunk
+	groups  []*Group
+	byChunk map[string]*Group
+}
+
+type pendingChunk struct {
+	digest string
+	data   []byte
+}
+
+// New returns a Store writing a group of parityShards parity chunks for
+// every dataShards chunks put into store. At most 256 chunks fit in a
+// group.
+func New(store ChunkStore, dataShards, parityShards int) (*Store, error) {
+	if dataShards < 1 || parityShards < 1 {
+		return nil, errors.New("dataShards and parityShards must be positive")
+	}
+	if dataShards+parityShards > 256 {
+		return nil, errors.New("dataShards + parityShards must be at most 256")
+	}
+	return &Store{
+		store:        store,
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		byChunk:      map[string]*Group{},
+	}, nil
+}
+
+// SetDigestFunction makes s digest parity chunks with f instead of SHA-256.
+// The chunks put into s must be digested with f too. It returns
+// manifest.ErrUnsupportedDigestFunction if f cannot be computed, and must
+// be called before the first Put.
+func (s *Store) SetDigestFunction(f manifest.DigestFunction) error {
+	if !f.Supported() {
+		return fmt.Errorf("%w: %v", manifest.ErrUnsupportedDigestFunction, f)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.digest = f
+	return nil
+}
+
+// Has reports whether a chunk is stored in the underlying store. A lost
+// chunk that Get could reconstruct is reported missing, so that callers
+// that skip stored chunks put it again.
+func (s *Store) Has(digest string) bool {
+	return s.store.Has(digest)
+}
+
+// Put stores a chunk and adds it to the group being filled, unless it is
+// already part of a group.
+func (s *Store) Put(digest string, data []byte) error {
+	if err := s.store.Put(digest, data); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byChunk[digest] != nil {
+		return nil
+	}
+	for _, c := range s.pending {
+		if c.digest == digest {
+			return nil
+		}
+	}
+	s.pending = append(s.pending, pendingChunk{digest: digest, data: bytes.Clone(data)})
+	if len(s.pending) < s.dataShards {
+		return nil
+	}
+	return s.encodePending()
+}
+
+// Flush writes the parity chunks of the group being filled, if any, even
+// though it has fewer than dataShards chunks.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return nil
+	}
+	return s.encodePending()
+}
+
+// encodePending writes the parity chunks of the pending chunks and records
+// their group. On failure the chunks stay pending.
+func (s *Store) encodePending() error {
+	g := &Group{DigestFunction: s.digest}
+	for _, c := range s.pending {
+		g.Data = append(g.Data, c.digest)
+		g.Lengths = append(g.Lengths, int64(len(c.data)))
+	}
+	for i := range s.parityShards {
+		parity := make([]byte, g.shardLength())
+		for j, c := range s.pending {
+			mulAdd(parity, c.data, parityCoefficient(i, j))
+		}
+		digest, err := s.digest.Digest(parity)
+		if err != nil {
+			return err
+		}
+		if err := s.store.Put(digest, parity); err != nil {
+			return err
+		}
+		g.Parity = append(g.Parity, digest)
+	}
+	s.pending = nil
+	s.addGroup(g)
+	return nil
+}
+
+func (s *Store) addGroup(g *Group) {
+	s.groups = append(s.groups, g)
+	for _, digest := range g.Data {
+		s.byChunk[digest] = g
+	}
+}
+
+// Groups returns the groups written so far and those added with
+// AddGroups, for persisting alongside the chunk store.
+func (s *Store) Groups() []Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	groups := make([]Group, len(s.groups))
+	for i, g := range s.groups {
+		groups[i] = *g
+	}
+	return groups
+}
+
+// AddGroups restores groups returned by Groups, for example after a restart,
+// so that Get can reconstruct their chunks.
+func (s *Store) AddGroups(groups ...Group) error {
+	for i := range groups {
+		if err := groups[i].validate(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, g := range groups {
+		s.addGroup(&g)
+	}
+	return nil
+}
+
+// Get returns the contents of a chunk, verified against its digest, and
+// reconstructs it from the other chunks of its group if it cannot be read
+// from the underlying store or is damaged there. Reconstructed chunks are
+// not written back; Put them to repair the store.
+func (s *Store) Get(digest string) ([]byte, error) {
+	s.mu.Lock()
+	g := s.byChunk[digest]
+	function := s.digest
+	s.mu.Unlock()
+	if g != nil {
+		function = g.DigestFunction
+	}
+	data, err := s.store.Get(digest)
+	if err == nil {
+		var got string
+		if got, err = function.Digest(data); err == nil && got == digest {
+			return data, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("chunk %s does not match its digest", digest)
+		}
+	}
+	data = nil
+	s.mu.Lock()
+	// The chunk's group may have been completed since it was looked up.
+	g = s.byChunk[digest]
+	for _, c := range s.pending {
+		if c.digest == digest {
+			data = bytes.Clone(c.data)
+		}
+	}
+	s.mu.Unlock()
+	if data != nil {
+		return data, nil
+	}
+	if g == nil {
+		return nil, err
+	}
+	data, rerr := s.reconstruct(g, digest)
+	if rerr != nil {
+		return nil, fmt.Errorf("%w; reconstructing: %w", err, rerr)
+	}
+	return data, nil
+}
+
+// reconstruct recovers the data chunk with the given digest from any
+// len(g.Data) other readable chunks of g.
+func (s *Store) reconstruct(g *Group, digest string) ([]byte, error) {
+	k := len(g.Data)
+	target := -1
+	for j, d := range g.Data {
+		if d == digest {
+			target = j
+		}
+	}
+	if target < 0 {
+		return nil, fmt.Errorf("chunk %s: %w", digest, os.ErrNotExist)
+	}
+	shardLen := g.shardLength()
+
+	// Each readable chunk contributes its row of the generator matrix: a
+	// unit row for a data chunk and a row of coefficients for a parity
+	// chunk.
+	var rows, shards [][]byte
+	for j, d := range g.Data {
+		if len(rows) == k {
+			break
+		}
+		if j == target {
+			continue
+		}
+		data, err := s.store.Get(d)
+		if err != nil || int64(len(data)) != g.Lengths[j] || !g.matches(data, d) {
+			continue
+		}
+		row := make([]byte, k)
+		row[j] = 1
+		rows, shards = append(rows, row), append(shards, data)
+	}
+	for i, d := range g.Parity {
+		if len(rows) == k {
+			break
+		}
+		data, err := s.store.Get(d)
+		if err != nil || int64(len(data)) != shardLen || !g.matches(data, d) {
+			continue
+		}
+		row := make([]byte, k)
+		for j := range row {
+			row[j] = parityCoefficient(i, j)
+		}
+		rows, shards = append(rows, row), append(shards, data)
+	}
+	if len(rows) < k {
+		return nil, fmt.Errorf("%w: %d of the %d chunks needed are readable", ErrTooManyLost, len(rows), k)
+	}
+
+	inv, err := invert(rows)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, shardLen)
+	for r, shard := range shards {
+		mulAdd(data, shard, inv[target][r])
+	}
+	data = data[:g.Lengths[target]]
+	if !g.matches(data, digest) {
+		return nil, fmt.Errorf("reconstructed chunk %s does not match its digest", digest)
+	}
+	return data, nil
+}
@@ -0,0 +1,215 @@
+package erasure
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// memStore is a ChunkStore backed by a map.
+type memStore map[string][]byte
+
+func (s memStore) Has(digest string) bool {
+	_, ok := s[digest]
+	return ok
+}
+
+func (s memStore) Get(digest string) ([]byte, error) {
+	data, ok := s[digest]
+	if !ok {
+		return nil, fmt.Errorf("chunk %s: %w", digest, os.ErrNotExist)
+	}
+	return data, nil
+}
+
+func (s memStore) Put(digest string, data []byte) error {
+	s[digest] = append([]byte(nil), data...)
+	return nil
+}
+
+// putChunks puts n chunks of random lengths, digested with f, and returns
+// their contents by digest, in order.
+func putChunks(t *testing.T, s *Store, f manifest.DigestFunction, n int) ([]string, map[string][]byte) {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	var digests []string
+	chunks := map[string][]byte{}
+	for range n {
+		data := make([]byte, 100+rng.Intn(1000))
+		rng.Read(data)
+		digest, err := f.Digest(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Put(digest, data); err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, digest)
+		chunks[digest] = data
+	}
+	return digests, chunks
+}
+
+func TestStore(t *testing.T) {
+	if _, err := New(memStore{}, 0, 1); err == nil {
+		t.Error("expected an error for zero data shards")
+	}
+	if _, err := New(memStore{}, 200, 57); err == nil {
+		t.Error("expected an error for more than 256 shards")
+	}
+
+	store := memStore{}
+	s, err := New(store, 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digests, chunks := putChunks(t, s, manifest.DigestSHA256, 10)
+
+	// Chunks of the incomplete group are readable from memory until flushed.
+	delete(store, digests[9])
+	if data, err := s.Get(digests[9]); err != nil || string(data) != string(chunks[digests[9]]) {
+		t.Errorf("Get() of a pending chunk = %d bytes, %v", len(data), err)
+	}
+	store.Put(digests[9], chunks[digests[9]])
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	groups := s.Groups()
+	if len(groups) != 3 || len(groups[2].Data) != 2 {
+		t.Fatalf("got %d groups, want 2 full ones and one of 2 chunks", len(groups))
+	}
+
+	// Every combination of two lost chunks of a group is recoverable.
+	for _, g := range groups {
+		all := append(append([]string(nil), g.Data...), g.Parity...)
+		for a := range all {
+			for b := a + 1; b < len(all); b++ {
+				saved := memStore{all[a]: store[all[a]], all[b]: store[all[b]]}
+				delete(store, all[a])
+				delete(store, all[b])
+				for _, digest := range g.Data {
+					data, err := s.Get(digest)
+					if err != nil {
+						t.Fatalf("lost %d and %d: Get(%s): %v", a, b, digest, err)
+					}
+					if string(data) != string(chunks[digest]) {
+						t.Fatalf("lost %d and %d: Get(%s) returned wrong data", a, b, digest)
+					}
+				}
+				for d, data := range saved {
+					store[d] = data
+				}
+			}
+		}
+	}
+
+	// Damaged chunks are not used for reconstruction.
+	g := groups[0]
+	delete(store, g.Data[0])
+	store[g.Data[1]] = []byte("damaged")
+	if data, err := s.Get(g.Data[0]); err != nil || string(data) != string(chunks[g.Data[0]]) {
+		t.Errorf("Get() with a damaged chunk in the group = %d bytes, %v", len(data), err)
+	}
+	// A damaged chunk read without an error is reconstructed, and one
+	// outside any group is reported.
+	if data, err := s.Get(g.Data[1]); err != nil || string(data) != string(chunks[g.Data[1]]) {
+		t.Errorf("Get() of a damaged chunk = %q, %v", data, err)
+	}
+	store["ungrouped"] = []byte("data")
+	if _, err := s.Get("ungrouped"); err == nil {
+		t.Error("Get() of an ungrouped chunk that does not match its digest: expected an error")
+	}
+	delete(store, g.Parity[0])
+	if _, err := s.Get(g.Data[0]); !errors.Is(err, ErrTooManyLost) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get() with three chunks of the group lost: got %v, want ErrTooManyLost and os.ErrNotExist", err)
+	}
+}
+
+func TestStore_AddGroups(t *testing.T) {
+	store := memStore{}
+	s, err := New(store, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digests, chunks := putChunks(t, s, manifest.DigestSHA256, 6)
+	enc, err := json.Marshal(s.Groups())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var groups []Group
+	if err := json.Unmarshal(enc, &groups); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := New(store, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.AddGroups(groups...); err != nil {
+		t.Fatal(err)
+	}
+	delete(store, digests[4])
+	if data, err := restored.Get(digests[4]); err != nil || string(data) != string(chunks[digests[4]]) {
+		t.Errorf("Get() after AddGroups = %d bytes, %v", len(data), err)
+	}
+
+	if err := restored.AddGroups(Group{Data: []string{"a"}, Parity: []string{"p"}}); err == nil {
+		t.Error("expected an error for a group without lengths")
+	}
+}
+
+func TestStore_DigestFunction(t *testing.T) {
+	store := memStore{}
+	s, err := New(store, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetDigestFunction(manifest.DigestBLAKE3); !errors.Is(err, manifest.ErrUnsupportedDigestFunction) {
+		t.Errorf("SetDigestFunction(BLAKE3) = %v, want ErrUnsupportedDigestFunction", err)
+	}
+	if err := s.SetDigestFunction(manifest.DigestSHA512); err != nil {
+		t.Fatal(err)
+	}
+	digests, chunks := putChunks(t, s, manifest.DigestSHA512, 6)
+	enc, err := json.Marshal(s.Groups())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var groups []Group
+	if err := json.Unmarshal(enc, &groups); err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range groups {
+		if g.DigestFunction != manifest.DigestSHA512 {
+			t.Errorf("group digest function = %v, want SHA512", g.DigestFunction)
+		}
+		if want, _ := manifest.DigestSHA512.Digest(store[g.Parity[0]]); g.Parity[0] != want {
+			t.Errorf("parity chunk stored under %s, want its SHA-512 digest %s", g.Parity[0], want)
+		}
+	}
+
+	// A store restored without SetDigestFunction reconstructs with the
+	// function its groups record.
+	restored, err := New(store, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.AddGroups(groups...); err != nil {
+		t.Fatal(err)
+	}
+	delete(store, digests[1])
+	if data, err := restored.Get(digests[1]); err != nil || string(data) != string(chunks[digests[1]]) {
+		t.Errorf("Get() of a lost SHA-512 chunk = %d bytes, %v", len(data), err)
+	}
+	damaged := append([]byte(nil), chunks[digests[4]]...)
+	damaged[0] ^= 1
+	store[digests[4]] = damaged
+	if data, err := restored.Get(digests[4]); err != nil || string(data) != string(chunks[digests[4]]) {
+		t.Errorf("Get() of a damaged SHA-512 chunk = %d bytes, %v", len(data), err)
+	}
+}
@@ -0,0 +1,98 @@
+package erasure
+
+import "errors"
+
+// Arithmetic in GF(2^8) with the polynomial x^8 + x^4 + x^3 + x^2 + 1, the
+// field used by most Reed-Solomon implementations.
+var (
+	gfExp [510]byte
+	gfLog [256]int
+)
+
+func init() {
+	x := 1
+	for i := range 255 {
+		gfExp[i] = byte(x)
+		gfLog[x] = i
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-gfLog[a]]
+}
+
+// mulAdd adds c times src to dst, which is at least as long as src.
+func mulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	lc := gfLog[c]
+	for i, b := range src {
+		if b != 0 {
+			dst[i] ^= gfExp[lc+gfLog[b]]
+		}
+	}
+}
+
+// parityCoefficient is the coefficient of data shard j in parity shard i.
+// The parity rows form a Cauchy matrix with x_i = 255-i and y_j = j, so
+// that every square submatrix of the systematic generator matrix is
+// invertible as long as there are at most 256 shards in all. The
+// coefficients do not depend on the number of data shards, so a group
+// shorter than the configured size is encoded as if its missing data shards
+// were empty.
+func parityCoefficient(i, j int) byte {
+	return gfInv(byte(255-i) ^ byte(j))
+}
+
+// errSingular is returned by invert for a singular matrix, which cannot
+// happen for rows of the generator matrix.
+var errSingular = errors.New("singular matrix")
+
+// invert returns the inverse of the square matrix m, which it overwrites.
+func invert(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	inv := make([][]byte, n)
+	for i := range inv {
+		inv[i] = make([]byte, n)
+		inv[i][i] = 1
+	}
+	for col := range n {
+		pivot := col
+		for pivot < n && m[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, errSingular
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		inv[col], inv[pivot] = inv[pivot], inv[col]
+		if c := gfInv(m[col][col]); c != 1 {
+			for j := range n {
+				m[col][j] = gfMul(m[col][j], c)
+				inv[col][j] = gfMul(inv[col][j], c)
+			}
+		}
+		for row := range n {
+			if c := m[row][col]; row != col && c != 0 {
+				mulAdd(m[row], m[col], c)
+				mulAdd(inv[row], inv[col], c)
+			}
+		}
+	}
+	return inv, nil
+}
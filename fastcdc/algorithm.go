@@ -0,0 +1,121 @@
+package fastcdc
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// Algorithm selects how a Chunker finds content-defined boundaries. All
+// algorithms share the chunker's buffering and options; options specific to
+// one algorithm are ignored by the others.
+type Algorithm int
+
+const (
+	// FastCDC is the FastCDC 2020 algorithm with normalized chunking. It is
+	// the default.
+	FastCDC Algorithm = iota
+	// TTTD is the two-threshold two-divisor algorithm of Eshghi and Tang,
+	// computed over the gear hash. It cuts where the fingerprint matches a
+	// main mask of log2(averageSize) bits, and falls back to the last match
+	// of a backup mask with one bit fewer when the maximum size is reached.
+	// Normalization is ignored; WithMaskPair sets the main and backup masks.
+	TTTD
+	// AE is the Asymmetric Extremum algorithm of Zhang et al. It computes no
+	// hash: past the minimum size, it cuts once a fixed window of 8-byte
+	// values follows the maximum value seen so far without exceeding it.
+	// The window is sized for the average chunk size. Normalization, the
+	// seed, and WithMaskPair are ignored.
+	AE
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case FastCDC:
+		return "FastCDC"
+	case TTTD:
+		return "TTTD"
+	case AE:
+		return "AE"
+	}
+	return "Algorithm(" + strconv.Itoa(int(a)) + ")"
+}
+
+// WithAlgorithm selects the chunking algorithm (defaults to FastCDC), e.g. for
+// comparison studies or compatibility with systems that use another one.
+func WithAlgorithm(a Algorithm) Option {
+	return func(o *options) {
+		o.algorithm = a
+	}
+}
+
+// cutTTTD returns the length of the next chunk in data using TTTD, and the
+// fingerprint at the cut point.
+func (c *Chunker) cutTTTD(data []byte) (int, uint64) {
+	dataLen := len(data)
+	if dataLen <= c.minSize {
+		return dataLen, 0
+	}
+	end := min(dataLen, c.maxSize)
+	gear := &c.gear
+
+	var fingerprint, backupFingerprint uint64
+	backup := 0
+	// Warm up the hash over the bytes before the minimum size so that
+	// fingerprints only depend on content.
+	for i := max(c.minSize-64, 0); i < c.minSize; i++ {
+		fingerprint = (fingerprint << 1) + gear[data[i]]
+	}
+	for i := c.minSize; i < end; i++ {
+		fingerprint = (fingerprint << 1) + gear[data[i]]
+		if fingerprint&c.maskSmall == 0 {
+			return i + 1, fingerprint
+		}
+		if fingerprint&c.maskLarge == 0 {
+			backup, backupFingerprint = i+1, fingerprint
+		}
+	}
+	if end < c.maxSize {
+		// The stream ends, or a boundary hint is reached, before the
+		// maximum size.
+		return end, fingerprint
+	}
+	if backup > 0 {
+		return backup, backupFingerprint
+	}
+	return end, fingerprint
+}
+
+// aeWindow returns the AE window for the given sizes. A window of w bytes
+// yields chunks of about w*(e-1) bytes past the minimum size on random data.
+func aeWindow(averageSize, minSize int) int {
+	return max(int(float64(averageSize-minSize)/(math.E-1)), 1)
+}
+
+// aeLookahead is how many bytes past a position AE reads to compare the
+// 8-byte value starting there.
+const aeLookahead = 7
+
+// cutAE returns the length of the next chunk in data using AE, and the
+// extreme value that determined the cut point. Values are compared up to
+// the maximum size, so data must extend aeLookahead bytes past it unless the
+// stream ends, or a boundary hint falls, before that.
+func (c *Chunker) cutAE(data []byte) (int, uint64) {
+	dataLen := len(data)
+	if dataLen <= c.minSize {
+		return dataLen, 0
+	}
+	end := min(dataLen, c.maxSize)
+
+	maxPos := c.minSize
+	var maxValue uint64
+	for i := c.minSize; i < end && i+aeLookahead < dataLen; i++ {
+		v := binary.LittleEndian.Uint64(data[i:])
+		if v > maxValue {
+			maxValue, maxPos = v, i
+		} else if i == maxPos+c.aeWindow {
+			return i + 1, maxValue
+		}
+	}
+	return end, maxValue
+}
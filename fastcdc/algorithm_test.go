@@ -0,0 +1,128 @@
+package fastcdc
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+	"testing/iotest"
+)
+
+func TestAlgorithms(t *testing.T) {
+	data := randBytes(1<<20, 161)
+	// Inserting a byte near the start should only disturb nearby boundaries.
+	edited := slices.Insert(slices.Clone(data), 1000, 0x42)
+
+	for _, alg := range []Algorithm{FastCDC, TTTD, AE} {
+		t.Run(alg.String(), func(t *testing.T) {
+			chunk := func(data []byte) []int {
+				chunker, err := NewChunker(bytes.NewReader(data), 8192, WithAlgorithm(alg))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return chunkLengths(t, chunker)
+			}
+			lengths := chunk(data)
+			var total int
+			for i, l := range lengths {
+				total += l
+				if l > 32768 || (l < 2048 && i < len(lengths)-1) {
+					t.Errorf("chunk %d has length %d outside [2048, 32768]", i, l)
+				}
+			}
+			if total != len(data) {
+				t.Fatalf("chunks cover %d bytes, want %d", total, len(data))
+			}
+			if mean := total / len(lengths); mean < 4096 || mean > 16384 {
+				t.Errorf("mean chunk size = %d, want about 8192", mean)
+			}
+			if !slices.Equal(chunk(data), lengths) {
+				t.Error("chunking is not deterministic")
+			}
+
+			ends := func(lengths []int, shift int) map[int]bool {
+				m := map[int]bool{}
+				var end int
+				for _, l := range lengths {
+					end += l
+					if end > 2000 {
+						m[end-shift] = true
+					}
+				}
+				return m
+			}
+			before, after := ends(lengths, 0), ends(chunk(edited), 1)
+			var kept int
+			for end := range before {
+				if after[end] {
+					kept++
+				}
+			}
+			if kept < len(before)*9/10 {
+				t.Errorf("only %d of %d boundaries survived an insertion", kept, len(before))
+			}
+		})
+	}
+
+	if _, err := NewChunker(nil, 8192, WithAlgorithm(Algorithm(99))); err == nil {
+		t.Error("NewChunker() with unknown algorithm succeeded")
+	}
+	if got := Algorithm(99).String(); got != "Algorithm(99)" {
+		t.Errorf("String() = %q", got)
+	}
+	if _, err := ExpectedDistribution(8192, WithAlgorithm(TTTD)); err == nil {
+		t.Error("ExpectedDistribution() for TTTD succeeded")
+	}
+}
+
+func TestTTTD_Backup(t *testing.T) {
+	// A main mask that never matches forces every chunk to the backup
+	// boundary or the maximum size.
+	data := randBytes(1<<20, 171)
+	chunker, err := NewChunker(bytes.NewReader(data), 8192, WithAlgorithm(TTTD), WithMaskPair(1<<62-1, Mask(12)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lengths := chunkLengths(t, chunker)
+	var atMax int
+	for _, l := range lengths[:len(lengths)-1] {
+		if l == 32768 {
+			atMax++
+		}
+	}
+	if atMax > len(lengths)/4 {
+		t.Errorf("%d of %d chunks cut at the maximum size, want most at backup boundaries", atMax, len(lengths))
+	}
+}
+
+func TestAE_BufferIndependent(t *testing.T) {
+	// Every chunk is cut 3 bytes before the maximum size, a window after
+	// the value starting with the only nonzero byte, which is only found
+	// by reading past the cut.
+	const period = 4096 - 3
+	data := make([]byte, 256*period)
+	for i := 0; i < len(data); i += period {
+		data[i+period-1-aeWindow(4096, 2048)+aeLookahead] = 0xff
+	}
+	opts := []Option{WithAlgorithm(AE), WithMinSize(2048), WithMaxSize(4096)}
+	chunk := func(r io.Reader, opts ...Option) []int {
+		chunker, err := NewChunker(r, 4096, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chunkLengths(t, chunker)
+	}
+	want := chunk(bytes.NewReader(data), opts...)
+	for _, bufSize := range []int{4096 + 7, 4096 + 8, 2 * 4096, 3 * 4096} {
+		sized := append(slices.Clone(opts), WithBufferSize(bufSize))
+		if got := chunk(bytes.NewBuffer(data), sized...); !slices.Equal(got, want) {
+			t.Errorf("buffer size %d: boundaries differ from chunking in place", bufSize)
+		}
+		if got := chunk(iotest.HalfReader(bytes.NewReader(data)), sized...); !slices.Equal(got, want) {
+			t.Errorf("buffer size %d with short reads: boundaries differ from chunking in place", bufSize)
+		}
+	}
+	if _, err := NewChunker(nil, 4096, append(opts, WithBufferSize(4096+6))...); err == nil {
+		t.Error("NewChunker() with AE and a buffer 6 bytes past MaxSize succeeded")
+	}
+}
@@ -0,0 +1,78 @@
+package fastcdc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// ErrNeedInput is returned by Next on a chunker continued with Append when
+// the data appended so far is exhausted, up to a tail whose chunking depends
+// on what follows. Append more data, or call Finish to end the stream.
+var ErrNeedInput = errors.New("chunker needs more input")
+
+// Append continues the stream with r once the current source is exhausted,
+// without resetting the stream position or the buffered data, so that a
+// stream delivered in parts, e.g. as gRPC messages or multipart parts,
+// chunks exactly as the contiguous stream would. Offsets continue across
+// parts.
+//
+// Once Append has been called, reaching the end of the sources no longer
+// ends the stream: Next returns ErrNeedInput instead, keeping up to the
+// maximum chunk size of data buffered, until more is appended or Finish is
+// called. Append must be called before Next has returned io.EOF, or the
+// chunks cut at the end of the previous sources remain as they are.
+//
+// Sources appended are read through the internal buffer, even when they
+// are in memory. Append does not read from r; Reset discards appended
+// sources.
+func (c *Chunker) Append(r io.Reader) {
+	if c.direct {
+		// Read the rest of an in-memory source through the buffer,
+		// ahead of r.
+		rest := c.buf[c.bufCursor:c.bufEnd]
+		c.buf = c.ownBuf
+		c.bufCursor, c.bufEnd = 0, 0
+		c.direct = false
+		c.reader = bytes.NewReader(rest)
+	}
+	c.sources = append(c.sources, r)
+	c.appending = true
+	c.drained = false
+	if c.maxBytes == 0 || int64(c.streamPos+c.bufEnd-c.bufCursor) < c.maxBytes {
+		c.readerEOF = false
+	}
+}
+
+// Finish ends a stream continued with Append: once the sources appended so
+// far are exhausted, Next cuts the last chunk and then returns io.EOF.
+func (c *Chunker) Finish() {
+	c.finished = true
+	if c.drained {
+		c.drained = false
+		c.readerEOF = true
+	}
+}
+
+// readSources reads into p from the reader and then the appended sources,
+// until p is full or all of them are exhausted.
+func (c *Chunker) readSources(p []byte) (int, error) {
+	if c.readTimeout > 0 {
+		c.setDeadline()
+	}
+	n, err := 0, io.EOF
+	if c.reader != nil {
+		n, err = c.readFull(p)
+	}
+	for (err == io.EOF || err == io.ErrUnexpectedEOF) && len(c.sources) > 0 {
+		c.clearDeadline()
+		c.reader, c.sources = c.sources[0], c.sources[1:]
+		if c.readTimeout > 0 {
+			c.setDeadline()
+		}
+		var nn int
+		nn, err = c.readFull(p[n:])
+		n += nn
+	}
+	return n, err
+}
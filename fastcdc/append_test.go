@@ -0,0 +1,84 @@
+package fastcdc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"testing/iotest"
+)
+
+// appendChunks chunks parts as one stream, appending each part to chunker
+// once it needs more input, and returns the chunks with copies of their
+// data.
+func appendChunks(t *testing.T, chunker *Chunker, parts [][]byte) []Chunk {
+	t.Helper()
+	var chunks []Chunk
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return chunks
+		}
+		if errors.Is(err, ErrNeedInput) {
+			if len(parts) == 0 {
+				chunker.Finish()
+			} else {
+				chunker.Append(bytes.NewReader(parts[0]))
+				parts = parts[1:]
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk.Data = slices.Clone(chunk.Data)
+		chunks = append(chunks, chunk)
+	}
+}
+
+func TestChunker_Append(t *testing.T) {
+	data := randBytes(300000, 44)
+	parts := [][]byte{data[:1], data[1:70000], data[70000:70000], data[70000:200001], data[200001:]}
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"merge tail", []Option{WithMergeTail(1000)}},
+		{"max bytes", []Option{WithMaxBytes(250000)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chunker, err := NewChunker(bytes.NewReader(data), 4096, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := collectChunks(t, chunker)
+
+			// Parts appended as they are needed.
+			chunker.Reset(nil)
+			chunker.Append(bytes.NewReader(parts[0]))
+			if got := appendChunks(t, chunker, parts[1:]); !equalChunks(got, want) {
+				t.Errorf("chunks differ when appending parts on demand")
+			}
+
+			// Parts appended up front to an in-memory source, read in
+			// small pieces.
+			chunker.Reset(bytes.NewReader(parts[0]))
+			for _, part := range parts[1:] {
+				chunker.Append(iotest.HalfReader(bytes.NewReader(part)))
+			}
+			chunker.Finish()
+			if got := collectChunks(t, chunker); !equalChunks(got, want) {
+				t.Errorf("chunks differ when appending parts up front")
+			}
+
+			// Reset ends append mode.
+			chunker.Reset(bytes.NewReader(data))
+			if got := collectChunks(t, chunker); !equalChunks(got, want) {
+				t.Errorf("chunks differ after Reset")
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package fastcdc
+
+import (
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+)
+
+// BuffersChunker chunks a list of byte slices as one stream without
+// concatenating them, for data received as segments such as net.Buffers.
+// The gear hash is carried across segment boundaries, so chunks are those
+// of the concatenated data, and each chunk's data is returned as sub-slices
+// of the segments.
+//
+// Only the FastCDC content-defined scan is supported, with its size,
+// normalization, seed, mask, warmup, exact scan, and checksum options.
+type BuffersChunker struct {
+	c    *Chunker
+	bufs [][]byte
+	size int
+
+	// pos is the stream position; seg and segOff locate it in bufs.
+	pos    int
+	seg    int
+	segOff int
+}
+
+// NewBuffersChunker creates a BuffersChunker over bufs, with the average size
+// and options as for NewChunker.
+func NewBuffersChunker(bufs [][]byte, averageSize int, opts ...Option) (*BuffersChunker, error) {
+	c, err := NewChunker(nil, averageSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if c.algorithm != FastCDC || c.gear32 != nil || c.jump != nil || len(c.boundaryHints) > 0 ||
+		c.mergeTail > 0 || c.firstChunkSize > 0 || c.alignment > 0 || c.maxBytes > 0 || c.entropy ||
+		c.progress != nil || c.observer != nil || c.debug {
+		return nil, errors.New("BuffersChunker supports only the FastCDC scan, sizes, normalization, seed, masks, warmup, exact scan, and checksums")
+	}
+	b := &BuffersChunker{c: c, bufs: bufs}
+	for _, buf := range bufs {
+		b.size += len(buf)
+	}
+	return b, nil
+}
+
+// Next returns the next chunk and its data as sub-slices of the segments, or
+// io.EOF when the segments are exhausted. The chunk's Data is nil.
+func (b *BuffersChunker) Next() (Chunk, net.Buffers, error) {
+	if b.pos == b.size {
+		return Chunk{}, nil, io.EOF
+	}
+	length, fp := b.cut()
+	reason := CutContent
+	if length == b.c.maxSize {
+		reason = CutMaxSize
+	} else if length == b.size-b.pos {
+		reason = CutEnd
+	}
+	chunk := Chunk{Offset: b.pos, Length: length, Fingerprint: fp, Cut: reason}
+
+	var data net.Buffers
+	for n := length; n > 0; {
+		buf := b.bufs[b.seg][b.segOff:]
+		if len(buf) == 0 {
+			b.seg, b.segOff = b.seg+1, 0
+			continue
+		}
+		buf = buf[:min(len(buf), n)]
+		data = append(data, buf)
+		if b.c.checksum {
+			chunk.Checksum = crc32.Update(chunk.Checksum, castagnoli, buf)
+		}
+		b.segOff += len(buf)
+		n -= len(buf)
+	}
+	b.pos += length
+	return chunk, data, nil
+}
+
+// cut is Chunker.cut and cutExact over the segments from the current
+// position, hashing one byte at a time. The two-byte scan checks the same
+// positions, and reports fingerprints at even positions shifted left by one.
+func (b *BuffersChunker) cut() (int, uint64) {
+	c := b.c
+	rest := b.size - b.pos
+	if rest <= c.minSize {
+		return rest, 0
+	}
+	if c.minSize == c.maxSize {
+		return c.maxSize, 0
+	}
+	maxBoundary := min(rest, c.maxSize)
+	scanStart, normalizeAt, scanEnd := c.minSize, min(c.normalizeSize, maxBoundary), maxBoundary
+	if !c.exactScan {
+		scanStart, normalizeAt, scanEnd = scanStart&^1, normalizeAt&^1, scanEnd&^1
+	}
+
+	i := max(scanStart-c.warmup, 0)
+	seg, segOff := b.seg, b.segOff+i
+	for seg < len(b.bufs) && segOff >= len(b.bufs[seg]) {
+		segOff -= len(b.bufs[seg])
+		seg++
+	}
+	var fingerprint uint64
+	for ; seg < len(b.bufs) && i < scanEnd; seg, segOff = seg+1, 0 {
+		for _, v := range b.bufs[seg][segOff:min(len(b.bufs[seg]), segOff+scanEnd-i)] {
+			fingerprint = fingerprint<<1 + c.gear[v]
+			if i >= scanStart {
+				mask := c.maskLarge
+				if i < normalizeAt {
+					mask = c.maskSmall
+				}
+				if fingerprint&mask == 0 {
+					if !c.exactScan && i%2 == 0 {
+						return i, fingerprint << 1
+					}
+					return i, fingerprint
+				}
+			}
+			i++
+		}
+	}
+	return maxBoundary, fingerprint
+}
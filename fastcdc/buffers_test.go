@@ -0,0 +1,65 @@
+package fastcdc
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestBuffersChunker(t *testing.T) {
+	data := randBytes(1<<20, 239)
+	rnd := rand.New(rand.NewSource(239))
+	var bufs [][]byte
+	for rest := data; len(rest) > 0; {
+		// Segments from empty to larger than the maximum chunk size.
+		n := min(len(rest), []int{0, 1, 7, 1500, 9000, 70000}[rnd.Intn(6)])
+		bufs = append(bufs, rest[:n])
+		rest = rest[n:]
+	}
+
+	for _, opts := range [][]Option{
+		nil,
+		{WithMinSize(2047), WithNormalization(0), WithChecksum()},
+		{WithSeed(99), WithWarmup(64)},
+		{WithExactScan(), WithMinSize(2047), WithMaxSize(40001)},
+		{WithMaskPair(Mask(15), Mask(11))},
+		{WithFixedSize(5000)},
+	} {
+		chunker, err := NewChunker(bytes.NewReader(data), 8192, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := collectChunks(t, chunker)
+
+		bc, err := NewBuffersChunker(bufs, 8192, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; ; i++ {
+			chunk, segs, err := bc.Next()
+			if err == io.EOF {
+				if i != len(want) {
+					t.Errorf("got %d chunks, want %d", i, len(want))
+				}
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i >= len(want) {
+				t.Fatalf("extra chunk %d at %d", i, chunk.Offset)
+			}
+			chunk.Data = bytes.Join(segs, nil)
+			if w := want[i]; !equalChunks([]Chunk{chunk}, []Chunk{w}) {
+				t.Fatalf("chunk %d = %d/%d/%#x/%v, want %d/%d/%#x/%v", i, chunk.Offset, chunk.Length, chunk.Fingerprint, chunk.Cut, w.Offset, w.Length, w.Fingerprint, w.Cut)
+			}
+		}
+	}
+
+	for _, opt := range []Option{WithAlgorithm(AE), WithMergeTail(100), WithEntropy(), WithBoundaryHints([]int64{5})} {
+		if _, err := NewBuffersChunker(bufs, 8192, opt); err == nil {
+			t.Error("NewBuffersChunker with unsupported option succeeded")
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package fastcdc
+
+import (
+	"os"
+	"strconv"
+)
+
+// CutImpl selects the implementation of the FastCDC boundary scan. All
+// implementations find the same boundaries and fingerprints; they differ
+// only in speed, which depends on the CPU.
+type CutImpl int
+
+const (
+	// CutAuto selects the implementation at init: the one named by the
+	// FASTCDC_CUT environment variable if it names one, else the one
+	// expected to be fastest on this CPU. It is the default.
+	CutAuto CutImpl = iota
+	// CutPortable scans 2 bytes per iteration, as in section 3.7 of the
+	// paper.
+	CutPortable
+	// CutUnroll4 scans 4 bytes per iteration. Configurations whose masks
+	// have any of the top 3 bits set use CutPortable instead.
+	CutUnroll4
+)
+
+func (i CutImpl) String() string {
+	switch i {
+	case CutAuto:
+		return "auto"
+	case CutPortable:
+		return "portable"
+	case CutUnroll4:
+		return "unroll4"
+	}
+	return "CutImpl(" + strconv.Itoa(int(i)) + ")"
+}
+
+// CutImpls lists the implementations other than CutAuto, e.g. to benchmark
+// each of them.
+func CutImpls() []CutImpl {
+	return []CutImpl{CutPortable, CutUnroll4}
+}
+
+// WithCutImpl overrides the implementation of the boundary scan (defaults to
+// CutAuto), e.g. to benchmark implementations or pin one for reproducible
+// performance. It applies to the FastCDC algorithm with the default 2-byte
+// scan only.
+func WithCutImpl(impl CutImpl) Option {
+	return func(o *options) {
+		o.cutImpl = impl
+	}
+}
+
+// autoCutImpl is the implementation selected by CutAuto.
+var autoCutImpl = selectCutImpl(os.Getenv("FASTCDC_CUT"))
+
+// selectCutImpl returns the implementation named by name, or the detected
+// one if name is empty or unknown.
+func selectCutImpl(name string) CutImpl {
+	for _, impl := range CutImpls() {
+		if name == impl.String() {
+			return impl
+		}
+	}
+	return detectCutImpl()
+}
+
+// detectCutImpl returns the implementation expected to be fastest on this
+// CPU. CutUnroll4 was not consistently faster than CutPortable on amd64, the
+// only architecture it has been measured on (see BenchmarkCutImpl), so it is
+// not selected anywhere yet.
+func detectCutImpl() CutImpl {
+	return CutPortable
+}
@@ -0,0 +1,65 @@
+package fastcdc
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestCutImpl(t *testing.T) {
+	data := randBytes(1<<20, 205)
+	var want []Chunk
+	for _, impl := range append([]CutImpl{CutAuto}, CutImpls()...) {
+		chunker, err := NewChunker(bytes.NewReader(data), 4096, WithCutImpl(impl))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := collectChunks(t, chunker)
+		if want == nil {
+			want = got
+		} else if !equalChunks(got, want) {
+			t.Errorf("%v: chunks differ from %v", impl, CutAuto)
+		}
+	}
+
+	if _, err := NewChunker(nil, 4096, WithCutImpl(CutUnroll4+1)); err == nil {
+		t.Error("NewChunker() with unknown CutImpl succeeded")
+	}
+
+	for name, want := range map[string]CutImpl{
+		"portable": CutPortable,
+		"unroll4":  CutUnroll4,
+		"":         detectCutImpl(),
+		"auto":     detectCutImpl(),
+		"simd":     detectCutImpl(),
+	} {
+		if got := selectCutImpl(name); got != want {
+			t.Errorf("selectCutImpl(%q) = %v, want %v", name, got, want)
+		}
+	}
+	if !slices.Contains(CutImpls(), autoCutImpl) {
+		t.Errorf("auto implementation %v is not listed", autoCutImpl)
+	}
+}
+
+func BenchmarkCutImpl(b *testing.B) {
+	data := randBytes(16<<20, 202)
+	for _, avg := range []int{4 << 10, 64 << 10, 1 << 20} {
+		for _, impl := range CutImpls() {
+			c, err := NewChunker(nil, avg, WithCutImpl(impl))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(fmt.Sprintf("%v/%dk", impl, avg>>10), func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				for b.Loop() {
+					for off := 0; off < len(data); {
+						n, _ := c.cutGear(data[off:min(off+c.maxSize, len(data))])
+						off += n
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package fastcdc
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// setReader starts chunking rd. A *bytes.Reader is chunked directly over
+// its data, without copying it into the internal buffer, and advanced past
+// the data chunked. Other in-memory sources such as *bytes.Buffer are read
+// like any other reader, since their data may change under the chunker.
+// Regular files are read with their holes filled in rather than read (see
+// sparseFile), unless readHoles is set.
+func (c *Chunker) setReader(rd io.Reader) {
+	c.reader = rd
+	c.sparse = sparseFile{}
+	if data, ok := c.directBytes(rd); ok {
+		c.buf = data
+		c.bufCursor, c.bufEnd = 0, len(data)
+		c.readerEOF = true
+		c.direct = true
+		if c.observer != nil {
+			c.observer.ObserveRefill(len(data))
+		}
+		return
+	}
+	if f, ok := rd.(*os.File); ok && !c.readHoles && c.sparse.open(f) {
+		c.reader = &c.sparse
+	}
+	c.buf = c.ownBuf
+	c.bufCursor, c.bufEnd = 0, 0
+	c.readerEOF = false
+	c.direct = false
+}
+
+// directBytes returns the unread data of a *bytes.Reader, limited to
+// maxBytes, unless reads are rate limited.
+func (c *Chunker) directBytes(rd io.Reader) ([]byte, bool) {
+	if c.rateLimit > 0 {
+		// The rate limit applies to reads into the buffer.
+		return nil, false
+	}
+	r, ok := rd.(*bytes.Reader)
+	if !ok {
+		return nil, false
+	}
+	// WriteTo hands the unread data to a single Write call. The result is
+	// checked in case that ever changes.
+	pos, n := r.Size()-int64(r.Len()), r.Len()
+	c.capture.b = nil
+	r.WriteTo(&c.capture)
+	data := c.capture.b
+	c.capture.b = nil
+	if len(data) != n {
+		r.Seek(pos, io.SeekStart)
+		return nil, false
+	}
+	if c.maxBytes > 0 && int64(len(data)) > c.maxBytes {
+		data = data[:c.maxBytes]
+	}
+	r.Seek(pos+int64(len(data)), io.SeekStart)
+	return data, true
+}
+
+// sliceWriter records the slice passed to Write.
+type sliceWriter struct {
+	b []byte
+}
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	w.b = p
+	return len(p), nil
+}
@@ -0,0 +1,96 @@
+package fastcdc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestChunker_Direct(t *testing.T) {
+	data := randBytes(300000, 227)
+
+	buffered, err := NewChunker(struct{ io.Reader }{bytes.NewReader(data)}, 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := collectChunks(t, buffered)
+
+	for _, src := range []struct {
+		name string
+		r    io.Reader
+	}{
+		{"bytes.Reader", bytes.NewReader(data)},
+	} {
+		t.Run(src.name, func(t *testing.T) {
+			chunker, err := NewChunker(src.r, 8192)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !chunker.direct || chunker.ownBuf != nil {
+				t.Fatal("chunker does not use the source's data directly")
+			}
+			for i := 0; ; i++ {
+				chunk, err := chunker.Next()
+				if err == io.EOF {
+					if i != len(want) {
+						t.Errorf("got %d chunks, want %d", i, len(want))
+					}
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if i >= len(want) || !equalChunks([]Chunk{chunk}, want[i:i+1]) {
+					t.Fatalf("chunk %d = %d/%d, differs from buffered chunking", i, chunk.Offset, chunk.Length)
+				}
+				if &chunk.Data[0] != &data[chunk.Offset] {
+					t.Fatalf("chunk %d data is a copy", i)
+				}
+			}
+			if chunker.ownBuf != nil {
+				t.Error("chunker allocated a buffer")
+			}
+		})
+	}
+
+	// A bytes.Reader is advanced past the data chunked, honoring MaxBytes.
+	r := bytes.NewReader(data)
+	r.Seek(1000, io.SeekStart)
+	chunker, err := NewChunker(r, 8192, WithMaxBytes(50000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for _, c := range collectChunks(t, chunker) {
+		n += c.Length
+	}
+	if n != 50000 || r.Len() != len(data)-51000 {
+		t.Errorf("chunked %d bytes leaving %d unread, want 50000 leaving %d", n, r.Len(), len(data)-51000)
+	}
+
+	// A bytes.Buffer is drained like any other reader, and chunk data does
+	// not alias it.
+	buf := bytes.NewBuffer(bytes.Clone(data))
+	buffered, err = NewChunker(buf, 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buffered.direct {
+		t.Error("bytes.Buffer chunked in place")
+	}
+	if got := collectChunks(t, buffered); !equalChunks(got, want) || buf.Len() != 0 {
+		t.Errorf("bytes.Buffer chunks differ or %d bytes were left unread", buf.Len())
+	}
+
+	// Reset switches between direct and buffered sources.
+	for _, src := range []io.Reader{struct{ io.Reader }{bytes.NewReader(data)}, bytes.NewReader(data)} {
+		chunker.Reset(src)
+		var n int
+		for _, c := range collectChunks(t, chunker) {
+			n += c.Length
+		}
+		if _, direct := src.(*bytes.Reader); n != 50000 || chunker.direct != direct {
+			t.Errorf("%T: chunked %d bytes with direct %v", src, n, chunker.direct)
+		}
+	}
+}
@@ -7,16 +7,24 @@ package fastcdc
 
 import (
 	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
+	"math"
 	"math/bits"
+	"os"
+	"slices"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	// absoluteMinSize and absoluteMaxSize are just sanity bounds for chunk sizes
 	// to give a helpful error message. The actual limits will be determined by
-	// the AverageSize/Normalization combination.
+	// the AverageSize/Normalization combination. absoluteMaxSize is 64GiB on
+	// 64-bit platforms and 1GiB elsewhere, where larger sizes overflow int.
 	absoluteMinSize = 64
-	absoluteMaxSize = 1 << 30
+	absoluteMaxSize = 1 << (30 + 6*(bits.UintSize/64))
 
 	// Normalization defaults to 2 from testing using Bazel build
 	// artifacts, since it provided the best balance of deduplication
@@ -39,6 +47,10 @@ const (
 	// normalization-3  │  570.18 KB │  176.29 KB │
 
 	defaultNormalization = 2
+
+	// defaultProgressInterval is how many bytes are chunked between progress
+	// callbacks when WithProgress is used without WithProgressInterval.
+	defaultProgressInterval = 64 << 20
 )
 
 type Option func(*options)
@@ -51,9 +63,35 @@ type options struct {
 	disableNormalization bool
 	seed                 uint64
 	bufSize              int
+	progress             func(bytesRead, chunksEmitted int64)
+	progressInterval     int
+	observer             Observer
+	maxEmptyReads        int
+	maxBytes             int64
+	rateLimit            int64
+	readTimeout          time.Duration
+	boundaryHints        []int64
+	skipRanges           []SkipRange
+	entropy              bool
+	checksum             bool
+	debug                bool
+	mergeTail            int
+	firstChunkSize       int
+	alignment            int
+	warmup               int
+	exactScan            bool
+	readHoles            bool
+	maskSmall            uint64
+	maskLarge            uint64
+	algorithm            Algorithm
+	jumpEntries          int
+	gear32               *[256]uint32
+	cutImpl              CutImpl
 }
 
 // WithMinSize overrides the minimum chunk size (defaults to averageSize / 4).
+// The default two-byte scan rounds an odd size down to even; WithExactScan
+// honors it exactly.
 func WithMinSize(size int) Option {
 	return func(o *options) {
 		o.minSize = size
@@ -84,6 +122,30 @@ func WithNormalization(level int) Option {
 	}
 }
 
+// WithFixedSize produces fixed-size chunks of the given size instead of
+// content-defined ones, skipping the gear hash entirely. It is equivalent to
+// setting the same minimum and maximum size, and lets callers compare fixed
+// and content-defined chunking through the same API. The size need not be a
+// power of 2, and the average size and normalization are ignored.
+func WithFixedSize(size int) Option {
+	return func(o *options) {
+		o.minSize = size
+		o.maxSize = size
+	}
+}
+
+// WithMaskPair overrides the masks used before (small) and after (large) the
+// normalization point, e.g. to experiment with bit-selection strategies. A
+// fingerprint matches a mask with probability 2^-n for a mask of n bits, so
+// small must have at least as many bits as large. Bit 63 must be clear in
+// both. The normalization level is ignored.
+func WithMaskPair(small, large uint64) Option {
+	return func(o *options) {
+		o.maskSmall = small
+		o.maskLarge = large
+	}
+}
+
 // WithSeed applies an XOR mask to the global gear tables to prevent fingerprinting
 // attacks that infer content from chunk sizes.
 func WithSeed(seed uint64) Option {
@@ -93,13 +155,207 @@ func WithSeed(seed uint64) Option {
 }
 
 // WithBufferSize sets the read buffer size (defaults to maxSize * 2).
-// Larger buffers reduce read syscalls. Must exceed maxSize.
+// Larger buffers reduce read syscalls. Must exceed maxSize, by at least 7
+// bytes for AE.
 func WithBufferSize(size int) Option {
 	return func(o *options) {
 		o.bufSize = size
 	}
 }
 
+// WithProgress registers a callback that receives the number of bytes chunked
+// and chunks emitted so far. It is called each time another progress interval
+// of bytes has been chunked (see WithProgressInterval) and once more when the
+// stream is exhausted, which makes it suitable for driving progress UIs and
+// watchdog timers on long chunking jobs.
+func WithProgress(fn func(bytesRead, chunksEmitted int64)) Option {
+	return func(o *options) {
+		o.progress = fn
+	}
+}
+
+// WithProgressInterval sets the number of bytes chunked between progress
+// callbacks (defaults to 64MiB). It has no effect without WithProgress.
+func WithProgressInterval(size int) Option {
+	return func(o *options) {
+		o.progressInterval = size
+	}
+}
+
+// Observer receives notifications about chunker activity, e.g. to export
+// metrics. An Observer attached to several chunkers must be safe for
+// concurrent use.
+type Observer interface {
+	// ObserveChunk is called for every chunk emitted with its length.
+	ObserveChunk(length int)
+	// ObserveRefill is called after each read into the internal buffer
+	// with the number of bytes read, or once with the size of a source
+	// chunked without buffering.
+	ObserveRefill(bytesRead int)
+	// ObserveReadError is called when the underlying reader fails.
+	ObserveReadError(err error)
+}
+
+// WithObserver attaches an Observer that is notified of chunks emitted,
+// buffer refills, and reader errors.
+func WithObserver(obs Observer) Option {
+	return func(o *options) {
+		o.observer = obs
+	}
+}
+
+// WithMaxEmptyReads caps the number of consecutive reads that may return no
+// data and a nil error before Next fails with io.ErrNoProgress (defaults to 0,
+// meaning such reads are retried indefinitely).
+func WithMaxEmptyReads(n int) Option {
+	return func(o *options) {
+		o.maxEmptyReads = n
+	}
+}
+
+// WithMaxBytes stops chunking after n bytes have been read, as if the stream
+// ended there (defaults to 0, meaning no limit). The reader is never read past
+// n bytes, so the rest of the stream can be consumed by the caller afterwards,
+// e.g. to chunk one member of a concatenated archive.
+func WithMaxBytes(n int64) Option {
+	return func(o *options) {
+		o.maxBytes = n
+	}
+}
+
+// WithRateLimit throttles reads from the source to about bytesPerSec bytes
+// per second (defaults to 0, meaning no limit), e.g. so that background
+// re-chunking does not starve foreground I/O. Next sleeps after each refill
+// of the buffer for as long as the bytes read take at that rate; time spent
+// elsewhere, e.g. by the caller between calls, is not credited. In-memory
+// sources are then read through the buffer like other sources, so that the
+// limit applies to them too.
+func WithRateLimit(bytesPerSec int64) Option {
+	return func(o *options) {
+		o.rateLimit = bytesPerSec
+	}
+}
+
+// WithReadTimeout bounds how long a call to Next may block reading from a
+// source with a SetReadDeadline method, such as a net.Conn or an *os.File
+// pipe (defaults to 0, meaning no bound). Next sets the read deadline before
+// its first read and clears it before returning. When the deadline passes,
+// Next fails with a *ReadError whose Timeout method reports true; the bytes
+// read so far are kept, so calling Next again resumes waiting. Other sources
+// are not bounded.
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = d
+	}
+}
+
+// WithBoundaryHints forces chunk boundaries at the given stream offsets, e.g.
+// at file boundaries inside a concatenated stream, while content-defined
+// chunking still applies between hints. Offsets are in the same coordinates as
+// Chunk.Offset. Chunks cut at a hint may be shorter than the minimum size.
+func WithBoundaryHints(offsets []int64) Option {
+	return func(o *options) {
+		o.boundaryHints = offsets
+	}
+}
+
+// WithEntropy enables computing Chunk.Entropy, a cheap estimate of each
+// chunk's compressibility. Large chunks are sampled rather than scanned fully.
+func WithEntropy() Option {
+	return func(o *options) {
+		o.entropy = true
+	}
+}
+
+// WithChecksum enables computing Chunk.Checksum, a hardware-accelerated
+// CRC-32C of each chunk for cheap transport integrity checks where a
+// cryptographic digest is unnecessary.
+func WithChecksum() Option {
+	return func(o *options) {
+		o.checksum = true
+	}
+}
+
+// WithMergeTail merges a final chunk shorter than threshold bytes into the
+// previous chunk instead of emitting it separately, which may make that chunk
+// longer than the maximum size (defaults to 0, meaning tails are never
+// merged). The buffer size must be at least maxSize + threshold.
+func WithMergeTail(threshold int) Option {
+	return func(o *options) {
+		o.mergeTail = threshold
+	}
+}
+
+// WithFirstChunkSize cuts the first chunk of every stream at exactly size
+// bytes, or at the end of a shorter stream, so that file headers land in a
+// chunk of their own and volatile header fields do not disturb the chunking
+// of the rest of the file (defaults to 0, meaning the first chunk is content
+// defined). The size must not exceed the maximum chunk size.
+func WithFirstChunkSize(size int) Option {
+	return func(o *options) {
+		o.firstChunkSize = size
+	}
+}
+
+// WithAlignment rounds content-defined cut points down to a multiple of n
+// bytes in Chunk.Offset coordinates, e.g. 4096 for storage backends that want
+// block-aligned chunks, unless that would make the chunk shorter than the
+// minimum size (defaults to 0, meaning no alignment). Chunks ending at the end
+// of the stream, at boundary hints, or at the first chunk size are not
+// aligned.
+func WithAlignment(n int) Option {
+	return func(o *options) {
+		o.alignment = n
+	}
+}
+
+// WithWarmup starts rolling the gear hash w bytes before the minimum size,
+// without allowing cuts there, so that the fingerprint at the first eligible
+// position reflects a full window of context as in the paper's windowed
+// definition (defaults to 0, meaning hashing starts at the minimum size).
+// Windows beyond 64 bytes have no effect, since older bytes are shifted out of
+// the fingerprint. The window must not exceed the minimum size and applies to
+// the FastCDC algorithm only.
+func WithWarmup(w int) Option {
+	return func(o *options) {
+		o.warmup = w
+	}
+}
+
+// WithExactScan scans one byte at a time instead of two, without rounding
+// the scan positions down to even offsets, so that boundaries are identical to
+// the canonical single-byte FastCDC definition used by implementations
+// without the optimization of section 3.7 of the paper. It is somewhat slower
+// and applies to the FastCDC algorithm only.
+func WithExactScan() Option {
+	return func(o *options) {
+		o.exactScan = true
+	}
+}
+
+// WithReadHoles reads the holes of a sparse *os.File source from the file
+// like any other data, instead of finding them with lseek and filling them
+// with zeros. Chunks are the same either way; use it for files whose holes
+// may be filled while they are chunked, or on file systems that report
+// holes unreliably.
+func WithReadHoles() Option {
+	return func(o *options) {
+		o.readHoles = true
+	}
+}
+
+// WithDebug enables checks for misuse of the chunker that are too costly for
+// production. Calls to Next or Reset that overlap another call on the same
+// chunker fail with ErrConcurrentUse instead of silently corrupting its
+// buffer. Chunk data is returned in a copy that is overwritten with a
+// 0xdeadbeef pattern by the next call to Next or Reset, so code that keeps
+// Data past its validity reads obvious garbage.
+func WithDebug() Option {
+	return func(o *options) {
+		o.debug = true
+	}
+}
+
 func (o *options) setDefaults() {
 	if o.minSize == 0 {
 		o.minSize = o.averageSize / 4
@@ -108,30 +364,91 @@ func (o *options) setDefaults() {
 		o.maxSize = o.averageSize * 4
 	}
 	if o.bufSize == 0 {
-		o.bufSize = o.maxSize * 2
+		// Twice maxSize, capped so that it does not overflow int on 32-bit
+		// platforms.
+		o.bufSize = o.maxSize + min(o.maxSize, math.MaxInt-o.maxSize)
 	}
 	if !o.disableNormalization && o.normalization == 0 {
 		o.normalization = defaultNormalization
 	}
+	if o.progressInterval == 0 {
+		o.progressInterval = defaultProgressInterval
+	}
+}
+
+// masks returns the masks used before and after the normalization point.
+func (o *options) masks() (small, large uint64, err error) {
+	if o.maskSmall != 0 || o.maskLarge != 0 {
+		if o.maskSmall == 0 || o.maskLarge == 0 {
+			return 0, 0, errors.New("MaskPair masks must not be zero")
+		}
+		if o.maskSmall>>63 != 0 || o.maskLarge>>63 != 0 {
+			return 0, 0, errors.New("MaskPair masks must not use bit 63")
+		}
+		if bits.OnesCount64(o.maskSmall) < bits.OnesCount64(o.maskLarge) {
+			return 0, 0, errors.New("MaskPair small mask must have at least as many bits as the large mask")
+		}
+		if o.gear32 != nil && (o.maskSmall>>32 != 0 || o.maskLarge>>32 != 0) {
+			return 0, 0, errors.New("MaskPair masks must fit in 32 bits with Gear32")
+		}
+		return o.maskSmall, o.maskLarge, nil
+	}
+	if o.gear32 != nil {
+		smallBits, largeBits, err := o.maskBits()
+		if err != nil {
+			return 0, 0, err
+		}
+		if smallBits > maxMask32Bits {
+			return 0, 0, errors.New("AverageSize/Normalization combination exceeds Gear32 mask bounds")
+		}
+		return uint64(Mask32(smallBits)), uint64(Mask32(largeBits)), nil
+	}
+	if o.algorithm == TTTD {
+		// The backup divisor is half the main one.
+		log2Avg := bits.TrailingZeros(uint(o.averageSize))
+		return Mask(log2Avg), Mask(log2Avg - 1), nil
+	}
+	smallBits, largeBits, err := o.maskBits()
+	if err != nil {
+		return 0, 0, err
+	}
+	return Mask(smallBits), Mask(largeBits), nil
+}
+
+// maskBits returns the number of bits in the masks used before and after the
+// normalization point.
+func (o *options) maskBits() (small, large int, err error) {
+	normalization := o.normalization
+	if o.disableNormalization {
+		normalization = 0
+	}
+	log2Avg := bits.TrailingZeros(uint(o.averageSize))
+	small = log2Avg + normalization
+	large = log2Avg - normalization
+	if small > maxMaskBits || large < 1 {
+		return 0, 0, errors.New("AverageSize/Normalization combination exceeds mask bounds")
+	}
+	return small, large, nil
 }
 
 func (o *options) validate() error {
 	if o.averageSize < absoluteMinSize || o.averageSize > absoluteMaxSize {
-		return errors.New("AverageSize must be in range 64B to 1GiB")
+		return errors.New("AverageSize must be in range 64B to 64GiB (1GiB on 32-bit platforms)")
 	}
 	if o.averageSize <= 0 || (o.averageSize&(o.averageSize-1)) != 0 {
 		return errors.New("AverageSize must be a power of 2")
 	}
 	if o.minSize < absoluteMinSize || o.minSize > absoluteMaxSize {
-		return errors.New("MinSize must be in range 64B to 1GiB")
+		return errors.New("MinSize must be in range 64B to 64GiB (1GiB on 32-bit platforms)")
 	}
 	if o.maxSize < absoluteMinSize || o.maxSize > absoluteMaxSize {
-		return errors.New("MaxSize must be in range 64B to 1GiB")
+		return errors.New("MaxSize must be in range 64B to 64GiB (1GiB on 32-bit platforms)")
 	}
-	if o.maxSize <= o.minSize {
-		return errors.New("MinSize must be less than MaxSize")
+	if o.maxSize < o.minSize {
+		return errors.New("MinSize must not exceed MaxSize")
 	}
-	if o.averageSize > o.maxSize || o.averageSize < o.minSize {
+	fixed := o.minSize == o.maxSize
+	if !fixed && (o.averageSize > o.maxSize || o.averageSize < o.minSize) {
 		return errors.New("AverageSize must be between MinSize and MaxSize")
 	}
 	if !o.disableNormalization && (o.normalization < 0 || o.normalization > 3) {
@@ -140,7 +457,99 @@ func (o *options) validate() error {
 	if o.bufSize <= o.maxSize {
 		return errors.New("BufferSize must be greater than MaxSize")
 	}
-	return nil
+	if o.algorithm < FastCDC || o.algorithm > AE {
+		return errors.New("Algorithm is unknown")
+	}
+	if o.firstChunkSize < 0 || o.firstChunkSize > o.maxSize {
+		return errors.New("FirstChunkSize must be in range 0 to MaxSize")
+	}
+	if o.alignment < 0 || o.alignment > o.maxSize {
+		return errors.New("Alignment must be in range 0 to MaxSize")
+	}
+	if o.warmup < 0 || o.warmup > o.minSize {
+		return errors.New("Warmup must be in range 0 to MinSize")
+	}
+	if o.warmup > 0 && o.algorithm != FastCDC {
+		return errors.New("Warmup requires the FastCDC algorithm")
+	}
+	if o.exactScan && o.algorithm != FastCDC {
+		return errors.New("ExactScan requires the FastCDC algorithm")
+	}
+	if o.gear32 != nil && o.algorithm != FastCDC {
+		return errors.New("Gear32 requires the FastCDC algorithm")
+	}
+	if o.cutImpl < CutAuto || o.cutImpl > CutUnroll4 {
+		return errors.New("CutImpl is unknown")
+	}
+	if o.jumpEntries < 0 {
+		return errors.New("QuickJump entries must not be negative")
+	}
+	if o.mergeTail < 0 || o.mergeTail > o.maxSize {
+		return errors.New("MergeTail must be in range 0 to MaxSize")
+	}
+	if o.bufSize < o.maxSize+o.mergeTail {
+		return errors.New("BufferSize must be at least MaxSize + MergeTail")
+	}
+	if o.algorithm == AE && o.bufSize-o.maxSize < aeLookahead {
+		return errors.New("BufferSize must be at least MaxSize + 7 for AE")
+	}
+	if o.progressInterval < 0 {
+		return errors.New("ProgressInterval must be positive")
+	}
+	if o.maxEmptyReads < 0 {
+		return errors.New("MaxEmptyReads must not be negative")
+	}
+	if o.maxBytes < 0 {
+		return errors.New("MaxBytes must not be negative")
+	}
+	if o.rateLimit < 0 {
+		return errors.New("RateLimit must not be negative")
+	}
+	if o.readTimeout < 0 {
+		return errors.New("ReadTimeout must not be negative")
+	}
+	for _, hint := range o.boundaryHints {
+		if hint < 0 {
+			return errors.New("BoundaryHints must not be negative")
+		}
+	}
+	return validateSkipRanges(sortedSkipRanges(o.skipRanges))
+}
+
+// ErrConcurrentUse is returned by Next in debug mode (see WithDebug) when the
+// chunker is used from several goroutines at once. A Chunker is not safe for
+// concurrent use; use SafeChunker to share one between goroutines.
+var ErrConcurrentUse = errors.New("Chunker used concurrently")
+
+// ReadError is returned by Next when the underlying reader fails. Errors that
+// are not a *ReadError originate from the chunker itself.
+type ReadError struct {
+	// Offset is the stream position of the first byte not yet returned in a
+	// chunk, i.e. where chunking should resume after a retry.
+	Offset int64
+	// BytesRead is the total number of bytes consumed from the reader,
+	// including buffered bytes that were not yet returned in a chunk.
+	BytesRead int64
+	// Err is the error returned by the reader.
+	Err error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("read error at offset %d (%d bytes read): %v", e.Offset, e.BytesRead, e.Err)
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the read timed out, e.g. at the deadline set by
+// WithReadTimeout.
+func (e *ReadError) Timeout() bool {
+	if errors.Is(e.Err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var t interface{ Timeout() bool }
+	return errors.As(e.Err, &t) && t.Timeout()
 }
 
 // Chunk holds the result of a single content-defined chunk.
@@ -149,8 +558,22 @@ type Chunk struct {
 	Length      int    // Size of the chunk in bytes.
 	Data        []byte // Raw chunk bytes. Only valid until the next call to Next.
 	Fingerprint uint64 // Final gear hash value at the chunk boundary.
+
+	// Entropy is the estimated Shannon entropy of Data in bits per byte,
+	// from 0 (constant) to 8 (incompressible). Only set with WithEntropy.
+	Entropy float64
+
+	// Checksum is the CRC-32C (Castagnoli) checksum of Data. Only set with
+	// WithChecksum.
+	Checksum uint32
+
+	// Cut records why the chunk ends where it does.
+	Cut CutReason
 }
 
+// castagnoli is the CRC-32C table used for Chunk.Checksum.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
 // Chunker splits a byte stream into variable-sized chunks using FastCDC 2020.
 type Chunker struct {
 	minSize       int
@@ -164,20 +587,138 @@ type Chunker struct {
 
 	gear        [256]uint64
 	gearShifted [256]uint64
+	gear4       *unroll4Tables // Non-nil if cut4 is used.
 
-	reader io.Reader
+	reader        io.Reader
+	observer      Observer
+	maxEmptyReads int
+	maxBytes      int64
 
+	// rateLimit is the read rate in bytes per second, or 0; rateNext is
+	// when reading may resume at that rate.
+	rateLimit int64
+	rateNext  time.Time
+
+	// readTimeout bounds the reads of one call to Next; deadline is the
+	// reader whose deadline has been set for it, if any.
+	readTimeout time.Duration
+	deadline    readDeadliner
+
+	// buf is ownBuf, allocated on first use, or the data of a direct
+	// source (see setReader).
 	buf       []byte
+	ownBuf    []byte
+	bufSize   int
 	bufCursor int
 	bufEnd    int
 	streamPos int
 	readerEOF bool
+
+	// direct is set when buf is the source's data, which is never read
+	// into or moved. capture receives that data from a bytes.Reader.
+	direct  bool
+	capture sliceWriter
+
+	// sparse reads a regular file source, skipping the holes, unless
+	// readHoles is set.
+	sparse    sparseFile
+	readHoles bool
+
+	// lazy defers refills until the cut scan reaches the end of the
+	// buffered data, so that a refill moves only the bytes of the chunk
+	// being scanned rather than up to maxSize bytes. scanPos and scanFP
+	// hold the position and fingerprint to resume that scan from, with
+	// scanPos 0 meaning a fresh scan.
+	lazy    bool
+	scanPos int
+	scanFP  uint64
+
+	// sources are the readers appended after reader. appending is set by
+	// Append, and finished by Finish; until then, drained is set when the
+	// sources are exhausted rather than readerEOF.
+	sources   []io.Reader
+	appending bool
+	drained   bool
+	finished  bool
+
+	// offsetBase is added to streamPos to report chunk offsets relative to
+	// an enclosing stream, e.g. for section chunkers.
+	offsetBase int
+	// alignBase is the offset in Chunk.Offset coordinates that alignment is
+	// relative to, e.g. the start of a file for ChunkFiles.
+	alignBase int
+
+	// boundaryHints are sorted forced cut points; hintIndex is the first
+	// hint that may still lie ahead of the current position.
+	boundaryHints []int64
+	hintIndex     int
+
+	// skipRanges are the sorted regions excluded from chunking; skipIndex
+	// is the first that may still lie ahead of the current position.
+	skipRanges []SkipRange
+	skipIndex  int
+
+	entropy  bool
+	checksum bool
+
+	// mergeTail is the size below which a final chunk is merged into the
+	// previous one.
+	mergeTail int
+	// lookahead is how many bytes past the maximum size the cut of a chunk
+	// may depend on: the tail to merge, or the values AE compares.
+	lookahead int
+
+	// firstChunkSize is the fixed length of the first chunk of a stream.
+	firstChunkSize int
+
+	// alignment is the multiple cut points are rounded down to.
+	alignment int
+
+	// warmup is the number of bytes hashed before the first cut candidate.
+	warmup int
+
+	// exactScan selects cutExact over cut.
+	exactScan bool
+
+	// algorithm selects the cut function. For TTTD, maskSmall and maskLarge
+	// are the main and backup masks. aeWindow is the AE window size.
+	algorithm Algorithm
+	aeWindow  int
+
+	// jump remembers recent chunks for WithQuickJump, or is nil.
+	jump *jumpTable
+
+	// gear32 is the seeded 32-bit gear table for WithGear32, or nil.
+	gear32 *[256]uint32
+
+	// debug enables misuse detection. busy is set while a call is in
+	// progress; misused records a concurrent Reset so that the next call
+	// to Next fails. lastData is the copy of the previous chunk's data,
+	// poisoned by the next call.
+	debug    bool
+	busy     atomic.Bool
+	misused  atomic.Bool
+	lastData []byte
+
+	progress         func(bytesRead, chunksEmitted int64)
+	progressInterval int
+	progressNext     int
+	progressReported int
+	chunksEmitted    int64
 }
 
 // NewChunker creates a new Chunker with the given average chunk size.
-// The averageSize must be a power of 2 and must be in the range 64B to 1GiB.
+// The averageSize must be a power of 2 and must be in the range 64B to 64GiB
+// (1GiB on 32-bit platforms).
 // High normalization reduces the range of allowed values for average size.
 // Other options have sensible defaults.
+//
+// A *bytes.Reader is chunked in place without copying, and advanced past the
+// data chunked. Chunk data then aliases the slice the reader was created
+// from, which must not change while the chunks are in use; wrap the reader,
+// e.g. in io.MultiReader, to have it copied instead. The holes of a sparse
+// *os.File are not read from disk but chunked as the zeros they read as, on
+// platforms that can find them, unless WithReadHoles is given.
 func NewChunker(rd io.Reader, averageSize int, opts ...Option) (*Chunker, error) {
 	o := &options{averageSize: averageSize}
 	for _, opt := range opts {
@@ -202,20 +743,11 @@ func NewChunker(rd io.Reader, averageSize int, opts ...Option) (*Chunker, error)
 		seedGearShifted = gearShifted
 	}
 
-	normalization := o.normalization
-	if o.disableNormalization {
-		normalization = 0
-	}
-	log2Avg := bits.TrailingZeros(uint(o.averageSize))
-	smallBits := log2Avg + normalization
-	largeBits := log2Avg - normalization
-	if smallBits > 25 || largeBits < 5 {
-		return nil, errors.New("AverageSize/Normalization combination exceeds mask table bounds")
+	maskS, maskL, err := o.masks()
+	if err != nil {
+		return nil, err
 	}
 
-	maskS := masks[smallBits]
-	maskL := masks[largeBits]
-
 	chunker := &Chunker{
 		minSize:          o.minSize,
 		maxSize:          o.maxSize,
@@ -224,28 +756,165 @@ func NewChunker(rd io.Reader, averageSize int, opts ...Option) (*Chunker, error)
 		maskLarge:        maskL,
 		maskSmallShifted: maskS << 1,
 		maskLargeShifted: maskL << 1,
-		reader:           rd,
-		buf:              make([]byte, o.bufSize),
-		bufCursor:        o.bufSize,
-		bufEnd:           o.bufSize,
+		bufSize:          o.bufSize,
 		gear:             seedGear,
 		gearShifted:      seedGearShifted,
+		progress:         o.progress,
+		progressInterval: o.progressInterval,
+		progressNext:     o.progressInterval,
+		progressReported: -1,
+		observer:         o.observer,
+		maxEmptyReads:    o.maxEmptyReads,
+		maxBytes:         o.maxBytes,
+		rateLimit:        o.rateLimit,
+		readTimeout:      o.readTimeout,
+		boundaryHints:    slices.Sorted(slices.Values(o.boundaryHints)),
+		entropy:          o.entropy,
+		checksum:         o.checksum,
+		debug:            o.debug,
+		mergeTail:        o.mergeTail,
+		lookahead:        o.mergeTail,
+		firstChunkSize:   o.firstChunkSize,
+		alignment:        o.alignment,
+		warmup:           o.warmup,
+		exactScan:        o.exactScan,
+		readHoles:        o.readHoles,
+		algorithm:        o.algorithm,
+		aeWindow:         aeWindow(o.averageSize, o.minSize),
+		// Only cut can resume a scan, and quick jumping and tail merging
+		// look ahead of the cut.
+		lazy: o.algorithm == FastCDC && o.gear32 == nil && !o.exactScan && o.jumpEntries == 0 && o.mergeTail == 0,
+	}
+	if len(o.skipRanges) > 0 {
+		chunker.skipRanges = sortedSkipRanges(o.skipRanges)
+		for _, r := range chunker.skipRanges {
+			chunker.boundaryHints = append(chunker.boundaryHints, r.Offset)
+		}
+		slices.Sort(chunker.boundaryHints)
+	}
+	if o.algorithm == AE {
+		chunker.lookahead = max(chunker.lookahead, aeLookahead)
+	}
+	if o.jumpEntries > 0 {
+		chunker.jump = newJumpTable(o.jumpEntries)
+	}
+	cutImpl := o.cutImpl
+	if cutImpl == CutAuto {
+		cutImpl = autoCutImpl
+	}
+	if cutImpl == CutUnroll4 {
+		chunker.gear4 = newUnroll4Tables(&chunker.gear, maskS, maskL)
+	}
+	if o.gear32 != nil {
+		table := *o.gear32
+		for i := range table {
+			table[i] ^= uint32(o.seed)
+		}
+		chunker.gear32 = &table
+	}
+	chunker.setReader(rd)
+
+	return chunker, nil
+}
+
+// NewChunkerForCount creates a Chunker that splits a stream of about size
+// bytes into roughly count chunks. The average size is derived from size and
+// count, rounded to the nearest power of 2 and clamped to what the size limits
+// and normalization level allow; the minimum and maximum sizes default to
+// multiples of it as for NewChunker. Other options are as for NewChunker.
+func NewChunkerForCount(rd io.Reader, size int64, count int, opts ...Option) (*Chunker, error) {
+	if size < 0 {
+		return nil, errors.New("Size must not be negative")
+	}
+	if count <= 0 {
+		return nil, errors.New("Count must be positive")
+	}
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
 	}
+	return NewChunker(rd, o.averageSizeForCount(size, count), opts...)
+}
+
+// averageSizeForCount returns the power of 2 nearest to size/count that is
+// valid with the options, before defaults are applied.
+func (o *options) averageSizeForCount(size int64, count int) int {
+	avg := uint64(size / int64(count))
+	log2Avg := 0
+	if avg > 0 {
+		log2Avg = bits.Len64(avg) - 1
+		if avg-1<<log2Avg > 1<<(log2Avg+1)-avg {
+			log2Avg++
+		}
+	}
+
+	normalization := o.normalization
+	if o.disableNormalization {
+		normalization = 0
+	} else if normalization == 0 {
+		normalization = defaultNormalization
+	}
+	lo := max(bits.TrailingZeros(absoluteMinSize), 1+normalization)
+	hi := min(bits.TrailingZeros(absoluteMaxSize), maxMaskBits-normalization)
+	if o.minSize == 0 {
+		// The default minimum size is a quarter of the average.
+		lo = max(lo, bits.TrailingZeros(absoluteMinSize)+2)
+	} else {
+		lo = max(lo, bits.Len(uint(o.minSize-1)))
+	}
+	if o.maxSize == 0 {
+		// The default maximum size is four times the average.
+		hi = min(hi, bits.TrailingZeros(absoluteMaxSize)-2)
+	} else {
+		hi = min(hi, bits.Len(uint(o.maxSize))-1)
+	}
+	return 1 << min(max(log2Avg, lo), hi)
+}
 
+// NewSectionChunker creates a Chunker over the n bytes of ra starting at
+// offset off. Chunk offsets are absolute positions within ra, which allows
+// re-chunking only a region of a large file. Options are as for NewChunker.
+func NewSectionChunker(ra io.ReaderAt, off, n int64, averageSize int, opts ...Option) (*Chunker, error) {
+	chunker, err := NewChunker(io.NewSectionReader(ra, off, n), averageSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	chunker.offsetBase = int(off)
 	return chunker, nil
 }
 
-// Reset reinitializes the chunker with a new reader.
+// Reset reinitializes the chunker with a new reader. Chunk offsets restart at
+// zero, including for chunkers created by NewSectionChunker. In debug mode, a
+// Reset that overlaps another call is dropped and the next call to Next fails
+// with ErrConcurrentUse.
 func (c *Chunker) Reset(rd io.Reader) {
-	c.reader = rd
-	c.streamPos = 0
-	c.readerEOF = false
+	if c.debug {
+		if !c.busy.CompareAndSwap(false, true) {
+			c.misused.Store(true)
+			return
+		}
+		defer c.busy.Store(false)
+		c.misused.Store(false)
+		c.poisonLastData()
+	}
 
-	// bufCursor indicates the position to read from.
-	// placing it at the end means the buffer is empty
-	// and needs to be filled.
-	c.bufCursor = len(c.buf)
-	c.bufEnd = len(c.buf)
+	c.streamPos = 0
+	c.offsetBase = 0
+	c.alignBase = 0
+	c.hintIndex = 0
+	c.skipIndex = 0
+	c.progressNext = c.progressInterval
+	c.progressReported = -1
+	c.chunksEmitted = 0
+	c.scanPos, c.scanFP = 0, 0
+	c.sources = nil
+	c.appending, c.drained, c.finished = false, false, false
+	if c.jump != nil {
+		// Chunks remembered from the previous stream could otherwise
+		// change where this one is cut.
+		clear(c.jump.entries)
+	}
+	c.setReader(rd)
 }
 
 func (c *Chunker) fillBuffer() error {
@@ -254,52 +923,327 @@ func (c *Chunker) fillBuffer() error {
 	// We know that the maximum chunk we can produce
 	// is c.maxSize, so if we have at least that much
 	// data available, we don't need to read more.
-	if availableToRead >= c.maxSize {
+	// Merging tails needs to see mergeTail bytes
+	// further to tell whether a chunk is followed
+	// by a short tail, and AE reads 8-byte values
+	// starting up to the maximum size.
+	if availableToRead >= c.maxSize+c.lookahead {
+		return nil
+	}
+	if c.lazy && !c.appending && availableToRead > 0 || c.direct {
 		return nil
 	}
+	return c.refill()
+}
 
+// refill moves the unconsumed data to the front of the buffer and reads
+// until the buffer is full or the stream ends.
+func (c *Chunker) refill() error {
+	if c.buf == nil {
+		c.ownBuf = make([]byte, c.bufSize)
+		c.buf = c.ownBuf
+	}
+	availableToRead := c.bufEnd - c.bufCursor
 	_ = copy(c.buf[:availableToRead], c.buf[c.bufCursor:])
 	c.bufCursor = 0
 
-	if c.readerEOF {
+	if c.readerEOF || c.drained {
 		c.bufEnd = availableToRead
 		return nil
 	}
 
-	bytesRead, err := io.ReadFull(c.reader, c.buf[availableToRead:])
+	dst := c.buf[availableToRead:]
+	if c.maxBytes > 0 {
+		remaining := c.maxBytes - int64(c.streamPos+availableToRead)
+		if remaining < int64(len(dst)) {
+			dst = dst[:remaining]
+		}
+	}
+
+	bytesRead, err := c.readSources(dst)
+	if c.observer != nil {
+		c.observer.ObserveRefill(bytesRead)
+	}
+	if c.rateLimit > 0 {
+		c.throttle(bytesRead)
+	}
+	c.bufEnd = availableToRead + bytesRead
+	if err == nil && c.maxBytes > 0 && int64(c.streamPos+c.bufEnd) == c.maxBytes {
+		c.readerEOF = true
+	}
 	if err == io.EOF || err == io.ErrUnexpectedEOF {
-		c.bufEnd = availableToRead + bytesRead
+		if c.appending && !c.finished {
+			// More sources may be appended.
+			c.drained = true
+			return nil
+		}
 		c.readerEOF = true
 		return nil
 	}
-	return err
+	if err != nil {
+		if c.observer != nil {
+			c.observer.ObserveReadError(err)
+		}
+		return &ReadError{
+			Offset:    int64(c.offsetBase + c.streamPos),
+			BytesRead: int64(c.streamPos + c.bufEnd),
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+// throttle sleeps for as long as reading n bytes takes at the rate limit,
+// counting from when the previous read was due or now, whichever is later.
+func (c *Chunker) throttle(n int) {
+	now := time.Now()
+	if c.rateNext.Before(now) {
+		c.rateNext = now
+	}
+	c.rateNext = c.rateNext.Add(time.Duration(float64(n) / float64(c.rateLimit) * float64(time.Second)))
+	time.Sleep(c.rateNext.Sub(now))
+}
+
+// readFull behaves like io.ReadFull, except that reads returning no data and a
+// nil error count towards maxEmptyReads instead of being retried forever.
+func (c *Chunker) readFull(p []byte) (int, error) {
+	n, emptyReads := 0, 0
+	for n < len(p) {
+		nn, err := c.reader.Read(p[n:])
+		n += nn
+		if err != nil {
+			return n, err
+		}
+		if nn > 0 {
+			emptyReads = 0
+			continue
+		}
+		emptyReads++
+		if c.maxEmptyReads > 0 && emptyReads >= c.maxEmptyReads {
+			return n, io.ErrNoProgress
+		}
+	}
+	return n, nil
 }
 
 // Next returns the next chunk, or io.EOF when the stream is exhausted.
 // The chunk's Data slice is only valid until the next call to Next.
+//
+// Next does not allocate, so chunkers reused with Reset run without garbage;
+// only read errors and debug mode, which copies each chunk, allocate.
 func (c *Chunker) Next() (Chunk, error) {
+	if c.debug {
+		if !c.busy.CompareAndSwap(false, true) {
+			return Chunk{}, ErrConcurrentUse
+		}
+		defer c.busy.Store(false)
+		if c.misused.Load() {
+			return Chunk{}, ErrConcurrentUse
+		}
+		c.poisonLastData()
+		chunk, err := c.next()
+		if err == nil {
+			chunk.Data = append([]byte(nil), chunk.Data...)
+			c.lastData = chunk.Data
+		}
+		return chunk, err
+	}
+	return c.next()
+}
+
+// poisonLastData overwrites the data of the previously returned chunk in
+// debug mode.
+func (c *Chunker) poisonLastData() {
+	for i := range c.lastData {
+		c.lastData[i] = poison[i%len(poison)]
+	}
+	c.lastData = nil
+}
+
+var poison = [4]byte{0xde, 0xad, 0xbe, 0xef}
+
+// readDeadliner is a source supporting WithReadTimeout.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// setDeadline sets the read deadline of the reader for a call to Next, once.
+func (c *Chunker) setDeadline() {
+	if c.deadline != nil {
+		return
+	}
+	if r, ok := c.reader.(readDeadliner); ok {
+		r.SetReadDeadline(time.Now().Add(c.readTimeout))
+		c.deadline = r
+	}
+}
+
+// clearDeadline clears the read deadline set for a call to Next.
+func (c *Chunker) clearDeadline() {
+	if c.deadline != nil {
+		c.deadline.SetReadDeadline(time.Time{})
+		c.deadline = nil
+	}
+}
+
+func (c *Chunker) next() (Chunk, error) {
+	if c.readTimeout > 0 {
+		defer c.clearDeadline()
+	}
 	if err := c.fillBuffer(); err != nil {
 		return Chunk{}, err
 	}
-	if c.bufEnd == 0 {
+	if c.drained && c.bufEnd-c.bufCursor < c.maxSize+c.lookahead {
+		// Where the next chunk ends may depend on data not yet appended.
+		return Chunk{}, ErrNeedInput
+	}
+	if c.bufCursor == c.bufEnd {
+		if c.progress != nil && c.progressReported != c.streamPos {
+			c.reportProgress()
+		}
 		return Chunk{}, io.EOF
 	}
+	if c.skipRanges != nil {
+		if n := c.skipLength(); n > 0 {
+			return c.skip(n)
+		}
+	}
+
+	data, hinted := c.window()
 
-	length, fp := c.cut(c.buf[c.bufCursor:c.bufEnd])
+	var (
+		length int
+		fp     uint64
+		reason CutReason
+	)
+	first := c.streamPos == 0 && c.firstChunkSize > 0
+	if first {
+		length = min(len(data), c.firstChunkSize)
+		reason = CutFirstChunk
+	} else {
+		if c.jump != nil {
+			length, fp = c.jump.lookup(data)
+			if length > 0 {
+				reason = CutQuickJump
+			}
+		}
+		if length == 0 {
+			switch c.algorithm {
+			case TTTD:
+				length, fp = c.cutTTTD(data)
+			case AE:
+				length, fp = c.cutAE(data)
+			default:
+				if c.gear32 != nil {
+					length, fp = c.cutGear32(data)
+				} else if c.exactScan {
+					length, fp = c.cutExact(data)
+				} else {
+					length, fp = c.cutGear(data)
+					for c.lazy && length == len(data) && length < c.maxSize && !hinted && !c.readerEOF {
+						// The cut may lie beyond the buffered data.
+						// Refill and resume the scan where it stopped.
+						if length > c.minSize {
+							c.scanPos, c.scanFP = length&^1, fp
+						}
+						if err := c.refill(); err != nil {
+							c.scanPos, c.scanFP = 0, 0
+							return Chunk{}, err
+						}
+						data, hinted = c.window()
+						length, fp = c.cutGear(data)
+					}
+					c.scanPos, c.scanFP = 0, 0
+				}
+			}
+			reason = CutContent
+			if length == c.maxSize {
+				reason = CutMaxSize
+			}
+		}
+		if c.alignment > 0 && length < len(data) {
+			end := c.offsetBase - c.alignBase + c.streamPos + length
+			if aligned := length - end%c.alignment; aligned >= c.minSize && aligned < length {
+				length = aligned
+				reason = CutAlignment
+			}
+		}
+		if c.jump != nil && length < len(data) {
+			c.jump.record(data[:length], fp)
+		}
+	}
+	// Merge a short tail unless a boundary hint or the first chunk cut
+	// separates it.
+	if rest := len(data) - length; c.readerEOF && !first && rest > 0 && rest < c.mergeTail && len(data) == c.bufEnd-c.bufCursor {
+		length += rest
+		reason = CutMergeTail
+	} else if length == len(data) && reason != CutQuickJump {
+		if hinted {
+			reason = CutHint
+		} else if c.readerEOF && reason != CutMaxSize && (!first || length < c.firstChunkSize) {
+			// A chunk of full size keeps its reason, since whether the
+			// stream is known to end there depends on how it was read.
+			reason = CutEnd
+		}
+	}
 
 	chunk := Chunk{
-		Offset:      c.streamPos,
+		Offset:      c.offsetBase + c.streamPos,
 		Length:      length,
 		Data:        c.buf[c.bufCursor : c.bufCursor+length],
 		Fingerprint: fp,
+		Cut:         reason,
+	}
+	if c.entropy {
+		chunk.Entropy = estimateEntropy(chunk.Data)
+	}
+	if c.checksum {
+		chunk.Checksum = crc32.Checksum(chunk.Data, castagnoli)
 	}
 
 	c.bufCursor += length
 	c.streamPos += length
+	c.chunksEmitted++
+
+	if c.observer != nil {
+		c.observer.ObserveChunk(length)
+	}
+	if c.progress != nil && c.streamPos >= c.progressNext {
+		c.progressNext = c.streamPos - c.streamPos%c.progressInterval + c.progressInterval
+		c.reportProgress()
+	}
 
 	return chunk, nil
 }
 
+// window returns the buffered data the next chunk is cut from, trimmed to the
+// next boundary hint, and whether it was trimmed.
+func (c *Chunker) window() ([]byte, bool) {
+	data := c.buf[c.bufCursor:c.bufEnd]
+	if hint := c.nextHint(); hint > 0 && hint < len(data) {
+		return data[:hint], true
+	}
+	return data, false
+}
+
+// nextHint returns the distance from the current position to the next
+// boundary hint, or 0 if there is none.
+func (c *Chunker) nextHint() int {
+	pos := int64(c.offsetBase + c.streamPos)
+	for c.hintIndex < len(c.boundaryHints) {
+		if hint := c.boundaryHints[c.hintIndex]; hint > pos {
+			return int(hint - pos)
+		}
+		c.hintIndex++
+	}
+	return 0
+}
+
+func (c *Chunker) reportProgress() {
+	c.progressReported = c.streamPos
+	c.progress(int64(c.streamPos), c.chunksEmitted)
+}
+
 func (c *Chunker) cut(data []byte) (int, uint64) {
 	localGear := c.gear
 	localGearShifted := c.gearShifted
@@ -308,6 +1252,10 @@ func (c *Chunker) cut(data []byte) (int, uint64) {
 	if dataLen <= c.minSize {
 		return dataLen, 0
 	}
+	if c.minSize == c.maxSize {
+		// Fixed-size chunking.
+		return c.maxSize, 0
+	}
 
 	maxBoundary := dataLen
 	if maxBoundary > c.maxSize {
@@ -326,6 +1274,18 @@ func (c *Chunker) cut(data []byte) (int, uint64) {
 	scanEnd := maxBoundary &^ 1
 
 	var fingerprint uint64
+	if c.scanPos > 0 {
+		// Resume a scan interrupted by a refill.
+		scanStart, fingerprint = c.scanPos, c.scanFP
+	} else {
+		for i := max(scanStart-c.warmup, 0); i < scanStart; i++ {
+			fingerprint = (fingerprint << 1) + localGear[data[i]]
+		}
+	}
+
+	// Each position is tested with its own branch. Cuts are rare, so the
+	// branches predict well, and testing a pair with a single branch is
+	// slower (see BenchmarkCut).
 
 	// Use smaller mask (harder to match) until normalize point
 	for i := scanStart; i < normalizeAt; i += 2 {
@@ -340,7 +1300,7 @@ func (c *Chunker) cut(data []byte) (int, uint64) {
 	}
 
 	// Use larger mask (easier to match) after normalize point
-	for i := normalizeAt; i < scanEnd; i += 2 {
+	for i := max(normalizeAt, scanStart); i < scanEnd; i += 2 {
 		fingerprint = (fingerprint << 2) + localGearShifted[data[i]]
 		if (fingerprint & c.maskLargeShifted) == 0 {
 			return i, fingerprint
@@ -354,6 +1314,101 @@ func (c *Chunker) cut(data []byte) (int, uint64) {
 	return maxBoundary, fingerprint
 }
 
+// cutExact is cut scanning one byte at a time.
+func (c *Chunker) cutExact(data []byte) (int, uint64) {
+	localGear := c.gear
+
+	dataLen := len(data)
+	if dataLen <= c.minSize {
+		return dataLen, 0
+	}
+	if c.minSize == c.maxSize {
+		return c.maxSize, 0
+	}
+	maxBoundary := min(dataLen, c.maxSize)
+	normalizeBoundary := min(c.normalizeSize, maxBoundary)
+
+	var fingerprint uint64
+	for i := max(c.minSize-c.warmup, 0); i < c.minSize; i++ {
+		fingerprint = (fingerprint << 1) + localGear[data[i]]
+	}
+	i := c.minSize
+	for ; i < normalizeBoundary; i++ {
+		fingerprint = (fingerprint << 1) + localGear[data[i]]
+		if fingerprint&c.maskSmall == 0 {
+			return i, fingerprint
+		}
+	}
+	for ; i < maxBoundary; i++ {
+		fingerprint = (fingerprint << 1) + localGear[data[i]]
+		if fingerprint&c.maskLarge == 0 {
+			return i, fingerprint
+		}
+	}
+	return maxBoundary, fingerprint
+}
+
+// entropySampleSize bounds the number of bytes examined by estimateEntropy.
+const entropySampleSize = 64 << 10
+
+// estimateEntropy returns the Shannon entropy of the byte distribution of
+// data in bits per byte. Data larger than entropySampleSize is sampled at
+// evenly spaced positions.
+func estimateEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	stride := 1
+	if len(data) > entropySampleSize {
+		stride = len(data) / entropySampleSize
+	}
+	var counts [256]int
+	var n int
+	for i := 0; i < len(data); i += stride {
+		counts[data[i]]++
+		n++
+	}
+	var entropy float64
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / float64(n)
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+const (
+	// maskSpan is the number of low bits generated masks spread their bits
+	// over. Fingerprint bit i depends on the last i+1 bytes, so this is the
+	// window of bytes that determines a cut, matching the published masks.
+	maskSpan = 48
+
+	// maxMaskBits is the largest number of bits Mask supports, one per bit
+	// of the span.
+	maxMaskBits = maskSpan
+)
+
+// Mask returns the chunking mask with the given number of bits, from 1 to 48.
+// A fingerprint matches the mask, ending a chunk, with probability 2^-n on
+// random data. For 5 to 25 bits this is the published mask from the FastCDC
+// 2020 paper, which keeps boundaries compatible with other implementations.
+// Other masks spread their bits evenly over the low 48 bits of the
+// fingerprint, placing bit i of n at position floor((2i+1) * 48 / 2n).
+func Mask(n int) uint64 {
+	if n >= 5 && n <= 25 {
+		return masks[n]
+	}
+	if n < 1 || n > maxMaskBits {
+		panic(fmt.Sprintf("fastcdc: mask bits %d out of range", n))
+	}
+	var mask uint64
+	for i := range n {
+		mask |= 1 << ((2*i + 1) * maskSpan / (2 * n))
+	}
+	return mask
+}
+
 // masks holds the normalized chunking masks from the FastCDC 2020 paper (Table II).
 // Index corresponds to log2(chunk_size), e.g., masks[13] is for 8KB chunks.
 var masks = [26]uint64{
@@ -453,6 +1508,12 @@ var gear = [256]uint64{
 	0x8e3e4221d3614413, 0xef14d0d86bf1a22c, 0xe1d830d3f16c5ddb, 0xaabd2b2a451504e1,
 }
 
+// Gear returns the gear table of the FastCDC 2020 paper, used to hash bytes
+// when no seed is set. A seed is XORed into every entry.
+func Gear() [256]uint64 {
+	return gear
+}
+
 // gearShifted is gear with each value left-shifted by 1 for the 2-byte optimization.
 var gearShifted [256]uint64
 
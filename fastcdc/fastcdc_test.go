@@ -1,13 +1,23 @@
 package fastcdc
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
+	"math/bits"
 	"math/rand"
+	"net"
 	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 )
 
 // Ref: https://github.com/bazelbuild/remote-apis/commit/de5501d284d7792ab9e5469b488ecaba341122a3
@@ -525,6 +535,870 @@ func TestChunker_EdgeCases(t *testing.T) {
 	})
 }
 
+func TestChunker_Progress(t *testing.T) {
+	data := randBytes(100000, 13)
+
+	type report struct {
+		bytesRead     int64
+		chunksEmitted int64
+	}
+	var reports []report
+	chunker, err := NewChunker(bytes.NewReader(data), 1024,
+		WithProgress(func(bytesRead, chunksEmitted int64) {
+			reports = append(reports, report{bytesRead, chunksEmitted})
+		}),
+		WithProgressInterval(10000),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nchunks int64
+	for {
+		_, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		nchunks++
+	}
+	// Further calls after EOF must not report again.
+	if _, err := chunker.Next(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+
+	if len(reports) != 10 {
+		t.Fatalf("expected 10 progress reports, got %d: %v", len(reports), reports)
+	}
+	for i, r := range reports {
+		if r.bytesRead < int64(i+1)*10000 && i != len(reports)-1 {
+			t.Errorf("report %d: bytesRead %d below interval threshold", i, r.bytesRead)
+		}
+		if i > 0 && r.bytesRead <= reports[i-1].bytesRead {
+			t.Errorf("report %d: bytesRead %d did not increase", i, r.bytesRead)
+		}
+	}
+	last := reports[len(reports)-1]
+	if last.bytesRead != int64(len(data)) || last.chunksEmitted != nchunks {
+		t.Errorf("final report = %+v, want {%d %d}", last, len(data), nchunks)
+	}
+}
+
+func TestChunker_ReadError(t *testing.T) {
+	data := randBytes(50000, 21)
+	errRead := errors.New("connection reset")
+	r := io.MultiReader(bytes.NewReader(data[:20000]), &errReader{errRead})
+
+	chunker, err := NewChunker(r, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var emitted int
+	for {
+		chunk, err := chunker.Next()
+		if err == nil {
+			emitted += chunk.Length
+			continue
+		}
+		if !errors.Is(err, errRead) {
+			t.Fatalf("expected wrapped reader error, got %v", err)
+		}
+		var readErr *ReadError
+		if !errors.As(err, &readErr) {
+			t.Fatalf("expected *ReadError, got %T", err)
+		}
+		if readErr.Offset != int64(emitted) {
+			t.Errorf("Offset = %d, want %d", readErr.Offset, emitted)
+		}
+		if readErr.BytesRead != 20000 {
+			t.Errorf("BytesRead = %d, want 20000", readErr.BytesRead)
+		}
+		break
+	}
+}
+
+func TestChunker_EmptyReads(t *testing.T) {
+	data := randBytes(50000, 31)
+
+	chunker, err := NewChunker(bytes.NewReader(data), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := chunkLengths(t, chunker)
+
+	t.Run("retried", func(t *testing.T) {
+		chunker, err := NewChunker(&stutterReader{data: data}, 1024, WithMaxEmptyReads(2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := chunkLengths(t, chunker)
+		if len(got) != len(want) {
+			t.Fatalf("chunk count differs: %d vs %d", len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("chunk %d length differs: %d vs %d", i, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("capped", func(t *testing.T) {
+		r := io.MultiReader(bytes.NewReader(data[:100]), &stutterReader{})
+		chunker, err := NewChunker(r, 1024, WithMaxEmptyReads(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = chunker.Next()
+		if !errors.Is(err, io.ErrNoProgress) {
+			t.Fatalf("expected io.ErrNoProgress, got %v", err)
+		}
+		var readErr *ReadError
+		if !errors.As(err, &readErr) || readErr.BytesRead != 100 {
+			t.Errorf("expected *ReadError with 100 bytes read, got %v", err)
+		}
+	})
+}
+
+func TestChunker_MaxBytes(t *testing.T) {
+	data := randBytes(50000, 41)
+
+	chunker, err := NewChunker(bytes.NewReader(data[:30000]), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := chunkLengths(t, chunker)
+
+	r := bytes.NewReader(data)
+	chunker, err = NewChunker(r, 1024, WithMaxBytes(30000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := chunkLengths(t, chunker)
+	if len(got) != len(want) {
+		t.Fatalf("chunk count differs: %d vs %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("chunk %d length differs: %d vs %d", i, got[i], want[i])
+		}
+	}
+	if r.Len() != 20000 {
+		t.Errorf("reader consumed past limit: %d bytes left, want 20000", r.Len())
+	}
+
+	// The limit applies again after Reset.
+	chunker.Reset(r)
+	var total int
+	for _, length := range chunkLengths(t, chunker) {
+		total += length
+	}
+	if total != 20000 {
+		t.Errorf("expected 20000 bytes after Reset, got %d", total)
+	}
+}
+
+func TestChunker_RateLimit(t *testing.T) {
+	data := randBytes(128<<10, 42)
+
+	chunker, err := NewChunker(bytes.NewReader(data), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := chunkLengths(t, chunker)
+
+	// 128KiB at 1MiB/s takes 125ms.
+	start := time.Now()
+	chunker, err = NewChunker(bytes.NewReader(data), 1024, WithRateLimit(1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chunkLengths(t, chunker); !slices.Equal(got, want) {
+		t.Errorf("lengths with rate limit = %v, want %v", got, want)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("chunking took %v, want at least 125ms", elapsed)
+	}
+
+	if _, err := NewChunker(nil, 1024, WithRateLimit(-1)); err == nil {
+		t.Error("NewChunker() with negative rate limit succeeded")
+	}
+}
+
+func TestChunker_ReadTimeout(t *testing.T) {
+	data := randBytes(100000, 43)
+	chunker, err := NewChunker(bytes.NewReader(data), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := chunkLengths(t, chunker)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	resume := make(chan struct{})
+	go func() {
+		defer server.Close()
+		server.Write(data[:50000])
+		<-resume
+		server.Write(data[50000:])
+	}()
+
+	chunker, err = NewChunker(client, 1024, WithReadTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	var offset int
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		var re *ReadError
+		if errors.As(err, &re) && re.Timeout() {
+			if resume == nil {
+				t.Fatalf("second timeout: %v", err)
+			}
+			if re.Offset != int64(offset) {
+				t.Errorf("timeout at offset %d, want %d", re.Offset, offset)
+			}
+			close(resume)
+			resume = nil
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, chunk.Length)
+		offset += chunk.Length
+	}
+	if resume != nil {
+		t.Error("Next did not time out")
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("lengths after timeout = %v, want %v", got, want)
+	}
+}
+
+func TestSectionChunker(t *testing.T) {
+	data := randBytes(50000, 51)
+	const off, n = 12345, 30000
+
+	chunker, err := NewSectionChunker(bytes.NewReader(data), off, n, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pos := off
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk.Offset != pos {
+			t.Fatalf("chunk offset = %d, want %d", chunk.Offset, pos)
+		}
+		if !bytes.Equal(chunk.Data, data[chunk.Offset:chunk.Offset+chunk.Length]) {
+			t.Fatalf("chunk at %d does not match the underlying data", chunk.Offset)
+		}
+		pos += chunk.Length
+	}
+	if pos != off+n {
+		t.Errorf("chunked up to %d, want %d", pos, off+n)
+	}
+}
+
+func TestChunker_BoundaryHints(t *testing.T) {
+	data := randBytes(100000, 61)
+	hints := []int64{70000, 100, 33333, 33334, 5000, 200000}
+
+	chunker, err := NewChunker(bytes.NewReader(data), 4096, WithBoundaryHints(hints))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	boundaries := map[int64]bool{}
+	var total int
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk.Length > 16384 {
+			t.Errorf("chunk at %d exceeds max size: %d", chunk.Offset, chunk.Length)
+		}
+		total += chunk.Length
+		boundaries[int64(chunk.Offset+chunk.Length)] = true
+	}
+	if total != len(data) {
+		t.Errorf("expected %d bytes, got %d", len(data), total)
+	}
+	for _, hint := range hints {
+		if hint < int64(len(data)) && !boundaries[hint] {
+			t.Errorf("no boundary at hint %d", hint)
+		}
+	}
+}
+
+func TestChunker_Entropy(t *testing.T) {
+	random := randBytes(20000, 71)
+	text := bytes.Repeat([]byte("abcd"), 5000)
+	zeros := make([]byte, 200000)
+
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		min, max float64
+	}{
+		{"random", random, 7.5, 8},
+		{"four symbols", text, 1.99, 2.01},
+		{"zeros", zeros, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chunker, err := NewChunker(bytes.NewReader(tc.data), 16384, WithEntropy())
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunk, err := chunker.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chunk.Entropy < tc.min || chunk.Entropy > tc.max {
+				t.Errorf("Entropy = %f, want in [%f, %f]", chunk.Entropy, tc.min, tc.max)
+			}
+		})
+	}
+
+	chunker, err := NewChunker(bytes.NewReader(random), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk, err := chunker.Next(); err != nil || chunk.Entropy != 0 {
+		t.Errorf("Entropy = %f without WithEntropy, err %v", chunk.Entropy, err)
+	}
+}
+
+func TestChunker_Checksum(t *testing.T) {
+	data := randBytes(100000, 221)
+	chunker, err := NewChunker(bytes.NewReader(data), 4096, WithChecksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := crc32.MakeTable(crc32.Castagnoli)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := crc32.Checksum(chunk.Data, table); chunk.Checksum != want {
+			t.Errorf("chunk at %d: Checksum = %#x, want %#x", chunk.Offset, chunk.Checksum, want)
+		}
+	}
+
+	chunker, err = NewChunker(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk, err := chunker.Next(); err != nil || chunk.Checksum != 0 {
+		t.Errorf("Checksum = %#x without WithChecksum, err %v", chunk.Checksum, err)
+	}
+}
+
+func TestChunker_FixedSize(t *testing.T) {
+	data := randBytes(100000, 81)
+
+	for _, opts := range [][]Option{
+		{WithFixedSize(3000)},
+		{WithMinSize(3000), WithMaxSize(3000)},
+	} {
+		chunker, err := NewChunker(bytes.NewReader(data), 8192, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lengths := chunkLengths(t, chunker)
+		if len(lengths) != 34 {
+			t.Fatalf("got %d chunks, want 34", len(lengths))
+		}
+		for i, length := range lengths[:33] {
+			if length != 3000 {
+				t.Errorf("chunk %d has length %d, want 3000", i, length)
+			}
+		}
+		if last := lengths[33]; last != 1000 {
+			t.Errorf("last chunk has length %d, want 1000", last)
+		}
+	}
+
+	if _, err := NewChunker(nil, 8192, WithFixedSize(10)); err == nil {
+		t.Error("NewChunker() with fixed size below 64B succeeded")
+	}
+}
+
+func TestChunker_MergeTail(t *testing.T) {
+	data := randBytes(100000, 91)
+	chunker, err := NewChunker(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := chunkLengths(t, chunker)
+	last := want[len(want)-1]
+
+	// A threshold above the tail length merges it into the previous chunk.
+	chunker, err = NewChunker(bytes.NewReader(data), 4096, WithMergeTail(last+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := chunkLengths(t, chunker)
+	merged := append(slices.Clone(want[:len(want)-2]), want[len(want)-2]+last)
+	if !slices.Equal(got, merged) {
+		t.Errorf("lengths with merged tail = %v, want %v", got, merged)
+	}
+
+	// A threshold at the tail length keeps it.
+	chunker, err = NewChunker(bytes.NewReader(data), 4096, WithMergeTail(last))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chunkLengths(t, chunker); !slices.Equal(got, want) {
+		t.Errorf("lengths = %v, want %v", got, want)
+	}
+
+	// The tail is merged across buffer refills, with small reads.
+	chunker, err = NewChunker(&stutterReader{data: data}, 4096, WithMergeTail(last+1), WithBufferSize(16384+last+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chunkLengths(t, chunker); !slices.Equal(got, merged) {
+		t.Errorf("lengths with stuttering reader = %v, want %v", got, merged)
+	}
+
+	for _, opts := range [][]Option{
+		{WithMergeTail(-1)},
+		{WithMergeTail(20000)},
+		{WithMergeTail(1000), WithBufferSize(16385)},
+	} {
+		if _, err := NewChunker(nil, 4096, opts...); err == nil {
+			t.Errorf("NewChunker() with invalid merge tail options succeeded")
+		}
+	}
+}
+
+func TestChunker_FirstChunkSize(t *testing.T) {
+	data := randBytes(100000, 101)
+	// A header that differs between versions of a file.
+	edited := slices.Clone(data)
+	copy(edited, "new header")
+
+	chunk := func(data []byte) []int {
+		chunker, err := NewChunker(bytes.NewReader(data), 4096, WithFirstChunkSize(300), WithMergeTail(1000))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chunkLengths(t, chunker)
+	}
+	got := chunk(data)
+	if got[0] != 300 {
+		t.Errorf("first chunk has length %d, want 300", got[0])
+	}
+	if !slices.Equal(chunk(edited), got) {
+		t.Error("editing the header changed the chunking")
+	}
+	if got := chunk(data[:200]); !slices.Equal(got, []int{200}) {
+		t.Errorf("lengths of short stream = %v, want [200]", got)
+	}
+	if got := chunk(data[:500]); !slices.Equal(got, []int{300, 200}) {
+		t.Errorf("tail merged into first chunk: %v, want [300 200]", got)
+	}
+
+	if _, err := NewChunker(nil, 4096, WithFirstChunkSize(20000)); err == nil {
+		t.Error("NewChunker() with first chunk size above max size succeeded")
+	}
+}
+
+func TestChunker_Alignment(t *testing.T) {
+	data := randBytes(200000, 111)
+	chunker, err := NewChunker(bytes.NewReader(data), 8192, WithAlignment(1024), WithMinSize(2048))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lengths := chunkLengths(t, chunker)
+	var offset int
+	for i, length := range lengths {
+		offset += length
+		if i < len(lengths)-1 && offset%1024 != 0 {
+			t.Errorf("chunk %d ends at %d, want a multiple of 1024", i, offset)
+		}
+		if i < len(lengths)-1 && length < 2048 {
+			t.Errorf("chunk %d has length %d, below min size", i, length)
+		}
+	}
+	if offset != len(data) {
+		t.Errorf("chunks cover %d bytes, want %d", offset, len(data))
+	}
+
+	// Section chunkers align to positions in the underlying file.
+	chunker, err = NewSectionChunker(bytes.NewReader(data), 1000, 100000, 8192, WithAlignment(1024), WithMinSize(2048))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk, err := chunker.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end := chunk.Offset + chunk.Length; end%1024 != 0 {
+		t.Errorf("first section chunk ends at %d, want a multiple of 1024", end)
+	}
+
+	if _, err := NewChunker(nil, 8192, WithAlignment(-1)); err == nil {
+		t.Error("NewChunker() with negative alignment succeeded")
+	}
+}
+
+func TestChunkerForCount(t *testing.T) {
+	for _, tc := range []struct {
+		size  int64
+		count int
+		opts  []Option
+		want  int
+	}{
+		{1 << 20, 64, nil, 16384},
+		{1 << 20, 50, nil, 16384},
+		{1 << 20, 40, nil, 32768},
+		{100, 10, nil, 256},
+		{100, 10, []Option{WithNormalization(0), WithMinSize(64)}, 64},
+		{100, 10, []Option{WithNormalization(3), WithMinSize(64)}, 64},
+		{0, 1, nil, 256},
+		{1 << 40, 1, []Option{WithNormalization(0)}, absoluteMaxSize / 4},
+		{1 << 40, 1, []Option{WithMaxSize(1 << 30)}, 1 << 30},
+		{1 << 40, 1, []Option{WithMaxSize(3 << 20)}, 2 << 20},
+		{1 << 10, 1, []Option{WithMinSize(3 << 10)}, 4 << 10},
+	} {
+		o := &options{}
+		for _, opt := range tc.opts {
+			opt(o)
+		}
+		if got := o.averageSizeForCount(tc.size, tc.count); got != tc.want {
+			t.Errorf("averageSizeForCount(%d, %d) = %d, want %d", tc.size, tc.count, got, tc.want)
+		}
+	}
+
+	data := randBytes(1<<20, 121)
+	chunker, err := NewChunkerForCount(bytes.NewReader(data), int64(len(data)), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(chunkLengths(t, chunker)); n < 48 || n > 80 {
+		t.Errorf("got %d chunks, want about 64", n)
+	}
+	if _, err := NewChunkerForCount(nil, 100, 10); err != nil {
+		t.Errorf("NewChunkerForCount() for tiny input failed: %v", err)
+	}
+	if _, err := NewChunkerForCount(nil, 100, 0); err == nil {
+		t.Error("NewChunkerForCount() with zero count succeeded")
+	}
+}
+
+func TestMask(t *testing.T) {
+	for n := 1; n <= maxMaskBits; n++ {
+		mask := Mask(n)
+		if got := bits.OnesCount64(mask); got != n {
+			t.Errorf("Mask(%d) = %#x has %d bits", n, mask, got)
+		}
+		if mask>>maskSpan != 0 {
+			t.Errorf("Mask(%d) = %#x exceeds the %d-bit span", n, mask, maskSpan)
+		}
+	}
+	if Mask(13) != 0x0000d90303530000 {
+		t.Errorf("Mask(13) = %#x, want the published 8KB mask", Mask(13))
+	}
+
+	// Large averages and normalization levels beyond the published table.
+	for _, tc := range []struct {
+		averageSize int
+		opts        []Option
+	}{
+		{64, []Option{WithNormalization(3), WithMinSize(64), WithMaxSize(256)}},
+		{64 << 20, []Option{WithNormalization(3)}},
+		{256 << 20, nil},
+	} {
+		if _, err := NewChunker(nil, tc.averageSize, tc.opts...); err != nil {
+			t.Errorf("NewChunker(%d) failed: %v", tc.averageSize, err)
+		}
+	}
+
+	data := randBytes(1<<20, 141)
+	chunker, err := NewChunker(bytes.NewReader(data), 128, WithNormalization(3), WithMinSize(64), WithMaxSize(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lengths := chunkLengths(t, chunker)
+	if mean := len(data) / len(lengths); mean < 100 || mean > 200 {
+		t.Errorf("mean chunk size = %d, want about 128", mean)
+	}
+}
+
+func TestChunker_MaskPair(t *testing.T) {
+	data := randBytes(200000, 151)
+
+	// The published masks reproduce the default chunking.
+	chunker, err := NewChunker(bytes.NewReader(data), 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := chunkLengths(t, chunker)
+	chunker, err = NewChunker(bytes.NewReader(data), 8192, WithMaskPair(Mask(15), Mask(11)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chunkLengths(t, chunker); !slices.Equal(got, want) {
+		t.Errorf("lengths with published mask pair = %v, want %v", got, want)
+	}
+
+	// Low-bit masks of the same popcount give similar sizes.
+	chunker, err = NewChunker(bytes.NewReader(data), 8192, WithMaskPair(1<<15-1, 1<<11-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(chunkLengths(t, chunker)); n < len(want)/2 || n > len(want)*2 {
+		t.Errorf("got %d chunks with low-bit masks, want about %d", n, len(want))
+	}
+
+	for _, pair := range [][2]uint64{{0, 1}, {1 << 63, 1}, {1, 3}} {
+		if _, err := NewChunker(nil, 8192, WithMaskPair(pair[0], pair[1])); err == nil {
+			t.Errorf("NewChunker() with mask pair %#x succeeded", pair)
+		}
+	}
+}
+
+func TestChunker_Warmup(t *testing.T) {
+	data := randBytes(200000, 201)
+
+	// A zero window leaves the chunking unchanged.
+	chunker, err := NewChunker(bytes.NewReader(data), 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := chunkLengths(t, chunker)
+	chunker, err = NewChunker(bytes.NewReader(data), 8192, WithWarmup(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chunkLengths(t, chunker); !slices.Equal(got, want) {
+		t.Errorf("lengths with zero warmup = %v, want %v", got, want)
+	}
+
+	// With a single high mask bit the first chunk ends within a few bytes of
+	// the minimum size, so its fingerprint depends on the bytes just before
+	// the minimum size only if they are hashed.
+	first := func(data []byte, opts ...Option) Chunk {
+		opts = append([]Option{WithMinSize(2048), WithMaskPair(1<<62, 1<<62)}, opts...)
+		chunker, err := NewChunker(bytes.NewReader(data), 8192, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk, err := chunker.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chunk
+	}
+	modified := slices.Clone(data)
+	modified[2048-10]++
+	if a, b := first(data), first(modified); a.Length != b.Length || a.Fingerprint != b.Fingerprint {
+		t.Errorf("first chunk changed without warmup: %d/%#x, %d/%#x", a.Length, a.Fingerprint, b.Length, b.Fingerprint)
+	}
+	if a, b := first(data, WithWarmup(64)), first(modified, WithWarmup(64)); a.Length == b.Length && a.Fingerprint == b.Fingerprint {
+		t.Errorf("first chunk unchanged with warmup: %d/%#x", a.Length, a.Fingerprint)
+	}
+
+	for _, opts := range [][]Option{
+		{WithWarmup(-1)},
+		{WithWarmup(4096), WithMinSize(2048)},
+		{WithWarmup(64), WithAlgorithm(AE)},
+	} {
+		if _, err := NewChunker(nil, 8192, opts...); err == nil {
+			t.Errorf("NewChunker() with invalid warmup succeeded")
+		}
+	}
+}
+
+func TestChunker_ExactScan(t *testing.T) {
+	data := randBytes(1<<20, 211)
+
+	// reference is the canonical single-byte FastCDC loop.
+	reference := func(data []byte, minSize, avgSize, maxSize int, maskS, maskL uint64) []int {
+		var lengths []int
+		for len(data) > 0 {
+			n := len(data)
+			if n > minSize {
+				n = min(n, maxSize)
+				var fp uint64
+				for i := minSize; i < n; i++ {
+					fp = fp<<1 + gear[data[i]]
+					mask := maskL
+					if i < avgSize {
+						mask = maskS
+					}
+					if fp&mask == 0 {
+						n = i
+						break
+					}
+				}
+			}
+			lengths = append(lengths, n)
+			data = data[n:]
+		}
+		return lengths
+	}
+
+	// Odd sizes would be rounded down by the 2-byte scan.
+	chunker, err := NewChunker(bytes.NewReader(data), 8192, WithMinSize(2047), WithMaxSize(65535), WithExactScan())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := chunkLengths(t, chunker)
+	if want := reference(data, 2047, 8192, 65535, Mask(15), Mask(11)); !slices.Equal(got, want) {
+		t.Errorf("lengths = %v, want %v", got, want)
+	}
+
+	if _, err := NewChunker(nil, 8192, WithExactScan(), WithAlgorithm(TTTD)); err == nil {
+		t.Error("NewChunker() with ExactScan and TTTD succeeded")
+	}
+}
+
+// cutCombined is cut testing both positions of a pair with a single
+// branch: x-1 has bit 63 set if x is 0, and also for the rare x with bit 63
+// set, which only a mask with bit 62 set can produce. Those fall through
+// the exact tests.
+func cutCombined(c *Chunker, data []byte) (int, uint64) {
+	if len(data) <= c.minSize {
+		return len(data), 0
+	}
+	maxBoundary := min(len(data), c.maxSize)
+	normalizeAt := min(c.normalizeSize, maxBoundary) &^ 1
+	scanStart, scanEnd := c.minSize&^1, maxBoundary&^1
+	var fingerprint uint64
+	for i := max(scanStart-c.warmup, 0); i < scanStart; i++ {
+		fingerprint = (fingerprint << 1) + c.gear[data[i]]
+	}
+	scan := func(start, end int, mask, maskShifted uint64) (int, bool) {
+		for i := start; i < end; i += 2 {
+			fp0 := (fingerprint << 2) + c.gearShifted[data[i]]
+			fingerprint = fp0 + c.gear[data[i+1]]
+			z0, z1 := fp0&maskShifted, fingerprint&mask
+			if ((z0-1)|(z1-1))>>63 != 0 {
+				if z0 == 0 {
+					fingerprint = fp0
+					return i, true
+				}
+				if z1 == 0 {
+					return i + 1, true
+				}
+			}
+		}
+		return 0, false
+	}
+	if i, ok := scan(scanStart, normalizeAt, c.maskSmall, c.maskSmallShifted); ok {
+		return i, fingerprint
+	}
+	if i, ok := scan(max(normalizeAt, scanStart), scanEnd, c.maskLarge, c.maskLargeShifted); ok {
+		return i, fingerprint
+	}
+	return maxBoundary, fingerprint
+}
+
+func TestCut(t *testing.T) {
+	data := randBytes(1<<20, 203)
+	configs := []struct {
+		name string
+		avg  int
+		opts []Option
+	}{
+		{"default", 4096, nil},
+		{"odd", 1024, []Option{WithMinSize(257), WithMaxSize(4099), WithWarmup(32)}},
+		// Bit 62 of a mask sets bit 63 of the shifted mask, which the
+		// combined test of cutCombined cannot tell from a match.
+		{"bit62", 2048, []Option{WithMaskPair(1<<62|0x7ff, 1<<62|0xff)}},
+	}
+	for _, cfg := range configs {
+		t.Run(cfg.name, func(t *testing.T) {
+			c, err := NewChunker(nil, cfg.avg, cfg.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for off := 0; off < len(data); {
+				window := data[off:min(off+c.maxSize, len(data))]
+				wantLen, wantFP := c.cut(window)
+				gotLen, gotFP := cutCombined(c, window)
+				if gotLen != wantLen || gotFP != wantFP {
+					t.Fatalf("offset %d: cutCombined = (%d, %#x), cut = (%d, %#x)", off, gotLen, gotFP, wantLen, wantFP)
+				}
+				off += wantLen
+			}
+		})
+	}
+}
+
+func TestChunker_Allocs(t *testing.T) {
+	data := randBytes(1<<20, 223)
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"default", nil},
+		{"exact", []Option{WithExactScan()}},
+		{"gear32", []Option{WithGear32(&[256]uint32{1, 2, 3})}},
+		{"tttd", []Option{WithAlgorithm(TTTD)}},
+		{"ae", []Option{WithAlgorithm(AE)}},
+		{"jump", []Option{WithQuickJump(64)}},
+		{"metadata", []Option{WithEntropy(), WithChecksum()}},
+		{"hints", []Option{WithBoundaryHints([]int64{1 << 10, 300 << 10})}},
+		{"shaping", []Option{WithAlignment(512), WithMergeTail(1024), WithFirstChunkSize(100)}},
+		{"callbacks", []Option{WithProgress(func(int64, int64) {}), WithProgressInterval(1 << 10), WithObserver(nopObserver{})}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chunker, err := NewChunker(&loopReader{data: data}, 8192, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allocs := testing.AllocsPerRun(1000, func() {
+				if _, err := chunker.Next(); err != nil {
+					t.Fatal(err)
+				}
+			}); allocs != 0 {
+				t.Errorf("Next allocates %v times per chunk", allocs)
+			}
+
+			// Reset and the end of the stream do not allocate either.
+			r := bytes.NewReader(data)
+			if allocs := testing.AllocsPerRun(10, func() {
+				r.Reset(data)
+				chunker.Reset(r)
+				for {
+					if _, err := chunker.Next(); err == io.EOF {
+						break
+					} else if err != nil {
+						t.Fatal(err)
+					}
+				}
+			}); allocs != 0 {
+				t.Errorf("chunking a stream after Reset allocates %v times", allocs)
+			}
+		})
+	}
+}
+
 func BenchmarkChunker(b *testing.B) {
 	sizes := []struct {
 		size int
@@ -590,6 +1464,234 @@ func benchmarkChunker(b *testing.B, size int) {
 	b.ReportMetric(float64(nchunks)/float64(b.N), "chunks")
 }
 
+// BenchmarkChunkerSource measures chunking from real reader types, whose
+// short reads and per-read costs exercise buffer refills unlike bytes.Reader.
+func BenchmarkCut(b *testing.B) {
+	data := randBytes(16<<20, 204)
+	for _, avg := range []int{4 << 10, 64 << 10, 1 << 20} {
+		c, err := NewChunker(nil, avg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, v := range []struct {
+			name string
+			cut  func([]byte) (int, uint64)
+		}{
+			{"cut", c.cut},
+			{"combined", func(data []byte) (int, uint64) { return cutCombined(c, data) }},
+		} {
+			b.Run(fmt.Sprintf("%s/%dk", v.name, avg>>10), func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				for b.Loop() {
+					for off := 0; off < len(data); {
+						n, _ := v.cut(data[off:min(off+c.maxSize, len(data))])
+						off += n
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkChunkerSource(b *testing.B) {
+	const size = 64 << 20
+	data := randBytes(size, 1)
+
+	path := filepath.Join(b.TempDir(), "data")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		b.Fatal(err)
+	}
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(data)
+	zw.Close()
+
+	sources := []struct {
+		name string
+		open func(b *testing.B) io.Reader
+	}{
+		{"bytes", func(b *testing.B) io.Reader { return bytes.NewReader(data) }},
+		{"file", func(b *testing.B) io.Reader {
+			f, err := os.Open(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Cleanup(func() { f.Close() })
+			return f
+		}},
+		{"bufio", func(b *testing.B) io.Reader { return bufio.NewReader(bytes.NewReader(data)) }},
+		{"pipe", func(b *testing.B) io.Reader {
+			r, w := net.Pipe()
+			go func() {
+				w.Write(data)
+				w.Close()
+			}()
+			b.Cleanup(func() { r.Close() })
+			return r
+		}},
+		{"gzip", func(b *testing.B) io.Reader {
+			zr, err := gzip.NewReader(bytes.NewReader(compressed.Bytes()))
+			if err != nil {
+				b.Fatal(err)
+			}
+			return zr
+		}},
+	}
+	for _, src := range sources {
+		b.Run(src.name, func(b *testing.B) {
+			chunker, err := NewChunker(nil, 1<<20)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(size)
+			b.ReportAllocs()
+			for b.Loop() {
+				b.StopTimer()
+				r := src.open(b)
+				b.StartTimer()
+				chunker.Reset(r)
+				for {
+					if _, err := chunker.Next(); err != nil {
+						if err == io.EOF {
+							break
+						}
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDedup measures dedup quality rather than speed: for each
+// normalization level it chunks a corpus before and after k random edits and
+// reports the percentage of the original chunks still present afterwards.
+func BenchmarkDedup(b *testing.B) {
+	const size = 8 << 20
+	corpus := randBytes(size, 7)
+	for norm := range 4 {
+		for _, edits := range []int{1, 10, 100} {
+			b.Run(fmt.Sprintf("norm-%d/edits-%d", norm, edits), func(b *testing.B) {
+				mutated := mutate(corpus, edits, rand.New(rand.NewSource(int64(edits))))
+				opts := []Option{WithNormalization(norm)}
+				before := chunkDigests(b, corpus, opts)
+				b.SetBytes(int64(len(mutated)))
+				b.ReportAllocs()
+				b.ResetTimer()
+				var after map[[sha256.Size]byte]bool
+				for b.Loop() {
+					after = chunkDigests(b, mutated, opts)
+				}
+				retained := 0
+				for d := range before {
+					if after[d] {
+						retained++
+					}
+				}
+				b.ReportMetric(100*float64(retained)/float64(len(before)), "retained%")
+			})
+		}
+	}
+}
+
+// mutate returns a copy of data with edits random edits, each inserting,
+// deleting, or overwriting up to 16 bytes.
+func mutate(data []byte, edits int, rnd *rand.Rand) []byte {
+	data = slices.Clone(data)
+	for range edits {
+		off := rnd.Intn(len(data))
+		n := 1 + rnd.Intn(16)
+		edit := make([]byte, n)
+		rnd.Read(edit)
+		switch rnd.Intn(3) {
+		case 0:
+			data = slices.Insert(data, off, edit...)
+		case 1:
+			data = slices.Delete(data, off, min(off+n, len(data)))
+		default:
+			copy(data[off:], edit)
+		}
+	}
+	return data
+}
+
+// chunkDigests returns the set of chunk digests of data with an average
+// chunk size of 64KiB.
+func chunkDigests(tb testing.TB, data []byte, opts []Option) map[[sha256.Size]byte]bool {
+	chunker, err := NewChunker(bytes.NewReader(data), 64<<10, opts...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	digests := make(map[[sha256.Size]byte]bool)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return digests
+		}
+		if err != nil {
+			tb.Fatal(err)
+		}
+		digests[sha256.Sum256(chunk.Data)] = true
+	}
+}
+
+// stutterReader returns (0, nil) before every read that yields data and
+// io.EOF once data is exhausted. With nil data it returns (0, nil) forever.
+type stutterReader struct {
+	data  []byte
+	empty bool
+}
+
+func (r *stutterReader) Read(p []byte) (int, error) {
+	r.empty = !r.empty
+	if r.empty || len(r.data) == 0 {
+		if len(r.data) == 0 && r.data != nil {
+			return 0, io.EOF
+		}
+		return 0, nil
+	}
+	n := copy(p[:min(len(p), 777)], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func chunkLengths(t testing.TB, chunker *Chunker) []int {
+	t.Helper()
+	var lengths []int
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return lengths
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		lengths = append(lengths, chunk.Length)
+	}
+}
+
+// loopReader returns data over and over.
+type loopReader struct {
+	data []byte
+	off  int
+}
+
+func (r *loopReader) Read(p []byte) (int, error) {
+	n := copy(p, r.data[r.off:])
+	r.off = (r.off + n) % len(r.data)
+	return n, nil
+}
+
+type nopObserver struct{}
+
+func (nopObserver) ObserveChunk(int)       {}
+func (nopObserver) ObserveRefill(int)      {}
+func (nopObserver) ObserveReadError(error) {}
+
+type errReader struct{ err error }
+
+func (r *errReader) Read(p []byte) (int, error) { return 0, r.err }
+
 func randBytes(n int, seed int64) []byte {
 	b := make([]byte, n)
 	rnd := rand.New(rand.NewSource(seed))
@@ -0,0 +1,34 @@
+package fastcdc
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// ChunkFile chunks the file at path with the given average size and options,
+// as for NewChunker, calling fn for every chunk in order. Where supported the
+// file is memory-mapped and chunked in place, so that large files are not
+// copied through the chunker's buffer; elsewhere, or if mapping fails, it is
+// read as a stream. Chunk data passed to fn is only valid until fn returns.
+//
+// The file must not be truncated while it is chunked: accessing a mapped page
+// past the end of the file crashes the process.
+func ChunkFile(path string, averageSize int, fn func(Chunk) error, opts ...Option) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if data, unmap, ok := mmapFile(f); ok {
+		defer unmap()
+		r = bytes.NewReader(data)
+	}
+	chunker, err := NewChunker(nil, averageSize, opts...)
+	if err != nil {
+		return err
+	}
+	return run(chunker, r, fn)
+}
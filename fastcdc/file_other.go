@@ -0,0 +1,10 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package fastcdc
+
+import "os"
+
+// mmapFile reports that files cannot be mapped on this platform.
+func mmapFile(f *os.File) (data []byte, unmap func(), ok bool) {
+	return nil, nil, false
+}
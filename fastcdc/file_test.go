@@ -0,0 +1,57 @@
+package fastcdc
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChunkFile(t *testing.T) {
+	dir := t.TempDir()
+	data := randBytes(500000, 229)
+	path := filepath.Join(dir, "data")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	chunker, err := NewChunker(bytes.NewReader(data), 16384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := collectChunks(t, chunker)
+	var got []Chunk
+	if err := ChunkFile(path, 16384, func(c Chunk) error {
+		c.Data = bytes.Clone(c.Data)
+		got = append(got, c)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !equalChunks(got, want) {
+		t.Errorf("ChunkFile produced %d chunks differing from NewChunker's %d", len(got), len(want))
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ChunkFile(empty, 16384, func(Chunk) error {
+		t.Error("chunk of empty file")
+		return nil
+	}); err != nil {
+		t.Errorf("ChunkFile(empty) = %v", err)
+	}
+
+	errStop := errors.New("stop")
+	if err := ChunkFile(path, 16384, func(Chunk) error { return errStop }); err != errStop {
+		t.Errorf("ChunkFile with failing fn = %v, want %v", err, errStop)
+	}
+	if err := ChunkFile(filepath.Join(dir, "missing"), 16384, func(Chunk) error { return nil }); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ChunkFile(missing) = %v", err)
+	}
+	if err := ChunkFile(path, 1000, func(Chunk) error { return nil }); err == nil {
+		t.Error("ChunkFile with invalid average size succeeded")
+	}
+}
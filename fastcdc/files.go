@@ -0,0 +1,54 @@
+package fastcdc
+
+import (
+	"io"
+	"iter"
+)
+
+// FileChunk is a chunk of a multi-file stream annotated with the file
+// containing it. Its Offset is relative to the start of the stream.
+type FileChunk struct {
+	Chunk
+
+	// Name is the name of the file the chunk belongs to.
+	Name string
+
+	// FileOffset is the offset of the chunk within its file.
+	FileOffset int
+}
+
+// ChunkFiles chunks the files yielded by files, pairs of a name and a
+// reader, as one stream, calling fn for every chunk in order. Every file
+// starts a new chunk with a fresh hash state, so each file is cut exactly as
+// if it were chunked on its own and its chunks deduplicate wherever the file
+// appears, e.g. in archives built from overlapping sets of files. Empty
+// files yield no chunks. The averageSize and options are as for NewChunker.
+// Boundary hints and read errors use offsets in the stream, while the
+// maximum byte count and alignment apply to each file. Chunk data passed to
+// fn is only valid until fn returns.
+func ChunkFiles(files iter.Seq2[string, io.Reader], averageSize int, fn func(FileChunk) error, opts ...Option) error {
+	chunker, err := NewChunker(nil, averageSize, opts...)
+	if err != nil {
+		return err
+	}
+	var fileStart int
+	for name, r := range files {
+		chunker.Reset(r)
+		chunker.offsetBase = fileStart
+		chunker.alignBase = fileStart
+		for {
+			c, err := chunker.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err := fn(FileChunk{Chunk: c, Name: name, FileOffset: c.Offset - fileStart}); err != nil {
+				return err
+			}
+		}
+		fileStart += chunker.streamPos
+	}
+	return nil
+}
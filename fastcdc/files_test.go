@@ -0,0 +1,71 @@
+package fastcdc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestChunkFiles(t *testing.T) {
+	names := []string{"a", "empty", "b", "c"}
+	contents := [][]byte{randBytes(50000, 45), nil, randBytes(123, 46), randBytes(80000, 47)}
+	files := func(yield func(string, io.Reader) bool) {
+		for i, name := range names {
+			if !yield(name, bytes.NewReader(contents[i])) {
+				return
+			}
+		}
+	}
+
+	// Files are cut as on their own, also when they are aligned, although
+	// b and c do not start at aligned stream offsets.
+	for _, opts := range [][]Option{nil, {WithAlignment(512)}} {
+		var got []FileChunk
+		err := ChunkFiles(files, 4096, func(c FileChunk) error {
+			c.Data = bytes.Clone(c.Data)
+			got = append(got, c)
+			return nil
+		}, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var offset int
+		for i, name := range names {
+			chunker, err := NewChunker(bytes.NewReader(contents[i]), 4096, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range collectChunks(t, chunker) {
+				if len(got) == 0 {
+					t.Fatalf("missing chunk at %d of %s", want.Offset, name)
+				}
+				c := got[0]
+				got = got[1:]
+				if c.Name != name || c.FileOffset != want.Offset || c.Offset != offset || c.Length != want.Length ||
+					c.Fingerprint != want.Fingerprint || !bytes.Equal(c.Data, want.Data) {
+					t.Errorf("chunk %s@%d (stream %d, length %d), want %s@%d (stream %d, length %d)",
+						c.Name, c.FileOffset, c.Offset, c.Length, name, want.Offset, offset, want.Length)
+				}
+				offset += want.Length
+			}
+		}
+		if len(got) > 0 {
+			t.Errorf("%d extra chunks", len(got))
+		}
+	}
+
+	// Read errors report stream offsets.
+	failing := func(yield func(string, io.Reader) bool) {
+		if yield("a", bytes.NewReader(contents[0])) {
+			yield("b", io.MultiReader(bytes.NewReader(contents[2]), iotest.ErrReader(errors.ErrUnsupported)))
+		}
+	}
+	err := ChunkFiles(failing, 4096, func(FileChunk) error { return nil })
+	var re *ReadError
+	if !errors.As(err, &re) || re.Offset != int64(len(contents[0])) {
+		t.Errorf("ChunkFiles() with failing reader = %v, want read error at %d", err, len(contents[0]))
+	}
+}
@@ -0,0 +1,160 @@
+package fastcdc
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+	"testing/iotest"
+)
+
+// FuzzChunker checks invariants that hold for any input and combination of
+// options: chunks are contiguous and concatenate to the input, lengths respect
+// the size limits, chunking does not depend on how the input is read, and
+// Reset reproduces the same chunks.
+func FuzzChunker(f *testing.F) {
+	for i, flags := range []uint16{0, 0x1, 0x2, 0x4, 0x8, 0x10 | 0x20, 0x40 | 0x80, 0x100 | 0x200, 0x400 | 0x800, 0x1000 | 0x1} {
+		f.Add(randBytes(1<<(8+i%8), int64(i)), uint8(i), uint8(i), uint16(i*997), uint16(i*331), flags, uint64(i))
+	}
+	f.Fuzz(func(t *testing.T, data []byte, avgExp, norm uint8, minSize, maxSize, flags uint16, seed uint64) {
+		avg := 64 << (avgExp % 8)
+		min := 64 + int(minSize)%(avg-63)
+		max := avg + int(maxSize)%(3*avg+1)
+		alg := Algorithm(flags >> 2 & 3 % 3)
+		opts := []Option{WithMinSize(min), WithMaxSize(max), WithNormalization(int(norm % 4)), WithAlgorithm(alg)}
+		mergeTail := 0
+		if flags&0x1 != 0 {
+			opts = append(opts, WithSeed(seed))
+		}
+		if flags&0x10 != 0 {
+			mergeTail = min / 2
+			opts = append(opts, WithMergeTail(mergeTail))
+		}
+		if flags&0x20 != 0 {
+			opts = append(opts, WithFirstChunkSize(min/2+1))
+		}
+		if flags&0x40 != 0 {
+			opts = append(opts, WithAlignment(16))
+		}
+		if flags&0x100 != 0 {
+			opts = append(opts, WithQuickJump(16))
+		}
+		if flags&0x200 != 0 {
+			opts = append(opts, WithBoundaryHints([]int64{int64(len(data) / 3), int64(len(data) / 2)}))
+		}
+		if flags&0x400 != 0 {
+			opts = append(opts, WithEntropy(), WithChecksum())
+		}
+		if flags&0x1000 != 0 {
+			opts = append(opts, WithBufferSize(max+max/2+1))
+		}
+		if alg == FastCDC {
+			if flags&0x2 != 0 {
+				opts = append(opts, WithExactScan())
+			}
+			if flags&0x80 != 0 {
+				opts = append(opts, WithWarmup(min/2))
+			}
+			if flags&0x800 != 0 && avg <= 1<<13 {
+				var table [256]uint32
+				for i, g := range gear {
+					table[i] = uint32(g)
+				}
+				opts = append(opts, WithGear32(&table))
+			}
+		}
+
+		chunker, err := NewChunker(bytes.NewReader(data), avg, opts...)
+		if err != nil {
+			t.Fatalf("NewChunker(%d, min %d, max %d, flags %#x): %v", avg, min, max, flags, err)
+		}
+		chunks := collectChunks(t, chunker)
+
+		var offset int
+		for i, c := range chunks {
+			if c.Offset != offset || c.Length != len(c.Data) || c.Length == 0 {
+				t.Fatalf("chunk %d: offset %d length %d with %d bytes of data, want offset %d", i, c.Offset, c.Length, len(c.Data), offset)
+			}
+			if !bytes.Equal(c.Data, data[offset:offset+c.Length]) {
+				t.Fatalf("chunk %d at %d does not match the input", i, offset)
+			}
+			if c.Length > max && !(c.Cut == CutMergeTail && c.Length < max+mergeTail) {
+				t.Errorf("chunk %d at %d: length %d exceeds max %d (cut %v)", i, offset, c.Length, max, c.Cut)
+			}
+			// The two-byte scan rounds odd minimum sizes down.
+			if c.Length < min&^1 && i < len(chunks)-1 && c.Cut != CutHint && c.Cut != CutFirstChunk {
+				t.Errorf("chunk %d at %d: length %d below min %d (cut %v)", i, offset, c.Length, min, c.Cut)
+			}
+			offset += c.Length
+		}
+		if offset != len(data) {
+			t.Fatalf("chunks cover %d bytes, want %d", offset, len(data))
+		}
+
+		// Short reads change how the buffer is filled but not the chunks.
+		other, err := NewChunker(iotest.HalfReader(bytes.NewReader(data)), avg, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := collectChunks(t, other); !equalChunks(got, chunks) {
+			t.Errorf("chunks differ with short reads")
+		}
+
+		// Deferring refills does not change the chunks.
+		eager, err := NewChunker(bytes.NewReader(data), avg, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		eager.lazy = false
+		if got := collectChunks(t, eager); !equalChunks(got, chunks) {
+			t.Errorf("chunks differ with eager refills")
+		}
+
+		// So does the implementation of the boundary scan.
+		for _, impl := range CutImpls() {
+			other, err := NewChunker(bytes.NewReader(data), avg, append(opts, WithCutImpl(impl))...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := collectChunks(t, other); !equalChunks(got, chunks) {
+				t.Errorf("chunks differ with cut implementation %v", impl)
+			}
+		}
+
+		chunker.Reset(bytes.NewReader(data))
+		if got := collectChunks(t, chunker); !equalChunks(got, chunks) {
+			t.Errorf("chunks differ after Reset")
+		}
+
+		// So does delivering the stream in parts.
+		chunker.Reset(nil)
+		chunker.Append(bytes.NewReader(data[:len(data)/3]))
+		if got := appendChunks(t, chunker, [][]byte{data[len(data)/3 : len(data)/2], data[len(data)/2:]}); !equalChunks(got, chunks) {
+			t.Errorf("chunks differ when appending parts")
+		}
+	})
+}
+
+// collectChunks returns all chunks of chunker, with copies of their data.
+func collectChunks(t *testing.T, chunker *Chunker) []Chunk {
+	t.Helper()
+	var chunks []Chunk
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunk.Data = slices.Clone(chunk.Data)
+		chunks = append(chunks, chunk)
+	}
+}
+
+func equalChunks(a, b []Chunk) bool {
+	return slices.EqualFunc(a, b, func(a, b Chunk) bool {
+		return a.Offset == b.Offset && a.Length == b.Length && a.Fingerprint == b.Fingerprint &&
+			a.Cut == b.Cut && a.Entropy == b.Entropy && a.Checksum == b.Checksum && bytes.Equal(a.Data, b.Data)
+	})
+}
@@ -0,0 +1,67 @@
+package fastcdc
+
+import "fmt"
+
+// WithGear32 switches to 32-bit gear hashing with the given table, for
+// compatibility with implementations that use 32-bit fingerprints, e.g. to
+// keep fingerprints stored by an older C implementation comparable during a
+// migration. The fingerprint is rolled one byte at a time as
+// fp = fp<<1 + table[b] in 32-bit arithmetic, and a chunk ends before the
+// first byte past the minimum size at which fp&mask == 0.
+//
+// Masks default to Mask32 of the usual number of bits; WithMaskPair may
+// override them with masks that fit in 32 bits. The seed, if any, is XORed
+// into the table. Gear32 applies to the FastCDC algorithm only.
+func WithGear32(table *[256]uint32) Option {
+	return func(o *options) {
+		o.gear32 = table
+	}
+}
+
+// maxMask32Bits is the largest number of bits Mask32 supports.
+const maxMask32Bits = 32
+
+// Mask32 returns a 32-bit chunking mask with n bits, from 1 to 32, spread
+// evenly over the fingerprint as for generated masks of Mask: bit i of n is
+// at position floor((2i+1) * 32 / 2n).
+func Mask32(n int) uint32 {
+	if n < 1 || n > maxMask32Bits {
+		panic(fmt.Sprintf("fastcdc: mask bits %d out of range", n))
+	}
+	var mask uint32
+	for i := range n {
+		mask |= 1 << ((2*i + 1) * maxMask32Bits / (2 * n))
+	}
+	return mask
+}
+
+// cutGear32 is cut for 32-bit gear hashing.
+func (c *Chunker) cutGear32(data []byte) (int, uint64) {
+	dataLen := len(data)
+	if dataLen <= c.minSize {
+		return dataLen, 0
+	}
+	maxBoundary := min(dataLen, c.maxSize)
+	normalizeBoundary := min(c.normalizeSize, maxBoundary)
+	table := c.gear32
+	maskSmall, maskLarge := uint32(c.maskSmall), uint32(c.maskLarge)
+
+	var fingerprint uint32
+	for i := max(c.minSize-c.warmup, 0); i < c.minSize; i++ {
+		fingerprint = fingerprint<<1 + table[data[i]]
+	}
+	i := c.minSize
+	for ; i < normalizeBoundary; i++ {
+		fingerprint = fingerprint<<1 + table[data[i]]
+		if fingerprint&maskSmall == 0 {
+			return i, uint64(fingerprint)
+		}
+	}
+	for ; i < maxBoundary; i++ {
+		fingerprint = fingerprint<<1 + table[data[i]]
+		if fingerprint&maskLarge == 0 {
+			return i, uint64(fingerprint)
+		}
+	}
+	return maxBoundary, uint64(fingerprint)
+}
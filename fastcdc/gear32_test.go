@@ -0,0 +1,78 @@
+package fastcdc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+	"slices"
+	"testing"
+)
+
+func TestGear32(t *testing.T) {
+	var table [256]uint32
+	raw := randBytes(4*len(table), 191)
+	for i := range table {
+		table[i] = binary.LittleEndian.Uint32(raw[4*i:])
+	}
+	data := randBytes(1<<20, 192)
+
+	// reference is a straightforward 32-bit FastCDC loop, as found in C
+	// implementations.
+	reference := func(data []byte, minSize, avgSize, maxSize int, maskS, maskL uint32) []int {
+		var lengths []int
+		for len(data) > 0 {
+			n := len(data)
+			if n > minSize {
+				n = min(n, maxSize)
+				var fp uint32
+				for i := minSize; i < n; i++ {
+					fp = fp<<1 + table[data[i]]
+					mask := maskL
+					if i < avgSize {
+						mask = maskS
+					}
+					if fp&mask == 0 {
+						n = i
+						break
+					}
+				}
+			}
+			lengths = append(lengths, n)
+			data = data[n:]
+		}
+		return lengths
+	}
+
+	chunker, err := NewChunker(bytes.NewReader(data), 8192, WithMinSize(2048), WithMaxSize(65536), WithGear32(&table))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := chunkLengths(t, chunker)
+	if want := reference(data, 2048, 8192, 65536, Mask32(15), Mask32(11)); !slices.Equal(got, want) {
+		t.Errorf("lengths = %v, want %v", got, want)
+	}
+
+	// Custom 32-bit masks are used as given.
+	chunker, err = NewChunker(bytes.NewReader(data), 8192, WithMinSize(2048), WithMaxSize(65536), WithGear32(&table), WithMaskPair(1<<14-1, 1<<12-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = chunkLengths(t, chunker)
+	if want := reference(data, 2048, 8192, 65536, 1<<14-1, 1<<12-1); !slices.Equal(got, want) {
+		t.Errorf("lengths with mask pair = %v, want %v", got, want)
+	}
+
+	for _, opt := range []Option{WithMaskPair(1<<32, 1), WithAlgorithm(TTTD)} {
+		if _, err := NewChunker(nil, 8192, WithGear32(&table), opt); err == nil {
+			t.Error("NewChunker() with invalid Gear32 options succeeded")
+		}
+	}
+}
+
+func TestMask32(t *testing.T) {
+	for n := 1; n <= 32; n++ {
+		if got := bits.OnesCount32(Mask32(n)); got != n {
+			t.Errorf("Mask32(%d) has %d bits", n, got)
+		}
+	}
+}
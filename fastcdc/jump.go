@@ -0,0 +1,81 @@
+package fastcdc
+
+import "encoding/binary"
+
+// jumpFeatureSize is the number of leading and trailing bytes of a chunk
+// recorded in the jump table.
+const jumpFeatureSize = 8
+
+// WithQuickJump enables QuickCDC-style jumping for highly redundant streams
+// such as CI logs or VM images. The chunker remembers the first and last bytes
+// and the length of up to entries recent chunks. When a chunk starts with the
+// same bytes as a remembered one and the bytes at the remembered length match
+// its last bytes, the chunk is cut there without scanning it.
+//
+// A jumped chunk matches the remembered one only at its edges, so boundaries
+// can differ from those found without jumping when content repeats with
+// changes in the middle of a chunk. The table is bounded by entries, rounded
+// up to a power of 2, with newer chunks replacing older ones (defaults to 0,
+// meaning no jumping). Reset clears the table.
+func WithQuickJump(entries int) Option {
+	return func(o *options) {
+		o.jumpEntries = entries
+	}
+}
+
+// jumpTable is a direct-mapped table of recently emitted chunks keyed by
+// their leading bytes.
+type jumpTable struct {
+	entries []jumpEntry
+	mask    uint64
+}
+
+type jumpEntry struct {
+	front, back uint64
+	length      int
+	fingerprint uint64
+}
+
+func newJumpTable(entries int) *jumpTable {
+	size := 1
+	for size < entries {
+		size <<= 1
+	}
+	return &jumpTable{entries: make([]jumpEntry, size), mask: uint64(size - 1)}
+}
+
+func (t *jumpTable) slot(front uint64) *jumpEntry {
+	// Fibonacci hashing spreads the leading bytes over the table.
+	return &t.entries[(front*0x9e3779b97f4a7c15>>32)&t.mask]
+}
+
+// lookup returns the length and fingerprint of a remembered chunk that data
+// starts with, or 0 if there is none.
+func (t *jumpTable) lookup(data []byte) (int, uint64) {
+	if len(data) < jumpFeatureSize {
+		return 0, 0
+	}
+	front := binary.LittleEndian.Uint64(data)
+	e := t.slot(front)
+	if e.length == 0 || e.front != front || e.length > len(data) {
+		return 0, 0
+	}
+	if binary.LittleEndian.Uint64(data[e.length-jumpFeatureSize:]) != e.back {
+		return 0, 0
+	}
+	return e.length, e.fingerprint
+}
+
+// record remembers a chunk.
+func (t *jumpTable) record(chunk []byte, fingerprint uint64) {
+	if len(chunk) < 2*jumpFeatureSize {
+		return
+	}
+	front := binary.LittleEndian.Uint64(chunk)
+	*t.slot(front) = jumpEntry{
+		front:       front,
+		back:        binary.LittleEndian.Uint64(chunk[len(chunk)-jumpFeatureSize:]),
+		length:      len(chunk),
+		fingerprint: fingerprint,
+	}
+}
@@ -0,0 +1,57 @@
+package fastcdc
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestQuickJump(t *testing.T) {
+	chunk := func(data []byte, opts ...Option) []int {
+		chunker, err := NewChunker(bytes.NewReader(data), 4096, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chunkLengths(t, chunker)
+	}
+
+	// Jumping does not change the chunking of random or repeated data.
+	block := randBytes(100000, 181)
+	for _, data := range [][]byte{randBytes(1<<20, 182), bytes.Repeat(block, 10)} {
+		if got, want := chunk(data, WithQuickJump(1024)), chunk(data); !slices.Equal(got, want) {
+			t.Errorf("lengths with jumping = %v, want %v", got, want)
+		}
+	}
+
+	// A chunk whose edges match a remembered chunk is cut at the remembered
+	// length, even though its middle would be cut elsewhere. FastCDC decides
+	// a cut using the byte that follows it, so a must repeat its first byte
+	// there for the boundary to survive the repetition.
+	var a []byte
+	var first int
+	for seed := int64(1000); ; seed++ {
+		a = randBytes(20000, seed)
+		if first = chunk(a)[0]; a[first] == a[0] {
+			break
+		}
+	}
+	var b []byte
+	for seed := int64(184); ; seed++ {
+		c := randBytes(20000, seed)
+		if l := chunk(c)[0]; l < first-100 {
+			b = slices.Concat(a[:8], c[8:first-8], a[first-8:first], c[first:])
+			break
+		}
+	}
+	data := slices.Concat(a[:first], b)
+	if got := chunk(data)[1]; got == first {
+		t.Fatalf("second chunk without jumping has length %d, want it to differ", got)
+	}
+	if got := chunk(data, WithQuickJump(16))[1]; got != first {
+		t.Errorf("second chunk with jumping has length %d, want %d", got, first)
+	}
+
+	if _, err := NewChunker(nil, 4096, WithQuickJump(-1)); err == nil {
+		t.Error("NewChunker() with negative jump entries succeeded")
+	}
+}
@@ -0,0 +1,178 @@
+package fastcdc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// CutReason records why a chunk ends where it does.
+type CutReason uint8
+
+const (
+	// CutUnknown is the zero CutReason.
+	CutUnknown CutReason = iota
+	// CutContent is a content-defined boundary chosen by the algorithm.
+	CutContent
+	// CutMaxSize is a forced cut at the maximum chunk size, or at the fixed
+	// size with WithFixedSize.
+	CutMaxSize
+	// CutEnd is the end of the stream, ending a chunk short of the size it
+	// would otherwise be cut at.
+	CutEnd
+	// CutHint is a boundary hint.
+	CutHint
+	// CutFirstChunk is the fixed end of the first chunk with
+	// WithFirstChunkSize.
+	CutFirstChunk
+	// CutAlignment is a content-defined boundary rounded down by
+	// WithAlignment.
+	CutAlignment
+	// CutQuickJump is a boundary remembered by WithQuickJump.
+	CutQuickJump
+	// CutMergeTail is the end of the stream after merging a short tail with
+	// WithMergeTail.
+	CutMergeTail
+	// CutSkip is the end of a region excluded with WithSkipRanges. Such a
+	// chunk has no Data.
+	CutSkip
+)
+
+var cutReasonNames = [...]string{
+	CutUnknown:    "unknown",
+	CutContent:    "content",
+	CutMaxSize:    "max-size",
+	CutEnd:        "end",
+	CutHint:       "hint",
+	CutFirstChunk: "first-chunk",
+	CutAlignment:  "alignment",
+	CutQuickJump:  "quick-jump",
+	CutMergeTail:  "merge-tail",
+	CutSkip:       "skip",
+}
+
+func (r CutReason) String() string {
+	if int(r) < len(cutReasonNames) {
+		return cutReasonNames[r]
+	}
+	return fmt.Sprintf("CutReason(%d)", r)
+}
+
+// MarshalText returns the name of r, as used in JSON.
+func (r CutReason) MarshalText() ([]byte, error) {
+	if int(r) >= len(cutReasonNames) {
+		return nil, fmt.Errorf("unknown cut reason %d", r)
+	}
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText parses a name returned by MarshalText.
+func (r *CutReason) UnmarshalText(text []byte) error {
+	for i, name := range cutReasonNames {
+		if string(text) == name {
+			*r = CutReason(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown cut reason %q", text)
+}
+
+// ErrInvalidEncoding is returned when decoding malformed chunk metadata.
+var ErrInvalidEncoding = errors.New("invalid chunk encoding")
+
+// chunkEncodingVersion is the first byte of the binary encoding of a Chunk.
+const chunkEncodingVersion = 1
+
+// MarshalBinary returns a stable binary encoding of the metadata of c, that
+// is everything but Data: a version byte, then Offset, Length, Fingerprint,
+// Checksum, and Cut as uvarints, then the IEEE 754 bits of Entropy as a
+// little-endian uint64.
+func (c Chunk) MarshalBinary() ([]byte, error) {
+	if c.Offset < 0 || c.Length < 0 {
+		return nil, fmt.Errorf("chunk offset %d or length %d is negative", c.Offset, c.Length)
+	}
+	buf := []byte{chunkEncodingVersion}
+	buf = binary.AppendUvarint(buf, uint64(c.Offset))
+	buf = binary.AppendUvarint(buf, uint64(c.Length))
+	buf = binary.AppendUvarint(buf, c.Fingerprint)
+	buf = binary.AppendUvarint(buf, uint64(c.Checksum))
+	buf = binary.AppendUvarint(buf, uint64(c.Cut))
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(c.Entropy))
+	return buf, nil
+}
+
+// UnmarshalBinary decodes metadata encoded by MarshalBinary into c. Data is
+// set to nil.
+func (c *Chunk) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != chunkEncodingVersion {
+		return fmt.Errorf("%w: unknown version", ErrInvalidEncoding)
+	}
+	data = data[1:]
+	var fields [5]uint64
+	for i := range fields {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("%w: truncated", ErrInvalidEncoding)
+		}
+		fields[i] = v
+		data = data[n:]
+	}
+	if len(data) != 8 {
+		return fmt.Errorf("%w: truncated or trailing bytes", ErrInvalidEncoding)
+	}
+	offset, length, fingerprint, checksum, cut := fields[0], fields[1], fields[2], fields[3], fields[4]
+	if offset > math.MaxInt || length > math.MaxInt || checksum > math.MaxUint32 || cut > math.MaxUint8 {
+		return fmt.Errorf("%w: field out of range", ErrInvalidEncoding)
+	}
+	*c = Chunk{
+		Offset:      int(offset),
+		Length:      int(length),
+		Fingerprint: fingerprint,
+		Checksum:    uint32(checksum),
+		Cut:         CutReason(cut),
+		Entropy:     math.Float64frombits(binary.LittleEndian.Uint64(data)),
+	}
+	return nil
+}
+
+// chunkJSON is the JSON form of a Chunk.
+type chunkJSON struct {
+	Offset      int       `json:"offset"`
+	Length      int       `json:"length"`
+	Fingerprint uint64    `json:"fingerprint"`
+	Entropy     float64   `json:"entropy,omitempty"`
+	Checksum    uint32    `json:"checksum,omitempty"`
+	Cut         CutReason `json:"cut"`
+}
+
+// MarshalJSON encodes the metadata of c, that is everything but Data.
+func (c Chunk) MarshalJSON() ([]byte, error) {
+	return json.Marshal(chunkJSON{
+		Offset:      c.Offset,
+		Length:      c.Length,
+		Fingerprint: c.Fingerprint,
+		Entropy:     c.Entropy,
+		Checksum:    c.Checksum,
+		Cut:         c.Cut,
+	})
+}
+
+// UnmarshalJSON decodes metadata encoded by MarshalJSON into c. Data is set
+// to nil.
+func (c *Chunk) UnmarshalJSON(data []byte) error {
+	var j chunkJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*c = Chunk{
+		Offset:      j.Offset,
+		Length:      j.Length,
+		Fingerprint: j.Fingerprint,
+		Entropy:     j.Entropy,
+		Checksum:    j.Checksum,
+		Cut:         j.Cut,
+	}
+	return nil
+}
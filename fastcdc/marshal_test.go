@@ -0,0 +1,111 @@
+package fastcdc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestChunk_Cut(t *testing.T) {
+	data := randBytes(100000, 231)
+	reasons := func(data []byte, opts ...Option) []CutReason {
+		chunker, err := NewChunker(bytes.NewReader(data), 1024, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reasons []CutReason
+		for {
+			chunk, err := chunker.Next()
+			if err == io.EOF {
+				return reasons
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			reasons = append(reasons, chunk.Cut)
+		}
+	}
+
+	got := reasons(data)
+	if got[len(got)-1] != CutEnd {
+		t.Errorf("last cut = %v, want %v", got[len(got)-1], CutEnd)
+	}
+	for _, r := range got[:len(got)-1] {
+		if r != CutContent {
+			t.Errorf("cut = %v, want %v", r, CutContent)
+		}
+	}
+
+	if got := reasons(make([]byte, 10000)); got[0] != CutMaxSize {
+		t.Errorf("cut of zeros = %v, want %v", got[0], CutMaxSize)
+	}
+	if got := reasons(data[:5000], WithFixedSize(2000)); !slices.Equal(got, []CutReason{CutMaxSize, CutMaxSize, CutEnd}) {
+		t.Errorf("fixed-size cuts = %v", got)
+	}
+	if got := reasons(data, WithFirstChunkSize(100)); got[0] != CutFirstChunk {
+		t.Errorf("first cut = %v, want %v", got[0], CutFirstChunk)
+	}
+	if got := reasons(data, WithBoundaryHints([]int64{300})); got[0] != CutHint {
+		t.Errorf("first cut = %v, want %v", got[0], CutHint)
+	}
+	if got := reasons(data, WithMergeTail(4096)); got[len(got)-1] != CutMergeTail {
+		t.Errorf("last cut = %v, want %v", got[len(got)-1], CutMergeTail)
+	}
+	if got := reasons(data, WithAlignment(64)); !slices.Contains(got, CutAlignment) {
+		t.Errorf("cuts with alignment = %v, want some %v", got, CutAlignment)
+	}
+}
+
+func TestChunk_Marshal(t *testing.T) {
+	chunk := Chunk{
+		Offset:      123456,
+		Length:      7890,
+		Data:        []byte("ignored"),
+		Fingerprint: 0xfedcba9876543210,
+		Entropy:     7.25,
+		Checksum:    0xdeadbeef,
+		Cut:         CutMaxSize,
+	}
+	want := chunk
+	want.Data = nil
+
+	b, err := chunk.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Chunk
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("binary round trip = %+v, want %+v", got, want)
+	}
+	for _, bad := range [][]byte{nil, {2}, b[:len(b)-1], append(slices.Clone(b), 0)} {
+		if err := got.UnmarshalBinary(bad); !errors.Is(err, ErrInvalidEncoding) {
+			t.Errorf("UnmarshalBinary(%x) = %v, want %v", bad, err, ErrInvalidEncoding)
+		}
+	}
+
+	j, err := json.Marshal(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wantJSON = `{"offset":123456,"length":7890,"fingerprint":18364758544493064720,"entropy":7.25,"checksum":3735928559,"cut":"max-size"}`
+	if string(j) != wantJSON {
+		t.Errorf("JSON = %s, want %s", j, wantJSON)
+	}
+	got = Chunk{}
+	if err := json.Unmarshal(j, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("JSON round trip = %+v, want %+v", got, want)
+	}
+	if err := json.Unmarshal([]byte(`{"cut":"bogus"}`), &got); err == nil {
+		t.Error("Unmarshal with unknown cut reason succeeded")
+	}
+}
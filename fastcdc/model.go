@@ -0,0 +1,91 @@
+package fastcdc
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// Distribution describes the expected chunk sizes of a chunker configuration
+// on random input, under the FastCDC model in which every byte past the
+// minimum size ends a chunk independently with probability 2^-b, where b is
+// the number of bits in the mask in effect at that position.
+type Distribution struct {
+	// Mean is the expected chunk size in bytes.
+	Mean float64
+	// Variance is the variance of the chunk size in bytes squared.
+	Variance float64
+	// MaxSizeProbability is the probability that a chunk is cut at the
+	// maximum size rather than at a content-defined boundary.
+	MaxSizeProbability float64
+}
+
+// StdDev returns the standard deviation of the chunk size in bytes.
+func (d Distribution) StdDev() float64 {
+	return math.Sqrt(d.Variance)
+}
+
+// ExpectedDistribution returns the modeled chunk size distribution of a
+// chunker created with the given average size and options, as for
+// NewChunker. Only the FastCDC algorithm is modeled. The model ignores the end
+// of the stream and options that force boundaries, such as WithBoundaryHints
+// and WithFirstChunkSize.
+func ExpectedDistribution(averageSize int, opts ...Option) (Distribution, error) {
+	o := &options{averageSize: averageSize}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.setDefaults()
+	if err := o.validate(); err != nil {
+		return Distribution{}, err
+	}
+	if o.algorithm != FastCDC {
+		return Distribution{}, errors.New("ExpectedDistribution only models the FastCDC algorithm")
+	}
+	maskSmall, maskLarge, err := o.masks()
+	if err != nil {
+		return Distribution{}, err
+	}
+
+	normalizeSize := min(max(o.averageSize, o.minSize), o.maxSize)
+	pSmall := 1 / float64(uint64(1)<<bits.OnesCount64(maskSmall))
+	pLarge := 1 / float64(uint64(1)<<bits.OnesCount64(maskLarge))
+
+	// The chunk size is minSize + T1 + I*T2, where T1 and T2 are the bytes
+	// scanned before a cut with each mask, capped at the length of their
+	// region, and I indicates that no cut was found before the
+	// normalization point.
+	n1 := float64(normalizeSize - o.minSize)
+	n2 := float64(o.maxSize - normalizeSize)
+	mean1, sq1, q1 := cappedGeometric(pSmall, n1)
+	mean2, sq2, q2 := cappedGeometric(pLarge, n2)
+
+	mean := mean1 + q1*mean2
+	second := sq1 + 2*n1*q1*mean2 + q1*sq2
+	return Distribution{
+		Mean:               float64(o.minSize) + mean,
+		Variance:           max(second-mean*mean, 0),
+		MaxSizeProbability: q1 * q2,
+	}, nil
+}
+
+// cappedGeometric returns the first and second moments of T = min(K, n),
+// where K is the number of failures before the first success of trials with
+// success probability p, and the probability that K >= n.
+func cappedGeometric(p, n float64) (mean, second, tail float64) {
+	if n <= 0 {
+		return 0, 0, 1
+	}
+	r := 1 - p
+	// r^n and 1-r^n, computed stably for small p.
+	logR := math.Log1p(-p)
+	tail = math.Exp(n * logR)
+	notTail := -math.Expm1(n * logR)
+
+	// E[T] = sum_{k=1..n} P(K >= k) = sum r^k.
+	mean = r * notTail / p
+	// E[T^2] = sum_{k=1..n} (2k-1) r^k.
+	sumKR := r / p * (notTail/p - n*tail)
+	second = 2*sumKR - mean
+	return mean, second, tail
+}
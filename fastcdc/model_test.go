@@ -0,0 +1,111 @@
+package fastcdc
+
+import (
+	"bytes"
+	"math"
+	"math/bits"
+	"slices"
+	"testing"
+)
+
+func TestExpectedDistribution(t *testing.T) {
+	data := randBytes(32<<20, 131)
+
+	for _, tc := range []struct {
+		name        string
+		averageSize int
+		opts        []Option
+	}{
+		{"default", 8192, nil},
+		{"no normalization", 8192, []Option{WithNormalization(0)}},
+		{"normalization 3", 4096, []Option{WithNormalization(3)}},
+		{"tight max", 16384, []Option{WithMaxSize(20000)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := ExpectedDistribution(tc.averageSize, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			chunker, err := NewChunker(bytes.NewReader(data), tc.averageSize, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lengths := chunkLengths(t, chunker)
+			lengths = lengths[:len(lengths)-1] // Drop the tail.
+			maxSize := slices.Max(lengths)
+			var sum, sumSquares float64
+			var atMax int
+			for _, l := range lengths {
+				sum += float64(l)
+				sumSquares += float64(l) * float64(l)
+				if l == maxSize {
+					atMax++
+				}
+			}
+			n := float64(len(lengths))
+			mean := sum / n
+			stdDev := math.Sqrt(sumSquares/n - mean*mean)
+
+			if math.Abs(mean-d.Mean)/d.Mean > 0.05 {
+				t.Errorf("mean = %.0f, model predicts %.0f", mean, d.Mean)
+			}
+			if math.Abs(stdDev-d.StdDev())/d.StdDev() > 0.1 {
+				t.Errorf("stddev = %.0f, model predicts %.0f", stdDev, d.StdDev())
+			}
+			if p := float64(atMax) / n; math.Abs(p-d.MaxSizeProbability) > 0.02 {
+				t.Errorf("P(max size) = %.3f, model predicts %.3f", p, d.MaxSizeProbability)
+			}
+		})
+	}
+
+	d, err := ExpectedDistribution(8192, WithFixedSize(5000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Mean != 5000 || d.Variance != 0 || d.MaxSizeProbability != 1 {
+		t.Errorf("fixed-size distribution = %+v", d)
+	}
+	if _, err := ExpectedDistribution(1000); err == nil {
+		t.Error("ExpectedDistribution() with invalid average size succeeded")
+	}
+}
+
+func TestCappedGeometric(t *testing.T) {
+	for _, tc := range []struct{ p, n float64 }{
+		{0.5, 10}, {1.0 / 1024, 3000}, {1.0 / (1 << 20), 100}, {0.1, 1},
+	} {
+		var mean, second float64
+		r := 1 - tc.p
+		for k := 1.0; k <= tc.n; k++ {
+			mean += math.Pow(r, k)
+			second += (2*k - 1) * math.Pow(r, k)
+		}
+		gotMean, gotSecond, tail := cappedGeometric(tc.p, tc.n)
+		if math.Abs(gotMean-mean) > 1e-6*math.Max(mean, 1) || math.Abs(gotSecond-second) > 1e-6*math.Max(second, 1) {
+			t.Errorf("cappedGeometric(%g, %g) = %g, %g, want %g, %g", tc.p, tc.n, gotMean, gotSecond, mean, second)
+		}
+		if want := math.Pow(r, tc.n); math.Abs(tail-want) > 1e-12 {
+			t.Errorf("tail = %g, want %g", tail, want)
+		}
+	}
+}
+
+func TestExpectedDistribution_LargeSizes(t *testing.T) {
+	if bits.UintSize < 64 {
+		t.Skip("chunks above 1GiB require a 64-bit platform")
+	}
+	// The sizes are computed at run time, since they overflow int as
+	// constants on 32-bit platforms.
+	gib := 1 << 30
+	d, err := ExpectedDistribution(4*gib, WithMaxSize(16*gib))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Mean < float64(2*gib) || d.Mean > float64(6*gib) {
+		t.Errorf("mean = %g, want about 4GiB", d.Mean)
+	}
+	if _, err := ExpectedDistribution(128 * gib); err == nil {
+		t.Error("ExpectedDistribution() above the maximum size succeeded")
+	}
+}
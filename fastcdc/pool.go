@@ -0,0 +1,94 @@
+package fastcdc
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// Pool owns a fixed set of reusable chunkers and runs chunking jobs on them,
+// bounding both concurrency and buffer memory to the pool size.
+type Pool struct {
+	chunkers chan *Chunker
+	wg       sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// NewPool creates a Pool of size chunkers configured with the given average
+// size and options, as for NewChunker.
+func NewPool(size, averageSize int, opts ...Option) (*Pool, error) {
+	if size <= 0 {
+		return nil, errors.New("Pool size must be positive")
+	}
+	p := &Pool{chunkers: make(chan *Chunker, size)}
+	for range size {
+		chunker, err := NewChunker(nil, averageSize, opts...)
+		if err != nil {
+			return nil, err
+		}
+		p.chunkers <- chunker
+	}
+	return p, nil
+}
+
+// Do chunks r on a pooled chunker in the calling goroutine, calling fn for
+// every chunk in stream order. It blocks until a chunker is available and
+// returns the first error from reading or from fn. Chunk data passed to fn is
+// only valid until fn returns.
+func (p *Pool) Do(r io.Reader, fn func(Chunk) error) error {
+	chunker := <-p.chunkers
+	defer p.release(chunker)
+	return run(chunker, r, fn)
+}
+
+// Submit chunks r on a pooled chunker in a new goroutine, calling fn for
+// every chunk in stream order. It blocks until a chunker is available, which
+// applies backpressure to producers. Errors are reported by Wait.
+func (p *Pool) Submit(r io.Reader, fn func(Chunk) error) {
+	chunker := <-p.chunkers
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer p.release(chunker)
+		if err := run(chunker, r, fn); err != nil {
+			p.mu.Lock()
+			p.errs = append(p.errs, err)
+			p.mu.Unlock()
+		}
+	}()
+}
+
+// Wait blocks until all submitted jobs have finished and returns their errors
+// joined together, or nil if all succeeded.
+func (p *Pool) Wait() error {
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := errors.Join(p.errs...)
+	p.errs = nil
+	return err
+}
+
+func (p *Pool) release(chunker *Chunker) {
+	// Drop the reference to the job's reader before reuse.
+	chunker.Reset(nil)
+	p.chunkers <- chunker
+}
+
+func run(chunker *Chunker, r io.Reader, fn func(Chunk) error) error {
+	chunker.Reset(r)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(chunk); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package fastcdc
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	pool, err := NewPool(3, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs := make([][]byte, 10)
+	for i := range inputs {
+		inputs[i] = randBytes(20000+i*1000, int64(i))
+	}
+
+	var mu sync.Mutex
+	got := make([][]int, len(inputs))
+	for i, data := range inputs {
+		pool.Submit(bytes.NewReader(data), func(chunk Chunk) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got[i] = append(got[i], chunk.Length)
+			return nil
+		})
+	}
+	if err := pool.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, data := range inputs {
+		chunker, err := NewChunker(bytes.NewReader(data), 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := chunkLengths(t, chunker); !slices.Equal(got[i], want) {
+			t.Errorf("input %d: pooled chunk lengths %v, want %v", i, got[i], want)
+		}
+	}
+}
+
+func TestPool_Errors(t *testing.T) {
+	if _, err := NewPool(0, 1024); err == nil {
+		t.Error("expected error for empty pool")
+	}
+	if _, err := NewPool(2, 1000); err == nil {
+		t.Error("expected error for invalid chunker options")
+	}
+
+	pool, err := NewPool(2, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errStop := errors.New("stop")
+	stop := func(Chunk) error { return errStop }
+
+	if err := pool.Do(bytes.NewReader(randBytes(5000, 1)), stop); err != errStop {
+		t.Errorf("Do() error = %v, want %v", err, errStop)
+	}
+
+	errRead := errors.New("read failed")
+	pool.Submit(&errReader{errRead}, func(Chunk) error { return nil })
+	pool.Submit(bytes.NewReader(randBytes(5000, 2)), stop)
+	err = pool.Wait()
+	if !errors.Is(err, errRead) || !errors.Is(err, errStop) {
+		t.Errorf("Wait() error = %v, want both job errors", err)
+	}
+	if err := pool.Wait(); err != nil {
+		t.Errorf("errors not cleared after Wait: %v", err)
+	}
+
+	// Chunkers are returned to the pool after failed jobs.
+	var n int
+	if err := pool.Do(bytes.NewReader(randBytes(5000, 3)), func(Chunk) error { n++; return nil }); err != nil || n == 0 {
+		t.Errorf("Do() after failures: n=%d err=%v", n, err)
+	}
+}
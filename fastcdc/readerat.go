@@ -0,0 +1,66 @@
+package fastcdc
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ReaderAtChunker chunks regions of an io.ReaderAt with positioned reads,
+// without a shared read position, so that disjoint regions of one file handle
+// can be chunked concurrently. Each region is chunked as a separate stream:
+// its start and end are always boundaries.
+type ReaderAtChunker struct {
+	ra          io.ReaderAt
+	averageSize int
+	opts        []Option
+	chunkers    sync.Pool
+}
+
+// NewReaderAtChunker creates a ReaderAtChunker reading from ra, with the
+// average size and options as for NewChunker.
+func NewReaderAtChunker(ra io.ReaderAt, averageSize int, opts ...Option) (*ReaderAtChunker, error) {
+	// Check the options once so that Chunk cannot fail on them.
+	chunker, err := NewChunker(nil, averageSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c := &ReaderAtChunker{ra: ra, averageSize: averageSize, opts: opts}
+	c.chunkers.Put(chunker)
+	return c, nil
+}
+
+// Chunk chunks the n bytes at offset off, calling fn for every chunk in
+// order, and returns the first error from reading or from fn. Chunk offsets
+// are relative to the start of the ReaderAt, and chunk data passed to fn is
+// only valid until fn returns. Chunk may be called concurrently.
+func (c *ReaderAtChunker) Chunk(off, n int64, fn func(Chunk) error) error {
+	if off < 0 || n < 0 {
+		return errors.New("ReaderAtChunker region must not be negative")
+	}
+	chunker, _ := c.chunkers.Get().(*Chunker)
+	if chunker == nil {
+		var err error
+		if chunker, err = NewChunker(nil, c.averageSize, c.opts...); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		chunker.Reset(nil)
+		c.chunkers.Put(chunker)
+	}()
+	chunker.Reset(io.NewSectionReader(c.ra, off, n))
+	chunker.offsetBase = int(off)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(chunk); err != nil {
+			return err
+		}
+	}
+}
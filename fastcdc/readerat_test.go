@@ -0,0 +1,58 @@
+package fastcdc
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestReaderAtChunker(t *testing.T) {
+	data := randBytes(1<<20, 233)
+	ra := bytes.NewReader(data)
+	c, err := NewReaderAtChunker(ra, 8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Chunk disjoint quarters concurrently and compare each with a section
+	// chunker over the same region.
+	const quarter = 1 << 18
+	got := make([][]Chunk, 4)
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Go(func() {
+			if err := c.Chunk(int64(i*quarter), quarter, func(chunk Chunk) error {
+				chunk.Data = bytes.Clone(chunk.Data)
+				got[i] = append(got[i], chunk)
+				return nil
+			}); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	wg.Wait()
+	for i := range got {
+		section, err := NewSectionChunker(ra, int64(i*quarter), quarter, 8192)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := collectChunks(t, section); !equalChunks(got[i], want) {
+			t.Errorf("quarter %d: %d chunks differ from section chunking with %d", i, len(got[i]), len(want))
+		}
+		if got[i][0].Offset != i*quarter {
+			t.Errorf("quarter %d starts at offset %d", i, got[i][0].Offset)
+		}
+	}
+
+	errStop := errors.New("stop")
+	if err := c.Chunk(0, quarter, func(Chunk) error { return errStop }); err != errStop {
+		t.Errorf("Chunk with failing fn = %v, want %v", err, errStop)
+	}
+	if err := c.Chunk(-1, 10, func(Chunk) error { return nil }); err == nil {
+		t.Error("Chunk with negative offset succeeded")
+	}
+	if _, err := NewReaderAtChunker(ra, 1000); err == nil {
+		t.Error("NewReaderAtChunker with invalid average size succeeded")
+	}
+}
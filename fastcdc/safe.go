@@ -0,0 +1,46 @@
+package fastcdc
+
+import (
+	"io"
+	"sync"
+)
+
+// SafeChunker is a Chunker that is safe for concurrent use, e.g. when it is
+// shared behind a connection pool. Calls to Next and Reset are serialized,
+// and because another goroutine's call to Next may overwrite the internal
+// buffer at any time, Next returns chunks whose Data is a copy owned by the
+// caller.
+type SafeChunker struct {
+	mu      sync.Mutex
+	chunker *Chunker
+}
+
+// NewSafeChunker creates a SafeChunker with the given average size and
+// options, as for NewChunker.
+func NewSafeChunker(rd io.Reader, averageSize int, opts ...Option) (*SafeChunker, error) {
+	chunker, err := NewChunker(rd, averageSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &SafeChunker{chunker: chunker}, nil
+}
+
+// Next returns the next chunk, or io.EOF when the stream is exhausted. The
+// chunk's Data slice remains valid after later calls.
+func (s *SafeChunker) Next() (Chunk, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	chunk, err := s.chunker.Next()
+	if err != nil {
+		return chunk, err
+	}
+	chunk.Data = append([]byte(nil), chunk.Data...)
+	return chunk, nil
+}
+
+// Reset reinitializes the chunker with a new reader, as for Chunker Reset.
+func (s *SafeChunker) Reset(rd io.Reader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunker.Reset(rd)
+}
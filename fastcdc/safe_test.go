@@ -0,0 +1,136 @@
+package fastcdc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestSafeChunker(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	chunker, err := NewSafeChunker(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu     sync.Mutex
+		chunks = make(map[int][]byte)
+		wg     sync.WaitGroup
+	)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				chunk, err := chunker.Next()
+				if err == io.EOF {
+					return
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				chunks[chunk.Offset] = chunk.Data
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var offset int
+	for offset < len(data) {
+		chunk, ok := chunks[offset]
+		if !ok {
+			t.Fatalf("no chunk at offset %d", offset)
+		}
+		if !bytes.Equal(chunk, data[offset:offset+len(chunk)]) {
+			t.Fatalf("chunk at offset %d differs from input", offset)
+		}
+		offset += len(chunk)
+	}
+}
+
+// blockingReader blocks every read until release is closed.
+type blockingReader struct {
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingReader) Read(p []byte) (int, error) {
+	close(r.reading)
+	<-r.release
+	return 0, io.EOF
+}
+
+func TestDebug_ConcurrentUse(t *testing.T) {
+	r := &blockingReader{reading: make(chan struct{}), release: make(chan struct{})}
+	chunker, err := NewChunker(r, 1024, WithDebug())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := chunker.Next()
+		done <- err
+	}()
+	<-r.reading
+	if _, err := chunker.Next(); !errors.Is(err, ErrConcurrentUse) {
+		t.Errorf("overlapping Next() error = %v, want ErrConcurrentUse", err)
+	}
+	// An overlapping Reset is dropped and reported by the next call.
+	chunker.Reset(bytes.NewReader([]byte("data")))
+	close(r.release)
+	if err := <-done; err != io.EOF {
+		t.Errorf("first Next() error = %v, want io.EOF", err)
+	}
+	if _, err := chunker.Next(); !errors.Is(err, ErrConcurrentUse) {
+		t.Errorf("Next() after overlapping Reset error = %v, want ErrConcurrentUse", err)
+	}
+
+	// A clean Reset recovers the chunker.
+	chunker.Reset(bytes.NewReader([]byte("data")))
+	chunk, err := chunker.Next()
+	if err != nil || string(chunk.Data) != "data" {
+		t.Errorf("Next() after Reset = %q, %v, want \"data\"", chunk.Data, err)
+	}
+}
+
+func TestDebug_PoisonData(t *testing.T) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(2)).Read(data)
+	chunker, err := NewChunker(bytes.NewReader(data), 1024, WithDebug())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := chunker.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Data, data[:first.Length]) {
+		t.Fatal("first chunk differs from input before the next call")
+	}
+	second, err := chunker.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bytes.Repeat([]byte{0xde, 0xad, 0xbe, 0xef}, first.Length/4+1)[:first.Length]
+	if !bytes.Equal(first.Data, want) {
+		t.Error("first chunk's data was not poisoned by Next")
+	}
+	if !bytes.Equal(second.Data, data[second.Offset:second.Offset+second.Length]) {
+		t.Error("second chunk differs from input")
+	}
+
+	chunker.Reset(bytes.NewReader(data))
+	if bytes.Equal(second.Data, data[second.Offset:second.Offset+second.Length]) {
+		t.Error("second chunk's data was not poisoned by Reset")
+	}
+}
@@ -0,0 +1,96 @@
+package fastcdc
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+)
+
+// SkipRange is a region of the stream excluded from chunking.
+type SkipRange struct {
+	Offset int64
+	Length int64
+}
+
+// WithSkipRanges excludes regions of the stream from content-defined
+// chunking, e.g. embedded signatures or timestamps that would otherwise
+// change the chunks around them, or holes known to be zero. Each region is
+// returned as a single chunk cut with CutSkip and no Data, whatever its
+// length, so that offsets still follow the stream; the chunk before it is
+// cut at its start as for a boundary hint. Offsets are in the same
+// coordinates as Chunk.Offset, and ranges must not overlap.
+func WithSkipRanges(ranges []SkipRange) Option {
+	return func(o *options) {
+		o.skipRanges = ranges
+	}
+}
+
+// validateSkipRanges checks ranges sorted by offset.
+func validateSkipRanges(ranges []SkipRange) error {
+	for i, r := range ranges {
+		if r.Offset < 0 || r.Length <= 0 {
+			return errors.New("SkipRanges must have a non-negative offset and a positive length")
+		}
+		if i > 0 && ranges[i-1].Offset+ranges[i-1].Length > r.Offset {
+			return errors.New("SkipRanges must not overlap")
+		}
+	}
+	return nil
+}
+
+// sortedSkipRanges returns a sorted copy of ranges.
+func sortedSkipRanges(ranges []SkipRange) []SkipRange {
+	return slices.SortedFunc(slices.Values(ranges), func(a, b SkipRange) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+}
+
+// skipLength returns the number of bytes of a skip range from the current
+// position, or 0 if the position is not in one.
+func (c *Chunker) skipLength() int {
+	pos := int64(c.offsetBase + c.streamPos)
+	for c.skipIndex < len(c.skipRanges) {
+		r := c.skipRanges[c.skipIndex]
+		if r.Offset+r.Length <= pos {
+			c.skipIndex++
+			continue
+		}
+		if r.Offset <= pos {
+			return int(r.Offset + r.Length - pos)
+		}
+		break
+	}
+	return 0
+}
+
+// skip consumes up to n bytes of the stream and returns them as a CutSkip
+// chunk.
+func (c *Chunker) skip(n int) (Chunk, error) {
+	chunk := Chunk{Offset: c.offsetBase + c.streamPos, Cut: CutSkip}
+	for {
+		k := min(n-chunk.Length, c.bufEnd-c.bufCursor)
+		c.bufCursor += k
+		c.streamPos += k
+		chunk.Length += k
+		if chunk.Length == n || c.readerEOF || c.drained {
+			break
+		}
+		if err := c.refill(); err != nil {
+			// Emit what was skipped; the rest is skipped on retry.
+			if chunk.Length == 0 {
+				return Chunk{}, err
+			}
+			break
+		}
+	}
+
+	c.chunksEmitted++
+	if c.observer != nil {
+		c.observer.ObserveChunk(chunk.Length)
+	}
+	if c.progress != nil && c.streamPos >= c.progressNext {
+		c.progressNext = c.streamPos - c.streamPos%c.progressInterval + c.progressInterval
+		c.reportProgress()
+	}
+	return chunk, nil
+}
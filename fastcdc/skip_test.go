@@ -0,0 +1,63 @@
+package fastcdc
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+	"testing/iotest"
+)
+
+func TestChunker_SkipRanges(t *testing.T) {
+	data := randBytes(200000, 48)
+	ranges := []SkipRange{{120000, 100}, {50000, 10000}, {199990, 1000}}
+
+	// Between skip ranges, chunks are those of each segment on its own.
+	var want []int
+	for _, seg := range [][2]int{{0, 50000}, {60000, 120000}, {120100, 199990}} {
+		chunker, err := NewChunker(bytes.NewReader(data[seg[0]:seg[1]]), 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, chunkLengths(t, chunker)...)
+	}
+
+	for _, r := range []io.Reader{bytes.NewReader(data), iotest.HalfReader(bytes.NewReader(data))} {
+		chunker, err := NewChunker(r, 1024, WithSkipRanges(ranges))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		var offset int
+		for _, c := range collectChunks(t, chunker) {
+			if c.Offset != offset {
+				t.Fatalf("chunk at %d, want %d", c.Offset, offset)
+			}
+			offset += c.Length
+			if c.Cut != CutSkip {
+				if !bytes.Equal(c.Data, data[c.Offset:offset]) {
+					t.Fatalf("chunk at %d does not match the input", c.Offset)
+				}
+				got = append(got, c.Length)
+				continue
+			}
+			if c.Data != nil || !slices.ContainsFunc(ranges, func(r SkipRange) bool {
+				return r.Offset == int64(c.Offset) && min(r.Offset+r.Length, int64(len(data))) == int64(offset)
+			}) {
+				t.Errorf("skip chunk %d+%d with %d bytes of data does not match a range", c.Offset, c.Length, len(c.Data))
+			}
+		}
+		if offset != len(data) {
+			t.Errorf("chunks cover %d bytes, want %d", offset, len(data))
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("lengths = %v, want %v", got, want)
+		}
+	}
+
+	for _, ranges := range [][]SkipRange{{{-1, 10}}, {{0, 0}}, {{100, 10}, {0, 101}}} {
+		if _, err := NewChunker(nil, 1024, WithSkipRanges(ranges)); err == nil {
+			t.Errorf("NewChunker() with skip ranges %v succeeded", ranges)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package fastcdc
+
+import (
+	"io"
+	"math"
+	"os"
+)
+
+// sparseFile reads a regular file, filling its holes with zeros instead of
+// reading them, so that chunking a sparse file such as a VM image does not
+// read the unallocated regions from disk. Holes are found with the
+// SEEK_DATA and SEEK_HOLE whences of lseek. Where those are not supported,
+// the whole file is read as data. The file offset is kept in step with the
+// bytes returned, as if the file were read directly.
+type sparseFile struct {
+	f    *os.File
+	pos  int64 // Offset of the next byte.
+	size int64 // Size when opened; later data is read as is.
+	end  int64 // End of the region containing pos.
+	hole bool  // Whether that region is a hole.
+}
+
+// open starts reading f from its current offset, reporting false if f is
+// not a regular file or holes cannot be found on this platform.
+func (s *sparseFile) open(f *os.File) bool {
+	if !sparseSupported {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false
+	}
+	*s = sparseFile{f: f, pos: pos, size: fi.Size(), end: pos}
+	return true
+}
+
+func (s *sparseFile) Read(p []byte) (int, error) {
+	if s.pos >= s.end {
+		if err := s.nextRegion(); err != nil {
+			return 0, err
+		}
+	}
+	p = p[:min(int64(len(p)), s.end-s.pos)]
+	if !s.hole {
+		n, err := s.f.Read(p)
+		s.pos += int64(n)
+		return n, err
+	}
+	if _, err := s.f.Seek(int64(len(p)), io.SeekCurrent); err != nil {
+		return 0, err
+	}
+	clear(p)
+	s.pos += int64(len(p))
+	return len(p), nil
+}
+
+// nextRegion finds the region starting at pos. Past the size of the file,
+// or if lseek does not support holes, the rest of the file is one region
+// of data.
+func (s *sparseFile) nextRegion() error {
+	s.hole, s.end = false, math.MaxInt64
+	data, err := s.f.Seek(s.pos, seekData)
+	switch {
+	case isNoData(err):
+		// No data past pos.
+		if s.pos < s.size {
+			s.hole, s.end = true, s.size
+		}
+	case err != nil:
+	case data > s.pos:
+		s.hole, s.end = true, data
+	default:
+		if end, err := s.f.Seek(s.pos, seekHole); err == nil && end > s.pos {
+			s.end = end
+		}
+	}
+	// Probing moved the file offset.
+	_, err = s.f.Seek(s.pos, io.SeekStart)
+	return err
+}
@@ -0,0 +1,21 @@
+package fastcdc
+
+import (
+	"errors"
+	"syscall"
+)
+
+// sparseSupported reports whether lseek can find holes.
+const sparseSupported = true
+
+// Whences of lseek for finding data and holes.
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// isNoData reports whether err is lseek's report that there is no data past
+// the offset sought from.
+func isNoData(err error) bool {
+	return errors.Is(err, syscall.ENXIO)
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package fastcdc
+
+// sparseSupported reports whether lseek can find holes.
+const sparseSupported = false
+
+// Whences of lseek for finding data and holes, unused.
+const (
+	seekData = -1
+	seekHole = -1
+)
+
+// isNoData is never called, since lseek is not used to find holes.
+func isNoData(err error) bool {
+	return false
+}
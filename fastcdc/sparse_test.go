@@ -0,0 +1,108 @@
+package fastcdc
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChunker_SparseFile(t *testing.T) {
+	// Data, a hole of 4MiB, data, and a trailing hole.
+	path := filepath.Join(t.TempDir(), "sparse")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Write(randBytes(100000, 49)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(randBytes(100000, 50), 100000+4<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(8 << 20); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunker, err := NewChunker(bytes.NewReader(data), 16384)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := collectChunks(t, chunker)
+
+	for _, start := range []int64{0, 12345} {
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		chunker.Reset(f)
+		if sparseSupported && chunker.reader != &chunker.sparse {
+			t.Fatal("file not read as sparse")
+		}
+		got := collectChunks(t, chunker)
+		if start == 0 && !equalChunks(got, want) {
+			t.Errorf("chunks of sparse file differ from its contents")
+		}
+		var offset int
+		for _, c := range got {
+			if !bytes.Equal(c.Data, data[int(start)+offset:int(start)+offset+c.Length]) {
+				t.Fatalf("chunk at %d does not match the file", c.Offset)
+			}
+			offset += c.Length
+		}
+		if pos, _ := f.Seek(0, io.SeekCurrent); pos != int64(len(data)) || int(start)+offset != len(data) {
+			t.Errorf("chunked %d bytes from %d, file offset %d, want %d", offset, start, pos, len(data))
+		}
+	}
+
+	// WithReadHoles reads the file as is, with the same chunks.
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	dense, err := NewChunker(f, 16384, WithReadHoles())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dense.reader != f {
+		t.Error("file read as sparse despite WithReadHoles")
+	}
+	if got := collectChunks(t, dense); !equalChunks(got, want) {
+		t.Error("chunks with WithReadHoles differ from the file's contents")
+	}
+
+	// The file offset follows the bytes read, also inside holes.
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	chunker, err = NewChunker(f, 16384, WithMaxBytes(3<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectChunks(t, chunker)
+	if pos, _ := f.Seek(0, io.SeekCurrent); pos != 3<<20 {
+		t.Errorf("file offset %d after chunking 3MiB, want %d", pos, 3<<20)
+	}
+
+	if !sparseSupported {
+		return
+	}
+	var s sparseFile
+	if !s.open(f) {
+		t.Fatal("open failed")
+	}
+	s.pos = 200000
+	if err := s.nextRegion(); err != nil {
+		t.Fatal(err)
+	}
+	if !s.hole {
+		t.Skip("file system does not report holes")
+	}
+	if s.end < 1<<20 || s.end > 100000+4<<20 {
+		t.Errorf("hole at 200000 ends at %d", s.end)
+	}
+}
@@ -0,0 +1,116 @@
+package fastcdc
+
+// unroll4Tables holds the gear table shifted for cut4. Bytes at positions
+// 4k, 4k+1, 4k+2 and 4k+3 of a block are hashed with the table shifted by 3,
+// 2, 1 and 0 bits, so that a block costs a single shift of the fingerprint.
+type unroll4Tables struct {
+	gearShifted2 [256]uint64
+	gearShifted3 [256]uint64
+}
+
+// newUnroll4Tables returns the tables for cut4 derived from a seeded gear
+// table, or nil if cut4 cannot reproduce the boundaries of cut for the given
+// masks: the shifted masks must not lose any bits.
+func newUnroll4Tables(gear *[256]uint64, maskSmall, maskLarge uint64) *unroll4Tables {
+	if maskSmall>>61 != 0 || maskLarge>>61 != 0 {
+		return nil
+	}
+	t := new(unroll4Tables)
+	for i, g := range gear {
+		t.gearShifted2[i] = g << 2
+		t.gearShifted3[i] = g << 3
+	}
+	return t
+}
+
+// cutGear is cut, or cut4 if CutUnroll4 is selected.
+func (c *Chunker) cutGear(data []byte) (int, uint64) {
+	if c.gear4 != nil {
+		return c.cut4(data)
+	}
+	return c.cut(data)
+}
+
+// cut4 is cut processing 4 bytes per iteration. Within a block each
+// position is tested against the mask shifted to match its table, and the
+// fingerprint of a cut is recomputed as cut reports it, so the boundaries
+// and fingerprints are identical to those of cut.
+func (c *Chunker) cut4(data []byte) (int, uint64) {
+	localGear := &c.gear
+
+	dataLen := len(data)
+	if dataLen <= c.minSize {
+		return dataLen, 0
+	}
+	if c.minSize == c.maxSize {
+		return c.maxSize, 0
+	}
+	maxBoundary := min(dataLen, c.maxSize)
+	normalizeBoundary := min(c.normalizeSize, maxBoundary)
+
+	scanStart := c.minSize &^ 1
+	normalizeAt := normalizeBoundary &^ 1
+	scanEnd := maxBoundary &^ 1
+
+	var fingerprint uint64
+	if c.scanPos > 0 {
+		scanStart, fingerprint = c.scanPos, c.scanFP
+	} else {
+		for i := max(scanStart-c.warmup, 0); i < scanStart; i++ {
+			fingerprint = (fingerprint << 1) + localGear[data[i]]
+		}
+	}
+
+	i, fingerprint, ok := c.scan4(data, scanStart, normalizeAt, fingerprint, c.maskSmall)
+	if ok {
+		return i, fingerprint
+	}
+	i, fingerprint, ok = c.scan4(data, max(normalizeAt, scanStart), scanEnd, fingerprint, c.maskLarge)
+	if ok {
+		return i, fingerprint
+	}
+	return maxBoundary, fingerprint
+}
+
+// scan4 hashes data[start:end] into fingerprint, testing each position
+// against mask, and reports the first cut. end-start must be even.
+func (c *Chunker) scan4(data []byte, start, end int, fingerprint, mask uint64) (int, uint64, bool) {
+	g0 := &c.gear
+	g1 := &c.gearShifted
+	g2 := &c.gear4.gearShifted2
+	g3 := &c.gear4.gearShifted3
+	mask1, mask2, mask3 := mask<<1, mask<<2, mask<<3
+
+	i := start
+	for ; i+4 <= end; i += 4 {
+		b := data[i : i+4 : i+4]
+		h := (fingerprint << 4) + g3[b[0]]
+		if h&mask3 == 0 {
+			return i, (fingerprint << 2) + g1[b[0]], true
+		}
+		h += g2[b[1]]
+		if h&mask2 == 0 {
+			return i + 1, (fingerprint << 2) + g1[b[0]] + g0[b[1]], true
+		}
+		h += g1[b[2]]
+		if h&mask1 == 0 {
+			return i + 2, h, true
+		}
+		h += g0[b[3]]
+		if h&mask == 0 {
+			return i + 3, h, true
+		}
+		fingerprint = h
+	}
+	if i < end {
+		fingerprint = (fingerprint << 2) + g1[data[i]]
+		if fingerprint&mask1 == 0 {
+			return i, fingerprint, true
+		}
+		fingerprint += g0[data[i+1]]
+		if fingerprint&mask == 0 {
+			return i + 1, fingerprint, true
+		}
+	}
+	return end, fingerprint, false
+}
@@ -0,0 +1,53 @@
+package fastcdc
+
+import "testing"
+
+func TestCut4(t *testing.T) {
+	data := randBytes(1<<20, 201)
+	configs := []struct {
+		name string
+		avg  int
+		opts []Option
+	}{
+		{"default", 4096, nil},
+		{"seed", 4096, []Option{WithSeed(0x9e3779b97f4a7c15)}},
+		{"odd", 1024, []Option{WithMinSize(257), WithMaxSize(4099)}},
+		{"norm0", 256, []Option{WithNormalization(0)}},
+		{"norm3", 8192, []Option{WithNormalization(3)}},
+		{"warmup", 2048, []Option{WithWarmup(64)}},
+		{"masks", 2048, []Option{WithMaskPair(1<<60|0xfff, 0xff)}},
+	}
+	for _, cfg := range configs {
+		t.Run(cfg.name, func(t *testing.T) {
+			c, err := NewChunker(nil, cfg.avg, cfg.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.gear4 = newUnroll4Tables(&c.gear, c.maskSmall, c.maskLarge)
+			if c.gear4 == nil {
+				t.Fatal("cut4 not supported for masks")
+			}
+			for off := 0; off < len(data); {
+				// Vary the window length to cover every leftover of a
+				// 4-byte block.
+				window := data[off:min(off+c.maxSize-off%7, len(data))]
+				wantLen, wantFP := c.cut(window)
+				gotLen, gotFP := c.cut4(window)
+				if gotLen != wantLen || gotFP != wantFP {
+					t.Fatalf("offset %d: cut4 = (%d, %#x), cut = (%d, %#x)", off, gotLen, gotFP, wantLen, wantFP)
+				}
+				off += wantLen
+			}
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		c, err := NewChunker(nil, 4096, WithMaskPair(1<<62, 1<<61))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tables := newUnroll4Tables(&c.gear, c.maskSmall, c.maskLarge); tables != nil {
+			t.Error("cut4 used for masks with high bits set")
+		}
+	})
+}
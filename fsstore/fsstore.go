@@ -0,0 +1,270 @@
+// Package fsstore stores chunks as individual files in a directory.
+//
+// Each chunk is stored in a file named by its hex digest, in a subdirectory
+// named by the first two characters of the digest so that no directory grows
+// too large. Unlike pack files, individual chunks can be deleted, which makes
+// a Store suitable as a bounded local cache.
+//
+// Chunk files are written crash-safely: to a temporary file that is synced
+// and then renamed into place. Each file ends with a trailer holding the
+// chunk length and its CRC-32C, so that a file truncated or damaged by a
+// power loss is detected when read instead of poisoning reassembly, and
+// Recover can sweep such files after a crash.
+package fsstore
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	tempPrefix    = ".tmp-"
+	quarantineDir = ".quarantine"
+
+	// trailerSize is the size of the chunk length (uint64 LE) and CRC-32C
+	// (uint32 LE) that end every chunk file.
+	trailerSize = 12
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupt is returned when a chunk file is truncated or damaged.
+var ErrCorrupt = errors.New("corrupt chunk file")
+
+// Store is a directory of chunk files. It is safe for concurrent use.
+type Store struct {
+	path string
+}
+
+// Open opens the store at path, creating the directory if necessary.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, err
+	}
+	return &Store{path: path}, nil
+}
+
+// Has reports whether a chunk is stored. It does not verify the chunk.
+func (s *Store) Has(digest string) bool {
+	name, err := s.name(digest)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(name)
+	return err == nil
+}
+
+// Get returns the contents of a stored chunk. Missing chunks are reported
+// with an error wrapping os.ErrNotExist, and damaged ones with an error
+// wrapping ErrCorrupt.
+func (s *Store) Get(digest string) ([]byte, error) {
+	name, err := s.name(digest)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := decode(buf)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", digest, err)
+	}
+	return data, nil
+}
+
+// Put stores a chunk unless it is already stored. The chunk is written to a
+// temporary file, synced, and renamed into place, so that neither readers
+// nor a crash can leave a partial chunk under its final name.
+func (s *Store) Put(digest string, data []byte) error {
+	name, err := s.name(digest)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(name); err == nil {
+		return nil
+	}
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, tempPrefix)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(encode(data))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return syncDir(dir)
+}
+
+// Delete removes a chunk. Deleting a missing chunk is not an error.
+func (s *Store) Delete(digest string) error {
+	name, err := s.name(digest)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Quarantine moves a chunk out of the store into its quarantine
+// subdirectory, where it is kept for inspection but no longer served.
+func (s *Store) Quarantine(digest string) error {
+	name, err := s.name(digest)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(s.path, quarantineDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.Rename(name, filepath.Join(dir, digest))
+}
+
+// Walk calls fn with the digest and size of every stored chunk, in no
+// particular order, until fn returns an error. Sizes are taken from file
+// sizes; chunks are not verified.
+func (s *Store) Walk(fn func(digest string, size int64) error) error {
+	return s.walk(func(digest, _ string, size int64) error {
+		return fn(digest, max(size-trailerSize, 0))
+	})
+}
+
+// RecoveryStats reports what Recover found.
+type RecoveryStats struct {
+	// Checked is the number of chunk files verified.
+	Checked int
+	// Corrupt lists the digests of chunk files that failed verification
+	// and were quarantined.
+	Corrupt []string
+	// TempFiles is the number of leftover temporary files removed.
+	TempFiles int
+}
+
+// Recover checks the store after a crash: it removes temporary files left
+// by interrupted Puts and verifies every chunk file, quarantining those that
+// are truncated or damaged. It must not run concurrently with Put.
+func (s *Store) Recover() (RecoveryStats, error) {
+	var stats RecoveryStats
+	err := filepath.WalkDir(s.path, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() && de.Name() == quarantineDir {
+			return filepath.SkipDir
+		}
+		if de.Type().IsRegular() && strings.HasPrefix(de.Name(), tempPrefix) {
+			stats.TempFiles++
+			return os.Remove(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+	err = s.walk(func(digest, path string, _ int64) error {
+		stats.Checked++
+		buf, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if _, err := decode(buf); err == nil {
+			return nil
+		}
+		stats.Corrupt = append(stats.Corrupt, digest)
+		return s.Quarantine(digest)
+	})
+	return stats, err
+}
+
+// walk calls fn with the digest, path, and file size of every chunk file.
+func (s *Store) walk(fn func(digest, path string, size int64) error) error {
+	return filepath.WalkDir(s.path, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() && de.Name() == quarantineDir {
+			return filepath.SkipDir
+		}
+		if !de.Type().IsRegular() || !validDigest(de.Name()) {
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			return err
+		}
+		return fn(de.Name(), path, info.Size())
+	})
+}
+
+// name returns the file name of a chunk.
+func (s *Store) name(digest string) (string, error) {
+	if !validDigest(digest) {
+		return "", fmt.Errorf("invalid chunk digest %q", digest)
+	}
+	return filepath.Join(s.path, digest[:2], digest), nil
+}
+
+// validDigest reports whether digest is a lowercase hex string long enough
+// to be stored.
+func validDigest(digest string) bool {
+	if len(digest) < 4 || strings.ToLower(digest) != digest {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+// encode appends the trailer to data.
+func encode(data []byte) []byte {
+	buf := make([]byte, 0, len(data)+trailerSize)
+	buf = append(buf, data...)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(data)))
+	return binary.LittleEndian.AppendUint32(buf, crc32.Checksum(data, castagnoli))
+}
+
+// decode verifies the trailer of a chunk file and returns the chunk data.
+func decode(buf []byte) ([]byte, error) {
+	if len(buf) < trailerSize {
+		return nil, fmt.Errorf("%w: truncated", ErrCorrupt)
+	}
+	data, trailer := buf[:len(buf)-trailerSize], buf[len(buf)-trailerSize:]
+	if binary.LittleEndian.Uint64(trailer) != uint64(len(data)) {
+		return nil, fmt.Errorf("%w: length mismatch", ErrCorrupt)
+	}
+	if binary.LittleEndian.Uint32(trailer[8:]) != crc32.Checksum(data, castagnoli) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+	return data, nil
+}
+
+// syncDir syncs a directory so that renames within it are durable.
+func syncDir(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
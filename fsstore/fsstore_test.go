@@ -0,0 +1,138 @@
+package fsstore
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+func TestStore(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("hello, chunk")
+	digest := manifest.Digest(data)
+
+	if s.Has(digest) {
+		t.Error("Has() before Put = true")
+	}
+	if _, err := s.Get(digest); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get() before Put = %v, want ErrNotExist", err)
+	}
+	for range 2 {
+		if err := s.Put(digest, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := s.Get(digest); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Get() = %q, %v, want %q", got, err, data)
+	}
+
+	var walked []string
+	if err := s.Walk(func(d string, size int64) error {
+		if size != int64(len(data)) {
+			t.Errorf("Walk() size = %d, want %d", size, len(data))
+		}
+		walked = append(walked, d)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(walked) != 1 || walked[0] != digest {
+		t.Errorf("Walk() = %v, want [%s]", walked, digest)
+	}
+
+	if err := s.Delete(digest); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(digest); err != nil {
+		t.Errorf("second Delete() = %v", err)
+	}
+	if s.Has(digest) {
+		t.Error("Has() after Delete = true")
+	}
+
+	for _, bad := range []string{"", "../../etc/passwd", "ABCD", "xyzw"} {
+		if err := s.Put(bad, data); err == nil {
+			t.Errorf("Put(%q) succeeded", bad)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(s.path, digest[:2]))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("directory holds %v, %v, want no leftover files", entries, err)
+	}
+}
+
+func TestStore_Recover(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var digests []string
+	for i := range 3 {
+		data := bytes.Repeat([]byte{byte(i)}, 1000)
+		digest := manifest.Digest(data)
+		digests = append(digests, digest)
+		if err := s.Put(digest, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Simulate a power loss: one chunk file is truncated, another has a
+	// flipped bit, and an interrupted Put left a temporary file.
+	name := func(digest string) string {
+		n, err := s.name(digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if err := os.Truncate(name(digests[0]), 500); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := os.ReadFile(name(digests[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf[10] ^= 1
+	if err := os.WriteFile(name(digests[1]), buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(name(digests[2])), tempPrefix+"1"), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range digests[:2] {
+		if _, err := s.Get(d); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Get() of damaged chunk = %v, want %v", err, ErrCorrupt)
+		}
+	}
+
+	stats, err := s.Recover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Checked != 3 || len(stats.Corrupt) != 2 || stats.TempFiles != 1 {
+		t.Errorf("Recover() = %+v, want 3 checked, 2 corrupt, 1 temp file", stats)
+	}
+	if s.Has(digests[0]) || s.Has(digests[1]) || !s.Has(digests[2]) {
+		t.Error("Recover() did not quarantine exactly the damaged chunks")
+	}
+	if _, err := os.Stat(filepath.Join(s.path, quarantineDir, digests[0])); err != nil {
+		t.Errorf("quarantined chunk: %v", err)
+	}
+
+	// Quarantined chunks can be stored again.
+	if err := s.Put(digests[0], bytes.Repeat([]byte{0}, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := s.Recover(); err != nil || len(stats.Corrupt) != 0 || stats.Checked != 2 {
+		t.Errorf("second Recover() = %+v, %v", stats, err)
+	}
+}
@@ -0,0 +1,192 @@
+package index
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Filter is a Bloom filter of digests. It never reports an added digest as
+// absent, and reports a digest that was not added as possibly present with
+// the false positive rate it was sized for.
+//
+// A Filter is not safe for concurrent use; the Index serializes access to
+// its filter.
+type Filter struct {
+	bits []uint64
+	k    int
+}
+
+// NewFilter returns a filter sized for n digests at the given false positive
+// rate.
+func NewFilter(n int, fpRate float64) (*Filter, error) {
+	if n < 0 {
+		return nil, errors.New("filter size must be non-negative")
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		return nil, errors.New("false positive rate must be between 0 and 1")
+	}
+	m := math.Ceil(-float64(max(n, 1)) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := max(1, int(math.Round(m/float64(max(n, 1))*math.Ln2)))
+	return &Filter{bits: make([]uint64, (int(m)+63)/64), k: k}, nil
+}
+
+// locations returns the two hashes from which the k bit positions of a
+// digest are derived.
+func (f *Filter) locations(digest string) (uint64, uint64) {
+	h := fnv.New128a()
+	h.Write([]byte(digest))
+	var sum [16]byte
+	h.Sum(sum[:0])
+	return binary.LittleEndian.Uint64(sum[:8]), binary.LittleEndian.Uint64(sum[8:]) | 1
+}
+
+// Add adds a digest to the filter.
+func (f *Filter) Add(digest string) {
+	h1, h2 := f.locations(digest)
+	m := uint64(len(f.bits)) * 64
+	for i := range f.k {
+		bit := (h1 + uint64(i)*h2) % m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// MayContain reports whether a digest may have been added. It is false only
+// if the digest was definitely not added.
+func (f *Filter) MayContain(digest string) bool {
+	h1, h2 := f.locations(digest)
+	m := uint64(len(f.bits)) * 64
+	for i := range f.k {
+		bit := (h1 + uint64(i)*h2) % m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// filterEncodingVersion is the first byte of the binary encoding of a
+// Filter.
+const filterEncodingVersion = 1
+
+// MarshalBinary encodes the filter as a version byte, the number of hashes
+// and of 64-bit words as uvarints, and the words in little-endian order.
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	buf := []byte{filterEncodingVersion}
+	buf = binary.AppendUvarint(buf, uint64(f.k))
+	buf = binary.AppendUvarint(buf, uint64(len(f.bits)))
+	for _, w := range f.bits {
+		buf = binary.LittleEndian.AppendUint64(buf, w)
+	}
+	return buf, nil
+}
+
+var errCorruptFilter = errors.New("corrupt filter")
+
+// UnmarshalBinary decodes a filter encoded by MarshalBinary into f.
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != filterEncodingVersion {
+		return fmt.Errorf("%w: unknown version", errCorruptFilter)
+	}
+	data = data[1:]
+	k, n := binary.Uvarint(data)
+	if n <= 0 || k == 0 || k > 64 {
+		return errCorruptFilter
+	}
+	data = data[n:]
+	words, n := binary.Uvarint(data)
+	if n <= 0 || words == 0 || uint64(len(data)-n) != words*8 {
+		return errCorruptFilter
+	}
+	data = data[n:]
+	bits := make([]uint64, words)
+	for i := range bits {
+		bits[i] = binary.LittleEndian.Uint64(data[i*8:])
+	}
+	*f = Filter{bits: bits, k: int(k)}
+	return nil
+}
+
+// BuildFilter puts a Bloom filter in front of the index, sized for
+// max(expected, current size) chunks at the given false positive rate and
+// filled with every indexed chunk. Has and FindMissing of chunks the filter
+// rules out, such as the new chunks of a large initial ingest, then skip the
+// KV. Get and every update still read the KV, so a stale filter cannot
+// corrupt reference counts.
+// Removing chunks leaves them in the filter, so rebuild it once many chunks
+// have been swept, or once the index outgrows expected.
+func (ix *Index) BuildFilter(expected int, fpRate float64) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	var digests []string
+	err := ix.kv.Range(func(key string, value []byte) bool {
+		digests = append(digests, key)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	f, err := NewFilter(max(expected, len(digests)), fpRate)
+	if err != nil {
+		return err
+	}
+	for _, d := range digests {
+		f.Add(d)
+	}
+	ix.filter = f
+	return nil
+}
+
+// SaveFilter writes the index's filter to path, crash-safely like Save. It
+// must be saved whenever the index is, since a stale filter would make Has
+// and FindMissing report the chunks added since as missing.
+func (ix *Index) SaveFilter(path string) error {
+	ix.mu.RLock()
+	if ix.filter == nil {
+		ix.mu.RUnlock()
+		return errors.New("index has no filter")
+	}
+	data, err := ix.filter.MarshalBinary()
+	ix.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadFilter puts the filter written by SaveFilter to path in front of the
+// index, avoiding the full scan of BuildFilter on startup.
+func (ix *Index) LoadFilter(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	f := &Filter{}
+	if err := f.UnmarshalBinary(data); err != nil {
+		return fmt.Errorf("loading filter %s: %w", path, err)
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.filter = f
+	return nil
+}
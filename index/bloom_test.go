@@ -0,0 +1,148 @@
+package index
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// countingKV is a MemKV that counts Get calls.
+type countingKV struct {
+	MemKV
+	gets int
+}
+
+func (kv *countingKV) Get(key string) ([]byte, bool, error) {
+	kv.gets++
+	return kv.MemKV.Get(key)
+}
+
+func TestFilter(t *testing.T) {
+	if _, err := NewFilter(10, 0); err == nil {
+		t.Error("expected error for a zero false positive rate")
+	}
+	f, err := NewFilter(10000, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 10000 {
+		f.Add(fmt.Sprint("added", i))
+	}
+	falsePositives := 0
+	for i := range 10000 {
+		if !f.MayContain(fmt.Sprint("added", i)) {
+			t.Fatalf("added digest %d reported absent", i)
+		}
+		if f.MayContain(fmt.Sprint("other", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 200 {
+		t.Errorf("%d false positives in 10000 lookups, want about 100", falsePositives)
+	}
+
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Filter
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.k != f.k || !slices.Equal(decoded.bits, f.bits) {
+		t.Error("decoded filter differs")
+	}
+	if err := decoded.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Error("expected error decoding a truncated filter")
+	}
+}
+
+func TestIndex_Filter(t *testing.T) {
+	kv := &countingKV{MemKV: MemKV{}}
+	ix := New(kv)
+	for i := range 100 {
+		if _, err := ix.Add(fmt.Sprint("old", i), 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ix.BuildFilter(10000, 0.01); err != nil {
+		t.Fatal(err)
+	}
+
+	// An ingest of new chunks rarely reaches the KV to find them missing.
+	kv.gets = 0
+	var digests []string
+	for i := range 5000 {
+		digests = append(digests, fmt.Sprint("new", i))
+	}
+	digests = append(digests, "old7")
+	missing, err := ix.FindMissing(digests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 5000 || slices.Contains(missing, "old7") {
+		t.Errorf("FindMissing() returned %d digests, want the 5000 new ones", len(missing))
+	}
+	if kv.gets > 100 {
+		t.Errorf("FindMissing() made %d KV lookups, want about 50", kv.gets)
+	}
+
+	// Chunks added after the filter was built are found.
+	if _, err := ix.Add("new1", 10); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := ix.Has("new1"); err != nil || !ok {
+		t.Errorf("Has(new1) = %v, %v after Add", ok, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "filter")
+	if err := ix.SaveFilter(path); err != nil {
+		t.Fatal(err)
+	}
+	reopened := New(kv.MemKV)
+	if err := reopened.LoadFilter(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{"old0", "old99", "new1"} {
+		if ok, err := reopened.Has(d); err != nil || !ok {
+			t.Errorf("Has(%s) = %v, %v with the loaded filter", d, ok, err)
+		}
+	}
+	if err := New(nil).SaveFilter(path); err == nil {
+		t.Error("expected error saving a missing filter")
+	}
+}
+
+func TestIndex_StaleFilter(t *testing.T) {
+	kv := MemKV{}
+	ix := New(kv)
+	if err := ix.BuildFilter(100, 0.01); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "filter")
+	if err := ix.SaveFilter(path); err != nil {
+		t.Fatal(err)
+	}
+	// The chunk is added after the filter was saved, as after a crash
+	// between writing the KV and saving the filter.
+	for range 2 {
+		if _, err := ix.Add("a", 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened := New(kv)
+	if err := reopened.LoadFilter(path); err != nil {
+		t.Fatal(err)
+	}
+	if isNew, err := reopened.Add("a", 10); err != nil || isNew {
+		t.Errorf("Add() with a stale filter = %v, %v, want an existing chunk", isNew, err)
+	}
+	if err := reopened.IncRef("a"); err != nil {
+		t.Errorf("IncRef() with a stale filter = %v", err)
+	}
+	if e, ok, err := reopened.Get("a"); err != nil || !ok || e.RefCount != 4 {
+		t.Errorf("Get() = %+v, %v, %v, want 4 references", e, ok, err)
+	}
+}
@@ -0,0 +1,541 @@
+// Package index maps chunk digests to chunk metadata and reference counts.
+//
+// An Index records every chunk known to a deduplicating store together with
+// the number of manifests referencing it. Entries live in a pluggable
+// key-value backend, such as the in-memory MemKV or LogKV, which keeps them
+// on disk in a log and a table sorted by key, and the whole index can be
+// saved to and loaded from disk.
+//
+// Reference counts drive garbage collection: deleting a manifest drops a
+// reference to each of its chunks with DecRef, and Sweep later reclaims the
+// chunks that are no longer referenced.
+//
+// To run a store as a bounded cache rather than an archive, the index also
+// records when each chunk was last used, and Expire evicts chunks that have
+// not been used recently regardless of their references. Pinning the chunks
+// of a manifest with Pin protects them from both Expire and Sweep, so pinned
+// manifests can always be reassembled.
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// Entry is the metadata recorded for a chunk.
+type Entry struct {
+	// Length is the size of the chunk in bytes.
+	Length int64 `json:"length"`
+	// RefCount is the number of references to the chunk.
+	RefCount int64 `json:"refCount"`
+	// LastUsed is when the chunk was last added, referenced, or touched.
+	LastUsed time.Time `json:"lastUsed,omitzero"`
+	// Pins is the number of pins on the chunk. Pinned chunks are neither
+	// expired nor swept.
+	Pins int64 `json:"pins,omitempty"`
+}
+
+// KV is the storage backend of an Index. The Index serializes all calls, so
+// implementations need not be safe for concurrent use.
+type KV interface {
+	// Get returns the value stored for key, if any.
+	Get(key string) (value []byte, ok bool, err error)
+	// Put stores value for key. The KV must not retain value.
+	Put(key string, value []byte) error
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(key string) error
+	// Range calls fn for every key in ascending order until fn returns false.
+	Range(fn func(key string, value []byte) bool) error
+}
+
+// MemKV is an in-memory KV backed by a map.
+type MemKV map[string][]byte
+
+func (m MemKV) Get(key string) ([]byte, bool, error) {
+	v, ok := m[key]
+	return v, ok, nil
+}
+
+func (m MemKV) Put(key string, value []byte) error {
+	m[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (m MemKV) Delete(key string) error {
+	delete(m, key)
+	return nil
+}
+
+func (m MemKV) Range(fn func(key string, value []byte) bool) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !fn(k, m[k]) {
+			break
+		}
+	}
+	return nil
+}
+
+// Index maps chunk digests to their entries. It is safe for concurrent use.
+type Index struct {
+	mu     sync.RWMutex
+	kv     KV
+	now    func() time.Time
+	filter *Filter // Optional; see BuildFilter.
+}
+
+// New returns an Index stored in kv, or in a new MemKV if kv is nil.
+func New(kv KV) *Index {
+	if kv == nil {
+		kv = MemKV{}
+	}
+	return &Index{kv: kv, now: time.Now}
+}
+
+// Get returns the entry for digest, if present.
+func (ix *Index) Get(digest string) (Entry, bool, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.get(digest)
+}
+
+// Has reports whether digest is indexed. With a filter (see BuildFilter),
+// digests it rules out are reported missing without reading the KV.
+func (ix *Index) Has(digest string) (bool, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.has(digest)
+}
+
+// FindMissing returns the digests that are not indexed, in order, e.g. the
+// chunks of a new manifest that must be uploaded. Like Has, it consults the
+// filter first.
+func (ix *Index) FindMissing(digests []string) ([]string, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	var missing []string
+	for _, d := range digests {
+		ok, err := ix.has(d)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			missing = append(missing, d)
+		}
+	}
+	return missing, nil
+}
+
+// Add records a reference to the chunk with the given digest and length,
+// inserting it if it is not yet indexed. It reports whether the chunk is new.
+func (ix *Index) Add(digest string, length int64) (bool, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.add(digest, length)
+}
+
+// AddBatch records a reference to every chunk in chunks under a single lock,
+// e.g. all chunks of a new manifest. It returns the chunks that were not yet
+// indexed.
+func (ix *Index) AddBatch(chunks []manifest.Chunk) ([]manifest.Chunk, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	var added []manifest.Chunk
+	err := ix.batch(func() error {
+		for _, c := range chunks {
+			isNew, err := ix.add(c.Digest, c.Length)
+			if err != nil {
+				return err
+			}
+			if isNew {
+				added = append(added, c)
+			}
+		}
+		return nil
+	})
+	return added, err
+}
+
+// IncRef adds a reference to an indexed chunk.
+func (ix *Index) IncRef(digest string) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	e, err := ix.mustGet(digest)
+	if err != nil {
+		return err
+	}
+	e.RefCount++
+	e.LastUsed = ix.now()
+	return ix.put(digest, e)
+}
+
+// Touch records a use of indexed chunks, e.g. a cache hit, so that Expire
+// keeps them.
+func (ix *Index) Touch(digests ...string) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	now := ix.now()
+	for _, digest := range digests {
+		e, err := ix.mustGet(digest)
+		if err != nil {
+			return err
+		}
+		e.LastUsed = now
+		if err := ix.put(digest, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pin adds a pin to every chunk in chunks, e.g. all chunks of a manifest
+// that must stay reassemblable, under a single lock. A chunk listed twice is
+// pinned twice. Either all chunks are pinned or, if one is not indexed, none
+// is.
+func (ix *Index) Pin(chunks []manifest.Chunk) error {
+	return ix.updatePins(chunks, 1)
+}
+
+// Unpin drops a pin added by Pin from every chunk in chunks.
+func (ix *Index) Unpin(chunks []manifest.Chunk) error {
+	return ix.updatePins(chunks, -1)
+}
+
+func (ix *Index) updatePins(chunks []manifest.Chunk, delta int64) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	entries := make(map[string]Entry, len(chunks))
+	for _, c := range chunks {
+		e, ok := entries[c.Digest]
+		if !ok {
+			var err error
+			if e, err = ix.mustGet(c.Digest); err != nil {
+				return err
+			}
+		}
+		e.Pins += delta
+		if e.Pins < 0 {
+			return fmt.Errorf("chunk %s is not pinned", c.Digest)
+		}
+		entries[c.Digest] = e
+	}
+	return ix.batch(func() error {
+		for digest, e := range entries {
+			if err := ix.put(digest, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DecRef drops a reference to an indexed chunk, e.g. when a manifest using it
+// is deleted. Chunks left without references stay indexed until Sweep, so a
+// chunk that is referenced again in the meantime is never reclaimed.
+func (ix *Index) DecRef(digest string) error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	e, err := ix.mustGet(digest)
+	if err != nil {
+		return err
+	}
+	if e.RefCount == 0 {
+		return fmt.Errorf("chunk %s has no references", digest)
+	}
+	e.RefCount--
+	return ix.put(digest, e)
+}
+
+// Sweep removes every unpinned chunk without references from the index, calling
+// reclaim first so the caller can delete the chunk from its store. The index
+// is locked for the duration, so no chunk can gain a reference while it is
+// being reclaimed. If reclaim fails the chunk stays indexed and Sweep stops.
+// Sweep returns the number of chunks removed.
+func (ix *Index) Sweep(reclaim func(digest string, e Entry) error) (int, error) {
+	return ix.remove(func(e Entry) bool {
+		return e.RefCount == 0 && e.Pins == 0
+	}, reclaim)
+}
+
+// Expire removes every unpinned chunk last used before cutoff from the
+// index, referenced or not, calling reclaim first like Sweep. Manifests
+// referencing an expired chunk can no longer be reassembled from the store,
+// which is what a bounded cache wants for manifests it has not pinned.
+// Chunks with no last-use time, indexed before last use was recorded, are
+// kept until Add, IncRef, or Touch records one. Expire returns the number
+// of chunks removed.
+func (ix *Index) Expire(cutoff time.Time, reclaim func(digest string, e Entry) error) (int, error) {
+	return ix.remove(func(e Entry) bool {
+		return e.Pins == 0 && !e.LastUsed.IsZero() && e.LastUsed.Before(cutoff)
+	}, reclaim)
+}
+
+// remove implements Sweep and Expire, removing the chunks selected by
+// match.
+func (ix *Index) remove(match func(Entry) bool, reclaim func(digest string, e Entry) error) (int, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	var matched []record
+	var decodeErr error
+	err := ix.kv.Range(func(key string, value []byte) bool {
+		e, err := decodeEntry(value)
+		if err != nil {
+			decodeErr = fmt.Errorf("chunk %s: %w", key, err)
+			return false
+		}
+		if match(e) {
+			matched = append(matched, record{Digest: key, Entry: e})
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if decodeErr != nil {
+		return 0, decodeErr
+	}
+
+	// Chunks reclaimed before a failure are removed all the same.
+	var removed int
+	var reclaimErr error
+	err = ix.batch(func() error {
+		for _, r := range matched {
+			if reclaimErr = reclaim(r.Digest, r.Entry); reclaimErr != nil {
+				return nil
+			}
+			if err := ix.kv.Delete(r.Digest); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, reclaimErr
+}
+
+// Range calls fn for every indexed chunk in ascending digest order until fn
+// returns false. The index must not be modified from fn.
+func (ix *Index) Range(fn func(digest string, e Entry) bool) error {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	var decodeErr error
+	err := ix.kv.Range(func(key string, value []byte) bool {
+		e, err := decodeEntry(value)
+		if err != nil {
+			decodeErr = fmt.Errorf("chunk %s: %w", key, err)
+			return false
+		}
+		return fn(key, e)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeErr
+}
+
+// record is the on-disk form of an index entry written by Save.
+type record struct {
+	Digest string `json:"digest"`
+	Entry
+}
+
+// Save writes a consistent snapshot of the index to path as JSON lines.
+// The file is written to a temporary file and renamed into place, so a crash
+// never leaves a partially written index behind. Writers are blocked while the
+// snapshot is taken.
+func (ix *Index) Save(path string) error {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	var encodeErr error
+	err = ix.kv.Range(func(key string, value []byte) bool {
+		e, err := decodeEntry(value)
+		if err != nil {
+			encodeErr = fmt.Errorf("chunk %s: %w", key, err)
+			return false
+		}
+		encodeErr = enc.Encode(record{Digest: key, Entry: e})
+		return encodeErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	if encodeErr != nil {
+		return encodeErr
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Load reads an index written by Save into kv, or into a new MemKV if kv is
+// nil. Reference counts and pins are added to those of any entries already
+// present in kv, keeping the later last use.
+func Load(path string, kv KV) (*Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ix := New(kv)
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var r record
+		if err := dec.Decode(&r); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("loading index %s: %w", path, err)
+		}
+		e, ok, err := ix.get(r.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			r.RefCount += e.RefCount
+			r.Pins += e.Pins
+			if e.LastUsed.After(r.LastUsed) {
+				r.LastUsed = e.LastUsed
+			}
+		}
+		if err := ix.put(r.Digest, r.Entry); err != nil {
+			return nil, err
+		}
+	}
+	return ix, nil
+}
+
+// has reports whether digest is indexed, trusting the filter to rule out
+// digests. Only read-only lookups may use it: a stale filter must never make
+// a mutation treat an indexed chunk as new.
+func (ix *Index) has(digest string) (bool, error) {
+	if ix.filter != nil && !ix.filter.MayContain(digest) {
+		return false, nil
+	}
+	_, ok, err := ix.get(digest)
+	return ok, err
+}
+
+func (ix *Index) get(digest string) (Entry, bool, error) {
+	value, ok, err := ix.kv.Get(digest)
+	if err != nil || !ok {
+		return Entry{}, false, err
+	}
+	e, err := decodeEntry(value)
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("chunk %s: %w", digest, err)
+	}
+	return e, true, nil
+}
+
+func (ix *Index) mustGet(digest string) (Entry, error) {
+	e, ok, err := ix.get(digest)
+	if err != nil {
+		return Entry{}, err
+	}
+	if !ok {
+		return Entry{}, fmt.Errorf("chunk %s is not indexed", digest)
+	}
+	return e, nil
+}
+
+func (ix *Index) put(digest string, e Entry) error {
+	if err := ix.kv.Put(digest, encodeEntry(e)); err != nil {
+		return err
+	}
+	if ix.filter != nil {
+		ix.filter.Add(digest)
+	}
+	return nil
+}
+
+func (ix *Index) add(digest string, length int64) (bool, error) {
+	e, ok, err := ix.get(digest)
+	if err != nil {
+		return false, err
+	}
+	if ok && e.Length != length {
+		return false, fmt.Errorf("chunk %s: length %d does not match indexed length %d", digest, length, e.Length)
+	}
+	e.Length = length
+	e.RefCount++
+	e.LastUsed = ix.now()
+	return !ok, ix.put(digest, e)
+}
+
+// encodeEntry encodes the length, reference count, last use in Unix
+// nanoseconds (zero if unknown), and pins of an entry as uvarints. Entries
+// written before last use and pins were recorded end after the reference
+// count.
+func encodeEntry(e Entry) []byte {
+	var lastUsed int64
+	if !e.LastUsed.IsZero() {
+		lastUsed = e.LastUsed.UnixNano()
+	}
+	buf := make([]byte, 0, 4*binary.MaxVarintLen64)
+	buf = binary.AppendUvarint(buf, uint64(e.Length))
+	buf = binary.AppendUvarint(buf, uint64(e.RefCount))
+	buf = binary.AppendUvarint(buf, uint64(lastUsed))
+	return binary.AppendUvarint(buf, uint64(e.Pins))
+}
+
+var errCorruptEntry = errors.New("corrupt index entry")
+
+func decodeEntry(value []byte) (Entry, error) {
+	var fields [4]uint64
+	n := 0
+	for i := range fields {
+		if i == 2 && n == len(value) {
+			break
+		}
+		v, m := binary.Uvarint(value[n:])
+		if m <= 0 {
+			return Entry{}, errCorruptEntry
+		}
+		fields[i] = v
+		n += m
+	}
+	if n != len(value) {
+		return Entry{}, errCorruptEntry
+	}
+	e := Entry{Length: int64(fields[0]), RefCount: int64(fields[1]), Pins: int64(fields[3])}
+	if fields[2] != 0 {
+		e.LastUsed = time.Unix(0, int64(fields[2])).UTC()
+	}
+	return e, nil
+}
@@ -0,0 +1,267 @@
+package index
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+func TestIndex(t *testing.T) {
+	ix := New(nil)
+	now := time.Unix(1700000000, 0).UTC()
+	ix.now = func() time.Time { return now }
+
+	isNew, err := ix.Add("aa", 100)
+	if err != nil || !isNew {
+		t.Fatalf("Add() = %v, %v; want new chunk", isNew, err)
+	}
+	added, err := ix.AddBatch([]manifest.Chunk{
+		{Digest: "aa", Length: 100},
+		{Digest: "bb", Length: 200},
+		{Digest: "bb", Length: 200},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || added[0].Digest != "bb" {
+		t.Errorf("AddBatch() added %v, want only bb", added)
+	}
+
+	e, ok, err := ix.Get("bb")
+	if err != nil || !ok {
+		t.Fatalf("Get(bb) = %v, %v", ok, err)
+	}
+	if e != (Entry{Length: 200, RefCount: 2, LastUsed: now}) {
+		t.Errorf("Get(bb) = %+v", e)
+	}
+
+	if _, err := ix.Add("aa", 101); err == nil {
+		t.Error("expected error for mismatched length")
+	}
+
+	if err := ix.IncRef("missing"); err == nil {
+		t.Error("expected error referencing unknown chunk")
+	}
+}
+
+func TestIndex_Sweep(t *testing.T) {
+	ix := New(nil)
+	for _, d := range []string{"aa", "bb", "cc"} {
+		if _, err := ix.Add(d, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ix.IncRef("bb"); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{"aa", "bb", "cc"} {
+		if err := ix.DecRef(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ix.DecRef("aa"); err == nil {
+		t.Error("expected error dropping a reference below zero")
+	}
+
+	// A chunk referenced again before the sweep survives it.
+	if _, err := ix.Add("cc", 10); err != nil {
+		t.Fatal(err)
+	}
+
+	var reclaimed []string
+	n, err := ix.Sweep(func(digest string, e Entry) error {
+		reclaimed = append(reclaimed, digest)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(reclaimed) != 1 || reclaimed[0] != "aa" {
+		t.Errorf("Sweep() reclaimed %v (n=%d), want [aa]", reclaimed, n)
+	}
+	for d, want := range map[string]bool{"aa": false, "bb": true, "cc": true} {
+		if _, ok, _ := ix.Get(d); ok != want {
+			t.Errorf("%s indexed = %v after sweep, want %v", d, ok, want)
+		}
+	}
+
+	// Chunks whose reclamation fails stay indexed.
+	if err := ix.DecRef("bb"); err != nil {
+		t.Fatal(err)
+	}
+	errDelete := errors.New("delete failed")
+	if _, err := ix.Sweep(func(string, Entry) error { return errDelete }); err != errDelete {
+		t.Errorf("Sweep() error = %v, want %v", err, errDelete)
+	}
+	if _, ok, _ := ix.Get("bb"); !ok {
+		t.Error("bb removed despite failed reclamation")
+	}
+}
+
+func TestIndex_Expire(t *testing.T) {
+	ix := New(nil)
+	now := time.Unix(1700000000, 0).UTC()
+	ix.now = func() time.Time { return now }
+	for _, d := range []string{"aa", "bb", "cc", "dd"} {
+		if _, err := ix.Add(d, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pinned := []manifest.Chunk{{Digest: "bb"}, {Digest: "cc"}, {Digest: "bb"}}
+	if err := ix.Pin(pinned); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Pin([]manifest.Chunk{{Digest: "aa"}, {Digest: "missing"}}); err == nil {
+		t.Error("expected error pinning an unknown chunk")
+	}
+	if e, _, _ := ix.Get("aa"); e.Pins != 0 {
+		t.Errorf("aa pinned %d times after a failed Pin, want 0", e.Pins)
+	}
+	if e, _, _ := ix.Get("bb"); e.Pins != 2 {
+		t.Errorf("bb pinned %d times, want 2", e.Pins)
+	}
+
+	now = now.Add(time.Hour)
+	if err := ix.Touch("dd"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Touch("missing"); err == nil {
+		t.Error("expected error touching an unknown chunk")
+	}
+
+	// Chunks unused for the last 30 minutes are expired even though they
+	// are referenced, except for pinned ones.
+	var expired []string
+	n, err := ix.Expire(now.Add(-30*time.Minute), func(digest string, e Entry) error {
+		expired = append(expired, digest)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(expired) != 1 || expired[0] != "aa" {
+		t.Errorf("Expire() removed %v (n=%d), want [aa]", expired, n)
+	}
+
+	// Pinned chunks survive Sweep until unpinned.
+	for _, d := range []string{"bb", "cc"} {
+		if err := ix.DecRef(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := ix.Sweep(func(string, Entry) error { return nil }); err != nil || n != 0 {
+		t.Errorf("Sweep() = %d, %v; want pinned chunks kept", n, err)
+	}
+	if err := ix.Unpin(pinned); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Unpin(pinned); err == nil {
+		t.Error("expected error unpinning chunks that are not pinned")
+	}
+	if n, err := ix.Sweep(func(string, Entry) error { return nil }); err != nil || n != 2 {
+		t.Errorf("Sweep() = %d, %v; want bb and cc removed", n, err)
+	}
+}
+
+func TestIndex_LegacyEntry(t *testing.T) {
+	// Entries written before last use and pins were recorded hold only the
+	// length and reference count.
+	kv := MemKV{"aa": {100, 2}}
+	e, ok, err := New(kv).Get("aa")
+	if err != nil || !ok || e != (Entry{Length: 100, RefCount: 2}) {
+		t.Errorf("Get() = %+v, %v, %v", e, ok, err)
+	}
+
+	// Legacy entries have no last use to expire them by.
+	ix := New(kv)
+	if n, err := ix.Expire(time.Now(), func(string, Entry) error { return nil }); err != nil || n != 0 {
+		t.Errorf("Expire() = %d, %v; want legacy entries kept", n, err)
+	}
+	if err := ix.Touch("aa"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := ix.Expire(time.Now().Add(time.Hour), func(string, Entry) error { return nil }); err != nil || n != 1 {
+		t.Errorf("Expire() after Touch = %d, %v; want the entry expired", n, err)
+	}
+}
+
+func TestIndex_SaveLoad(t *testing.T) {
+	ix := New(nil)
+	for _, d := range []string{"cc", "aa", "bb", "aa"} {
+		if _, err := ix.Add(d, int64(len(d)*10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	if err := ix.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	matches, _ := filepath.Glob(path + ".tmp*")
+	if len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+
+	kv := MemKV{}
+	loaded, err := Load(path, kv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kv) != 3 {
+		t.Errorf("expected 3 entries in backend, got %d", len(kv))
+	}
+	var digests []string
+	err = loaded.Range(func(digest string, e Entry) bool {
+		digests = append(digests, digest)
+		want, _, _ := ix.Get(digest)
+		if e != want {
+			t.Errorf("%s: loaded %+v, want %+v", digest, e, want)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digests) != 3 || digests[0] != "aa" || digests[2] != "cc" {
+		t.Errorf("Range() visited %v, want sorted digests", digests)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, nil); err == nil {
+		t.Error("expected error loading corrupt index")
+	}
+}
+
+func TestIndex_ConcurrentSave(t *testing.T) {
+	ix := New(nil)
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range 1000 {
+			if _, err := ix.Add(string(rune('a'+i%26)), 1); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 10 {
+			if err := ix.Save(filepath.Join(dir, "index")); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,470 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+)
+
+// BatchKV is a KV that can apply many writes at once, e.g. in a single
+// transaction or a single synced append. The Index groups the writes of
+// AddBatch, Pin, Unpin, Sweep, and Expire into one batch when its KV
+// implements BatchKV.
+type BatchKV interface {
+	KV
+	// WriteBatch applies the writes of b in order, all or none of them.
+	WriteBatch(b *Batch) error
+}
+
+// Batch is a list of writes for BatchKV.WriteBatch.
+type Batch struct {
+	ops []batchOp
+}
+
+type batchOp struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+// Put adds a write of value for key to b. The batch retains value.
+func (b *Batch) Put(key string, value []byte) {
+	b.ops = append(b.ops, batchOp{key: key, value: value})
+}
+
+// Delete adds a deletion of key to b.
+func (b *Batch) Delete(key string) {
+	b.ops = append(b.ops, batchOp{key: key, delete: true})
+}
+
+// Len returns the number of writes in b.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// batchingKV collects the writes made through it into a batch, reading its
+// own writes back before they are applied to the underlying BatchKV.
+type batchingKV struct {
+	kv      BatchKV
+	batch   Batch
+	pending map[string]*batchOp
+}
+
+func (b *batchingKV) Get(key string) ([]byte, bool, error) {
+	if op, ok := b.pending[key]; ok {
+		return op.value, !op.delete, nil
+	}
+	return b.kv.Get(key)
+}
+
+func (b *batchingKV) Put(key string, value []byte) error {
+	b.batch.Put(key, append([]byte(nil), value...))
+	b.pending[key] = &b.batch.ops[len(b.batch.ops)-1]
+	return nil
+}
+
+func (b *batchingKV) Delete(key string) error {
+	b.batch.Delete(key)
+	b.pending[key] = &b.batch.ops[len(b.batch.ops)-1]
+	return nil
+}
+
+func (b *batchingKV) Range(fn func(key string, value []byte) bool) error {
+	return errors.New("range over an uncommitted batch")
+}
+
+// batch runs fn, which must not call Range, with the writes to the index's
+// KV grouped into one batch if the KV implements BatchKV. The writes are
+// applied only if fn succeeds. The caller must hold the write lock.
+func (ix *Index) batch(fn func() error) error {
+	bkv, ok := ix.kv.(BatchKV)
+	if !ok {
+		return fn()
+	}
+	b := &batchingKV{kv: bkv, pending: map[string]*batchOp{}}
+	ix.kv = b
+	err := fn()
+	ix.kv = bkv
+	if err != nil {
+		return err
+	}
+	if b.batch.Len() == 0 {
+		return nil
+	}
+	return bkv.WriteBatch(&b.batch)
+}
+
+// LogKV is a BatchKV kept on disk, so that an index survives restarts and
+// need not fit in memory, without an external database. Every write, or
+// batch of writes, is appended to a log file as checksummed records and
+// synced before it returns. Once the log exceeds 64MiB, Compact merges it
+// into a table of entries sorted by key, stored next to the log with the
+// suffix ".table", and empties it.
+//
+// Only the writes logged since the last flush and the index of the table's
+// blocks, one key per 4KiB of entries, are held in memory, and looking up a
+// key in the table reads a single block. OpenLogKV replays only the log,
+// dropping a partial batch left by a crash.
+type LogKV struct {
+	path  string
+	f     *os.File
+	table *table
+	// m holds the writes logged since the last flush, deletions included,
+	// which take precedence over the table.
+	m map[string]batchOp
+	// end is the offset just past the last committed batch in the log.
+	end int64
+	// flushSize is the log size past which writes flush it into the table.
+	flushSize int64
+	// failed, if set, is the error that left the log in an unknown state,
+	// which every later write returns.
+	failed error
+	// garbage is the number of records in the log that are overwritten or
+	// deleted.
+	garbage int
+}
+
+// defaultFlushSize is the default log size past which LogKV flushes the log
+// into its table.
+const defaultFlushSize = 64 << 20
+
+// tableExt is the suffix of the table next to a LogKV's log.
+const tableExt = ".table"
+
+// Log record types. A batch is a sequence of records whose last one is
+// marked with recordCommit.
+const (
+	recordPut    = 1
+	recordDelete = 2
+	recordCommit = 0x80
+)
+
+var (
+	errCorruptLog = errors.New("corrupt log")
+	castagnoli    = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// OpenLogKV opens the log at path and its table, creating the log if
+// necessary.
+func OpenLogKV(path string) (*LogKV, error) {
+	t, err := openTable(path + tableExt)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		t.close()
+		return nil, err
+	}
+	kv := &LogKV{path: path, f: f, table: t, m: map[string]batchOp{}, flushSize: defaultFlushSize}
+	end, err := kv.replay()
+	kv.end = end
+	if err == nil {
+		// Drop a partial batch at the end of the log.
+		err = f.Truncate(end)
+	}
+	if err == nil {
+		_, err = f.Seek(end, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		t.close()
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	return kv, nil
+}
+
+// replay applies the committed batches of the log and returns the offset
+// just past the last of them.
+func (kv *LogKV) replay() (int64, error) {
+	r := bufio.NewReader(kv.f)
+	var end, off int64
+	var batch []batchOp
+	for {
+		op, commit, n, err := readRecord(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF || errors.Is(err, errCorruptLog) {
+			// A crash can leave a torn record at the end of the log.
+			return end, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		off += n
+		batch = append(batch, op)
+		if commit {
+			kv.apply(batch)
+			batch = batch[:0]
+			end = off
+		}
+	}
+}
+
+// readRecord reads one record: its type, the key and value lengths as
+// uvarints, the key and value, and a little-endian CRC-32C of all of these.
+// It returns the size of the record.
+func readRecord(r *bufio.Reader) (op batchOp, commit bool, n int64, err error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return op, false, 0, err
+	}
+	keyLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return op, false, 0, io.ErrUnexpectedEOF
+	}
+	valueLen, err := binary.ReadUvarint(r)
+	if err != nil {
+		return op, false, 0, io.ErrUnexpectedEOF
+	}
+	if keyLen > maxKeyLength || valueLen > maxValueLength {
+		return op, false, 0, errCorruptLog
+	}
+	rec := binary.AppendUvarint([]byte{typ}, keyLen)
+	rec = binary.AppendUvarint(rec, valueLen)
+	header := len(rec)
+	rec = append(rec, make([]byte, keyLen+valueLen+4)...)
+	if _, err := io.ReadFull(r, rec[header:]); err != nil {
+		return op, false, 0, io.ErrUnexpectedEOF
+	}
+	body, trailer := rec[:len(rec)-4], rec[len(rec)-4:]
+	if crc32.Checksum(body, castagnoli) != binary.LittleEndian.Uint32(trailer) {
+		return op, false, 0, errCorruptLog
+	}
+	key := string(body[header : header+int(keyLen)])
+	switch typ &^ recordCommit {
+	case recordPut:
+		op = batchOp{key: key, value: body[header+int(keyLen):]}
+	case recordDelete:
+		op = batchOp{key: key, delete: true}
+	default:
+		return op, false, 0, errCorruptLog
+	}
+	return op, typ&recordCommit != 0, int64(len(rec)), nil
+}
+
+// appendRecord appends the record of op to buf.
+func appendRecord(buf []byte, op batchOp, commit bool) []byte {
+	typ := byte(recordPut)
+	if op.delete {
+		typ = recordDelete
+	}
+	if commit {
+		typ |= recordCommit
+	}
+	start := len(buf)
+	buf = append(buf, typ)
+	buf = binary.AppendUvarint(buf, uint64(len(op.key)))
+	buf = binary.AppendUvarint(buf, uint64(len(op.value)))
+	buf = append(buf, op.key...)
+	buf = append(buf, op.value...)
+	return binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf[start:], castagnoli))
+}
+
+// Limits on record sizes, which guard replay against allocating huge
+// buffers for a damaged length.
+const (
+	maxKeyLength   = 1 << 16
+	maxValueLength = 1 << 24
+)
+
+// apply applies committed writes to the in-memory map.
+func (kv *LogKV) apply(ops []batchOp) {
+	for _, op := range ops {
+		if _, ok := kv.m[op.key]; ok {
+			kv.garbage++
+		}
+		if op.delete {
+			kv.garbage++
+		}
+		kv.m[op.key] = op
+	}
+}
+
+// write appends ops to the log as one batch, syncs it, and applies it, and
+// flushes the log into the table if it has grown past the flush size. The
+// batch is durable once it is logged, so a failed flush is not reported,
+// and is retried by the next write.
+//
+// A failed write is truncated away, since replay stops at the first torn
+// record and would drop the batches appended after it. If that fails too,
+// or the sync fails, which leaves unknown data in the log, the LogKV fails
+// every later write; reopen it to recover the committed batches.
+func (kv *LogKV) write(ops []batchOp) error {
+	if kv.f == nil {
+		return os.ErrClosed
+	}
+	if kv.failed != nil {
+		return fmt.Errorf("log %s failed: %w", kv.path, kv.failed)
+	}
+	var buf []byte
+	for i, op := range ops {
+		if len(op.key) > maxKeyLength || len(op.value) > maxValueLength {
+			return fmt.Errorf("key %q or its value is too long", op.key)
+		}
+		buf = appendRecord(buf, op, i == len(ops)-1)
+	}
+	if _, err := kv.f.Write(buf); err != nil {
+		if terr := kv.truncate(); terr != nil {
+			kv.failed = err
+		}
+		return err
+	}
+	if err := kv.f.Sync(); err != nil {
+		kv.truncate()
+		kv.failed = err
+		return err
+	}
+	kv.end += int64(len(buf))
+	kv.apply(ops)
+	if kv.end >= kv.flushSize {
+		kv.Compact()
+	}
+	return nil
+}
+
+// truncate cuts the log back to the end of the last committed batch.
+func (kv *LogKV) truncate() error {
+	if err := kv.f.Truncate(kv.end); err != nil {
+		return err
+	}
+	_, err := kv.f.Seek(kv.end, io.SeekStart)
+	return err
+}
+
+func (kv *LogKV) Get(key string) ([]byte, bool, error) {
+	if op, ok := kv.m[key]; ok {
+		return op.value, !op.delete, nil
+	}
+	return kv.table.get(key)
+}
+
+func (kv *LogKV) Put(key string, value []byte) error {
+	return kv.write([]batchOp{{key: key, value: append([]byte(nil), value...)}})
+}
+
+func (kv *LogKV) Delete(key string) error {
+	if _, ok, err := kv.Get(key); err != nil || !ok {
+		return err
+	}
+	return kv.write([]batchOp{{key: key, delete: true}})
+}
+
+// Range merges the writes logged since the last flush into a scan of the
+// table.
+func (kv *LogKV) Range(fn func(key string, value []byte) bool) error {
+	keys := make([]string, 0, len(kv.m))
+	for k := range kv.m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	next := 0
+	// logged calls fn for the logged entries before key, or all remaining
+	// ones if last is set, and reports whether to go on.
+	logged := func(key string, last bool) bool {
+		for ; next < len(keys) && (last || keys[next] < key); next++ {
+			if op := kv.m[keys[next]]; !op.delete && !fn(op.key, op.value) {
+				return false
+			}
+		}
+		return true
+	}
+	stopped := false
+	err := kv.table.scan(func(key string, value []byte) bool {
+		if !logged(key, false) {
+			stopped = true
+			return false
+		}
+		if next < len(keys) && keys[next] == key {
+			// Overwritten or deleted since the last flush.
+			op := kv.m[key]
+			next++
+			if op.delete {
+				return true
+			}
+			value = op.value
+		}
+		if !fn(key, value) {
+			stopped = true
+			return false
+		}
+		return true
+	})
+	if err != nil || stopped {
+		return err
+	}
+	logged("", true)
+	return nil
+}
+
+// WriteBatch appends the writes of b to the log with a single sync.
+func (kv *LogKV) WriteBatch(b *Batch) error {
+	if b.Len() == 0 {
+		return nil
+	}
+	return kv.write(b.ops)
+}
+
+// Garbage returns the number of records in the log that are overwritten or
+// deleted.
+func (kv *LogKV) Garbage() int {
+	return kv.garbage
+}
+
+// Compact flushes the log into the table and empties it. The merged table
+// is written crash-safely, to a temporary file that is synced and renamed
+// into place, before the log is emptied; a crash in between only replays
+// the log over the table again on the next open, which changes nothing.
+// Compacting also recovers a LogKV that failed a write.
+func (kv *LogKV) Compact() error {
+	if kv.f == nil {
+		return os.ErrClosed
+	}
+	path := kv.path + tableExt
+	if err := writeTable(path, kv.Range); err != nil {
+		return err
+	}
+	t, err := openTable(path)
+	if err != nil {
+		return err
+	}
+	kv.table.close()
+	kv.table = t
+	kv.m = map[string]batchOp{}
+	kv.garbage = 0
+	// The log may hold a torn batch of a failed write past end, which is
+	// dropped along with the rest.
+	kv.end = 0
+	err = kv.truncate()
+	if err == nil {
+		err = kv.f.Sync()
+	}
+	kv.failed = err
+	return err
+}
+
+// syncDir syncs a directory so that renames within it are durable.
+func syncDir(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// Close closes the log and table files.
+func (kv *LogKV) Close() error {
+	if kv.f == nil {
+		return nil
+	}
+	err := kv.f.Close()
+	if terr := kv.table.close(); err == nil {
+		err = terr
+	}
+	kv.f = nil
+	return err
+}
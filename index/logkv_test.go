@@ -0,0 +1,293 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// countingLogKV is a LogKV that counts single and batched writes.
+type countingLogKV struct {
+	*LogKV
+	puts, batches int
+}
+
+func (kv *countingLogKV) Put(key string, value []byte) error {
+	kv.puts++
+	return kv.LogKV.Put(key, value)
+}
+
+func (kv *countingLogKV) WriteBatch(b *Batch) error {
+	kv.batches++
+	return kv.LogKV.WriteBatch(b)
+}
+
+func TestLogKV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.log")
+	kv, err := OpenLogKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counting := &countingLogKV{LogKV: kv}
+	ix := New(counting)
+	chunks := []manifest.Chunk{
+		{Digest: "aa", Length: 10},
+		{Digest: "bb", Length: 20},
+		{Digest: "aa", Length: 10},
+	}
+	if _, err := ix.AddBatch(chunks); err != nil {
+		t.Fatal(err)
+	}
+	if counting.puts != 0 || counting.batches != 1 {
+		t.Errorf("AddBatch() made %d puts and %d batches, want one batch", counting.puts, counting.batches)
+	}
+	if _, err := ix.Add("cc", 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.DecRef("cc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ix.Sweep(func(string, Entry) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Entry{}
+	ix.Range(func(digest string, e Entry) bool {
+		want[digest] = e
+		return true
+	})
+	if len(want) != 2 || want["aa"].RefCount != 2 {
+		t.Fatalf("index holds %+v, want aa referenced twice and bb", want)
+	}
+	if err := kv.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The index survives reopening, including after a torn write.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(appendRecord(nil, batchOp{key: "dd", value: encodeEntry(Entry{Length: 1})}, true)[:5])
+	f.Close()
+	check := func(kv *LogKV) {
+		t.Helper()
+		ix := New(kv)
+		got := map[string]Entry{}
+		if err := ix.Range(func(digest string, e Entry) bool {
+			got[digest] = e
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("reopened index holds %+v, want %+v", got, want)
+		}
+		for d, e := range want {
+			if got[d] != e {
+				t.Errorf("%s: reopened entry %+v, want %+v", d, got[d], e)
+			}
+		}
+	}
+	kv, err = OpenLogKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(kv)
+
+	// Compaction keeps the live entries and drops the rest.
+	if kv.Garbage() == 0 {
+		t.Error("no garbage after overwrites and a sweep")
+	}
+	before, _ := os.Stat(path)
+	if err := kv.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(path)
+	if kv.Garbage() != 0 || after.Size() >= before.Size() {
+		t.Errorf("compacted log is %d bytes with %d garbage records, was %d bytes", after.Size(), kv.Garbage(), before.Size())
+	}
+	if err := kv.Put("ee", encodeEntry(Entry{Length: 5})); err != nil {
+		t.Fatal(err)
+	}
+	want["ee"] = Entry{Length: 5}
+	kv.Close()
+	kv, err = OpenLogKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+	check(kv)
+}
+
+func TestLogKV_FailedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.log")
+	kv, err := OpenLogKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+	if err := kv.Put("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A write that fails part way leaves a torn record, which write cuts
+	// off so that later batches stay replayable.
+	torn, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	torn.Write(appendRecord(nil, batchOp{key: "x", value: []byte("torn")}, true)[:5])
+	torn.Close()
+	if err := kv.truncate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.Put("b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenLogKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if _, ok, _ := reopened.Get(key); !ok {
+			t.Errorf("%s lost after a failed write", key)
+		}
+	}
+	reopened.Close()
+
+	// If the log cannot be cut back, the LogKV fails later writes.
+	f := kv.f
+	if kv.f, err = os.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.Put("c", []byte("3")); err == nil {
+		t.Fatal("write to a read-only log succeeded")
+	}
+	kv.f.Close()
+	kv.f = f
+	if err := kv.Put("d", []byte("4")); err == nil {
+		t.Error("write after an unrecovered failure succeeded")
+	}
+	if err := kv.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.Put("d", []byte("4")); err != nil {
+		t.Errorf("write after Compact = %v", err)
+	}
+}
+
+func TestLogKV_Table(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.log")
+	kv, err := OpenLogKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv.flushSize = 8 << 10
+	model := MemKV{}
+	check := func(kv *LogKV) {
+		t.Helper()
+		for i := range 1200 {
+			key := fmt.Sprintf("key%04d", i)
+			got, ok, err := kv.Get(key)
+			want, wantOK := model[key]
+			if err != nil || ok != wantOK || !bytes.Equal(got, want) {
+				t.Fatalf("Get(%s) = %q, %v, %v, want %q, %v", key, got, ok, err, want, wantOK)
+			}
+		}
+		var keys []string
+		if err := kv.Range(func(key string, value []byte) bool {
+			if !bytes.Equal(value, model[key]) {
+				t.Errorf("Range: %s = %q, want %q", key, value, model[key])
+			}
+			keys = append(keys, key)
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != len(model) || !slices.IsSorted(keys) {
+			t.Fatalf("Range visited %d keys, sorted %v, want %d", len(keys), slices.IsSorted(keys), len(model))
+		}
+	}
+
+	// Writes, overwrites, and deletions flush the log into the table many
+	// times over, keeping only the writes since the last flush in memory.
+	rng := rand.New(rand.NewSource(1))
+	for range 5000 {
+		key := fmt.Sprintf("key%04d", rng.Intn(1200))
+		if rng.Intn(4) == 0 {
+			delete(model, key)
+			if err := kv.Delete(key); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		value := []byte(fmt.Sprint(rng.Int()))
+		model[key] = value
+		if err := kv.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+		if len(kv.m) > 500 {
+			t.Fatalf("%d entries held in memory", len(kv.m))
+		}
+	}
+	if len(kv.table.blocks) < 2 {
+		t.Errorf("table has %d blocks, want several", len(kv.table.blocks))
+	}
+	check(kv)
+	kv.Close()
+
+	kv, err = OpenLogKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(kv)
+
+	// A crash after the table is written but before the log is emptied
+	// replays the log over the table again.
+	if err := kv.Put("key0000", []byte("last")); err != nil {
+		t.Fatal(err)
+	}
+	model["key0000"] = []byte("last")
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	kv.Close()
+	if err := os.WriteFile(path, log, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	kv, err = OpenLogKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kv.Close()
+	check(kv)
+
+	// A damaged table is detected.
+	table, err := os.ReadFile(path + tableExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table[10] ^= 0xff
+	if err := os.WriteFile(path+tableExt, table, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	damaged, err := OpenLogKV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer damaged.Close()
+	if err := damaged.Range(func(string, []byte) bool { return true }); !errors.Is(err, errCorruptTable) {
+		t.Errorf("Range() over a damaged table = %v, want errCorruptTable", err)
+	}
+}
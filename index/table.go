@@ -0,0 +1,276 @@
+package index
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// A table is an immutable file of entries sorted by key, into which LogKV
+// flushes its log so that entries need not be held in memory. Entries are
+// grouped into blocks of about tableBlockSize bytes, each followed by its
+// CRC-32C. The blocks are followed by an index of the first key, offset, and
+// length of every block, and a footer locating the index:
+//
+//	block... index | index offset (uint64 LE) | index CRC-32C (uint32 LE) | "FCT1"
+//
+// Each entry is its key and value lengths as uvarints, then the key and the
+// value. Only the block index is held in memory, and a lookup reads a
+// single block.
+type table struct {
+	f      *os.File
+	blocks []tableBlock
+}
+
+// tableBlock locates a block of a table.
+type tableBlock struct {
+	firstKey string
+	offset   int64
+	// length includes the CRC-32C.
+	length int64
+}
+
+const (
+	tableBlockSize  = 4 << 10
+	tableMagic      = "FCT1"
+	tableFooterSize = 8 + 4 + len(tableMagic)
+)
+
+var errCorruptTable = errors.New("corrupt table")
+
+// openTable opens the table at path. A missing table is empty.
+func openTable(path string) (*table, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &table{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := &table{f: f}
+	if err := t.readIndex(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("table %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// readIndex reads the footer and block index of t.
+func (t *table) readIndex() error {
+	info, err := t.f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size < int64(tableFooterSize) {
+		return errCorruptTable
+	}
+	footer := make([]byte, tableFooterSize)
+	if _, err := t.f.ReadAt(footer, size-int64(tableFooterSize)); err != nil {
+		return err
+	}
+	indexOffset := binary.LittleEndian.Uint64(footer)
+	if string(footer[12:]) != tableMagic || indexOffset > uint64(size-int64(tableFooterSize)) {
+		return errCorruptTable
+	}
+	index := make([]byte, size-int64(tableFooterSize)-int64(indexOffset))
+	if _, err := t.f.ReadAt(index, int64(indexOffset)); err != nil {
+		return err
+	}
+	if crc32.Checksum(index, castagnoli) != binary.LittleEndian.Uint32(footer[8:]) {
+		return errCorruptTable
+	}
+	for len(index) > 0 {
+		keyLen, n := binary.Uvarint(index)
+		if n <= 0 || keyLen > uint64(len(index)-n) {
+			return errCorruptTable
+		}
+		key := string(index[n : n+int(keyLen)])
+		index = index[n+int(keyLen):]
+		offset, n := binary.Uvarint(index)
+		if n <= 0 {
+			return errCorruptTable
+		}
+		index = index[n:]
+		length, n := binary.Uvarint(index)
+		if n <= 0 || length > indexOffset || offset > indexOffset-length {
+			return errCorruptTable
+		}
+		index = index[n:]
+		t.blocks = append(t.blocks, tableBlock{firstKey: key, offset: int64(offset), length: int64(length)})
+	}
+	return nil
+}
+
+// readBlock returns the entries of block i.
+func (t *table) readBlock(i int) ([]byte, error) {
+	b := t.blocks[i]
+	buf := make([]byte, b.length)
+	if _, err := t.f.ReadAt(buf, b.offset); err != nil {
+		return nil, err
+	}
+	if len(buf) < 4 {
+		return nil, errCorruptTable
+	}
+	entries, trailer := buf[:len(buf)-4], buf[len(buf)-4:]
+	if crc32.Checksum(entries, castagnoli) != binary.LittleEndian.Uint32(trailer) {
+		return nil, fmt.Errorf("block at %d: %w", b.offset, errCorruptTable)
+	}
+	return entries, nil
+}
+
+// nextEntry splits the first entry off the entries of a block.
+func nextEntry(entries []byte) (key string, value, rest []byte, err error) {
+	keyLen, n := binary.Uvarint(entries)
+	if n <= 0 {
+		return "", nil, nil, errCorruptTable
+	}
+	entries = entries[n:]
+	valueLen, n := binary.Uvarint(entries)
+	if n <= 0 || keyLen > uint64(len(entries)-n) || valueLen > uint64(len(entries)-n)-keyLen {
+		return "", nil, nil, errCorruptTable
+	}
+	entries = entries[n:]
+	key = string(entries[:keyLen])
+	value = entries[keyLen : keyLen+valueLen : keyLen+valueLen]
+	return key, value, entries[keyLen+valueLen:], nil
+}
+
+// get returns the value stored for key, if any.
+func (t *table) get(key string) ([]byte, bool, error) {
+	i := sort.Search(len(t.blocks), func(i int) bool {
+		return t.blocks[i].firstKey > key
+	}) - 1
+	if i < 0 {
+		return nil, false, nil
+	}
+	entries, err := t.readBlock(i)
+	if err != nil {
+		return nil, false, err
+	}
+	for len(entries) > 0 {
+		k, v, rest, err := nextEntry(entries)
+		if err != nil {
+			return nil, false, err
+		}
+		if k == key {
+			return v, true, nil
+		}
+		if k > key {
+			break
+		}
+		entries = rest
+	}
+	return nil, false, nil
+}
+
+// scan calls fn for every entry in ascending key order until fn returns
+// false.
+func (t *table) scan(fn func(key string, value []byte) bool) error {
+	for i := range t.blocks {
+		entries, err := t.readBlock(i)
+		if err != nil {
+			return err
+		}
+		for len(entries) > 0 {
+			k, v, rest, err := nextEntry(entries)
+			if err != nil {
+				return err
+			}
+			if !fn(k, v) {
+				return nil
+			}
+			entries = rest
+		}
+	}
+	return nil
+}
+
+func (t *table) close() error {
+	if t.f == nil {
+		return nil
+	}
+	return t.f.Close()
+}
+
+// writeTable writes the entries that scan passes to its callback, which must
+// be in ascending key order, to a table at path. The table is written
+// crash-safely: to a temporary file that is synced and renamed into place.
+func writeTable(path string, scan func(fn func(key string, value []byte) bool) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	var (
+		offset int64
+		block  []byte
+		first  string
+		index  []byte
+		werr   error
+	)
+	flush := func() {
+		if len(block) == 0 || werr != nil {
+			return
+		}
+		block = binary.LittleEndian.AppendUint32(block, crc32.Checksum(block, castagnoli))
+		_, werr = w.Write(block)
+		index = binary.AppendUvarint(index, uint64(len(first)))
+		index = append(index, first...)
+		index = binary.AppendUvarint(index, uint64(offset))
+		index = binary.AppendUvarint(index, uint64(len(block)))
+		offset += int64(len(block))
+		block = block[:0]
+	}
+	err = scan(func(key string, value []byte) bool {
+		if len(block) == 0 {
+			first = key
+		}
+		block = binary.AppendUvarint(block, uint64(len(key)))
+		block = binary.AppendUvarint(block, uint64(len(value)))
+		block = append(block, key...)
+		block = append(block, value...)
+		if len(block) >= tableBlockSize {
+			flush()
+		}
+		return werr == nil
+	})
+	if err != nil {
+		return err
+	}
+	flush()
+	if werr != nil {
+		return werr
+	}
+	footer := binary.LittleEndian.AppendUint64(nil, uint64(offset))
+	footer = binary.LittleEndian.AppendUint32(footer, crc32.Checksum(index, castagnoli))
+	footer = append(footer, tableMagic...)
+	if _, err := w.Write(index); err != nil {
+		return err
+	}
+	if _, err := w.Write(footer); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
@@ -0,0 +1,129 @@
+// Package ipfs expresses chunks in IPFS terms so that FastCDC-chunked data
+// can feed UnixFS DAG builders.
+//
+// Chunk digests convert to sha2-256 multihashes and to CIDv1 identifiers of
+// raw blocks, and Splitter implements the chunker.Splitter interface of
+// github.com/ipfs/boxo/chunker structurally, without depending on it.
+package ipfs
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+const (
+	// sha256Code is the multicodec code of sha2-256.
+	sha256Code = 0x12
+	// rawCodec is the multicodec code of raw binary blocks.
+	rawCodec = 0x55
+	cidV1    = 1
+	// base32Prefix is the multibase prefix of lowercase, unpadded base32.
+	base32Prefix = 'b'
+)
+
+var base32Encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ErrInvalidCID is returned when parsing a CID that is not a CIDv1 of a raw
+// block with a sha2-256 multihash.
+var ErrInvalidCID = errors.New("unsupported or malformed CID")
+
+// Multihash returns the sha2-256 multihash of a hex-encoded SHA-256 digest,
+// such as manifest.Chunk Digest.
+func Multihash(digest string) ([]byte, error) {
+	sum, err := hex.DecodeString(digest)
+	if err != nil || len(sum) != 32 {
+		return nil, fmt.Errorf("invalid SHA-256 digest %q", digest)
+	}
+	mh := binary.AppendUvarint(nil, sha256Code)
+	mh = binary.AppendUvarint(mh, uint64(len(sum)))
+	return append(mh, sum...), nil
+}
+
+// CID returns the CIDv1 of the raw block with the given hex-encoded SHA-256
+// digest, in its default base32 string form.
+func CID(digest string) (string, error) {
+	mh, err := Multihash(digest)
+	if err != nil {
+		return "", err
+	}
+	b := binary.AppendUvarint(nil, cidV1)
+	b = binary.AppendUvarint(b, rawCodec)
+	b = append(b, mh...)
+	return string(base32Prefix) + strings.ToLower(base32Encoding.EncodeToString(b)), nil
+}
+
+// ParseCID returns the hex-encoded SHA-256 digest of a CID returned by CID.
+func ParseCID(cid string) (string, error) {
+	if len(cid) == 0 || cid[0] != base32Prefix {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCID, cid)
+	}
+	b, err := base32Encoding.DecodeString(strings.ToUpper(cid[1:]))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidCID, err)
+	}
+	for _, want := range []uint64{cidV1, rawCodec, sha256Code, 32} {
+		v, n := binary.Uvarint(b)
+		if n <= 0 || v != want {
+			return "", fmt.Errorf("%w: %q", ErrInvalidCID, cid)
+		}
+		b = b[n:]
+	}
+	if len(b) != 32 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCID, cid)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// CIDs returns the CIDs of the chunks of m in order.
+func CIDs(m *manifest.Manifest) ([]string, error) {
+	cids := make([]string, len(m.Chunks))
+	for i, c := range m.Chunks {
+		cid, err := CID(c.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("chunk at offset %d: %w", c.Offset, err)
+		}
+		cids[i] = cid
+	}
+	return cids, nil
+}
+
+// Splitter splits a stream into FastCDC chunks. It has the method set of
+// the IPFS chunker.Splitter interface and can be passed to UnixFS importers
+// directly.
+type Splitter struct {
+	r       io.Reader
+	chunker *fastcdc.Chunker
+}
+
+// NewSplitter returns a Splitter chunking r with the given average size and
+// options, as for fastcdc.NewChunker.
+func NewSplitter(r io.Reader, averageSize int, opts ...fastcdc.Option) (*Splitter, error) {
+	chunker, err := fastcdc.NewChunker(r, averageSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Splitter{r: r, chunker: chunker}, nil
+}
+
+// Reader returns the reader being split.
+func (s *Splitter) Reader() io.Reader {
+	return s.r
+}
+
+// NextBytes returns the next chunk, or io.EOF after the last one. Unlike
+// fastcdc.Chunker Next, the returned slice is owned by the caller.
+func (s *Splitter) NextBytes() ([]byte, error) {
+	chunk, err := s.chunker.Next()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), chunk.Data...), nil
+}
@@ -0,0 +1,90 @@
+package ipfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+func TestCID(t *testing.T) {
+	// The CID of the raw block "hello world", as printed by
+	// `ipfs add --raw-leaves --cid-version 1`.
+	const want = "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"
+	digest := manifest.Digest([]byte("hello world"))
+	got, err := CID(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("CID() = %s, want %s", got, want)
+	}
+	parsed, err := ParseCID(got)
+	if err != nil || parsed != digest {
+		t.Errorf("ParseCID() = %s, %v, want %s", parsed, err, digest)
+	}
+
+	mh, err := Multihash(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mh) != 34 || mh[0] != 0x12 || mh[1] != 0x20 {
+		t.Errorf("Multihash() = %x, want sha2-256 prefix 1220", mh)
+	}
+
+	if _, err := CID("not hex"); err == nil {
+		t.Error("CID() of invalid digest succeeded")
+	}
+	for _, cid := range []string{"", "Qm123", "b!!", "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"} {
+		if _, err := ParseCID(cid); !errors.Is(err, ErrInvalidCID) {
+			t.Errorf("ParseCID(%q) error = %v, want ErrInvalidCID", cid, err)
+		}
+	}
+}
+
+func TestSplitter(t *testing.T) {
+	data := make([]byte, 200000)
+	rand.New(rand.NewSource(1)).Read(data)
+	r := bytes.NewReader(data)
+	s, err := NewSplitter(r, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Reader() != r {
+		t.Error("Reader() does not return the split reader")
+	}
+	m, err := manifest.Build(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := CIDs(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var chunks [][]byte
+	for {
+		b, err := s.NextBytes()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, b)
+	}
+	if !bytes.Equal(bytes.Join(chunks, nil), data) {
+		t.Fatal("chunks do not reassemble the input")
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks, want %d", len(chunks), len(want))
+	}
+	for i, b := range chunks {
+		if cid, _ := CID(manifest.Digest(b)); cid != want[i] {
+			t.Errorf("chunk %d CID = %s, want %s", i, cid, want[i])
+		}
+	}
+}
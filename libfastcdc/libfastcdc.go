@@ -0,0 +1,185 @@
+// Command libfastcdc exports the chunker through a C ABI, so that services
+// written in other languages produce exactly the same chunk boundaries as
+// Go ones. Build the shared library and its header with
+//
+//	go build -buildmode=c-shared -o libfastcdc.so ./libfastcdc
+//
+// which writes libfastcdc.h next to it. A chunker is created by
+// fastcdc_create, reading its input through a callback, or by
+// fastcdc_create_buffer, chunking a buffer in place. Chunks are returned one
+// at a time by fastcdc_next until it returns 0, and the chunker is released
+// with fastcdc_destroy:
+//
+//	fastcdc_options opts;
+//	fastcdc_options_init(&opts, 65536);
+//	char err[256];
+//	uintptr_t h = fastcdc_create_buffer(data, len, &opts, err, sizeof err);
+//	if (h == 0) { /* err holds the message */ }
+//	fastcdc_chunk chunk;
+//	int rc;
+//	while ((rc = fastcdc_next(h, &chunk)) == 1) {
+//	    /* chunk.offset, chunk.length, chunk.data */
+//	}
+//	if (rc < 0) { fastcdc_error(h, err, sizeof err); }
+//	fastcdc_destroy(h);
+//
+// A chunker is not safe for concurrent use, but different chunkers may be
+// used from different threads.
+package main
+
+/*
+#include <stdint.h>
+#include <string.h>
+
+// fastcdc_options configures a chunker. Initialize it with
+// fastcdc_options_init, then override fields as needed.
+typedef struct {
+	int64_t average_size;   // Power of 2.
+	int64_t min_size;       // 0 for average_size / 4.
+	int64_t max_size;       // 0 for average_size * 4.
+	int32_t normalization;  // Level 0-3, or -1 for the default.
+	uint64_t seed;          // 0 for no seed.
+} fastcdc_options;
+
+static inline void fastcdc_options_init(fastcdc_options *opts, int64_t average_size) {
+	memset(opts, 0, sizeof *opts);
+	opts->average_size = average_size;
+	opts->normalization = -1;
+}
+
+// fastcdc_chunk describes a chunk. data points into the buffer of a chunker
+// created by fastcdc_create_buffer and is NULL otherwise.
+typedef struct {
+	int64_t offset;
+	int64_t length;
+	uint64_t fingerprint;
+	int32_t cut;  // Why the chunk ends there, as a fastcdc.CutReason.
+	const uint8_t *data;
+} fastcdc_chunk;
+
+// fastcdc_read_fn reads up to len bytes into buf, returning the number of
+// bytes read, 0 at the end of the input, or -1 on error.
+typedef int64_t (*fastcdc_read_fn)(void *ctx, uint8_t *buf, int64_t len);
+
+static inline int64_t fastcdc_call_read(fastcdc_read_fn fn, void *ctx, uint8_t *buf, int64_t len) {
+	return fn(ctx, buf, len);
+}
+*/
+import "C"
+
+import (
+	"io"
+	"runtime/cgo"
+	"unsafe"
+)
+
+func main() {}
+
+// fastcdc_create returns a chunker reading its input through read, called
+// with ctx. On error it returns 0 and writes the message to errbuf.
+//
+//export fastcdc_create
+func fastcdc_create(read C.fastcdc_read_fn, ctx unsafe.Pointer, opts *C.fastcdc_options, errbuf *C.char, errlen C.size_t) C.uintptr_t {
+	s, err := newReaderSession(func(p []byte) (int, error) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		n := C.fastcdc_call_read(read, ctx, (*C.uint8_t)(unsafe.Pointer(&p[0])), C.int64_t(len(p)))
+		switch {
+		case n < 0:
+			return 0, errReadCallback
+		case n == 0:
+			return 0, io.EOF
+		}
+		return int(n), nil
+	}, toConfig(opts))
+	if err != nil {
+		writeError(err, errbuf, errlen)
+		return 0
+	}
+	return C.uintptr_t(cgo.NewHandle(s))
+}
+
+// fastcdc_create_buffer returns a chunker splitting the len bytes at data
+// in place. The bytes must not change until the chunker is destroyed. On
+// error it returns 0 and writes the message to errbuf.
+//
+//export fastcdc_create_buffer
+func fastcdc_create_buffer(data *C.uint8_t, length C.int64_t, opts *C.fastcdc_options, errbuf *C.char, errlen C.size_t) C.uintptr_t {
+	var buf []byte
+	if length > 0 {
+		buf = unsafe.Slice((*byte)(unsafe.Pointer(data)), int(length))
+	}
+	s, err := newBufferSession(buf, toConfig(opts))
+	if err != nil {
+		writeError(err, errbuf, errlen)
+		return 0
+	}
+	return C.uintptr_t(cgo.NewHandle(s))
+}
+
+// fastcdc_next stores the next chunk in chunk and returns 1, or returns 0 at
+// the end of the input and -1 on error (see fastcdc_error).
+//
+//export fastcdc_next
+func fastcdc_next(h C.uintptr_t, chunk *C.fastcdc_chunk) C.int {
+	s := cgo.Handle(h).Value().(*session)
+	c, ok := s.next()
+	if !ok {
+		if s.err != nil {
+			return -1
+		}
+		return 0
+	}
+	*chunk = C.fastcdc_chunk{
+		offset:      C.int64_t(c.Offset),
+		length:      C.int64_t(c.Length),
+		fingerprint: C.uint64_t(c.Fingerprint),
+		cut:         C.int32_t(c.Cut),
+	}
+	if len(c.Data) > 0 {
+		chunk.data = (*C.uint8_t)(unsafe.Pointer(&c.Data[0]))
+	}
+	return 1
+}
+
+// fastcdc_error writes the message of the error returned by the last failed
+// fastcdc_next to errbuf.
+//
+//export fastcdc_error
+func fastcdc_error(h C.uintptr_t, errbuf *C.char, errlen C.size_t) {
+	s := cgo.Handle(h).Value().(*session)
+	writeError(s.err, errbuf, errlen)
+}
+
+// fastcdc_destroy releases a chunker.
+//
+//export fastcdc_destroy
+func fastcdc_destroy(h C.uintptr_t) {
+	cgo.Handle(h).Delete()
+}
+
+func toConfig(opts *C.fastcdc_options) config {
+	return config{
+		averageSize:   int(opts.average_size),
+		minSize:       int(opts.min_size),
+		maxSize:       int(opts.max_size),
+		normalization: int(opts.normalization),
+		seed:          uint64(opts.seed),
+	}
+}
+
+// writeError copies the message of err, truncated and NUL-terminated, to
+// the errlen bytes at errbuf.
+func writeError(err error, errbuf *C.char, errlen C.size_t) {
+	if errbuf == nil || errlen == 0 {
+		return
+	}
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(errbuf)), int(errlen))
+	n := copy(buf[:len(buf)-1], msg)
+	buf[n] = 0
+}
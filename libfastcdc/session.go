@@ -0,0 +1,90 @@
+//go:build cgo
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+// config mirrors fastcdc_options.
+type config struct {
+	averageSize   int
+	minSize       int // 0 for the default.
+	maxSize       int // 0 for the default.
+	normalization int // -1 for the default.
+	seed          uint64
+}
+
+func (c config) options() []fastcdc.Option {
+	var opts []fastcdc.Option
+	if c.minSize != 0 {
+		opts = append(opts, fastcdc.WithMinSize(c.minSize))
+	}
+	if c.maxSize != 0 {
+		opts = append(opts, fastcdc.WithMaxSize(c.maxSize))
+	}
+	if c.normalization != -1 {
+		opts = append(opts, fastcdc.WithNormalization(c.normalization))
+	}
+	if c.seed != 0 {
+		opts = append(opts, fastcdc.WithSeed(c.seed))
+	}
+	return opts
+}
+
+// session is a chunker created through the C API.
+type session struct {
+	chunker *fastcdc.Chunker
+	// inMemory is set if the chunker chunks caller memory in place, so
+	// that chunk data may be handed back to C.
+	inMemory bool
+	// err is the error of the last call to next that failed.
+	err error
+}
+
+// newReaderSession returns a session chunking the stream read by read.
+func newReaderSession(read func(p []byte) (int, error), cfg config) (*session, error) {
+	chunker, err := fastcdc.NewChunker(readerFunc(read), cfg.averageSize, cfg.options()...)
+	if err != nil {
+		return nil, err
+	}
+	return &session{chunker: chunker}, nil
+}
+
+// newBufferSession returns a session chunking data in place. data must not
+// change until the session is destroyed.
+func newBufferSession(data []byte, cfg config) (*session, error) {
+	chunker, err := fastcdc.NewChunker(bytes.NewReader(data), cfg.averageSize, cfg.options()...)
+	if err != nil {
+		return nil, err
+	}
+	return &session{chunker: chunker, inMemory: true}, nil
+}
+
+// next returns the next chunk, or ok == false at the end of the stream or
+// on error, recording the error in s.err.
+func (s *session) next() (c fastcdc.Chunk, ok bool) {
+	c, err := s.chunker.Next()
+	if err == io.EOF {
+		return fastcdc.Chunk{}, false
+	}
+	if err != nil {
+		s.err = err
+		return fastcdc.Chunk{}, false
+	}
+	if !s.inMemory {
+		c.Data = nil
+	}
+	return c, true
+}
+
+// errReadCallback is returned when the C read callback reports a failure.
+var errReadCallback = errors.New("read callback failed")
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
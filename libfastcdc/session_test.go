@@ -0,0 +1,68 @@
+//go:build cgo
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+func TestSession(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	cfg := config{averageSize: 16384, minSize: 4096, normalization: -1, seed: 7}
+
+	chunker, err := fastcdc.NewChunker(bytes.NewReader(data), 16384, fastcdc.WithMinSize(4096), fastcdc.WithSeed(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []fastcdc.Chunk
+	for {
+		c, err := chunker.Next()
+		if err != nil {
+			break
+		}
+		want = append(want, c)
+	}
+
+	buffered, err := newBufferSession(data, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	streamed, err := newReaderSession(r.Read, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, w := range want {
+		b, ok := buffered.next()
+		if !ok || b.Offset != w.Offset || b.Length != w.Length || b.Fingerprint != w.Fingerprint || !bytes.Equal(b.Data, w.Data) {
+			t.Fatalf("buffered chunk %d = %d/%d/%#x, want %d/%d/%#x", i, b.Offset, b.Length, b.Fingerprint, w.Offset, w.Length, w.Fingerprint)
+		}
+		s, ok := streamed.next()
+		if !ok || s.Offset != w.Offset || s.Length != w.Length || s.Data != nil {
+			t.Fatalf("streamed chunk %d = %d/%d with %d bytes of data, want %d/%d without data", i, s.Offset, s.Length, len(s.Data), w.Offset, w.Length)
+		}
+	}
+	for _, s := range []*session{buffered, streamed} {
+		if _, ok := s.next(); ok || s.err != nil {
+			t.Errorf("next() at end = %v, %v, want end without error", ok, s.err)
+		}
+	}
+
+	failing, err := newReaderSession(func(p []byte) (int, error) { return 0, errReadCallback }, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := failing.next(); ok || !errors.Is(failing.err, errReadCallback) {
+		t.Errorf("next() with failing reader = %v, %v, want %v", ok, failing.err, errReadCallback)
+	}
+
+	if _, err := newBufferSession(data, config{averageSize: 1000, normalization: -1}); err == nil {
+		t.Error("newBufferSession() with invalid average size succeeded")
+	}
+}
@@ -0,0 +1,204 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// The binary encoding of a manifest is
+//
+//	magic "FCM1" | size | digest | chunk count | chunks...
+//
+// where each chunk is its length, digest, and fingerprint. Integers are
+// uvarints and digests are a uvarint length followed by the digest string.
+// Chunk offsets are not stored; chunks are contiguous from offset zero.
+//
+// The encoding is deterministic: a manifest has exactly one encoding, and
+// decoding rejects anything else, including non-minimal varints and trailing
+// bytes. The format will not change under the "FCM1" magic, so the digest
+// of an encoded manifest (see ID) is stable across versions.
+//
+// A manifest with a DigestFunction other than SHA-256 is encoded as
+//
+//	magic "FCM2" | digest function | size | digest | chunk count | chunks...
+//
+// with the function as a uvarint. SHA-256 manifests are encoded as "FCM1"
+// whether or not they name the function, so that they keep one encoding.
+var (
+	binaryMagic   = []byte("FCM1")
+	binaryMagicV2 = []byte("FCM2")
+)
+
+// ErrInvalidEncoding is returned when decoding a malformed binary manifest.
+var ErrInvalidEncoding = errors.New("invalid manifest encoding")
+
+// MarshalBinary returns the deterministic binary encoding of m. The chunks
+// of m must be contiguous, start at offset zero, and sum to m.Size.
+func (m *Manifest) MarshalBinary() ([]byte, error) {
+	var offset int64
+	for _, c := range m.Chunks {
+		if c.Offset != offset || c.Length < 0 {
+			return nil, fmt.Errorf("chunk at offset %d is not contiguous", c.Offset)
+		}
+		offset += c.Length
+	}
+	if offset != m.Size || m.Size < 0 {
+		return nil, fmt.Errorf("chunks cover %d bytes, manifest size is %d", offset, m.Size)
+	}
+
+	var buf []byte
+	if m.DigestFunction.Resolve() == DigestSHA256 {
+		buf = append(buf, binaryMagic...)
+	} else {
+		if m.DigestFunction < 0 {
+			return nil, fmt.Errorf("invalid digest function %d", m.DigestFunction)
+		}
+		buf = append(buf, binaryMagicV2...)
+		buf = binary.AppendUvarint(buf, uint64(m.DigestFunction))
+	}
+	buf = binary.AppendUvarint(buf, uint64(m.Size))
+	buf = appendString(buf, m.Digest)
+	buf = binary.AppendUvarint(buf, uint64(len(m.Chunks)))
+	for _, c := range m.Chunks {
+		buf = binary.AppendUvarint(buf, uint64(c.Length))
+		buf = appendString(buf, c.Digest)
+		buf = binary.AppendUvarint(buf, c.Fingerprint)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a manifest encoded by MarshalBinary into m.
+func (m *Manifest) UnmarshalBinary(data []byte) error {
+	var d decoder
+	var out Manifest
+	switch {
+	case bytes.HasPrefix(data, binaryMagic):
+		d.buf = data[len(binaryMagic):]
+	case bytes.HasPrefix(data, binaryMagicV2):
+		d.buf = data[len(binaryMagicV2):]
+		f := d.uvarint()
+		if d.err == nil && (f == 0 || f == uint64(DigestSHA256) || f > math.MaxInt32) {
+			return fmt.Errorf("%w: digest function %d out of range", ErrInvalidEncoding, f)
+		}
+		out.DigestFunction = DigestFunction(f)
+	default:
+		return fmt.Errorf("%w: bad magic", ErrInvalidEncoding)
+	}
+	out.Size = int64(d.uvarint())
+	out.Digest = d.string()
+	count := d.uvarint()
+	// Every chunk takes at least three bytes, which bounds the allocation.
+	if count > uint64(len(d.buf))/3 {
+		return fmt.Errorf("%w: chunk count %d exceeds data", ErrInvalidEncoding, count)
+	}
+	var offset int64
+	for range count {
+		c := Chunk{Offset: offset, Length: int64(d.uvarint())}
+		c.Digest = d.string()
+		c.Fingerprint = d.uvarint()
+		offset += c.Length
+		if c.Length < 0 || offset < 0 {
+			return fmt.Errorf("%w: chunk length out of range", ErrInvalidEncoding)
+		}
+		out.Chunks = append(out.Chunks, c)
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.buf) != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidEncoding, len(d.buf))
+	}
+	if out.Size < 0 || offset != out.Size {
+		return fmt.Errorf("%w: chunks cover %d bytes, manifest size is %d", ErrInvalidEncoding, offset, out.Size)
+	}
+	*m = out
+	return nil
+}
+
+// ID returns the hex-encoded digest of the binary encoding of m under its
+// DigestFunction, which identifies the manifest itself, for example to
+// deduplicate manifests of manifests.
+func (m *Manifest) ID() (string, error) {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return m.DigestFunction.Digest(data)
+}
+
+// MarshalBinary returns the deterministic binary encoding of c on its own:
+// its offset, length, digest, and fingerprint, encoded as in a manifest.
+func (c Chunk) MarshalBinary() ([]byte, error) {
+	if c.Offset < 0 || c.Length < 0 {
+		return nil, fmt.Errorf("chunk offset %d or length %d is negative", c.Offset, c.Length)
+	}
+	buf := binary.AppendUvarint(nil, uint64(c.Offset))
+	buf = binary.AppendUvarint(buf, uint64(c.Length))
+	buf = appendString(buf, c.Digest)
+	buf = binary.AppendUvarint(buf, c.Fingerprint)
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a chunk encoded by Chunk.MarshalBinary into c.
+func (c *Chunk) UnmarshalBinary(data []byte) error {
+	d := decoder{buf: data}
+	out := Chunk{Offset: int64(d.uvarint()), Length: int64(d.uvarint())}
+	out.Digest = d.string()
+	out.Fingerprint = d.uvarint()
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.buf) != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidEncoding, len(d.buf))
+	}
+	if out.Offset < 0 || out.Length < 0 {
+		return fmt.Errorf("%w: chunk offset or length out of range", ErrInvalidEncoding)
+	}
+	*c = out
+	return nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// decoder reads the fields of a binary manifest, recording the first error.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = fmt.Errorf("%w: truncated", ErrInvalidEncoding)
+		return 0
+	}
+	if n != len(binary.AppendUvarint(nil, v)) {
+		d.err = fmt.Errorf("%w: non-canonical varint", ErrInvalidEncoding)
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if n > uint64(len(d.buf)) {
+		d.err = fmt.Errorf("%w: truncated", ErrInvalidEncoding)
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
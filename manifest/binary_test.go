@@ -0,0 +1,114 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestBinary_RoundTrip(t *testing.T) {
+	data := make([]byte, 300000)
+	rand.New(rand.NewSource(1)).Read(data)
+	m, err := Build(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range []*Manifest{m, {Digest: Digest(nil)}} {
+		enc, err := m.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := &Manifest{}
+		if err := got.UnmarshalBinary(enc); err != nil {
+			t.Fatal(err)
+		}
+		if len(m.Chunks) == 0 {
+			m.Chunks = nil
+		}
+		if !reflect.DeepEqual(got, m) {
+			t.Errorf("round trip = %+v, want %+v", got, m)
+		}
+	}
+
+	// The encoding of a manifest never changes.
+	small := &Manifest{
+		Size:   5,
+		Digest: "ab",
+		Chunks: []Chunk{
+			{Offset: 0, Length: 2, Digest: "c", Fingerprint: 300},
+			{Offset: 2, Length: 3, Digest: "d"},
+		},
+	}
+	enc, err := small.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hex.EncodeToString(enc), "46434d3105026162020201"+"63ac020301"+"6400"; got != want {
+		t.Errorf("MarshalBinary() = %s, want %s", got, want)
+	}
+	id, err := small.ID()
+	if err != nil || id != Digest(enc) {
+		t.Errorf("ID() = %s, %v, want %s", id, err, Digest(enc))
+	}
+
+	// Naming SHA-256 does not change the encoding or the ID.
+	explicit := *small
+	explicit.DigestFunction = DigestSHA256
+	if got, err := explicit.MarshalBinary(); err != nil || !bytes.Equal(got, enc) {
+		t.Errorf("MarshalBinary() with explicit SHA-256 = %x, %v, want %x", got, err, enc)
+	}
+	if got, err := explicit.ID(); err != nil || got != id {
+		t.Errorf("ID() with explicit SHA-256 = %s, %v, want %s", got, err, id)
+	}
+}
+
+func TestBinary_Invalid(t *testing.T) {
+	if _, err := (&Manifest{Size: 3, Chunks: []Chunk{{Offset: 1, Length: 2}}}).MarshalBinary(); err == nil {
+		t.Error("MarshalBinary() of non-contiguous chunks succeeded")
+	}
+
+	valid, err := (&Manifest{Size: 2, Digest: "ab", Chunks: []Chunk{{Length: 2, Digest: "c"}}}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"bad magic":     append([]byte("XXXX"), valid[4:]...),
+		"truncated":     valid[:len(valid)-1],
+		"trailing":      append(valid[:len(valid):len(valid)], 0),
+		"non-canonical": append([]byte("FCM1\x82\x00"), valid[5:]...),
+		"size mismatch": append([]byte("FCM1\x03"), valid[5:]...),
+		"huge count":    []byte("FCM1\x00\x00\xff\xff\xff\xff\x0f"),
+		"FCM2 SHA-256":  append([]byte("FCM2\x01"), valid[4:]...),
+	} {
+		if err := (&Manifest{}).UnmarshalBinary(data); !errors.Is(err, ErrInvalidEncoding) {
+			t.Errorf("%s: UnmarshalBinary() error = %v, want ErrInvalidEncoding", name, err)
+		}
+	}
+}
+
+func TestChunk_Binary(t *testing.T) {
+	c := Chunk{Offset: 1 << 40, Length: 4096, Digest: Digest([]byte("x")), Fingerprint: 1<<64 - 1}
+	enc, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Chunk
+	if err := got.UnmarshalBinary(enc); err != nil {
+		t.Fatal(err)
+	}
+	if got != c {
+		t.Errorf("round trip = %+v, want %+v", got, c)
+	}
+	for _, bad := range [][]byte{nil, enc[:len(enc)-1], append(enc, 0)} {
+		if err := got.UnmarshalBinary(bad); !errors.Is(err, ErrInvalidEncoding) {
+			t.Errorf("UnmarshalBinary(%x) = %v, want %v", bad, err, ErrInvalidEncoding)
+		}
+	}
+	if _, err := (Chunk{Offset: -1}).MarshalBinary(); err == nil {
+		t.Error("MarshalBinary() of negative offset succeeded")
+	}
+}
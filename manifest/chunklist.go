@@ -0,0 +1,93 @@
+package manifest
+
+import "fmt"
+
+// ChunkList is an ordered list of chunks, such as the chunks of a Manifest.
+type ChunkList []Chunk
+
+// Store holds chunk contents by digest. pack.Dir is a Store.
+type Store interface {
+	// Has reports whether the chunk with the given digest is stored.
+	Has(digest string) bool
+	// Get returns the contents of the chunk with the given digest.
+	Get(digest string) ([]byte, error)
+}
+
+// TotalSize returns the sum of the chunk lengths.
+func (l ChunkList) TotalSize() int64 {
+	var size int64
+	for _, c := range l {
+		size += c.Length
+	}
+	return size
+}
+
+// Digests returns the digests of the chunks in order, including duplicates.
+func (l ChunkList) Digests() []string {
+	digests := make([]string, len(l))
+	for i, c := range l {
+		digests[i] = c.Digest
+	}
+	return digests
+}
+
+// Validate reports whether the chunks are contiguous, each starting where
+// the previous one ends, with non-negative offsets and lengths.
+func (l ChunkList) Validate() error {
+	for i, c := range l {
+		if c.Offset < 0 || c.Length < 0 {
+			return fmt.Errorf("chunk %d: offset %d or length %d is negative", i, c.Offset, c.Length)
+		}
+		if i > 0 && c.Offset != l[i-1].Offset+l[i-1].Length {
+			return fmt.Errorf("chunk %d: offset %d does not follow previous chunk ending at %d", i, c.Offset, l[i-1].Offset+l[i-1].Length)
+		}
+	}
+	return nil
+}
+
+// Diff compares l with a newer list. It returns the first occurrence of each
+// digest in other that does not occur in l, and the first occurrence of each
+// digest in l that does not occur in other.
+func (l ChunkList) Diff(other ChunkList) (added, removed ChunkList) {
+	return other.missingFrom(l), l.missingFrom(other)
+}
+
+// missingFrom returns the first occurrence of each digest in l that does
+// not occur in other.
+func (l ChunkList) missingFrom(other ChunkList) ChunkList {
+	seen := make(map[string]bool, len(other))
+	for _, c := range other {
+		seen[c.Digest] = true
+	}
+	var missing ChunkList
+	for _, c := range l {
+		if !seen[c.Digest] {
+			seen[c.Digest] = true
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+// Missing returns the digests of the chunks that store does not have, each
+// once, in order of first occurrence.
+func (l ChunkList) Missing(store Store) []string {
+	var missing []string
+	checked := make(map[string]bool)
+	for _, c := range l {
+		if checked[c.Digest] {
+			continue
+		}
+		checked[c.Digest] = true
+		if !store.Has(c.Digest) {
+			missing = append(missing, c.Digest)
+		}
+	}
+	return missing
+}
+
+// Reconstructable reports whether store has every chunk of l, so that the
+// data they describe can be reassembled.
+func (l ChunkList) Reconstructable(store Store) bool {
+	return len(l.Missing(store)) == 0
+}
@@ -0,0 +1,79 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+)
+
+// memStore is a Store backed by a map.
+type memStore map[string][]byte
+
+func (s memStore) Has(digest string) bool {
+	_, ok := s[digest]
+	return ok
+}
+
+func (s memStore) Get(digest string) ([]byte, error) {
+	data, ok := s[digest]
+	if !ok {
+		return nil, fmt.Errorf("chunk %s: %w", digest, os.ErrNotExist)
+	}
+	return data, nil
+}
+
+func TestChunkList(t *testing.T) {
+	l := ChunkList{
+		{Offset: 0, Length: 3, Digest: "a"},
+		{Offset: 3, Length: 4, Digest: "b"},
+		{Offset: 7, Length: 3, Digest: "a"},
+		{Offset: 10, Length: 5, Digest: "c"},
+	}
+	if got := l.TotalSize(); got != 15 {
+		t.Errorf("TotalSize() = %d, want 15", got)
+	}
+	if got, want := l.Digests(), []string{"a", "b", "a", "c"}; !slices.Equal(got, want) {
+		t.Errorf("Digests() = %v, want %v", got, want)
+	}
+	if err := l.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	if err := l[1:].Validate(); err != nil {
+		t.Errorf("Validate() of sublist = %v", err)
+	}
+	for _, bad := range []ChunkList{
+		{{Offset: 0, Length: 3}, {Offset: 4, Length: 1}},
+		{{Offset: 0, Length: -1}},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%v) succeeded", bad)
+		}
+	}
+
+	newer := ChunkList{
+		{Offset: 0, Length: 3, Digest: "a"},
+		{Offset: 3, Length: 2, Digest: "d"},
+		{Offset: 5, Length: 2, Digest: "d"},
+		{Offset: 7, Length: 5, Digest: "c"},
+	}
+	added, removed := l.Diff(newer)
+	if got, want := added.Digests(), []string{"d"}; !slices.Equal(got, want) {
+		t.Errorf("added = %v, want %v", got, want)
+	}
+	if got, want := removed.Digests(), []string{"b"}; !slices.Equal(got, want) {
+		t.Errorf("removed = %v, want %v", got, want)
+	}
+
+	store := memStore{"a": nil, "c": nil}
+	if got, want := l.Missing(store), []string{"b"}; !slices.Equal(got, want) {
+		t.Errorf("Missing() = %v, want %v", got, want)
+	}
+	if l.Reconstructable(store) {
+		t.Error("Reconstructable() = true with missing chunk")
+	}
+	store["b"] = nil
+	if !l.Reconstructable(store) {
+		t.Error("Reconstructable() = false with all chunks")
+	}
+}
@@ -0,0 +1,58 @@
+package manifest
+
+// DiffStats summarizes the changes between two versions of a blob, computed
+// from their manifests alone.
+type DiffStats struct {
+	// SharedBytes is the number of bytes of the new version covered by
+	// chunks that also occur in the old version.
+	SharedBytes int64
+	// NewBytes is the total length of the distinct chunks of the new version
+	// that do not occur in the old version, i.e. the data a store that holds
+	// the old version must add.
+	NewBytes int64
+	// NewChunks is the number of those distinct new chunks.
+	NewChunks int
+	// RemovedBytes is the total length of the distinct chunks of the old
+	// version that do not occur in the new version.
+	RemovedBytes int64
+	// RemovedChunks is the number of those distinct removed chunks.
+	RemovedChunks int
+	// Regions are the maximal byte ranges of the new version made of chunks
+	// that do not occur in the old version, in order. Few regions mean the
+	// edits were local; many small regions mean they were scattered.
+	Regions []Region
+}
+
+// Region is a byte range of a blob.
+type Region struct {
+	Offset int64
+	Length int64
+}
+
+// Diff compares the manifest a of an old version of a blob with the manifest
+// b of a new version, without reading any chunk contents.
+func Diff(a, b *Manifest) DiffStats {
+	added, removed := a.Chunks.Diff(b.Chunks)
+	stats := DiffStats{
+		NewBytes:      added.TotalSize(),
+		NewChunks:     len(added),
+		RemovedBytes:  removed.TotalSize(),
+		RemovedChunks: len(removed),
+	}
+	isNew := make(map[string]bool, len(added))
+	for _, c := range added {
+		isNew[c.Digest] = true
+	}
+	for _, c := range b.Chunks {
+		if !isNew[c.Digest] {
+			stats.SharedBytes += c.Length
+			continue
+		}
+		if n := len(stats.Regions); n > 0 && stats.Regions[n-1].Offset+stats.Regions[n-1].Length == c.Offset {
+			stats.Regions[n-1].Length += c.Length
+		} else {
+			stats.Regions = append(stats.Regions, Region{Offset: c.Offset, Length: c.Length})
+		}
+	}
+	return stats
+}
@@ -0,0 +1,49 @@
+package manifest
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := make([]byte, 1<<20)
+	rand.New(rand.NewSource(2)).Read(old)
+	edit := make([]byte, 10000)
+	rand.New(rand.NewSource(3)).Read(edit)
+	// Overwrite a region in the middle of the blob.
+	modified := bytes.Clone(old)
+	copy(modified[500000:], edit)
+
+	build := func(data []byte) *Manifest {
+		m, err := Build(bytes.NewReader(data), 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	a, b := build(old), build(modified)
+
+	stats := Diff(a, a)
+	if stats.SharedBytes != a.Size || stats.NewBytes != 0 || stats.RemovedChunks != 0 || len(stats.Regions) != 0 {
+		t.Errorf("Diff(a, a) = %+v, want everything shared", stats)
+	}
+
+	stats = Diff(a, b)
+	if len(stats.Regions) != 1 {
+		t.Fatalf("Regions = %v, want one region", stats.Regions)
+	}
+	r := stats.Regions[0]
+	if r.Offset > 500000 || r.Offset+r.Length < 510000 {
+		t.Errorf("region %+v does not cover the edit", r)
+	}
+	if stats.NewBytes != r.Length || stats.SharedBytes != b.Size-r.Length {
+		t.Errorf("NewBytes = %d, SharedBytes = %d, want %d and %d", stats.NewBytes, stats.SharedBytes, r.Length, b.Size-r.Length)
+	}
+	if stats.NewChunks == 0 || stats.RemovedChunks == 0 || stats.RemovedBytes == 0 {
+		t.Errorf("Diff(a, b) = %+v, want new and removed chunks", stats)
+	}
+	if stats.NewBytes > 100000 {
+		t.Errorf("NewBytes = %d, want edit to stay local", stats.NewBytes)
+	}
+}
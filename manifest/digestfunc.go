@@ -0,0 +1,186 @@
+package manifest
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+// DigestFunction is a hash function for chunk and blob digests. Its values
+// are those of DigestFunction.Value in the Remote Execution API, so that a
+// chunk's Digest and Length are directly the hash and size_bytes of an REAPI
+// Digest under the same function.
+type DigestFunction int32
+
+const (
+	// DigestUnknown is the zero DigestFunction. Manifests treat it as
+	// SHA-256, as REAPI servers do for clients that do not name a function.
+	DigestUnknown DigestFunction = 0
+	DigestSHA256  DigestFunction = 1
+	DigestSHA1    DigestFunction = 2
+	DigestMD5     DigestFunction = 3
+	DigestVSO     DigestFunction = 4
+	DigestSHA384  DigestFunction = 5
+	DigestSHA512  DigestFunction = 6
+	DigestMURMUR3 DigestFunction = 7
+	// DigestSHA256Tree is the tree hash of SHA-256 over 1KiB blocks.
+	DigestSHA256Tree DigestFunction = 8
+	DigestBLAKE3     DigestFunction = 9
+)
+
+var digestFunctionNames = [...]string{
+	DigestUnknown:    "UNKNOWN",
+	DigestSHA256:     "SHA256",
+	DigestSHA1:       "SHA1",
+	DigestMD5:        "MD5",
+	DigestVSO:        "VSO",
+	DigestSHA384:     "SHA384",
+	DigestSHA512:     "SHA512",
+	DigestMURMUR3:    "MURMUR3",
+	DigestSHA256Tree: "SHA256TREE",
+	DigestBLAKE3:     "BLAKE3",
+}
+
+// ErrUnsupportedDigestFunction is returned for a digest function that this
+// package cannot compute, such as BLAKE3, for which the standard library
+// has no implementation.
+var ErrUnsupportedDigestFunction = errors.New("unsupported digest function")
+
+// String returns the REAPI name of f, e.g. "SHA256".
+func (f DigestFunction) String() string {
+	if f >= 0 && int(f) < len(digestFunctionNames) {
+		return digestFunctionNames[f]
+	}
+	return fmt.Sprintf("DigestFunction(%d)", f)
+}
+
+// MarshalText returns the REAPI name of f, as used in JSON.
+func (f DigestFunction) MarshalText() ([]byte, error) {
+	if f < 0 || int(f) >= len(digestFunctionNames) {
+		return nil, fmt.Errorf("unknown digest function %d", f)
+	}
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText parses a name returned by MarshalText. Names are matched
+// exactly, as REAPI spells them.
+func (f *DigestFunction) UnmarshalText(text []byte) error {
+	for i, name := range digestFunctionNames {
+		if string(text) == name {
+			*f = DigestFunction(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown digest function %q", text)
+}
+
+// Resolve returns the function that f stands for: DigestSHA256 for
+// DigestUnknown, and f otherwise.
+func (f DigestFunction) Resolve() DigestFunction {
+	if f == DigestUnknown {
+		return DigestSHA256
+	}
+	return f
+}
+
+// Supported reports whether this package can compute digests with f.
+func (f DigestFunction) Supported() bool {
+	return f.newHash() != nil
+}
+
+// New returns a hash computing f, or ErrUnsupportedDigestFunction.
+func (f DigestFunction) New() (hash.Hash, error) {
+	h := f.newHash()
+	if h == nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedDigestFunction, f)
+	}
+	return h, nil
+}
+
+func (f DigestFunction) newHash() hash.Hash {
+	switch f.Resolve() {
+	case DigestSHA256:
+		return sha256.New()
+	case DigestSHA1:
+		return sha1.New()
+	case DigestMD5:
+		return md5.New()
+	case DigestSHA384:
+		return sha512.New384()
+	case DigestSHA512:
+		return sha512.New()
+	}
+	return nil
+}
+
+// Digest returns the hex-encoded digest of data under f, in the lowercase
+// form REAPI expects.
+func (f DigestFunction) Digest(data []byte) (string, error) {
+	if f.Resolve() == DigestSHA256 {
+		return Digest(data), nil
+	}
+	h, err := f.New()
+	if err != nil {
+		return "", err
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// NewChunk returns the manifest entry for a chunk, computing its digest
+// with f.
+func (f DigestFunction) NewChunk(chunk fastcdc.Chunk) (Chunk, error) {
+	digest, err := f.Digest(chunk.Data)
+	if err != nil {
+		return Chunk{}, err
+	}
+	return Chunk{
+		Offset:      int64(chunk.Offset),
+		Length:      int64(chunk.Length),
+		Digest:      digest,
+		Fingerprint: chunk.Fingerprint,
+	}, nil
+}
+
+// Build is like the package-level Build, but digests the blob and its
+// chunks with f.
+func (f DigestFunction) Build(r io.Reader, averageSize int, opts ...fastcdc.Option) (*Manifest, error) {
+	if !f.Supported() {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedDigestFunction, f)
+	}
+	chunker, err := fastcdc.NewChunker(r, averageSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return f.FromChunker(chunker)
+}
+
+// FromChunker is like the package-level FromChunker, but digests the blob
+// and its chunks with f.
+func (f DigestFunction) FromChunker(chunker *fastcdc.Chunker) (*Manifest, error) {
+	b, err := newBuilder(f)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := b.add(chunk); err != nil {
+			return nil, err
+		}
+	}
+	return b.finish(), nil
+}
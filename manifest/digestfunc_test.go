@@ -0,0 +1,107 @@
+package manifest
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestDigestFunction_Build(t *testing.T) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	m, err := DigestSHA512.Build(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.DigestFunction != DigestSHA512 {
+		t.Errorf("digest function = %v, want SHA512", m.DigestFunction)
+	}
+	sum := sha512.Sum512(data)
+	if m.Digest != hex.EncodeToString(sum[:]) {
+		t.Errorf("manifest digest = %s, want %x", m.Digest, sum)
+	}
+	base, err := Build(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Chunks) != len(base.Chunks) {
+		t.Fatalf("got %d chunks, want %d", len(m.Chunks), len(base.Chunks))
+	}
+	for i, c := range m.Chunks {
+		sum := sha512.Sum512(data[c.Offset : c.Offset+c.Length])
+		if c.Digest != hex.EncodeToString(sum[:]) {
+			t.Errorf("chunk %d: digest = %s, want %x", i, c.Digest, sum)
+		}
+		if c.Offset != base.Chunks[i].Offset || c.Length != base.Chunks[i].Length {
+			t.Errorf("chunk %d: boundaries differ from SHA-256 manifest", i)
+		}
+	}
+
+	// The encodings carry the function, and SHA-256 manifests keep theirs.
+	enc, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Manifest
+	if err := got.UnmarshalBinary(enc); err != nil {
+		t.Fatal(err)
+	}
+	if got.DigestFunction != DigestSHA512 || got.Digest != m.Digest {
+		t.Errorf("binary round trip = %v %s, want SHA512 %s", got.DigestFunction, got.Digest, m.Digest)
+	}
+	if baseEnc, _ := base.MarshalBinary(); !bytes.HasPrefix(baseEnc, []byte("FCM1")) {
+		t.Error("SHA-256 manifest not encoded as FCM1")
+	}
+	js, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(js, []byte(`"digestFunction":"SHA512"`)) {
+		t.Errorf("JSON lacks digest function: %.200s", js)
+	}
+	if js, _ := json.Marshal(base); bytes.Contains(js, []byte("digestFunction")) {
+		t.Error("SHA-256 manifest JSON names a digest function")
+	}
+}
+
+func TestDigestFunction_Unsupported(t *testing.T) {
+	for _, f := range []DigestFunction{DigestBLAKE3, DigestVSO, DigestMURMUR3, DigestSHA256Tree, 42} {
+		if f.Supported() {
+			t.Errorf("%v reported as supported", f)
+		}
+		if _, err := f.Build(bytes.NewReader([]byte("data")), 4096); !errors.Is(err, ErrUnsupportedDigestFunction) {
+			t.Errorf("%v: Build error = %v, want ErrUnsupportedDigestFunction", f, err)
+		}
+	}
+	tc, err := NewTreeChunker(4096, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.SetDigestFunction(DigestBLAKE3); !errors.Is(err, ErrUnsupportedDigestFunction) {
+		t.Errorf("SetDigestFunction(BLAKE3) = %v, want ErrUnsupportedDigestFunction", err)
+	}
+}
+
+func TestDigestFunction_Text(t *testing.T) {
+	for f := DigestUnknown; f <= DigestBLAKE3; f++ {
+		text, err := f.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got DigestFunction
+		if err := got.UnmarshalText(text); err != nil || got != f {
+			t.Errorf("UnmarshalText(%q) = %v, %v, want %v", text, got, err, f)
+		}
+	}
+	if DigestUnknown.Resolve() != DigestSHA256 {
+		t.Error("unknown digest function does not resolve to SHA-256")
+	}
+	if d, _ := DigestUnknown.Digest([]byte("x")); d != Digest([]byte("x")) {
+		t.Error("unknown digest function does not digest with SHA-256")
+	}
+}
@@ -0,0 +1,172 @@
+package manifest
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileKey identifies a version of a file: its device and inode, size, and
+// modification time. Where the platform or file system does not report a
+// device and inode, the file's path takes their place.
+type FileKey struct {
+	Device  uint64 `json:"device,omitempty"`
+	Inode   uint64 `json:"inode,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"` // In Unix nanoseconds.
+}
+
+// NewFileKey returns the key of the file at path described by info.
+func NewFileKey(path string, info fs.FileInfo) FileKey {
+	k := FileKey{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	if dev, ino, ok := fileID(info); ok {
+		k.Device, k.Inode = dev, ino
+	} else {
+		k.Path = path
+	}
+	return k
+}
+
+// FileCache remembers the manifests of files by FileKey, so that snapshots
+// of a tree skip chunking files that have not changed since the last run.
+// It is safe for concurrent use.
+//
+// A FileCache must only be used with one chunker configuration, since the
+// manifests it returns were chunked with whatever configuration stored
+// them. Like most tools that trust file metadata, it misses changes that
+// preserve a file's size and modification time, for example two writes
+// within the time stamp granularity of the file system; callers that need
+// stronger change detection set Validate.
+type FileCache struct {
+	// Validate, if not nil, is called on every hit with the path and info
+	// of the file and the cached manifest, and rejects the hit by returning
+	// false, e.g. after comparing a change time or checksum that the caller
+	// tracks.
+	Validate func(path string, info fs.FileInfo, m *Manifest) bool
+
+	mu      sync.Mutex
+	entries map[FileKey]*Manifest
+	used    map[FileKey]bool
+}
+
+// NewFileCache returns an empty FileCache.
+func NewFileCache() *FileCache {
+	return &FileCache{entries: map[FileKey]*Manifest{}, used: map[FileKey]bool{}}
+}
+
+// Lookup returns the cached manifest of the file at path described by info.
+func (c *FileCache) Lookup(path string, info fs.FileInfo) (*Manifest, bool) {
+	k := NewFileKey(path, info)
+	c.mu.Lock()
+	m, ok := c.entries[k]
+	c.mu.Unlock()
+	if !ok || (c.Validate != nil && !c.Validate(path, info, m)) {
+		return nil, false
+	}
+	c.mu.Lock()
+	c.used[k] = true
+	c.mu.Unlock()
+	return m, true
+}
+
+// Store caches the manifest of the file at path described by info, which
+// must have been obtained before the file was read.
+func (c *FileCache) Store(path string, info fs.FileInfo, m *Manifest) {
+	k := NewFileKey(path, info)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[k] = m
+	c.used[k] = true
+}
+
+// Len returns the number of cached manifests.
+func (c *FileCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Prune drops the manifests that were neither looked up nor stored since
+// the cache was created, loaded, or last pruned, e.g. those of files deleted
+// or changed since the previous snapshot, and returns how many it dropped.
+func (c *FileCache) Prune() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for k := range c.entries {
+		if !c.used[k] {
+			delete(c.entries, k)
+			n++
+		}
+	}
+	clear(c.used)
+	return n
+}
+
+// fileCacheRecord is the on-disk form of a cache entry written by Save.
+type fileCacheRecord struct {
+	Key      FileKey   `json:"key"`
+	Manifest *Manifest `json:"manifest"`
+}
+
+// Save writes the cache to path as JSON lines, crash-safely: to a temporary
+// file that is synced and renamed into place.
+func (c *FileCache) Save(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	c.mu.Lock()
+	for k, m := range c.entries {
+		if err = enc.Encode(fileCacheRecord{Key: k, Manifest: m}); err != nil {
+			break
+		}
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadFileCache reads a cache written by Save. Validate must be set again
+// on the result.
+func LoadFileCache(path string) (*FileCache, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c := NewFileCache()
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var r fileCacheRecord
+		if err := dec.Decode(&r); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("loading file cache %s: %w", path, err)
+		}
+		c.entries[r.Key] = r.Manifest
+	}
+	return c, nil
+}
@@ -0,0 +1,111 @@
+package manifest
+
+import (
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFileCache(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	randBytes := func(n int) []byte {
+		data := make([]byte, n)
+		rng.Read(data)
+		return data
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(dir, name), randBytes(50000), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fsys := os.DirFS(dir)
+	tc, err := NewTreeChunker(4096, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewFileCache()
+	tc.SetCache(cache)
+	var puts atomic.Int64
+	snapshot := func() Tree {
+		t.Helper()
+		puts.Store(0)
+		tree, err := tc.ChunkAndPut(fsys, ".", func(string, []byte) error {
+			puts.Add(1)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tree
+	}
+
+	first := snapshot()
+	if puts.Load() == 0 || cache.Len() != 2 {
+		t.Fatalf("first snapshot put %d chunks and cached %d files", puts.Load(), cache.Len())
+	}
+
+	// Unchanged files are not chunked again.
+	second := snapshot()
+	if puts.Load() != 0 {
+		t.Errorf("snapshot of unchanged files put %d chunks", puts.Load())
+	}
+	for name, m := range first {
+		if second[name].Digest != m.Digest {
+			t.Errorf("%s: cached manifest differs", name)
+		}
+	}
+
+	// A changed file is chunked again, and its old entry is pruned.
+	if err := os.WriteFile(filepath.Join(dir, "b"), randBytes(40000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cache.Prune()
+	third := snapshot()
+	if puts.Load() == 0 || third["a"] != first["a"] || third["b"].Digest == first["b"].Digest {
+		t.Errorf("snapshot after changing b put %d chunks, b changed = %v", puts.Load(), third["b"].Digest != first["b"].Digest)
+	}
+	if n := cache.Prune(); n != 1 || cache.Len() != 2 {
+		t.Errorf("Prune() dropped %d entries, leaving %d; want 1 dropped, 2 left", n, cache.Len())
+	}
+
+	// The cache survives saving and loading.
+	path := filepath.Join(t.TempDir(), "cache.jsonl")
+	if err := cache.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFileCache(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.SetCache(loaded)
+	if fourth := snapshot(); puts.Load() != 0 || fourth["b"].Digest != third["b"].Digest {
+		t.Errorf("snapshot with the loaded cache put %d chunks", puts.Load())
+	}
+
+	// Validate can reject hits.
+	loaded.Validate = func(path string, info fs.FileInfo, m *Manifest) bool {
+		return path != "a"
+	}
+	snapshot()
+	if puts.Load() == 0 {
+		t.Error("rejected hit was not chunked again")
+	}
+}
+
+func TestNewFileKey(t *testing.T) {
+	// File systems without inodes are keyed by path.
+	fsys := fstest.MapFS{"x": &fstest.MapFile{Data: []byte("data"), ModTime: time.Unix(1, 0)}}
+	info, err := fs.Stat(fsys, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k := NewFileKey("x", info); k != (FileKey{Path: "x", Size: 4, ModTime: 1e9}) {
+		t.Errorf("NewFileKey() = %+v", k)
+	}
+}
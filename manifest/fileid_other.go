@@ -0,0 +1,11 @@
+//go:build !unix
+
+package manifest
+
+import "io/fs"
+
+// fileID returns the device and inode of a file, which are not available
+// on this platform.
+func fileID(info fs.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package manifest
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID returns the device and inode of a file.
+func fileID(info fs.FileInfo) (dev, ino uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(st.Dev), st.Ino, true
+}
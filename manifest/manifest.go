@@ -0,0 +1,100 @@
+// Package manifest describes chunked blobs as ordered lists of chunk digests.
+//
+// A Manifest records where each chunk of a blob starts, how long it is, and
+// the digest of its contents, which is all that is needed to store chunks in
+// a content-addressed store and to reassemble the blob later. Digests are
+// SHA-256 unless a manifest names another DigestFunction.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+// Chunk describes a single chunk of a blob.
+type Chunk struct {
+	Offset      int64  `json:"offset"`
+	Length      int64  `json:"length"`
+	Digest      string `json:"digest"`
+	Fingerprint uint64 `json:"fingerprint,omitempty"`
+}
+
+// Manifest lists the chunks of a blob in stream order.
+type Manifest struct {
+	// Size is the total size of the blob in bytes.
+	Size int64 `json:"size"`
+	// Digest is the hex-encoded digest of the whole blob.
+	Digest string `json:"digest"`
+	// DigestFunction is the function of Digest and of the chunk digests.
+	// The zero value means SHA-256.
+	DigestFunction DigestFunction `json:"digestFunction,omitzero"`
+	// Chunks are the chunks of the blob in stream order.
+	Chunks ChunkList `json:"chunks"`
+}
+
+// Build chunks r with the given average size and options, as for
+// fastcdc.NewChunker, and returns the manifest of the stream.
+func Build(r io.Reader, averageSize int, opts ...fastcdc.Option) (*Manifest, error) {
+	chunker, err := fastcdc.NewChunker(r, averageSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return FromChunker(chunker)
+}
+
+// FromChunker reads all remaining chunks from chunker and returns their
+// manifest.
+func FromChunker(chunker *fastcdc.Chunker) (*Manifest, error) {
+	return DigestUnknown.FromChunker(chunker)
+}
+
+// builder accumulates chunks of a stream into a manifest.
+type builder struct {
+	m        *Manifest
+	blobHash hash.Hash
+}
+
+func newBuilder(f DigestFunction) (*builder, error) {
+	h, err := f.New()
+	if err != nil {
+		return nil, err
+	}
+	return &builder{m: &Manifest{DigestFunction: f}, blobHash: h}, nil
+}
+
+func (b *builder) add(chunk fastcdc.Chunk) error {
+	c, err := b.m.DigestFunction.NewChunk(chunk)
+	if err != nil {
+		return err
+	}
+	b.blobHash.Write(chunk.Data)
+	b.m.Chunks = append(b.m.Chunks, c)
+	b.m.Size += int64(chunk.Length)
+	return nil
+}
+
+func (b *builder) finish() *Manifest {
+	b.m.Digest = hex.EncodeToString(b.blobHash.Sum(nil))
+	return b.m
+}
+
+// NewChunk returns the manifest entry for a chunk, computing its SHA-256
+// digest.
+func NewChunk(chunk fastcdc.Chunk) Chunk {
+	return Chunk{
+		Offset:      int64(chunk.Offset),
+		Length:      int64(chunk.Length),
+		Digest:      Digest(chunk.Data),
+		Fingerprint: chunk.Fingerprint,
+	}
+}
+
+// Digest returns the hex-encoded SHA-256 digest of data.
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
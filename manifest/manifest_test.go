@@ -0,0 +1,50 @@
+package manifest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	m, err := Build(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(data)
+	if m.Digest != hex.EncodeToString(sum[:]) {
+		t.Errorf("manifest digest = %s, want %x", m.Digest, sum)
+	}
+	if m.Size != int64(len(data)) {
+		t.Errorf("manifest size = %d, want %d", m.Size, len(data))
+	}
+	if len(m.Chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(m.Chunks))
+	}
+
+	var offset int64
+	for i, c := range m.Chunks {
+		if c.Offset != offset {
+			t.Errorf("chunk %d: offset = %d, want %d", i, c.Offset, offset)
+		}
+		if want := Digest(data[c.Offset : c.Offset+c.Length]); c.Digest != want {
+			t.Errorf("chunk %d: digest = %s, want %s", i, c.Digest, want)
+		}
+		offset += c.Length
+	}
+	if offset != m.Size {
+		t.Errorf("chunks cover %d bytes, want %d", offset, m.Size)
+	}
+}
+
+func TestBuild_InvalidOptions(t *testing.T) {
+	if _, err := Build(bytes.NewReader(nil), 1000); err == nil {
+		t.Error("expected error for non-power-of-2 average size")
+	}
+}
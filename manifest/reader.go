@@ -0,0 +1,123 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// RangeReader reads a byte range of a chunked blob, fetching only the
+// chunks that overlap each read from a Store. It implements io.Reader,
+// io.ReaderAt, and io.Seeker with offsets relative to the start of the range,
+// like io.SectionReader. ReadAt may be called concurrently.
+type RangeReader struct {
+	m     *Manifest
+	store Store
+	off   int64
+	n     int64
+	pos   int64
+
+	// The most recently fetched chunk, which serves sequential reads smaller
+	// than a chunk.
+	mu          sync.Mutex
+	cachedIndex int
+	cachedData  []byte
+}
+
+// NewRangeReader returns a RangeReader over the n bytes at offset off of the
+// blob described by m, whose chunks are fetched from store. The chunks of m
+// must be contiguous from offset zero.
+func NewRangeReader(m *Manifest, store Store, off, n int64) (*RangeReader, error) {
+	if off < 0 || n < 0 || off > m.Size-n {
+		return nil, fmt.Errorf("range [%d, %d) out of bounds for size %d", off, off+n, m.Size)
+	}
+	return &RangeReader{m: m, store: store, off: off, n: n, cachedIndex: -1}, nil
+}
+
+// Size returns the length of the range in bytes.
+func (r *RangeReader) Size() int64 {
+	return r.n
+}
+
+// Read implements io.Reader.
+func (r *RangeReader) Read(p []byte) (int, error) {
+	if r.pos >= r.n {
+		return 0, io.EOF
+	}
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (r *RangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.n
+	default:
+		return 0, errors.New("Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("Seek: invalid offset")
+	}
+	r.pos = offset
+	return offset, nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *RangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("ReadAt: negative offset")
+	}
+	if off >= r.n {
+		return 0, io.EOF
+	}
+	var err error
+	if int64(len(p)) > r.n-off {
+		p = p[:r.n-off]
+		err = io.EOF
+	}
+	pos := r.off + off
+	end := pos + int64(len(p))
+	n := 0
+	for i := r.m.Chunks.find(pos); n < len(p); i++ {
+		c := r.m.Chunks[i]
+		data, fetchErr := r.fetch(i)
+		if fetchErr != nil {
+			return n, fetchErr
+		}
+		n += copy(p[n:], data[pos-c.Offset:min(c.Length, end-c.Offset)])
+		pos = c.Offset + c.Length
+	}
+	return n, err
+}
+
+// fetch returns the contents of chunk i.
+func (r *RangeReader) fetch(i int) ([]byte, error) {
+	r.mu.Lock()
+	if r.cachedIndex == i {
+		defer r.mu.Unlock()
+		return r.cachedData, nil
+	}
+	r.mu.Unlock()
+
+	c := r.m.Chunks[i]
+	data, err := r.store.Get(c.Digest)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != c.Length {
+		return nil, fmt.Errorf("chunk %s: got %d bytes, want %d", c.Digest, len(data), c.Length)
+	}
+	r.mu.Lock()
+	r.cachedIndex, r.cachedData = i, data
+	r.mu.Unlock()
+	return data, nil
+}
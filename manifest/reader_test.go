@@ -0,0 +1,78 @@
+package manifest
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+// countingStore counts the chunks fetched from a Store.
+type countingStore struct {
+	Store
+	gets int
+}
+
+func (s *countingStore) Get(digest string) ([]byte, error) {
+	s.gets++
+	return s.Store.Get(digest)
+}
+
+func TestRangeReader(t *testing.T) {
+	data := make([]byte, 300000)
+	rand.New(rand.NewSource(5)).Read(data)
+	m, err := Build(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := memStore{}
+	for _, c := range m.Chunks {
+		mem[c.Digest] = data[c.Offset : c.Offset+c.Length]
+	}
+
+	for _, r := range [][2]int64{{0, 300000}, {12345, 100000}, {299999, 1}, {7, 0}} {
+		rr, err := NewRangeReader(m, mem, r[0], r[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := iotest.TestReader(rr, data[r[0]:r[0]+r[1]]); err != nil {
+			t.Errorf("range %v: %v", r, err)
+		}
+	}
+
+	// A small read fetches only the chunks it overlaps.
+	store := &countingStore{Store: mem}
+	rr, err := NewRangeReader(m, store, 0, m.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := m.Chunks[10]
+	buf := make([]byte, c.Length+1)
+	if _, err := rr.ReadAt(buf, c.Offset); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data[c.Offset:c.Offset+c.Length+1]) {
+		t.Error("ReadAt() returned wrong data")
+	}
+	if store.gets != 2 {
+		t.Errorf("ReadAt() fetched %d chunks, want 2", store.gets)
+	}
+
+	if _, err := rr.ReadAt(buf, m.Size); err != io.EOF {
+		t.Errorf("ReadAt() past end = %v, want EOF", err)
+	}
+	if _, err := NewRangeReader(m, mem, 1, m.Size); err == nil {
+		t.Error("NewRangeReader() past end succeeded")
+	}
+
+	// Missing chunks are reported.
+	delete(mem, m.Chunks[0].Digest)
+	rr, err = NewRangeReader(m, mem, 0, m.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(rr); err == nil {
+		t.Error("ReadAll() with missing chunk succeeded")
+	}
+}
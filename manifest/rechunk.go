@@ -0,0 +1,166 @@
+package manifest
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+// RechunkStats reports how much of a blob Rechunk read.
+type RechunkStats struct {
+	// ReusedChunks and ReusedBytes count the chunks of the previous version
+	// that were kept without reading them.
+	ReusedChunks int
+	ReusedBytes  int64
+	// RechunkedBytes is the number of bytes read and chunked again.
+	RechunkedBytes int64
+}
+
+// Rechunk returns the manifest of a new version of a blob, size bytes long
+// and read from ra, given the manifest old of the previous version and the
+// byte ranges of the new version that may have changed, e.g. as reported by
+// inotify or the USN journal. Bytes outside dirty must be unchanged, and a
+// change of size needs no dirty range of its own.
+//
+// Each dirty range is chunked from the boundary of old that precedes it,
+// through the range and on until a cut falls on a boundary of old again;
+// beyond that point the cuts of both versions agree, so the old chunks are
+// reused until the next dirty range. The result equals that of chunking the
+// whole blob with the same average size and options, provided that they are
+// the ones old was built with and that they do not cut at absolute
+// positions, as WithBoundaryHints, WithSkipRanges, WithFirstChunkSize, and
+// WithAlignment do. Put, if not nil, is called with every new chunk, as in
+// TreeChunker.ChunkAndPut.
+//
+// New chunks are digested with the DigestFunction of old. The Digest of the
+// result is left empty, because it would take reading the whole blob.
+func Rechunk(old *Manifest, ra io.ReaderAt, size int64, dirty []Region, averageSize int, put func(digest string, data []byte) error, opts ...fastcdc.Option) (*Manifest, RechunkStats, error) {
+	var stats RechunkStats
+	if err := old.Chunks.Validate(); err != nil {
+		return nil, stats, err
+	}
+	if len(old.Chunks) > 0 && old.Chunks[0].Offset != 0 || old.Chunks.TotalSize() != old.Size {
+		return nil, stats, errors.New("chunks of the previous version do not cover it")
+	}
+	if size < 0 {
+		return nil, stats, fmt.Errorf("size %d is negative", size)
+	}
+	dirty = normalizeDirty(dirty, old.Size, size)
+
+	if !old.DigestFunction.Supported() {
+		return nil, stats, fmt.Errorf("%w: %v", ErrUnsupportedDigestFunction, old.DigestFunction)
+	}
+	m := &Manifest{Size: size, DigestFunction: old.DigestFunction}
+	// next is the index of the first old chunk not yet reused or passed.
+	next := 0
+	// reuse appends the old chunks from next up to offset end.
+	reuse := func(end int64) {
+		for ; next < len(old.Chunks) && old.Chunks[next].Offset < end; next++ {
+			m.Chunks = append(m.Chunks, old.Chunks[next])
+			stats.ReusedChunks++
+			stats.ReusedBytes += old.Chunks[next].Length
+		}
+	}
+
+	// pos is the end of the chunks of m so far.
+	var pos int64
+	for k := 0; k < len(dirty) && pos < size; {
+		// Restart at the last old boundary strictly before the first dirty
+		// byte: a boundary at the dirty offset itself is not kept, because
+		// the cut there depends on the byte that follows it.
+		i := sort.Search(len(old.Chunks), func(i int) bool {
+			return old.Chunks[i].Offset >= dirty[k].Offset
+		}) - 1
+		var start int64
+		if i >= 0 {
+			start = old.Chunks[i].Offset
+		}
+		reuse(start)
+
+		chunker, err := fastcdc.NewSectionChunker(ra, start, size-start, averageSize, opts...)
+		if err != nil {
+			return nil, stats, err
+		}
+		end := dirty[k].Offset + dirty[k].Length
+		k++
+		for {
+			chunk, err := chunker.Next()
+			if err == io.EOF {
+				next = len(old.Chunks)
+				pos = size
+				break
+			}
+			if err != nil {
+				return nil, stats, err
+			}
+			c, err := old.DigestFunction.NewChunk(chunk)
+			if err != nil {
+				return nil, stats, err
+			}
+			if put != nil {
+				if err := put(c.Digest, chunk.Data); err != nil {
+					return nil, stats, err
+				}
+			}
+			m.Chunks = append(m.Chunks, c)
+			stats.RechunkedBytes += c.Length
+
+			// Dirty ranges reached on the way must be passed too, including
+			// one starting at the cut, which may move it.
+			cut := c.Offset + c.Length
+			pos = cut
+			for ; k < len(dirty) && dirty[k].Offset <= cut; k++ {
+				end = max(end, dirty[k].Offset+dirty[k].Length)
+			}
+			if cut < end {
+				continue
+			}
+			j, ok := slices.BinarySearchFunc(old.Chunks, cut, func(c Chunk, off int64) int {
+				return cmp.Compare(c.Offset, off)
+			})
+			if ok {
+				// Resynchronized with the old boundaries.
+				next = j
+				break
+			}
+		}
+	}
+	reuse(size)
+	return m, stats, nil
+}
+
+// normalizeDirty sorts and merges dirty ranges and clips them to the new
+// size, adding the range from the end of the shorter version to the end of
+// the new one if their sizes differ.
+func normalizeDirty(dirty []Region, oldSize, size int64) []Region {
+	var regions []Region
+	for _, r := range dirty {
+		start, end := max(r.Offset, 0), min(r.Offset+r.Length, size)
+		if start < end {
+			regions = append(regions, Region{Offset: start, Length: end - start})
+		}
+	}
+	if oldSize != size {
+		// The last byte the versions share is dirty too: the chunk that
+		// held it is cut at the end of the stream in one version only.
+		start := max(min(oldSize, size)-1, 0)
+		regions = append(regions, Region{Offset: start, Length: size - start})
+	}
+	slices.SortFunc(regions, func(a, b Region) int {
+		return cmp.Compare(a.Offset, b.Offset)
+	})
+	var merged []Region
+	for _, r := range regions {
+		if n := len(merged); n > 0 && r.Offset <= merged[n-1].Offset+merged[n-1].Length {
+			merged[n-1].Length = max(merged[n-1].Length, r.Offset+r.Length-merged[n-1].Offset)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
@@ -0,0 +1,165 @@
+package manifest
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestRechunk(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	randBytes := func(n int) []byte {
+		data := make([]byte, n)
+		rng.Read(data)
+		return data
+	}
+	base := randBytes(1 << 20)
+	overwrite := func(off int, n int) []byte {
+		data := bytes.Clone(base)
+		rng.Read(data[off : off+n])
+		return data
+	}
+	old, err := Build(bytes.NewReader(base), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	boundary := old.Chunks[len(old.Chunks)/2].Offset
+
+	tests := []struct {
+		name  string
+		data  []byte
+		dirty []Region
+		// maxRechunked bounds the bytes chunked again, if positive.
+		maxRechunked int64
+	}{
+		{name: "unchanged", data: base, maxRechunked: -1},
+		{
+			name:         "overwrite",
+			data:         overwrite(300000, 100),
+			dirty:        []Region{{Offset: 300000, Length: 100}},
+			maxRechunked: 64 << 10,
+		},
+		{
+			name: "overlapping and adjacent ranges",
+			data: func() []byte {
+				data := overwrite(100000, 5000)
+				rng.Read(data[700000:700010])
+				return data
+			}(),
+			dirty: []Region{
+				{Offset: 102000, Length: 3000},
+				{Offset: 100000, Length: 2500},
+				{Offset: 700005, Length: 5},
+				{Offset: 700000, Length: 5},
+			},
+			maxRechunked: 128 << 10,
+		},
+		{
+			name:  "insertion",
+			data:  slices.Concat(base[:500000], randBytes(777), base[500000:]),
+			dirty: []Region{{Offset: 500000, Length: int64(len(base)) + 777 - 500000}},
+		},
+		{name: "append", data: slices.Concat(base, randBytes(10000)), maxRechunked: 64 << 10},
+		{name: "truncate", data: base[:900001], maxRechunked: 64 << 10},
+		{name: "truncate at boundary", data: base[:boundary], maxRechunked: 64 << 10},
+		{name: "empty", data: nil},
+		{
+			name:  "ranges past the end",
+			data:  overwrite(len(base)-10, 10),
+			dirty: []Region{{Offset: int64(len(base)) - 10, Length: 100}, {Offset: 2 << 20, Length: 5}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := Build(bytes.NewReader(tt.data), 4096)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var puts int64
+			m, stats, err := Rechunk(old, bytes.NewReader(tt.data), int64(len(tt.data)), tt.dirty, 4096, func(digest string, data []byte) error {
+				puts += int64(len(data))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Size != want.Size || !slices.Equal(m.Chunks, want.Chunks) {
+				t.Fatalf("got %d chunks, want the %d chunks of a full chunking", len(m.Chunks), len(want.Chunks))
+			}
+			if stats.ReusedBytes+stats.RechunkedBytes != m.Size || puts != stats.RechunkedBytes {
+				t.Errorf("stats %+v do not add up to %d bytes, %d put", stats, m.Size, puts)
+			}
+			if tt.maxRechunked < 0 && stats.RechunkedBytes != 0 || tt.maxRechunked > 0 && stats.RechunkedBytes > tt.maxRechunked {
+				t.Errorf("rechunked %d bytes", stats.RechunkedBytes)
+			}
+		})
+	}
+
+	// A new version of an empty blob is chunked whole.
+	m, _, err := Rechunk(&Manifest{}, bytes.NewReader(base), int64(len(base)), nil, 4096, nil)
+	if err != nil || !slices.Equal(m.Chunks, old.Chunks) {
+		t.Errorf("Rechunk() of a previously empty blob = %v", err)
+	}
+
+	if _, _, err := Rechunk(&Manifest{Size: 10}, bytes.NewReader(base), 10, nil, 4096, nil); err == nil {
+		t.Error("expected an error for a manifest whose chunks do not cover it")
+	}
+}
+
+func TestRechunk_ChunkStart(t *testing.T) {
+	base := make([]byte, 1<<20)
+	rand.New(rand.NewSource(8)).Read(base)
+	old, err := Build(bytes.NewReader(base), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The cut that starts a chunk depends on its first byte, so editing it
+	// may move the boundary before it.
+	for _, c := range old.Chunks[1:] {
+		data := bytes.Clone(base)
+		data[c.Offset] ^= 0xff
+		want, err := Build(bytes.NewReader(data), 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, _, err := Rechunk(old, bytes.NewReader(data), int64(len(data)), []Region{{Offset: c.Offset, Length: 1}}, 4096, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(m.Chunks, want.Chunks) {
+			t.Fatalf("editing the first byte of the chunk at %d: result differs from a full chunking", c.Offset)
+		}
+	}
+}
+
+func TestRechunk_DirtyAtResync(t *testing.T) {
+	base := make([]byte, 1<<20)
+	rand.New(rand.NewSource(9)).Read(base)
+	old, err := Build(bytes.NewReader(base), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first range resynchronizes at the boundary where the second one
+	// starts.
+	for i := 1; i+1 < len(old.Chunks); i += 7 {
+		b := old.Chunks[i+1].Offset
+		data := bytes.Clone(base)
+		data[b+1] ^= 0xff
+		dirty := []Region{{Offset: old.Chunks[i].Offset + 1, Length: 1}, {Offset: b, Length: 2}}
+		m, _, err := Rechunk(old, bytes.NewReader(data), int64(len(data)), dirty, 4096, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Chunks.Validate(); err != nil || m.Chunks.TotalSize() != m.Size {
+			t.Fatalf("dirty range at %d: chunks add up to %d of %d bytes: %v", b, m.Chunks.TotalSize(), m.Size, err)
+		}
+		want, err := Build(bytes.NewReader(data), 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(m.Chunks, want.Chunks) {
+			t.Fatalf("dirty range at %d: result differs from a full chunking", b)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package manifest
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Concat returns the manifest of the concatenation of the blobs described
+// by parts, with chunk offsets recomputed relative to the start of each
+// part's first chunk. The digest of the whole blob cannot be derived from
+// the parts without reading them, so it is left empty for the caller to
+// fill in. Parts with different DigestFunctions are an error, since the
+// digests of their chunks could not be told apart.
+func Concat(parts ...*Manifest) (*Manifest, error) {
+	out := &Manifest{}
+	for i, m := range parts {
+		if i == 0 {
+			out.DigestFunction = m.DigestFunction
+		} else if m.DigestFunction.Resolve() != out.DigestFunction.Resolve() {
+			return nil, fmt.Errorf("part %d has digest function %v, part 0 %v", i, m.DigestFunction, out.DigestFunction)
+		}
+		for _, c := range m.Chunks {
+			c.Offset = out.Size + c.Offset - m.Chunks[0].Offset
+			out.Chunks = append(out.Chunks, c)
+		}
+		out.Size += m.Size
+	}
+	return out, nil
+}
+
+// Section describes a byte range of a chunked blob. Its chunks are the
+// chunks of the blob that overlap the range, with offsets relative to the
+// start of the range, so the first chunk may start at a negative offset and
+// the last may extend past Size. Only the part of each chunk within
+// [0, Size) belongs to the section.
+type Section struct {
+	Size           int64
+	Chunks         ChunkList
+	DigestFunction DigestFunction
+}
+
+// Slice returns the section of the blob described by m that starts at off
+// and is n bytes long. The chunks of m must be contiguous from offset zero.
+func (m *Manifest) Slice(off, n int64) (*Section, error) {
+	if off < 0 || n < 0 || off > m.Size-n {
+		return nil, fmt.Errorf("range [%d, %d) out of bounds for size %d", off, off+n, m.Size)
+	}
+	s := &Section{Size: n, DigestFunction: m.DigestFunction}
+	if n == 0 {
+		return s, nil
+	}
+	first := m.Chunks.find(off)
+	for _, c := range m.Chunks[first:] {
+		if c.Offset >= off+n {
+			break
+		}
+		c.Offset -= off
+		s.Chunks = append(s.Chunks, c)
+	}
+	return s, nil
+}
+
+// Manifest returns the manifest of a section that starts and ends on chunk
+// boundaries, and false for one that splits a chunk. The digest of the
+// result is left empty, as for Concat.
+func (s *Section) Manifest() (*Manifest, bool) {
+	m := &Manifest{Size: s.Size, Chunks: s.Chunks, DigestFunction: s.DigestFunction}
+	if len(s.Chunks) == 0 {
+		return m, true
+	}
+	last := s.Chunks[len(s.Chunks)-1]
+	if s.Chunks[0].Offset != 0 || last.Offset+last.Length != s.Size {
+		return nil, false
+	}
+	return m, true
+}
+
+// find returns the index of the chunk containing offset off, assuming l is
+// contiguous and sorted by offset, or len(l) if no chunk does.
+func (l ChunkList) find(off int64) int {
+	return sort.Search(len(l), func(i int) bool {
+		return l[i].Offset+l[i].Length > off
+	})
+}
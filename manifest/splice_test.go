@@ -0,0 +1,102 @@
+package manifest
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestConcatSlice(t *testing.T) {
+	data := make([]byte, 200000)
+	rand.New(rand.NewSource(4)).Read(data)
+	build := func(data []byte) *Manifest {
+		m, err := Build(bytes.NewReader(data), 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	a, b := build(data[:120000]), build(data[120000:])
+	store := memStore{}
+	for _, c := range a.Chunks {
+		store[c.Digest] = data[c.Offset : c.Offset+c.Length]
+	}
+	for _, c := range b.Chunks {
+		store[c.Digest] = data[120000+c.Offset : 120000+c.Offset+c.Length]
+	}
+	// read reassembles a section from the store.
+	read := func(s *Section) []byte {
+		var out []byte
+		for _, c := range s.Chunks {
+			chunk, err := store.Get(c.Digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunk = chunk[max(-c.Offset, 0):min(c.Length, s.Size-c.Offset)]
+			out = append(out, chunk...)
+		}
+		return out
+	}
+
+	m, err := Concat(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Size != int64(len(data)) || m.Digest != "" {
+		t.Errorf("Concat() size = %d, digest = %q", m.Size, m.Digest)
+	}
+	if err := m.Chunks.Validate(); err != nil || m.Chunks[0].Offset != 0 {
+		t.Errorf("Concat() chunks are not contiguous: %v", err)
+	}
+
+	for _, r := range [][2]int64{{0, 200000}, {0, 0}, {1, 1}, {5000, 100000}, {119999, 2}, {199999, 1}} {
+		s, err := m.Slice(r[0], r[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := read(s); !bytes.Equal(got, data[r[0]:r[0]+r[1]]) {
+			t.Errorf("Slice(%d, %d) reads %d bytes that differ from the range", r[0], r[1], len(got))
+		}
+	}
+	for _, r := range [][2]int64{{-1, 1}, {0, 200001}, {200000, 1}, {1, -1}} {
+		if _, err := m.Slice(r[0], r[1]); err == nil {
+			t.Errorf("Slice(%d, %d) succeeded", r[0], r[1])
+		}
+	}
+
+	// Sections on chunk boundaries are manifests again.
+	s, err := m.Slice(a.Size, b.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub, ok := s.Manifest(); !ok || !sub.Chunks.Reconstructable(store) || len(sub.Chunks) != len(b.Chunks) {
+		t.Errorf("Manifest() of aligned section = %v, %v", sub, ok)
+	}
+	if s, err = m.Slice(1, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Manifest(); ok {
+		t.Error("Manifest() of unaligned section succeeded")
+	}
+
+	// Parts whose chunks do not start at zero are rebased.
+	tail := &Manifest{Size: b.Size, Chunks: m.Chunks[len(a.Chunks):]}
+	if joined, err := Concat(a, tail); err != nil || !slices.Equal(joined.Chunks, m.Chunks) {
+		t.Errorf("Concat() with a part starting at %d = %v, chunks differ", tail.Chunks[0].Offset, err)
+	}
+
+	// Parts must share a digest function.
+	explicit := *b
+	explicit.DigestFunction = DigestSHA256
+	if _, err := Concat(a, &explicit); err != nil {
+		t.Errorf("Concat() of implicit and explicit SHA-256 parts = %v", err)
+	}
+	sha512, err := DigestSHA512.Build(bytes.NewReader(data[120000:]), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Concat(a, sha512); err == nil {
+		t.Error("Concat() of SHA-256 and SHA-512 parts succeeded")
+	}
+}
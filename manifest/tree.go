@@ -0,0 +1,168 @@
+package manifest
+
+import (
+	"fmt"
+	"io/fs"
+	"runtime"
+	"sync"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+// Tree maps slash-separated file paths to the manifests of their contents.
+type Tree map[string]*Manifest
+
+// TreeChunker chunks every regular file of a directory tree with the same
+// chunker configuration, using a pool of workers.
+type TreeChunker struct {
+	pool    *fastcdc.Pool
+	workers int
+	cache   *FileCache
+	digest  DigestFunction
+}
+
+// NewTreeChunker creates a TreeChunker that chunks files with the given
+// average size and options, as for fastcdc.NewChunker, using up to workers
+// files in parallel. If workers is not positive, GOMAXPROCS workers are used.
+func NewTreeChunker(averageSize, workers int, opts ...fastcdc.Option) (*TreeChunker, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	pool, err := fastcdc.NewPool(workers, averageSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &TreeChunker{pool: pool, workers: workers}, nil
+}
+
+// SetCache makes tc look up every file in cache before chunking it, and
+// store the manifests of the files it chunks there. Put is not called for
+// the chunks of files found in the cache. The cache must not be shared with
+// TreeChunkers of another configuration.
+func (tc *TreeChunker) SetCache(cache *FileCache) {
+	tc.cache = cache
+}
+
+// SetDigestFunction makes tc digest files and chunks with f instead of
+// SHA-256. It returns ErrUnsupportedDigestFunction if f cannot be computed.
+func (tc *TreeChunker) SetDigestFunction(f DigestFunction) error {
+	if !f.Supported() {
+		return fmt.Errorf("%w: %v", ErrUnsupportedDigestFunction, f)
+	}
+	tc.digest = f
+	return nil
+}
+
+// Chunk walks fsys from root and returns the manifest of every regular file.
+// Tree keys are paths as produced by fs.WalkDir. Chunking stops at the first
+// error encountered.
+func (tc *TreeChunker) Chunk(fsys fs.FS, root string) (Tree, error) {
+	return tc.ChunkAndPut(fsys, root, nil)
+}
+
+// ChunkAndPut is like Chunk, but also calls put with the digest and data of
+// every chunk, for example to store it, in the same pass over the files. Put
+// is called concurrently from the workers and must not retain data. If put
+// is nil, ChunkAndPut is equivalent to Chunk.
+func (tc *TreeChunker) ChunkAndPut(fsys fs.FS, root string, put func(digest string, data []byte) error) (Tree, error) {
+	var (
+		mu       sync.Mutex
+		tree     = Tree{}
+		firstErr error
+	)
+	setErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	paths := make(chan string)
+	var wg sync.WaitGroup
+	for range tc.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				m, err := tc.chunkFile(fsys, path, put)
+				if err != nil {
+					setErr(err)
+					continue
+				}
+				mu.Lock()
+				tree[path] = m
+				mu.Unlock()
+			}
+		}()
+	}
+
+	walkErr := fs.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if failed() {
+			return fs.SkipAll
+		}
+		paths <- path
+		return nil
+	})
+	close(paths)
+	wg.Wait()
+
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return tree, nil
+}
+
+func (tc *TreeChunker) chunkFile(fsys fs.FS, path string, put func(digest string, data []byte) error) (*Manifest, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var info fs.FileInfo
+	if tc.cache != nil {
+		// Stat before reading, so that changes made while the file is read
+		// invalidate the cached manifest.
+		if info, err = f.Stat(); err != nil {
+			return nil, err
+		}
+		if m, ok := tc.cache.Lookup(path, info); ok {
+			return m, nil
+		}
+	}
+	b, err := newBuilder(tc.digest)
+	if err != nil {
+		return nil, err
+	}
+	add := b.add
+	if put != nil {
+		add = func(chunk fastcdc.Chunk) error {
+			if err := b.add(chunk); err != nil {
+				return err
+			}
+			return put(b.m.Chunks[len(b.m.Chunks)-1].Digest, chunk.Data)
+		}
+	}
+	if err := tc.pool.Do(f, add); err != nil {
+		return nil, err
+	}
+	m := b.finish()
+	if tc.cache != nil {
+		tc.cache.Store(path, info, m)
+	}
+	return m, nil
+}
@@ -0,0 +1,112 @@
+package manifest
+
+import (
+	"bytes"
+	"io/fs"
+	"math/rand"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestTreeChunker(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	fsys := fstest.MapFS{}
+	for _, name := range []string{"a.bin", "dir/b.bin", "dir/sub/c.bin", "empty"} {
+		data := make([]byte, rng.Intn(50000))
+		if name == "empty" {
+			data = nil
+		}
+		rng.Read(data)
+		fsys[name] = &fstest.MapFile{Data: data, Mode: 0o644}
+	}
+	fsys["dir/link"] = &fstest.MapFile{Data: []byte("a.bin"), Mode: fs.ModeSymlink | 0o777}
+
+	tc, err := NewTreeChunker(4096, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := tc.Chunk(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tree) != 4 {
+		t.Fatalf("expected 4 files in tree, got %d", len(tree))
+	}
+	for name, f := range fsys {
+		m, ok := tree[name]
+		if name == "dir/link" {
+			if ok {
+				t.Error("symlink should not be chunked")
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("missing manifest for %s", name)
+			continue
+		}
+		want, err := Build(bytes.NewReader(f.Data), 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Digest != want.Digest || len(m.Chunks) != len(want.Chunks) {
+			t.Errorf("%s: manifest differs from sequential chunking", name)
+		}
+	}
+}
+
+func TestTreeChunker_Subtree(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a":     &fstest.MapFile{Data: []byte("a")},
+		"dir/b": &fstest.MapFile{Data: []byte("b")},
+	}
+	tc, err := NewTreeChunker(4096, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := tc.Chunk(fsys, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tree["dir/b"]; !ok || len(tree) != 1 {
+		t.Errorf("unexpected tree: %v", tree)
+	}
+
+	if _, err := tc.Chunk(fsys, "missing"); err == nil {
+		t.Error("expected error for missing root")
+	}
+}
+
+func TestTreeChunker_ChunkAndPut(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	fsys := fstest.MapFS{}
+	for _, name := range []string{"a", "b/c", "b/d"} {
+		data := make([]byte, 30000)
+		rng.Read(data)
+		fsys[name] = &fstest.MapFile{Data: data}
+	}
+	tc, err := NewTreeChunker(4096, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	store := memStore{}
+	tree, err := tc.ChunkAndPut(fsys, ".", func(digest string, data []byte) error {
+		if Digest(data) != digest {
+			t.Errorf("put digest %s does not match data", digest)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		store[digest] = bytes.Clone(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, m := range tree {
+		if !m.Chunks.Reconstructable(store) {
+			t.Errorf("%s: not every chunk was put", name)
+		}
+	}
+}
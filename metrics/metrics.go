@@ -0,0 +1,151 @@
+// Package metrics provides a fastcdc.Observer that collects chunking metrics
+// and exposes them in the Prometheus text exposition format.
+//
+// A single Collector can be attached to any number of chunkers:
+//
+//	collector := metrics.NewCollector("ingest")
+//	http.Handle("/metrics", collector)
+//	chunker, err := fastcdc.NewChunker(r, 1<<20, fastcdc.WithObserver(collector))
+//
+// The format is written directly, so no dependency on the Prometheus client
+// library is required.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+// sizeBuckets are the upper bounds of the chunk size histogram buckets, the
+// powers of 2 from 64B to 64GiB, the largest chunk size fastcdc allows.
+// Larger chunks are only counted in the +Inf bucket. The bounds are int64 so
+// that they do not overflow int on 32-bit platforms.
+var sizeBuckets = func() []int64 {
+	var b []int64
+	for shift := 6; shift <= 36; shift++ {
+		b = append(b, 1<<shift)
+	}
+	return b
+}()
+
+// Collector counts chunks, bytes, buffer refills, and reader errors, and
+// tracks the distribution of chunk sizes. It is safe for concurrent use.
+type Collector struct {
+	prefix string
+
+	chunks     atomic.Int64
+	bytes      atomic.Int64
+	refills    atomic.Int64
+	readBytes  atomic.Int64
+	readErrors atomic.Int64
+	buckets    []atomic.Int64
+	// overflow counts the chunks larger than the last bucket.
+	overflow atomic.Int64
+}
+
+var _ fastcdc.Observer = (*Collector)(nil)
+
+// NewCollector returns a Collector whose metric names are prefixed with
+// namespace (e.g. "ingest_fastcdc_chunks_total"). An empty namespace yields
+// unprefixed "fastcdc_" names.
+func NewCollector(namespace string) *Collector {
+	prefix := "fastcdc_"
+	if namespace != "" {
+		prefix = namespace + "_" + prefix
+	}
+	return &Collector{
+		prefix:  prefix,
+		buckets: make([]atomic.Int64, len(sizeBuckets)),
+	}
+}
+
+// ObserveChunk implements fastcdc.Observer.
+func (c *Collector) ObserveChunk(length int) {
+	c.chunks.Add(1)
+	c.bytes.Add(int64(length))
+	for i, le := range sizeBuckets {
+		if int64(length) <= le {
+			c.buckets[i].Add(1)
+			return
+		}
+	}
+	c.overflow.Add(1)
+}
+
+// ObserveRefill implements fastcdc.Observer.
+func (c *Collector) ObserveRefill(bytesRead int) {
+	c.refills.Add(1)
+	c.readBytes.Add(int64(bytesRead))
+}
+
+// ObserveReadError implements fastcdc.Observer.
+func (c *Collector) ObserveReadError(err error) {
+	c.readErrors.Add(1)
+}
+
+// WriteTo writes all metrics to w in the Prometheus text exposition format.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+
+	c.writeCounter(cw, "chunks_total", "Number of chunks produced.", c.chunks.Load())
+	c.writeCounter(cw, "bytes_total", "Number of bytes chunked.", c.bytes.Load())
+	c.writeCounter(cw, "buffer_refills_total", "Number of reads into the chunker buffer.", c.refills.Load())
+	c.writeCounter(cw, "read_bytes_total", "Number of bytes read from the underlying readers.", c.readBytes.Load())
+	c.writeCounter(cw, "read_errors_total", "Number of errors returned by the underlying readers.", c.readErrors.Load())
+
+	// Buckets are recorded individually and accumulated here, so a snapshot
+	// taken while chunkers are running may be slightly inconsistent with
+	// the totals above; Prometheus tolerates this.
+	name := c.prefix + "chunk_size_bytes"
+	fmt.Fprintf(cw, "# HELP %s Distribution of chunk sizes.\n", name)
+	fmt.Fprintf(cw, "# TYPE %s histogram\n", name)
+	var cumulative int64
+	for i, le := range sizeBuckets {
+		cumulative += c.buckets[i].Load()
+		fmt.Fprintf(cw, "%s_bucket{le=\"%d\"} %d\n", name, le, cumulative)
+	}
+	cumulative += c.overflow.Load()
+	fmt.Fprintf(cw, "%s_bucket{le=\"+Inf\"} %d\n", name, cumulative)
+	fmt.Fprintf(cw, "%s_sum %d\n", name, c.bytes.Load())
+	fmt.Fprintf(cw, "%s_count %d\n", name, cumulative)
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// ServeHTTP serves the metrics so the Collector can be registered directly
+// as a Prometheus scrape endpoint.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = c.WriteTo(w)
+}
+
+func (c *Collector) writeCounter(w io.Writer, name, help string, value int64) {
+	name = c.prefix + name
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	fmt.Fprintf(w, "%s %d\n", name, value)
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
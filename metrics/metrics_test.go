@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"math/rand"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+func TestCollector(t *testing.T) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	collector := NewCollector("test")
+
+	// The same collector is shared by two chunkers.
+	var nchunks int
+	for range 2 {
+		chunker, err := fastcdc.NewChunker(bytes.NewReader(data), 1024, fastcdc.WithObserver(collector))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for {
+			_, err := chunker.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			nchunks++
+		}
+	}
+
+	var out bytes.Buffer
+	if _, err := collector.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# TYPE test_fastcdc_chunks_total counter\n",
+		"test_fastcdc_chunks_total " + strconv.Itoa(nchunks) + "\n",
+		"test_fastcdc_bytes_total 200000\n",
+		"test_fastcdc_read_bytes_total 200000\n",
+		"test_fastcdc_read_errors_total 0\n",
+		"# TYPE test_fastcdc_chunk_size_bytes histogram\n",
+		"test_fastcdc_chunk_size_bytes_bucket{le=\"+Inf\"} " + strconv.Itoa(nchunks) + "\n",
+		"test_fastcdc_chunk_size_bytes_bucket{le=\"68719476736\"} " + strconv.Itoa(nchunks) + "\n",
+		"test_fastcdc_chunk_size_bytes_sum 200000\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestCollector_ReadErrors(t *testing.T) {
+	collector := NewCollector("")
+	errRead := errors.New("read failed")
+	r := io.MultiReader(bytes.NewReader(make([]byte, 100)), &errReader{errRead})
+
+	chunker, err := fastcdc.NewChunker(r, 1024, fastcdc.WithObserver(collector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chunker.Next(); !errors.Is(err, errRead) {
+		t.Fatalf("expected read error, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), "fastcdc_read_errors_total 1\n") {
+		t.Errorf("read error not counted:\n%s", rec.Body.String())
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+}
+
+type errReader struct{ err error }
+
+func (r *errReader) Read(p []byte) (int, error) { return 0, r.err }
+
+func TestCollector_Overflow(t *testing.T) {
+	if bits.UintSize < 64 {
+		t.Skip("chunks above 64GiB require a 64-bit platform")
+	}
+	collector := NewCollector("")
+	collector.ObserveChunk(100)
+	collector.ObserveChunk(math.MaxInt)
+	var out bytes.Buffer
+	if _, err := collector.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"fastcdc_chunk_size_bytes_bucket{le=\"68719476736\"} 1\n",
+		"fastcdc_chunk_size_bytes_bucket{le=\"+Inf\"} 2\n",
+		"fastcdc_chunk_size_bytes_count 2\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
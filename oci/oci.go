@@ -0,0 +1,145 @@
+// Package oci chunks OCI and Docker image layers for chunk-level
+// deduplication across image versions.
+//
+// Layers are decompressed when necessary and chunked with tar entry alignment
+// (see the tarchunk package), so that a file shared by two image versions
+// yields the same chunks even when the surrounding layer differs.
+package oci
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+	"github.com/buildbuddy-io/fastcdc2020/tarchunk"
+)
+
+// Compression values reported in Layer.Compression.
+const (
+	CompressionNone = ""
+	CompressionGzip = "gzip"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ErrUnsupportedCompression is returned for layers compressed with a format
+// that cannot be decompressed, such as zstd.
+var ErrUnsupportedCompression = errors.New("unsupported layer compression")
+
+// Chunk is a chunk of an uncompressed layer tarball.
+type Chunk struct {
+	manifest.Chunk
+
+	// Path is the name of the tar entry containing the chunk.
+	Path string `json:"path,omitempty"`
+	// Header reports whether the chunk holds tar header blocks.
+	Header bool `json:"header,omitempty"`
+}
+
+// Layer is the chunk manifest of a single image layer.
+type Layer struct {
+	// Digest is the digest of the layer blob as stored in a registry,
+	// e.g. "sha256:abc...".
+	Digest string `json:"digest"`
+	// DiffID is the digest of the uncompressed layer tarball.
+	DiffID string `json:"diffID"`
+	// Compression is the compression of the layer blob.
+	Compression string `json:"compression,omitempty"`
+	// Size is the size of the uncompressed layer tarball.
+	Size int64 `json:"size"`
+	// Chunks are the chunks of the uncompressed layer tarball.
+	Chunks []Chunk `json:"chunks"`
+}
+
+// Manifest maps layer digests to their chunk manifests.
+type Manifest map[string]*Layer
+
+// Add records l under its layer digest.
+func (m Manifest) Add(l *Layer) {
+	m[l.Digest] = l
+}
+
+// ChunkLayer chunks the layer blob read from r. Gzip-compressed layers are
+// decompressed before chunking; uncompressed layers are chunked as is. The
+// averageSize and options configure the chunker as for fastcdc.NewChunker.
+func ChunkLayer(r io.Reader, averageSize int, opts ...fastcdc.Option) (*Layer, error) {
+	blobHash := sha256.New()
+	br := bufio.NewReader(io.TeeReader(r, blobHash))
+
+	layer := &Layer{}
+	var tarball io.Reader = br
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		layer.Compression = CompressionGzip
+		tarball = zr
+	case bytes.HasPrefix(magic, zstdMagic):
+		return nil, ErrUnsupportedCompression
+	}
+
+	diffHash := sha256.New()
+	tarball = io.TeeReader(tarball, diffHash)
+	chunker, err := tarchunk.NewChunker(tarball, averageSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		layer.Chunks = append(layer.Chunks, Chunk{
+			Chunk:  manifest.NewChunk(chunk.Chunk),
+			Path:   chunk.Path,
+			Header: chunk.Header,
+		})
+		layer.Size += int64(chunk.Length)
+	}
+
+	// Anything after the end-of-archive marker (usually zero padding to the
+	// record size) carries no entries but is kept so that the chunks still
+	// reassemble to the tarball.
+	trailer, err := io.ReadAll(tarball)
+	if err != nil {
+		return nil, err
+	}
+	if len(trailer) > 0 {
+		layer.Chunks = append(layer.Chunks, Chunk{
+			Chunk: manifest.Chunk{
+				Offset: layer.Size,
+				Length: int64(len(trailer)),
+				Digest: manifest.Digest(trailer),
+			},
+			Header: true,
+		})
+		layer.Size += int64(len(trailer))
+	}
+	if _, err := io.Copy(io.Discard, br); err != nil {
+		return nil, err
+	}
+
+	layer.Digest = digest(blobHash)
+	layer.DiffID = digest(diffHash)
+	return layer, nil
+}
+
+func digest(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
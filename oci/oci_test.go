@@ -0,0 +1,152 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func makeLayer(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"a", "b", "c"} {
+		data, ok := files[name]
+		if !ok {
+			continue
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Pad to a full record like most tar implementations do.
+	buf.Write(make([]byte, 10240-buf.Len()%10240))
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sha(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+func TestChunkLayer(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	shared := make([]byte, 100000)
+	rng.Read(shared)
+	tarball := makeLayer(t, map[string][]byte{"a": []byte("hello"), "b": shared})
+
+	for _, tc := range []struct {
+		name        string
+		blob        []byte
+		compression string
+	}{
+		{"uncompressed", tarball, CompressionNone},
+		{"gzip", gzipped(t, tarball), CompressionGzip},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			layer, err := ChunkLayer(bytes.NewReader(tc.blob), 4096)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if layer.Digest != sha(tc.blob) {
+				t.Errorf("Digest = %s, want %s", layer.Digest, sha(tc.blob))
+			}
+			if layer.DiffID != sha(tarball) {
+				t.Errorf("DiffID = %s, want %s", layer.DiffID, sha(tarball))
+			}
+			if layer.Compression != tc.compression {
+				t.Errorf("Compression = %q, want %q", layer.Compression, tc.compression)
+			}
+			if layer.Size != int64(len(tarball)) {
+				t.Errorf("Size = %d, want %d", layer.Size, len(tarball))
+			}
+			var offset int64
+			for _, c := range layer.Chunks {
+				if c.Offset != offset {
+					t.Fatalf("chunk offset = %d, want %d", c.Offset, offset)
+				}
+				if want := sha(tarball[c.Offset : c.Offset+c.Length]); "sha256:"+c.Digest != want {
+					t.Fatalf("chunk at %d has digest %s, want %s", c.Offset, c.Digest, want)
+				}
+				offset += c.Length
+			}
+			if offset != layer.Size {
+				t.Errorf("chunks cover %d bytes, want %d", offset, layer.Size)
+			}
+		})
+	}
+}
+
+func TestChunkLayer_SharedFileDedups(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	shared := make([]byte, 100000)
+	rng.Read(shared)
+
+	m := Manifest{}
+	for _, files := range []map[string][]byte{
+		{"a": []byte("version 1"), "b": shared},
+		{"a": []byte("version 2 has a longer file"), "b": shared, "c": []byte("new")},
+	} {
+		layer, err := ChunkLayer(bytes.NewReader(gzipped(t, makeLayer(t, files))), 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Add(layer)
+	}
+	if len(m) != 2 {
+		t.Fatalf("expected 2 layers, got %d", len(m))
+	}
+
+	digests := map[string]map[string]bool{}
+	for _, layer := range m {
+		for _, c := range layer.Chunks {
+			if c.Path == "b" && !c.Header {
+				if digests[layer.Digest] == nil {
+					digests[layer.Digest] = map[string]bool{}
+				}
+				digests[layer.Digest][c.Digest] = true
+			}
+		}
+	}
+	var sets []map[string]bool
+	for _, set := range digests {
+		sets = append(sets, set)
+	}
+	if len(sets) != 2 || len(sets[0]) != len(sets[1]) {
+		t.Fatalf("unexpected chunk sets for shared file: %v", sets)
+	}
+	for d := range sets[0] {
+		if !sets[1][d] {
+			t.Errorf("chunk %s of shared file not deduplicated across layers", d)
+		}
+	}
+}
+
+func TestChunkLayer_Zstd(t *testing.T) {
+	blob := []byte{0x28, 0xb5, 0x2f, 0xfd, 0, 0, 0, 0}
+	if _, err := ChunkLayer(bytes.NewReader(blob), 4096); err != ErrUnsupportedCompression {
+		t.Errorf("expected ErrUnsupportedCompression, got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package pack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// BlobStore is an object store holding the blobs written by a Batcher.
+type BlobStore interface {
+	// PutBlob stores data as the named blob.
+	PutBlob(name string, data []byte) error
+	// ReadBlob returns n bytes at offset off of the named blob, e.g. with a
+	// ranged GET.
+	ReadBlob(name string, off, n int64) ([]byte, error)
+}
+
+// Batcher packs chunks into upload blobs of about a target size, so that an
+// object store that charges per request stores many chunks with one PUT.
+// Each blob is a pack, and chunks are located by blob name, offset, and
+// length as in a Dir. A Batcher is safe for concurrent use, and implements
+// both manifest.Store and the upload.Store interface.
+//
+// Chunks are buffered in memory until their blob is stored, which happens
+// once it reaches the target size or on Flush.
+type Batcher struct {
+	store      BlobStore
+	targetSize int64
+
+	mu    sync.Mutex
+	index map[string]Location
+	name  string
+	buf   bytes.Buffer
+	w     *Writer
+}
+
+// NewBatcher returns a Batcher storing blobs of at least targetSize bytes of
+// chunk data in store, except for the last one written by Flush.
+func NewBatcher(store BlobStore, targetSize int64) (*Batcher, error) {
+	if targetSize <= 0 {
+		return nil, errors.New("pack target size must be positive")
+	}
+	return &Batcher{store: store, targetSize: targetSize, index: map[string]Location{}}, nil
+}
+
+// Put adds a chunk to the current blob unless a chunk with the same digest
+// was already added, and returns its location.
+func (b *Batcher) Put(digest string, data []byte) (Location, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if loc, ok := b.index[digest]; ok {
+		return loc, nil
+	}
+	if b.w == nil {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return Location{}, err
+		}
+		b.name = hex.EncodeToString(id) + packExt
+		b.buf.Reset()
+		b.w = NewWriter(&b.buf)
+	}
+	e, err := b.w.Add(digest, data)
+	if err != nil {
+		return Location{}, err
+	}
+	loc := Location{Pack: b.name, Offset: e.Offset, Length: e.Length}
+	b.index[digest] = loc
+	if b.w.Size() >= b.targetSize {
+		if err := b.finishCurrent(); err != nil {
+			return Location{}, err
+		}
+	}
+	return loc, nil
+}
+
+// Locate returns the location of a chunk added to the Batcher.
+func (b *Batcher) Locate(digest string) (Location, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	loc, ok := b.index[digest]
+	return loc, ok
+}
+
+// Has reports whether a chunk was added to the Batcher.
+func (b *Batcher) Has(digest string) bool {
+	_, ok := b.Locate(digest)
+	return ok
+}
+
+// Get returns the contents of a chunk added to the Batcher, reading it from
+// the current blob if that has not been stored yet.
+func (b *Batcher) Get(digest string) ([]byte, error) {
+	b.mu.Lock()
+	loc, ok := b.index[digest]
+	if ok && b.w != nil && loc.Pack == b.name {
+		defer b.mu.Unlock()
+		return bytes.Clone(b.buf.Bytes()[loc.Offset : loc.Offset+loc.Length]), nil
+	}
+	b.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("chunk %s: %w", digest, os.ErrNotExist)
+	}
+	return b.store.ReadBlob(loc.Pack, loc.Offset, loc.Length)
+}
+
+// Flush stores the current blob, if any.
+func (b *Batcher) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.w == nil {
+		return nil
+	}
+	return b.finishCurrent()
+}
+
+// Manifest returns m with the location of each of its chunks. Every chunk
+// of m must have been added to the Batcher, and the blobs holding them must
+// be flushed before the result is used to read them.
+func (b *Batcher) Manifest(m *manifest.Manifest) (*BlobManifest, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	bm := &BlobManifest{Manifest: m, Locations: make([]Location, len(m.Chunks))}
+	for i, c := range m.Chunks {
+		loc, ok := b.index[c.Digest]
+		if !ok {
+			return nil, fmt.Errorf("chunk %s: %w", c.Digest, os.ErrNotExist)
+		}
+		bm.Locations[i] = loc
+	}
+	return bm, nil
+}
+
+// finishCurrent stores the blob being written by Put. If that fails, its
+// chunks are dropped from the index so that they are added again.
+func (b *Batcher) finishCurrent() error {
+	w := b.w
+	b.w = nil
+	err := w.Close()
+	if err == nil {
+		err = b.store.PutBlob(b.name, b.buf.Bytes())
+	}
+	if err != nil {
+		for digest, loc := range b.index {
+			if loc.Pack == b.name {
+				delete(b.index, digest)
+			}
+		}
+	}
+	return err
+}
+
+// BlobManifest is a manifest together with the blob locations of its
+// chunks, as returned by Batcher.Manifest.
+type BlobManifest struct {
+	*manifest.Manifest
+	// Locations holds the location of each of Chunks, in the same order.
+	Locations []Location `json:"locations"`
+}
+
+// Store returns a manifest.Store reading the chunks of m from blobs through
+// its locations, for example to reassemble the blob with
+// manifest.NewRangeReader.
+func (m *BlobManifest) Store(blobs BlobStore) manifest.Store {
+	s := blobManifestStore{blobs: blobs, locations: make(map[string]Location, len(m.Locations))}
+	for i, loc := range m.Locations {
+		if i < len(m.Chunks) {
+			s.locations[m.Chunks[i].Digest] = loc
+		}
+	}
+	return s
+}
+
+// blobManifestStore is the manifest.Store returned by BlobManifest.Store.
+type blobManifestStore struct {
+	blobs     BlobStore
+	locations map[string]Location
+}
+
+func (s blobManifestStore) Has(digest string) bool {
+	_, ok := s.locations[digest]
+	return ok
+}
+
+func (s blobManifestStore) Get(digest string) ([]byte, error) {
+	loc, ok := s.locations[digest]
+	if !ok {
+		return nil, fmt.Errorf("chunk %s: %w", digest, os.ErrNotExist)
+	}
+	return s.blobs.ReadBlob(loc.Pack, loc.Offset, loc.Length)
+}
@@ -0,0 +1,119 @@
+package pack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// memBlobStore is a BlobStore backed by a map that counts PutBlob calls.
+type memBlobStore struct {
+	blobs map[string][]byte
+	puts  int
+}
+
+func (s *memBlobStore) PutBlob(name string, data []byte) error {
+	s.blobs[name] = bytes.Clone(data)
+	s.puts++
+	return nil
+}
+
+func (s *memBlobStore) ReadBlob(name string, off, n int64) ([]byte, error) {
+	blob, ok := s.blobs[name]
+	if !ok {
+		return nil, fmt.Errorf("blob %s: %w", name, os.ErrNotExist)
+	}
+	if off+n > int64(len(blob)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return blob[off : off+n], nil
+}
+
+func TestBatcher(t *testing.T) {
+	if _, err := NewBatcher(nil, 0); err == nil {
+		t.Error("expected an error for a zero target size")
+	}
+
+	data := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	copy(data[2<<20:], data[:1<<20]) // Repeated chunks are stored once.
+
+	store := &memBlobStore{blobs: map[string][]byte{}}
+	b, err := NewBatcher(store, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunker, err := fastcdc.NewChunker(bytes.NewReader(data), 64<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &manifest.Manifest{Size: int64(len(data)), Digest: manifest.Digest(data)}
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := manifest.NewChunk(chunk)
+		if _, err := b.Put(c.Digest, chunk.Data); err != nil {
+			t.Fatal(err)
+		}
+		m.Chunks = append(m.Chunks, c)
+	}
+
+	// Chunks of the blob not yet stored are readable.
+	last := m.Chunks[len(m.Chunks)-1]
+	if got, err := b.Get(last.Digest); err != nil || !bytes.Equal(got, data[last.Offset:]) {
+		t.Errorf("Get() of a pending chunk = %d bytes, %v", len(got), err)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if store.puts < 3 || store.puts > 4 {
+		t.Errorf("stored %d blobs for 3MiB of unique chunks, want 3 or 4", store.puts)
+	}
+	for name, blob := range store.blobs {
+		if _, err := ReadHeader(bytes.NewReader(blob), int64(len(blob))); err != nil {
+			t.Errorf("blob %s is not a pack: %v", name, err)
+		}
+	}
+
+	bm, err := b.Manifest(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Manifest(&manifest.Manifest{Chunks: manifest.ChunkList{{Digest: "missing"}}}); err == nil {
+		t.Error("expected an error for a chunk that was not added")
+	}
+
+	// The manifest and its locations survive encoding and reassemble the
+	// data from the blobs alone.
+	enc, err := json.Marshal(bm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded BlobManifest
+	if err := json.Unmarshal(enc, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	r, err := manifest.NewRangeReader(decoded.Manifest, decoded.Store(store), 0, decoded.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("reassembled data differs")
+	}
+}
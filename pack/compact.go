@@ -0,0 +1,182 @@
+package pack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CompactStats summarizes the work done by Compact.
+type CompactStats struct {
+	// PacksRewritten is the number of packs whose live chunks were copied
+	// and which were then deleted.
+	PacksRewritten int
+	// PacksWritten is the number of new packs written.
+	PacksWritten int
+	// ChunksDropped is the number of unreferenced chunks removed.
+	ChunksDropped int
+	// BytesReclaimed is the number of chunk bytes no longer stored.
+	BytesReclaimed int64
+}
+
+// Compact rewrites finalized packs to drop chunks for which live returns
+// false and to merge underfull packs, i.e. packs holding fewer than
+// minFill * targetSize bytes of live chunks. A single underfull pack without
+// dead chunks is left alone, since rewriting it would not reduce the number
+// of packs.
+//
+// Compaction is crash-safe: live chunks are first copied into new packs,
+// which are synced and renamed into place before any old pack is deleted. A
+// crash in between leaves duplicate copies of some chunks, which is harmless.
+// Put and Get are blocked while Compact runs; the pack currently being
+// written by Put is not compacted.
+func (d *Dir) Compact(live func(digest string) bool, minFill float64) (CompactStats, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var stats CompactStats
+	names, err := d.Packs()
+	if err != nil {
+		return stats, err
+	}
+
+	type candidate struct {
+		name    string
+		live    []Entry
+		dead    []Entry
+		deadLen int64
+	}
+	var (
+		dirty     []candidate
+		underfull []candidate
+	)
+	for _, name := range names {
+		entries, err := d.readHeader(name)
+		if err != nil {
+			return stats, fmt.Errorf("pack %s: %w", name, err)
+		}
+		c := candidate{name: name}
+		var liveLen int64
+		for _, e := range entries {
+			// Chunks also stored in another pack (e.g. after an interrupted
+			// compaction) are only live in the pack the index points to.
+			if loc, ok := d.index[e.Digest]; ok && loc.Pack == name && live(e.Digest) {
+				c.live = append(c.live, e)
+				liveLen += e.Length
+			} else {
+				c.dead = append(c.dead, e)
+				c.deadLen += e.Length
+			}
+		}
+		switch {
+		case len(c.dead) > 0:
+			dirty = append(dirty, c)
+		case float64(liveLen) < minFill*float64(d.targetSize):
+			underfull = append(underfull, c)
+		}
+	}
+	rewrite := dirty
+	if len(underfull) > 1 {
+		rewrite = append(rewrite, underfull...)
+	}
+	if len(rewrite) == 0 {
+		return stats, nil
+	}
+
+	// Copy live chunks into new packs.
+	moved := map[string]Location{}
+	var (
+		pending  *pendingPack
+		finished []string
+	)
+	abort := func(err error) (CompactStats, error) {
+		if pending != nil {
+			pending.abort()
+		}
+		for _, name := range finished {
+			os.Remove(filepath.Join(d.path, name))
+		}
+		return CompactStats{}, err
+	}
+	for _, c := range rewrite {
+		if len(c.live) == 0 {
+			continue
+		}
+		f, err := os.Open(filepath.Join(d.path, c.name))
+		if err != nil {
+			return abort(err)
+		}
+		for _, e := range c.live {
+			if pending == nil {
+				if pending, err = d.newPendingPack(); err != nil {
+					f.Close()
+					return abort(err)
+				}
+			}
+			data := make([]byte, e.Length)
+			if _, err := f.ReadAt(data, e.Offset); err != nil {
+				f.Close()
+				return abort(fmt.Errorf("pack %s: %w", c.name, err))
+			}
+			ne, err := pending.w.Add(e.Digest, data)
+			if err != nil {
+				f.Close()
+				return abort(err)
+			}
+			moved[e.Digest] = Location{Pack: pending.name, Offset: ne.Offset, Length: ne.Length}
+			if pending.w.Size() >= d.targetSize {
+				p := pending
+				pending = nil
+				if err := p.finish(); err != nil {
+					f.Close()
+					return abort(err)
+				}
+				finished = append(finished, p.name)
+			}
+		}
+		f.Close()
+	}
+	if pending != nil {
+		p := pending
+		pending = nil
+		if err := p.finish(); err != nil {
+			return abort(err)
+		}
+		finished = append(finished, p.name)
+	}
+	if err := syncDir(d.path); err != nil {
+		return abort(err)
+	}
+
+	// The new packs are durable; switch the index over and delete the old
+	// packs.
+	for digest, loc := range moved {
+		d.index[digest] = loc
+	}
+	for _, c := range rewrite {
+		for _, e := range c.dead {
+			if loc, ok := d.index[e.Digest]; ok && loc.Pack == c.name {
+				delete(d.index, e.Digest)
+			}
+			stats.ChunksDropped++
+			stats.BytesReclaimed += e.Length
+		}
+		if err := os.Remove(filepath.Join(d.path, c.name)); err != nil {
+			return stats, err
+		}
+		stats.PacksRewritten++
+	}
+	stats.PacksWritten = len(finished)
+	return stats, syncDir(d.path)
+}
+
+// syncDir syncs a directory so that renames and deletions within it are
+// durable.
+func syncDir(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -0,0 +1,110 @@
+package pack
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	path := t.TempDir()
+	d, err := Open(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := map[string][]byte{}
+	for i := range 40 {
+		digest := fmt.Sprintf("chunk%02d", i)
+		chunks[digest] = bytes.Repeat([]byte{byte(i)}, 200)
+		if _, err := d.Put(digest, chunks[digest]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := d.Packs()
+
+	// Drop every chunk except each fifth one.
+	live := func(digest string) bool {
+		var i int
+		fmt.Sscanf(digest, "chunk%d", &i)
+		return i%5 == 0
+	}
+	stats, err := d.Compact(live, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.ChunksDropped != 32 || stats.BytesReclaimed != 32*200 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	after, _ := d.Packs()
+	if len(after) >= len(before) {
+		t.Errorf("expected fewer packs after compaction: %d -> %d", len(before), len(after))
+	}
+	if stats.PacksRewritten != len(before) || stats.PacksWritten != len(after) {
+		t.Errorf("stats %+v inconsistent with packs %d -> %d", stats, len(before), len(after))
+	}
+
+	check := func(d *Dir) {
+		t.Helper()
+		for digest, data := range chunks {
+			got, err := d.Get(digest)
+			if !live(digest) {
+				if err == nil {
+					t.Errorf("%s still stored after compaction", digest)
+				}
+				continue
+			}
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("Get(%s) = %v; data mismatch", digest, err)
+			}
+		}
+	}
+	check(d)
+
+	reopened, err := Open(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(reopened)
+
+	// Compacting again has nothing left to do.
+	stats, err = reopened.Compact(live, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (CompactStats{}) {
+		t.Errorf("second compaction did work: %+v", stats)
+	}
+}
+
+func TestCompact_MergesUnderfullPacks(t *testing.T) {
+	d, err := Open(t.TempDir(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		if _, err := d.Put(fmt.Sprint(i), []byte("small")); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := d.Compact(func(string) bool { return true }, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packs, _ := d.Packs()
+	if len(packs) != 1 || stats.PacksRewritten != 3 || stats.ChunksDropped != 0 {
+		t.Errorf("expected 3 packs merged into 1, got %d packs, stats %+v", len(packs), stats)
+	}
+	for i := range 3 {
+		if got, err := d.Get(fmt.Sprint(i)); err != nil || string(got) != "small" {
+			t.Errorf("Get(%d) = %q, %v", i, got, err)
+		}
+	}
+}
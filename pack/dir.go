@@ -0,0 +1,266 @@
+package pack
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	packExt = ".pack"
+	tempExt = ".tmp"
+)
+
+// Location identifies a chunk stored in a pack.
+type Location struct {
+	// Pack is the name of the pack file, relative to the Dir.
+	Pack   string `json:"pack"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+// Dir stores chunks in pack files within a directory, starting a new pack
+// whenever the current one reaches the target size. It keeps an in-memory
+// index of every chunk in the directory and is safe for concurrent use.
+//
+// A pack being written lives in a temporary file until it is finalized by
+// Flush, Close, or reaching the target size. Packs left unfinished by a crash
+// are ignored by Open, so callers should Flush before relying on the
+// durability of chunks they have Put.
+type Dir struct {
+	path       string
+	targetSize int64
+
+	mu    sync.Mutex
+	index map[string]Location
+	cur   *pendingPack
+}
+
+// Open opens the pack directory at path, creating it if necessary, and
+// indexes the chunks of all existing packs. New packs are finalized once
+// they hold at least targetSize bytes of chunk data.
+func Open(path string, targetSize int64) (*Dir, error) {
+	if targetSize <= 0 {
+		return nil, errors.New("pack target size must be positive")
+	}
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		return nil, err
+	}
+	d := &Dir{path: path, targetSize: targetSize, index: map[string]Location{}}
+	names, err := d.Packs()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		entries, err := d.readHeader(name)
+		if err != nil {
+			return nil, fmt.Errorf("pack %s: %w", name, err)
+		}
+		for _, e := range entries {
+			d.index[e.Digest] = Location{Pack: name, Offset: e.Offset, Length: e.Length}
+		}
+	}
+	return d, nil
+}
+
+// Put stores a chunk unless a chunk with the same digest is already stored,
+// and returns its location.
+func (d *Dir) Put(digest string, data []byte) (Location, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if loc, ok := d.index[digest]; ok {
+		return loc, nil
+	}
+	if d.cur == nil {
+		p, err := d.newPendingPack()
+		if err != nil {
+			return Location{}, err
+		}
+		d.cur = p
+	}
+	e, err := d.cur.w.Add(digest, data)
+	if err != nil {
+		return Location{}, err
+	}
+	loc := Location{Pack: d.cur.name, Offset: e.Offset, Length: e.Length}
+	d.index[digest] = loc
+	if d.cur.w.Size() >= d.targetSize {
+		if err := d.finishCurrent(); err != nil {
+			return Location{}, err
+		}
+	}
+	return loc, nil
+}
+
+// Locate returns the location of a stored chunk.
+func (d *Dir) Locate(digest string) (Location, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	loc, ok := d.index[digest]
+	return loc, ok
+}
+
+// Has reports whether a chunk is stored.
+func (d *Dir) Has(digest string) bool {
+	_, ok := d.Locate(digest)
+	return ok
+}
+
+// Get returns the contents of a stored chunk.
+func (d *Dir) Get(digest string) ([]byte, error) {
+	loc, ok := d.Locate(digest)
+	if !ok {
+		return nil, fmt.Errorf("chunk %s: %w", digest, os.ErrNotExist)
+	}
+	return d.Read(loc)
+}
+
+// ChunkStore adapts a Dir to chunk stores whose Put returns only an error,
+// such as erasure.ChunkStore, so that it can be wrapped by them. Locations
+// are discarded.
+type ChunkStore struct {
+	*Dir
+}
+
+// Put stores a chunk unless a chunk with the same digest is already stored.
+func (s ChunkStore) Put(digest string, data []byte) error {
+	_, err := s.Dir.Put(digest, data)
+	return err
+}
+
+// Read returns the chunk stored at loc.
+func (d *Dir) Read(loc Location) ([]byte, error) {
+	buf := make([]byte, loc.Length)
+	d.mu.Lock()
+	if d.cur != nil && loc.Pack == d.cur.name {
+		// The pack is still being written; read from the temporary file.
+		defer d.mu.Unlock()
+		_, err := d.cur.f.ReadAt(buf, loc.Offset)
+		return buf, err
+	}
+	d.mu.Unlock()
+
+	f, err := os.Open(filepath.Join(d.path, loc.Pack))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.ReadAt(buf, loc.Offset); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("%w: chunk extends past end of %s", ErrCorrupt, loc.Pack)
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Flush finalizes the pack currently being written, if any.
+func (d *Dir) Flush() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cur == nil {
+		return nil
+	}
+	return d.finishCurrent()
+}
+
+// Close flushes the current pack.
+func (d *Dir) Close() error {
+	return d.Flush()
+}
+
+// Packs returns the names of all finalized packs.
+func (d *Dir) Packs() ([]string, error) {
+	dirents, err := os.ReadDir(d.path)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, de := range dirents {
+		if de.Type().IsRegular() && strings.HasSuffix(de.Name(), packExt) {
+			names = append(names, de.Name())
+		}
+	}
+	return names, nil
+}
+
+func (d *Dir) readHeader(name string) ([]Entry, error) {
+	f, err := os.Open(filepath.Join(d.path, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ReadHeader(f, fi.Size())
+}
+
+// finishCurrent finalizes the pack being written by Put. If that fails, its
+// chunks are dropped from the index so that they are written again.
+func (d *Dir) finishCurrent() error {
+	p := d.cur
+	d.cur = nil
+	if err := p.finish(); err != nil {
+		for digest, loc := range d.index {
+			if loc.Pack == p.name {
+				delete(d.index, digest)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// pendingPack is a pack being written to a temporary file.
+type pendingPack struct {
+	dir  string
+	name string
+	f    *os.File
+	w    *Writer
+}
+
+func (d *Dir) newPendingPack() (*pendingPack, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	name := hex.EncodeToString(id) + packExt
+	f, err := os.OpenFile(filepath.Join(d.path, name+tempExt), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &pendingPack{dir: d.path, name: name, f: f, w: NewWriter(f)}, nil
+}
+
+// finish writes the pack header, syncs the pack, and renames it into place.
+// On failure the temporary file is removed.
+func (p *pendingPack) finish() error {
+	err := p.w.Close()
+	if err == nil {
+		err = p.f.Sync()
+	}
+	if closeErr := p.f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(p.f.Name(), filepath.Join(p.dir, p.name))
+	}
+	if err != nil {
+		os.Remove(p.f.Name())
+	}
+	return err
+}
+
+// abort discards the pack.
+func (p *pendingPack) abort() {
+	p.f.Close()
+	os.Remove(p.f.Name())
+}
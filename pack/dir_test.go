@@ -0,0 +1,116 @@
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDir(t *testing.T) {
+	path := t.TempDir()
+	d, err := Open(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := map[string][]byte{}
+	for i := range 50 {
+		digest := fmt.Sprintf("chunk%d", i)
+		chunks[digest] = bytes.Repeat([]byte{byte(i)}, 100+i)
+		if _, err := d.Put(digest, chunks[digest]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Duplicate puts return the existing location.
+	loc1, _ := d.Locate("chunk3")
+	loc2, err := d.Put("chunk3", chunks["chunk3"])
+	if err != nil || loc1 != loc2 {
+		t.Errorf("duplicate Put() = %+v, %v; want %+v", loc2, err, loc1)
+	}
+
+	// Chunks in the unfinished pack are readable.
+	for digest, data := range chunks {
+		got, err := d.Get(digest)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", digest, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Get(%s) data mismatch", digest)
+		}
+	}
+	if _, err := d.Get("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get(missing) error = %v, want not exist", err)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	packs, err := d.Packs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packs) < 5 {
+		t.Errorf("expected chunks to be spread over several packs, got %d", len(packs))
+	}
+	temps, _ := filepath.Glob(filepath.Join(path, "*"+tempExt))
+	if len(temps) != 0 {
+		t.Errorf("temporary packs left after Close: %v", temps)
+	}
+
+	reopened, err := Open(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for digest, data := range chunks {
+		loc, ok := reopened.Locate(digest)
+		if !ok {
+			t.Fatalf("%s not indexed after reopening", digest)
+		}
+		if !strings.HasSuffix(loc.Pack, packExt) || loc.Length != int64(len(data)) {
+			t.Errorf("%s: unexpected location %+v", digest, loc)
+		}
+		got, err := reopened.Read(loc)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Read(%+v) = %v; data mismatch", loc, err)
+		}
+	}
+}
+
+func TestDir_UnfinishedPackIgnored(t *testing.T) {
+	path := t.TempDir()
+	d, err := Open(path, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Put("a", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash by reopening without flushing.
+	reopened, err := Open(path, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Has("a") {
+		t.Error("chunk from unfinished pack should not be indexed")
+	}
+}
+
+func TestChunkStore(t *testing.T) {
+	d, err := Open(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := ChunkStore{d}
+	if err := s.Put("a", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get("a"); err != nil || string(got) != "data" || !s.Has("a") {
+		t.Errorf("Get() after Put = %q, %v", got, err)
+	}
+}
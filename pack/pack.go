@@ -0,0 +1,166 @@
+// Package pack stores many small chunks in append-only pack files.
+//
+// Storing every chunk as its own file quickly overwhelms filesystem metadata
+// at scale. A pack file instead holds the contents of many chunks back to back,
+// followed by a header listing the digest, offset, and length of each chunk.
+// The header is found through a fixed-size trailer at the end of the file:
+//
+//	chunk data | header | header length (uint32 LE) | magic "FCP1"
+//
+// Each header entry is the digest length and digest bytes followed by the
+// offset and length of the chunk, all lengths encoded as uvarints. A Dir
+// manages a directory of packs, indexes their chunks by digest, and compacts
+// packs once chunks are no longer referenced.
+package pack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var magic = []byte("FCP1")
+
+const trailerSize = 8
+
+// ErrCorrupt is returned when a pack file is malformed.
+var ErrCorrupt = errors.New("corrupt pack")
+
+// Entry records where a chunk is stored within a pack.
+type Entry struct {
+	Digest string
+	Offset int64
+	Length int64
+}
+
+// Writer appends chunks to a pack. Close must be called to write the header.
+type Writer struct {
+	w       io.Writer
+	size    int64
+	entries []Entry
+	closed  bool
+}
+
+// NewWriter returns a Writer writing a new pack to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Add appends a chunk to the pack and returns its entry.
+func (w *Writer) Add(digest string, data []byte) (Entry, error) {
+	if w.closed {
+		return Entry{}, errors.New("pack writer is closed")
+	}
+	n, err := w.w.Write(data)
+	e := Entry{Digest: digest, Offset: w.size, Length: int64(len(data))}
+	w.size += int64(n)
+	if err != nil {
+		return Entry{}, err
+	}
+	w.entries = append(w.entries, e)
+	return e, nil
+}
+
+// Size returns the number of chunk bytes written so far.
+func (w *Writer) Size() int64 {
+	return w.size
+}
+
+// Count returns the number of chunks written so far.
+func (w *Writer) Count() int {
+	return len(w.entries)
+}
+
+// Close writes the pack header and trailer. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	header := encodeHeader(w.entries)
+	trailer := binary.LittleEndian.AppendUint32(nil, uint32(len(header)))
+	trailer = append(trailer, magic...)
+	_, err := w.w.Write(append(header, trailer...))
+	return err
+}
+
+// ReadHeader returns the entries of the pack stored in ra, which is size
+// bytes long.
+func ReadHeader(ra io.ReaderAt, size int64) ([]Entry, error) {
+	if size < trailerSize {
+		return nil, ErrCorrupt
+	}
+	trailer := make([]byte, trailerSize)
+	if _, err := ra.ReadAt(trailer, size-trailerSize); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(trailer[4:], magic) {
+		return nil, fmt.Errorf("%w: bad magic", ErrCorrupt)
+	}
+	headerLen := int64(binary.LittleEndian.Uint32(trailer))
+	if headerLen > size-trailerSize {
+		return nil, fmt.Errorf("%w: header length %d exceeds pack size", ErrCorrupt, headerLen)
+	}
+	header := make([]byte, headerLen)
+	if _, err := ra.ReadAt(header, size-trailerSize-headerLen); err != nil {
+		return nil, err
+	}
+	entries, err := decodeHeader(header)
+	if err != nil {
+		return nil, err
+	}
+	dataSize := size - trailerSize - headerLen
+	for _, e := range entries {
+		if e.Offset+e.Length > dataSize {
+			return nil, fmt.Errorf("%w: chunk %s extends past pack data", ErrCorrupt, e.Digest)
+		}
+	}
+	return entries, nil
+}
+
+func encodeHeader(entries []Entry) []byte {
+	var buf []byte
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, uint64(len(e.Digest)))
+		buf = append(buf, e.Digest...)
+		buf = binary.AppendUvarint(buf, uint64(e.Offset))
+		buf = binary.AppendUvarint(buf, uint64(e.Length))
+	}
+	return buf
+}
+
+func decodeHeader(buf []byte) ([]Entry, error) {
+	var entries []Entry
+	next := func() (uint64, error) {
+		v, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return 0, fmt.Errorf("%w: truncated header", ErrCorrupt)
+		}
+		buf = buf[n:]
+		return v, nil
+	}
+	for len(buf) > 0 {
+		digestLen, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if digestLen > uint64(len(buf)) {
+			return nil, fmt.Errorf("%w: truncated header", ErrCorrupt)
+		}
+		digest := string(buf[:digestLen])
+		buf = buf[digestLen:]
+		offset, err := next()
+		if err != nil {
+			return nil, err
+		}
+		length, err := next()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{Digest: digest, Offset: int64(offset), Length: int64(length)})
+	}
+	return entries, nil
+}
@@ -0,0 +1,70 @@
+package pack
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	chunks := map[string][]byte{
+		"a": []byte("first chunk"),
+		"b": {},
+		"c": bytes.Repeat([]byte{7}, 1000),
+	}
+	var want []Entry
+	for _, d := range []string{"a", "b", "c"} {
+		e, err := w.Add(d, chunks[d])
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, e)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Add("d", nil); err == nil {
+		t.Error("expected error adding to closed writer")
+	}
+
+	pack := buf.Bytes()
+	entries, err := ReadHeader(bytes.NewReader(pack), int64(len(pack)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("ReadHeader() returned %d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if e != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, e, want[i])
+		}
+		if got := pack[e.Offset : e.Offset+e.Length]; !bytes.Equal(got, chunks[e.Digest]) {
+			t.Errorf("chunk %s data mismatch", e.Digest)
+		}
+	}
+}
+
+func TestReadHeader_Corrupt(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if _, err := w.Add("a", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	pack := buf.Bytes()
+
+	for name, corrupt := range map[string][]byte{
+		"short":     pack[:4],
+		"magic":     append(append([]byte{}, pack[:len(pack)-1]...), 'X'),
+		"truncated": pack[2:],
+	} {
+		if _, err := ReadHeader(bytes.NewReader(corrupt), int64(len(corrupt))); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: expected ErrCorrupt, got %v", name, err)
+		}
+	}
+}
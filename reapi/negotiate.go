@@ -0,0 +1,219 @@
+// Package reapi agrees on chunking parameters with a Remote Execution API
+// server that splits and splices blobs.
+//
+// A client and a server only deduplicate each other's chunks if they cut
+// blobs at the same boundaries, which takes the same chunking function and
+// exactly the same parameters. Negotiate checks a client's preferences
+// against the parameters a server advertises, in the shape of the REAPI blob
+// splitting proposal, and returns a Config that produces the server's
+// boundaries, or an error that names the parameter that differs.
+package reapi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// ChunkingFunction is a chunking algorithm, numbered as ChunkingFunction.Value
+// in the REAPI blob splitting proposal.
+type ChunkingFunction int32
+
+const (
+	// ChunkingUnknown is the zero ChunkingFunction.
+	ChunkingUnknown ChunkingFunction = 0
+	// ChunkingFastCDC2020 is FastCDC 2020 as specified by remote-apis, which
+	// the fastcdc package implements.
+	ChunkingFastCDC2020 ChunkingFunction = 1
+)
+
+func (f ChunkingFunction) String() string {
+	switch f {
+	case ChunkingUnknown:
+		return "UNKNOWN"
+	case ChunkingFastCDC2020:
+		return "FASTCDC_2020"
+	}
+	return "ChunkingFunction(" + strconv.Itoa(int(f)) + ")"
+}
+
+// ChunkingParams is a set of chunking parameters. Zero MinSize and MaxSize
+// stand for the fastcdc defaults of a quarter and four times AverageSize.
+type ChunkingParams struct {
+	Function      ChunkingFunction
+	AverageSize   int
+	MinSize       int
+	MaxSize       int
+	Normalization int
+	Seed          uint64
+}
+
+// resolve returns p with its default sizes made explicit.
+func (p ChunkingParams) resolve() ChunkingParams {
+	if p.MinSize == 0 {
+		p.MinSize = p.AverageSize / 4
+	}
+	if p.MaxSize == 0 {
+		p.MaxSize = p.AverageSize * 4
+	}
+	return p
+}
+
+func (p ChunkingParams) String() string {
+	p = p.resolve()
+	return fmt.Sprintf("%v avg=%d min=%d max=%d norm=%d seed=%d",
+		p.Function, p.AverageSize, p.MinSize, p.MaxSize, p.Normalization, p.Seed)
+}
+
+// mismatch describes the first parameter in which p and q differ, or
+// returns "" if they are the same.
+func (p ChunkingParams) mismatch(q ChunkingParams) string {
+	p, q = p.resolve(), q.resolve()
+	field := func(name string, a, b any) string {
+		return fmt.Sprintf("%s %v, server %v", name, a, b)
+	}
+	switch {
+	case p.Function != q.Function:
+		return field("function", p.Function, q.Function)
+	case p.AverageSize != q.AverageSize:
+		return field("average size", p.AverageSize, q.AverageSize)
+	case p.MinSize != q.MinSize:
+		return field("min size", p.MinSize, q.MinSize)
+	case p.MaxSize != q.MaxSize:
+		return field("max size", p.MaxSize, q.MaxSize)
+	case p.Normalization != q.Normalization:
+		return field("normalization", p.Normalization, q.Normalization)
+	case p.Seed != q.Seed:
+		return field("seed", p.Seed, q.Seed)
+	}
+	return ""
+}
+
+// ServerCapabilities are the constraints a server advertises.
+type ServerCapabilities struct {
+	// DigestFunctions are the digest functions the server accepts. If
+	// empty, the server accepts SHA-256 only.
+	DigestFunctions []manifest.DigestFunction
+	// Chunking lists the parameter sets the server splits blobs with. If
+	// empty, the server does not split blobs.
+	Chunking []ChunkingParams
+	// MaxBlobSize is the largest blob the server accepts in one request,
+	// e.g. max_batch_total_size_bytes when chunks are uploaded with
+	// BatchUpdateBlobs. Zero means no limit.
+	MaxBlobSize int64
+}
+
+// Config is a validated chunking configuration. Its MinSize and MaxSize are
+// always explicit.
+type Config struct {
+	ChunkingParams
+	DigestFunction manifest.DigestFunction
+}
+
+// Options returns the fastcdc options selecting c's parameters. The average
+// size is passed to fastcdc.NewChunker separately.
+func (c Config) Options() []fastcdc.Option {
+	opts := []fastcdc.Option{
+		fastcdc.WithMinSize(c.MinSize),
+		fastcdc.WithMaxSize(c.MaxSize),
+		fastcdc.WithNormalization(c.Normalization),
+	}
+	if c.Seed != 0 {
+		opts = append(opts, fastcdc.WithSeed(c.Seed))
+	}
+	return opts
+}
+
+// ErrIncompatible is returned by Negotiate when the client and server
+// parameters cannot produce the same chunk boundaries.
+var ErrIncompatible = errors.New("incompatible with server")
+
+// Negotiate returns the Config to chunk with for a server with the given
+// capabilities. Fields of local that are zero are taken from the server:
+// without a DigestFunction, the first one the server accepts that the
+// manifest package can compute is used, and without an AverageSize, the
+// first FastCDC 2020 parameter set that fits the server's MaxBlobSize is
+// used. Otherwise local must match one of the server's parameter sets
+// exactly, since any difference moves boundaries.
+func Negotiate(local Config, server ServerCapabilities) (Config, error) {
+	digest, err := negotiateDigest(local.DigestFunction, server.DigestFunctions)
+	if err != nil {
+		return Config{}, err
+	}
+	params, err := negotiateChunking(local.ChunkingParams, server)
+	if err != nil {
+		return Config{}, err
+	}
+	c := Config{ChunkingParams: params.resolve(), DigestFunction: digest}
+	if _, err := fastcdc.NewChunker(bytes.NewReader(nil), c.AverageSize, c.Options()...); err != nil {
+		return Config{}, fmt.Errorf("parameters %v: %w", c.ChunkingParams, err)
+	}
+	return c, nil
+}
+
+func negotiateDigest(local manifest.DigestFunction, server []manifest.DigestFunction) (manifest.DigestFunction, error) {
+	if len(server) == 0 {
+		server = []manifest.DigestFunction{manifest.DigestSHA256}
+	}
+	if local == manifest.DigestUnknown {
+		for _, f := range server {
+			if f.Supported() {
+				return f.Resolve(), nil
+			}
+		}
+		return 0, fmt.Errorf("%w: no supported digest function among %v", ErrIncompatible, server)
+	}
+	if !local.Supported() {
+		return 0, fmt.Errorf("%w: %v", manifest.ErrUnsupportedDigestFunction, local)
+	}
+	if !slices.ContainsFunc(server, func(f manifest.DigestFunction) bool { return f.Resolve() == local.Resolve() }) {
+		return 0, fmt.Errorf("%w: digest function %v not among %v", ErrIncompatible, local, server)
+	}
+	return local, nil
+}
+
+func negotiateChunking(local ChunkingParams, server ServerCapabilities) (ChunkingParams, error) {
+	if len(server.Chunking) == 0 {
+		return ChunkingParams{}, fmt.Errorf("%w: server does not split blobs", ErrIncompatible)
+	}
+	if local.AverageSize == 0 {
+		for _, p := range server.Chunking {
+			if p.Function == ChunkingFastCDC2020 && fits(p, server.MaxBlobSize) {
+				return p, nil
+			}
+		}
+		return ChunkingParams{}, fmt.Errorf("%w: no FastCDC 2020 parameters with chunks up to %d bytes among %v",
+			ErrIncompatible, server.MaxBlobSize, server.Chunking)
+	}
+	if local.Function == ChunkingUnknown {
+		local.Function = ChunkingFastCDC2020
+	}
+	if local.Function != ChunkingFastCDC2020 {
+		return ChunkingParams{}, fmt.Errorf("chunking function %v is not implemented", local.Function)
+	}
+	var diffs []string
+	for _, p := range server.Chunking {
+		d := local.mismatch(p)
+		if d == "" {
+			if !fits(p, server.MaxBlobSize) {
+				return ChunkingParams{}, fmt.Errorf("%w: max chunk size %d exceeds max blob size %d",
+					ErrIncompatible, p.resolve().MaxSize, server.MaxBlobSize)
+			}
+			return p, nil
+		}
+		diffs = append(diffs, d)
+	}
+	return ChunkingParams{}, fmt.Errorf("%w: %v matches no server parameters (%s)",
+		ErrIncompatible, local, strings.Join(diffs, "; "))
+}
+
+// fits reports whether every chunk cut with p is at most maxBlobSize bytes.
+func fits(p ChunkingParams, maxBlobSize int64) bool {
+	return maxBlobSize == 0 || int64(p.resolve().MaxSize) <= maxBlobSize
+}
@@ -0,0 +1,75 @@
+package reapi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+var server = ServerCapabilities{
+	DigestFunctions: []manifest.DigestFunction{manifest.DigestBLAKE3, manifest.DigestSHA256, manifest.DigestSHA512},
+	Chunking: []ChunkingParams{
+		{Function: ChunkingFastCDC2020, AverageSize: 1 << 20, Normalization: 2},
+		{Function: ChunkingFastCDC2020, AverageSize: 16 << 10, MinSize: 4096, MaxSize: 65535, Normalization: 2},
+	},
+	MaxBlobSize: 4 << 20,
+}
+
+func TestNegotiate(t *testing.T) {
+	c, err := Negotiate(Config{}, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Config{
+		ChunkingParams: ChunkingParams{Function: ChunkingFastCDC2020, AverageSize: 1 << 20, MinSize: 256 << 10, MaxSize: 4 << 20, Normalization: 2},
+		DigestFunction: manifest.DigestSHA256,
+	}
+	if c != want {
+		t.Errorf("Negotiate(zero) = %+v, want %+v", c, want)
+	}
+
+	local := Config{
+		ChunkingParams: ChunkingParams{AverageSize: 16 << 10, MinSize: 4096, MaxSize: 65535, Normalization: 2},
+		DigestFunction: manifest.DigestSHA512,
+	}
+	c, err = Negotiate(local, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local.Function = ChunkingFastCDC2020
+	if c != local {
+		t.Errorf("Negotiate(local) = %+v, want %+v", c, local)
+	}
+}
+
+func TestNegotiate_Incompatible(t *testing.T) {
+	small := server
+	small.MaxBlobSize = 1 << 20
+	for _, tc := range []struct {
+		name   string
+		local  Config
+		server ServerCapabilities
+		want   string
+	}{
+		{"digest", Config{DigestFunction: manifest.DigestMD5}, server, "digest function MD5"},
+		{"no split", Config{}, ServerCapabilities{}, "does not split"},
+		{"max size", Config{ChunkingParams: ChunkingParams{AverageSize: 16 << 10, Normalization: 2}}, server, "max size 65536, server 65535"},
+		{"normalization", Config{ChunkingParams: ChunkingParams{AverageSize: 1 << 20, Normalization: 1}}, server, "normalization 1, server 2"},
+		{"blob size", Config{ChunkingParams: ChunkingParams{AverageSize: 1 << 20, Normalization: 2}}, small, "exceeds max blob size"},
+	} {
+		_, err := Negotiate(tc.local, tc.server)
+		if !errors.Is(err, ErrIncompatible) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error = %v, want ErrIncompatible mentioning %q", tc.name, err, tc.want)
+		}
+	}
+
+	if _, err := Negotiate(Config{DigestFunction: manifest.DigestBLAKE3}, server); !errors.Is(err, manifest.ErrUnsupportedDigestFunction) {
+		t.Errorf("BLAKE3: error = %v, want ErrUnsupportedDigestFunction", err)
+	}
+	invalid := ServerCapabilities{Chunking: []ChunkingParams{{Function: ChunkingFastCDC2020, AverageSize: 1000}}}
+	if _, err := Negotiate(Config{}, invalid); err == nil {
+		t.Error("expected error for a non-power-of-2 average size")
+	}
+}
@@ -0,0 +1,66 @@
+package reference
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Target is a chunker under test.
+type Target struct {
+	// Split returns the chunks of data. It is passed only valid parameters.
+	Split func(data []byte, p Params) ([]Chunk, error)
+	// Fingerprints requires fingerprints to match as well as boundaries.
+	Fingerprints bool
+	// TwoByteScan accommodates chunkers that scan two bytes at a time, like
+	// the fastcdc default: the minimum and maximum sizes are even, and a cut
+	// before the last byte of the input is not expected, as such chunkers
+	// cannot test it when the rest of the input has odd length.
+	TwoByteScan bool
+}
+
+// Fuzz runs a fuzz test comparing target with Split, seeded with a few
+// random inputs. Parameters are drawn from the fuzzed input with average
+// sizes from 64B to 4KiB, so that inputs of a few KiB span many chunks.
+func Fuzz(f *testing.F, target Target) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := range 8 {
+		data := make([]byte, 1<<(10+i))
+		rnd.Read(data)
+		f.Add(data, uint8(i), uint8(i), uint8(rnd.Intn(256)), uint8(rnd.Intn(256)), rnd.Uint64()*uint64(i%2))
+	}
+	f.Fuzz(func(t *testing.T, data []byte, avgExp, norm, minSize, maxSize uint8, seed uint64) {
+		p := params(avgExp, norm, minSize, maxSize, seed, target.TwoByteScan)
+		got, err := target.Split(data, p)
+		if err != nil {
+			t.Fatalf("%+v: %v", p, err)
+		}
+		want := Split(data, p)
+		// The last byte of an odd-length rest of the input is not scanned.
+		if n := len(want); target.TwoByteScan && n >= 2 && want[n-1].Length == 1 && want[n-2].Length%2 == 0 && want[n-2].Length < p.MaxSize {
+			want[n-2].Length++
+			want = want[:n-1]
+		}
+		if err := Compare(want, got, target.Fingerprints); err != nil {
+			t.Fatalf("%+v: %v", p, err)
+		}
+	})
+}
+
+// params derives valid parameters from fuzzed values. The low bits of
+// minSize and maxSize select a power of 2 fraction or multiple of the average
+// size and the high bits offset it.
+func params(avgExp, norm, minSize, maxSize uint8, seed uint64, even bool) Params {
+	avg := 64 << (avgExp % 7)
+	p := Params{
+		AverageSize:   avg,
+		MinSize:       max(avg>>(minSize%4)-int(minSize>>2), 64),
+		MaxSize:       avg<<(maxSize%4) + int(maxSize>>2),
+		Normalization: int(norm % 4),
+		Seed:          seed,
+	}
+	if even {
+		p.MinSize &^= 1
+		p.MaxSize &^= 1
+	}
+	return p
+}
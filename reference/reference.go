@@ -0,0 +1,103 @@
+// Package reference is a deliberately simple FastCDC 2020 implementation for
+// differential testing.
+//
+// Split follows the algorithm as published, hashing one byte at a time with
+// no buffering, unrolling, or other optimization, so that it can be checked
+// by reading it. Fuzz compares any chunker with it on random inputs and
+// parameters; the fastcdc package is tested this way, and forks and new
+// backends can reuse the same harness.
+package reference
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+// Params are the chunking parameters. They must satisfy the constraints of
+// fastcdc.NewChunker: AverageSize is a power of 2 between MinSize and
+// MaxSize and Normalization is 0 to 3.
+type Params struct {
+	MinSize       int
+	AverageSize   int
+	MaxSize       int
+	Normalization int
+	Seed          uint64
+}
+
+// Options returns the fastcdc options selecting p. The average size is passed
+// to fastcdc.NewChunker separately.
+func (p Params) Options() []fastcdc.Option {
+	return []fastcdc.Option{
+		fastcdc.WithMinSize(p.MinSize),
+		fastcdc.WithMaxSize(p.MaxSize),
+		fastcdc.WithNormalization(p.Normalization),
+		fastcdc.WithSeed(p.Seed),
+	}
+}
+
+// Chunk is a chunk found by Split. Fingerprint is the gear hash at the cut
+// point, or 0 for a chunk no longer than the minimum size.
+type Chunk struct {
+	Offset      int
+	Length      int
+	Fingerprint uint64
+}
+
+// Split returns the chunks of data.
+func Split(data []byte, p Params) []Chunk {
+	var gear [256]uint64
+	for i, g := range fastcdc.Gear() {
+		gear[i] = g ^ p.Seed
+	}
+	avgBits := bits.TrailingZeros(uint(p.AverageSize))
+	maskSmall := fastcdc.Mask(avgBits + p.Normalization)
+	maskLarge := fastcdc.Mask(avgBits - p.Normalization)
+
+	var chunks []Chunk
+	offset := 0
+	for offset < len(data) {
+		rest := data[offset:]
+		length := min(len(rest), p.MaxSize)
+		var fp uint64
+		if len(rest) > p.MinSize {
+			// Bytes before the minimum size are skipped. The cut is made
+			// before the first byte whose hash matches the mask, which is
+			// harder to match before the average size.
+			for i := p.MinSize; i < length; i++ {
+				fp = fp<<1 + gear[rest[i]]
+				mask := maskLarge
+				if i < p.AverageSize {
+					mask = maskSmall
+				}
+				if fp&mask == 0 {
+					length = i
+					break
+				}
+			}
+		}
+		chunks = append(chunks, Chunk{Offset: offset, Length: length, Fingerprint: fp})
+		offset += length
+	}
+	return chunks
+}
+
+// Compare returns an error describing the first difference between the chunks
+// want and got, or nil if they are equal. Fingerprints are compared only if
+// fingerprints is true.
+func Compare(want, got []Chunk, fingerprints bool) error {
+	for i := range min(len(want), len(got)) {
+		w, g := want[i], got[i]
+		if w.Offset != g.Offset || w.Length != g.Length {
+			return fmt.Errorf("chunk %d: got offset %d length %d, want offset %d length %d", i, g.Offset, g.Length, w.Offset, w.Length)
+		}
+		if fingerprints && w.Fingerprint != g.Fingerprint {
+			return fmt.Errorf("chunk %d at %d: got fingerprint %#x, want %#x", i, g.Offset, g.Fingerprint, w.Fingerprint)
+		}
+	}
+	if len(want) != len(got) {
+		return fmt.Errorf("got %d chunks, want %d", len(got), len(want))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package reference
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+// fastcdcSplit returns a Target.Split chunking with fastcdc and the given
+// extra options.
+func fastcdcSplit(opts ...fastcdc.Option) func([]byte, Params) ([]Chunk, error) {
+	return func(data []byte, p Params) ([]Chunk, error) {
+		chunker, err := fastcdc.NewChunker(bytes.NewReader(data), p.AverageSize, append(p.Options(), opts...)...)
+		if err != nil {
+			return nil, err
+		}
+		var chunks []Chunk
+		for {
+			chunk, err := chunker.Next()
+			if err == io.EOF {
+				return chunks, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			chunks = append(chunks, Chunk{Offset: chunk.Offset, Length: chunk.Length, Fingerprint: chunk.Fingerprint})
+		}
+	}
+}
+
+func FuzzExactScan(f *testing.F) {
+	Fuzz(f, Target{Split: fastcdcSplit(fastcdc.WithExactScan()), Fingerprints: true})
+}
+
+func FuzzChunker(f *testing.F) {
+	Fuzz(f, Target{Split: fastcdcSplit(), TwoByteScan: true})
+}
+
+func FuzzBuffersChunker(f *testing.F) {
+	Fuzz(f, Target{Split: func(data []byte, p Params) ([]Chunk, error) {
+		// Segment sizes cycle through a few values, including empty ones.
+		var bufs [][]byte
+		for i := 0; len(data) > 0; i++ {
+			n := min(len(data), []int{0, 1, 3, 100, 1000}[i%5])
+			bufs = append(bufs, data[:n])
+			data = data[n:]
+		}
+		bc, err := fastcdc.NewBuffersChunker(bufs, p.AverageSize, p.Options()...)
+		if err != nil {
+			return nil, err
+		}
+		var chunks []Chunk
+		for {
+			chunk, _, err := bc.Next()
+			if err == io.EOF {
+				return chunks, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			chunks = append(chunks, Chunk{Offset: chunk.Offset, Length: chunk.Length, Fingerprint: chunk.Fingerprint})
+		}
+	}, TwoByteScan: true})
+}
+
+func TestSplit(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(5)).Read(data)
+	p := Params{MinSize: 2048, AverageSize: 8192, MaxSize: 32768, Normalization: 2}
+	chunks := Split(data, p)
+	offset := 0
+	for i, c := range chunks {
+		if c.Offset != offset {
+			t.Fatalf("chunk %d at %d, want %d", i, c.Offset, offset)
+		}
+		if c.Length > p.MaxSize || c.Length <= p.MinSize && i < len(chunks)-1 {
+			t.Errorf("chunk %d has length %d", i, c.Length)
+		}
+		offset += c.Length
+	}
+	if offset != len(data) {
+		t.Errorf("chunks cover %d bytes, want %d", offset, len(data))
+	}
+	if mean := len(data) / len(chunks); mean < p.AverageSize/2 || mean > p.AverageSize*2 {
+		t.Errorf("mean chunk size %d, want about %d", mean, p.AverageSize)
+	}
+}
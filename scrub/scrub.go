@@ -0,0 +1,157 @@
+// Package scrub verifies the chunks of a store against their digests.
+//
+// A scrub re-reads every chunk listed by an index or a set of manifests,
+// recomputes its digest, and reports chunks that are missing, truncated, or
+// corrupt, optionally handing them to a quarantine function. Chunks are
+// checked in ascending digest order, and the digest of the last chunk
+// checked serves as a cursor from which an interrupted scrub of a very large
+// store can resume.
+package scrub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/buildbuddy-io/fastcdc2020/index"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// Store is the chunk store being scrubbed. manifest.Store implementations
+// such as pack.Dir satisfy it.
+type Store interface {
+	Get(digest string) ([]byte, error)
+}
+
+// Options configures a scrub.
+type Options struct {
+	// After resumes a scrub: only chunks with digests greater than After
+	// are checked. It is typically the Cursor of an interrupted Report.
+	After string
+	// Quarantine, if set, is called for every bad chunk, for example to move
+	// it out of the store. If it fails, the scrub stops.
+	Quarantine func(digest string, problem error) error
+	// Progress, if set, is called after every checked chunk with the
+	// cursor to persist for resuming and the number of chunks checked.
+	Progress func(cursor string, checked int)
+	// DigestFunction is the function the chunks of an index are digested
+	// with. The zero value means SHA-256. Manifests name their own.
+	DigestFunction manifest.DigestFunction
+}
+
+// Problem describes a bad chunk.
+type Problem struct {
+	Digest string
+	Err    error
+}
+
+// ErrCorrupt is reported for chunks whose contents do not match their
+// digest or expected length.
+var ErrCorrupt = errors.New("corrupt chunk")
+
+// Report is the result of a scrub.
+type Report struct {
+	// Checked is the number of chunks checked.
+	Checked int
+	// Problems lists the bad chunks in digest order. Missing chunks are
+	// reported with the error of the store, typically wrapping
+	// fs.ErrNotExist, and corrupt ones with an error wrapping ErrCorrupt.
+	Problems []Problem
+	// Cursor is the digest of the last chunk checked, to pass as
+	// Options.After to resume.
+	Cursor string
+}
+
+// target is a chunk to check with its expected length and the function
+// its digest was computed with.
+type target struct {
+	digest   string
+	length   int64
+	function manifest.DigestFunction
+}
+
+// Index scrubs every chunk recorded in ix.
+func Index(ctx context.Context, ix *index.Index, store Store, opts Options) (Report, error) {
+	if !opts.DigestFunction.Supported() {
+		return Report{Cursor: opts.After}, fmt.Errorf("%w: %v", manifest.ErrUnsupportedDigestFunction, opts.DigestFunction)
+	}
+	var targets []target
+	err := ix.Range(func(digest string, e index.Entry) bool {
+		if digest > opts.After {
+			targets = append(targets, target{digest: digest, length: e.Length, function: opts.DigestFunction})
+		}
+		return true
+	})
+	if err != nil {
+		return Report{Cursor: opts.After}, err
+	}
+	return scrub(ctx, targets, store, opts)
+}
+
+// Manifests scrubs every chunk referenced by the manifests, verifying each
+// with the DigestFunction of its manifest.
+func Manifests(ctx context.Context, ms []*manifest.Manifest, store Store, opts Options) (Report, error) {
+	byDigest := map[string]target{}
+	for _, m := range ms {
+		if !m.DigestFunction.Supported() {
+			return Report{Cursor: opts.After}, fmt.Errorf("%w: %v", manifest.ErrUnsupportedDigestFunction, m.DigestFunction)
+		}
+		for _, c := range m.Chunks {
+			if c.Digest > opts.After {
+				byDigest[c.Digest] = target{digest: c.Digest, length: c.Length, function: m.DigestFunction}
+			}
+		}
+	}
+	targets := make([]target, 0, len(byDigest))
+	for _, t := range byDigest {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].digest < targets[j].digest
+	})
+	return scrub(ctx, targets, store, opts)
+}
+
+// scrub checks targets, which are sorted by digest.
+func scrub(ctx context.Context, targets []target, store Store, opts Options) (Report, error) {
+	r := Report{Cursor: opts.After}
+	for _, t := range targets {
+		if err := ctx.Err(); err != nil {
+			return r, err
+		}
+		if problem := check(t, store); problem != nil {
+			if opts.Quarantine != nil {
+				if err := opts.Quarantine(t.digest, problem); err != nil {
+					return r, fmt.Errorf("quarantine chunk %s: %w", t.digest, err)
+				}
+			}
+			r.Problems = append(r.Problems, Problem{Digest: t.digest, Err: problem})
+		}
+		r.Checked++
+		r.Cursor = t.digest
+		if opts.Progress != nil {
+			opts.Progress(r.Cursor, r.Checked)
+		}
+	}
+	return r, nil
+}
+
+// check returns the problem with a chunk, or nil if it is intact.
+func check(t target, store Store) error {
+	data, err := store.Get(t.digest)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != t.length {
+		return fmt.Errorf("%w: %d bytes, want %d", ErrCorrupt, len(data), t.length)
+	}
+	got, err := t.function.Digest(data)
+	if err != nil {
+		return err
+	}
+	if got != t.digest {
+		return fmt.Errorf("%w: digest is %s", ErrCorrupt, got)
+	}
+	return nil
+}
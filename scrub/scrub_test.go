@@ -0,0 +1,150 @@
+package scrub
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/fsstore"
+	"github.com/buildbuddy-io/fastcdc2020/index"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+func TestScrub(t *testing.T) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+	m, err := manifest.Build(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := fsstore.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix := index.New(index.MemKV{})
+	for _, c := range m.Chunks {
+		if err := store.Put(c.Digest, data[c.Offset:c.Offset+c.Length]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ix.Add(c.Digest, c.Length); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := Index(context.Background(), ix, store, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Checked != len(m.Chunks) || len(r.Problems) != 0 {
+		t.Errorf("clean scrub = %+v, want %d chunks checked and no problems", r, len(m.Chunks))
+	}
+
+	// Damage one chunk, truncate another, and delete a third.
+	damaged, truncated, missing := m.Chunks[1], m.Chunks[2], m.Chunks[3]
+	bad := bytes.Clone(data[damaged.Offset : damaged.Offset+damaged.Length])
+	bad[0]++
+	for _, c := range []manifest.Chunk{damaged, truncated, missing} {
+		store.Delete(c.Digest)
+	}
+	store.Put(damaged.Digest, bad)
+	store.Put(truncated.Digest, data[truncated.Offset:truncated.Offset+truncated.Length-1])
+
+	quarantined := map[string]bool{}
+	opts := Options{Quarantine: func(digest string, problem error) error {
+		quarantined[digest] = true
+		return store.Delete(digest)
+	}}
+	r, err = Manifests(context.Background(), []*manifest.Manifest{m, m}, store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Problems) != 3 || len(quarantined) != 3 {
+		t.Fatalf("Problems = %v, want 3", r.Problems)
+	}
+	for _, p := range r.Problems {
+		wantErr := ErrCorrupt
+		if p.Digest == missing.Digest {
+			wantErr = fs.ErrNotExist
+		}
+		if !errors.Is(p.Err, wantErr) {
+			t.Errorf("problem with %s = %v, want %v", p.Digest, p.Err, wantErr)
+		}
+	}
+	if store.Has(damaged.Digest) {
+		t.Error("damaged chunk was not quarantined")
+	}
+
+	// An interrupted scrub resumes from its cursor.
+	ctx, cancel := context.WithCancel(context.Background())
+	var cursor string
+	first, err := Index(ctx, ix, store, Options{Progress: func(c string, checked int) {
+		cursor = c
+		if checked == 5 {
+			cancel()
+		}
+	}})
+	if !errors.Is(err, context.Canceled) || first.Checked != 5 || first.Cursor != cursor {
+		t.Fatalf("interrupted scrub = %+v, %v", first, err)
+	}
+	rest, err := Index(context.Background(), ix, store, Options{After: first.Cursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Checked+rest.Checked != len(m.Chunks) || len(first.Problems)+len(rest.Problems) != 3 {
+		t.Errorf("resumed scrub checked %d+%d chunks with %d+%d problems", first.Checked, rest.Checked, len(first.Problems), len(rest.Problems))
+	}
+}
+
+func TestScrub_DigestFunction(t *testing.T) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+	m, err := manifest.DigestSHA512.Build(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := fsstore.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix := index.New(index.MemKV{})
+	for _, c := range m.Chunks {
+		if err := store.Put(c.Digest, data[c.Offset:c.Offset+c.Length]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ix.Add(c.Digest, c.Length); err != nil {
+			t.Fatal(err)
+		}
+	}
+	damaged := m.Chunks[1]
+	bad := bytes.Clone(data[damaged.Offset : damaged.Offset+damaged.Length])
+	bad[0]++
+	store.Delete(damaged.Digest)
+	store.Put(damaged.Digest, bad)
+
+	quarantined := 0
+	opts := Options{Quarantine: func(string, error) error {
+		quarantined++
+		return nil
+	}}
+	r, err := Manifests(context.Background(), []*manifest.Manifest{m}, store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Checked != len(m.Chunks) || len(r.Problems) != 1 || r.Problems[0].Digest != damaged.Digest || quarantined != 1 {
+		t.Errorf("SHA-512 manifest scrub = %+v with %d quarantined, want only %s", r, quarantined, damaged.Digest)
+	}
+	opts.DigestFunction = manifest.DigestSHA512
+	r, err = Index(context.Background(), ix, store, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Problems) != 1 || r.Problems[0].Digest != damaged.Digest {
+		t.Errorf("SHA-512 index scrub problems = %v, want only %s", r.Problems, damaged.Digest)
+	}
+	if _, err := Index(context.Background(), ix, store, Options{DigestFunction: manifest.DigestBLAKE3}); !errors.Is(err, manifest.ErrUnsupportedDigestFunction) {
+		t.Errorf("BLAKE3 index scrub error = %v, want ErrUnsupportedDigestFunction", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Package shard places chunks on storage shards by consistent hashing.
+//
+// Every process that builds a Ring from the same shard names places each
+// digest on the same shards, and adding or removing a shard only moves the
+// chunks that hash to it.
+package shard
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"strconv"
+)
+
+// DefaultVirtualNodes is the number of points each shard occupies on the
+// ring when NewRing is given zero.
+const DefaultVirtualNodes = 128
+
+// Ring maps chunk digests to shards. It is immutable and safe for
+// concurrent use.
+type Ring struct {
+	shards []string
+	points []point
+}
+
+type point struct {
+	hash  uint64
+	shard int
+}
+
+// NewRing returns a ring over the named shards, each placed at
+// virtualNodes points. More virtual nodes spread chunks more evenly.
+func NewRing(shards []string, virtualNodes int) (*Ring, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("at least one shard is required")
+	}
+	if virtualNodes < 0 {
+		return nil, errors.New("virtualNodes must be non-negative")
+	}
+	if virtualNodes == 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	r := &Ring{shards: slices.Clone(shards)}
+	seen := make(map[string]bool, len(shards))
+	for i, name := range shards {
+		if seen[name] {
+			return nil, errors.New("duplicate shard " + strconv.Quote(name))
+		}
+		seen[name] = true
+		for v := range virtualNodes {
+			r.points = append(r.points, point{hash: hash(name + "#" + strconv.Itoa(v)), shard: i})
+		}
+	}
+	slices.SortFunc(r.points, func(a, b point) int {
+		if c := cmp.Compare(a.hash, b.hash); c != 0 {
+			return c
+		}
+		// Break ties by shard name so placement does not depend on the
+		// order shards were given in.
+		return cmp.Compare(r.shards[a.shard], r.shards[b.shard])
+	})
+	return r, nil
+}
+
+// Shards returns the shard names of the ring.
+func (r *Ring) Shards() []string {
+	return slices.Clone(r.shards)
+}
+
+// Locate returns the shard owning digest.
+func (r *Ring) Locate(digest string) string {
+	return r.shards[r.points[r.search(digest)].shard]
+}
+
+// LocateN returns up to n distinct shards for digest, for storing n
+// replicas. The first is the shard returned by Locate.
+func (r *Ring) LocateN(digest string, n int) []string {
+	n = min(n, len(r.shards))
+	if n <= 0 {
+		return nil
+	}
+	shards := make([]string, 0, n)
+	seen := make([]bool, len(r.shards))
+	for i := r.search(digest); len(shards) < n; i = (i + 1) % len(r.points) {
+		if p := r.points[i]; !seen[p.shard] {
+			seen[p.shard] = true
+			shards = append(shards, r.shards[p.shard])
+		}
+	}
+	return shards
+}
+
+// search returns the index of the first point at or after the hash of
+// digest, wrapping around the ring.
+func (r *Ring) search(digest string) int {
+	h := hash(digest)
+	i, _ := slices.BinarySearchFunc(r.points, h, func(p point, h uint64) int {
+		return cmp.Compare(p.hash, h)
+	})
+	if i == len(r.points) {
+		i = 0
+	}
+	return i
+}
+
+func hash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,103 @@
+package shard
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+func digests(n int) []string {
+	d := make([]string, n)
+	for i := range d {
+		d[i] = manifest.Digest([]byte(fmt.Sprint(i)))
+	}
+	return d
+}
+
+func TestRing_Locate(t *testing.T) {
+	shards := []string{"a", "b", "c", "d"}
+	r, err := NewRing(shards, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Placement does not depend on shard order.
+	reversed, err := NewRing([]string{"d", "c", "b", "a"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]int)
+	for _, d := range digests(10000) {
+		s := r.Locate(d)
+		counts[s]++
+		if got := reversed.Locate(d); got != s {
+			t.Fatalf("Locate(%s) = %s on reordered ring, want %s", d, got, s)
+		}
+	}
+	for _, s := range shards {
+		if counts[s] < 1500 || counts[s] > 3500 {
+			t.Errorf("shard %s holds %d of 10000 chunks, want about 2500", s, counts[s])
+		}
+	}
+}
+
+func TestRing_Rebalance(t *testing.T) {
+	before, err := NewRing([]string{"a", "b", "c", "d"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := NewRing([]string{"a", "b", "c", "d", "e"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var moved int
+	for _, d := range digests(10000) {
+		if s := after.Locate(d); s != before.Locate(d) {
+			moved++
+			if s != "e" {
+				t.Fatalf("chunk %s moved to %s, want only moves to the new shard", d, s)
+			}
+		}
+	}
+	if moved < 1000 || moved > 3000 {
+		t.Errorf("%d of 10000 chunks moved, want about 2000", moved)
+	}
+}
+
+func TestRing_LocateN(t *testing.T) {
+	r, err := NewRing([]string{"a", "b", "c"}, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range digests(100) {
+		got := r.LocateN(d, 2)
+		if len(got) != 2 || got[0] != r.Locate(d) || got[0] == got[1] {
+			t.Fatalf("LocateN(%s, 2) = %v", d, got)
+		}
+		all := r.LocateN(d, 5)
+		slices.Sort(all)
+		if !slices.Equal(all, []string{"a", "b", "c"}) {
+			t.Fatalf("LocateN(%s, 5) = %v, want every shard once", d, all)
+		}
+	}
+	if got := r.LocateN(digests(1)[0], 0); got != nil {
+		t.Errorf("LocateN(0) = %v, want nil", got)
+	}
+}
+
+func TestNewRing_Invalid(t *testing.T) {
+	for _, tc := range []struct {
+		shards []string
+		vnodes int
+	}{
+		{nil, 0},
+		{[]string{"a", "a"}, 0},
+		{[]string{"a"}, -1},
+	} {
+		if _, err := NewRing(tc.shards, tc.vnodes); err == nil {
+			t.Errorf("NewRing(%v, %d) succeeded", tc.shards, tc.vnodes)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package similarity
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+)
+
+// Candidate is a stored blob similar to a query sketch.
+type Candidate struct {
+	// Name identifies the stored blob, e.g. its digest.
+	Name string
+	// Resemblance is the estimated resemblance to the query.
+	Resemblance float64
+}
+
+// Index holds the sketches of stored blobs and finds the most similar ones
+// to use as delta-compression bases. It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	sketches map[string]Sketch
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{sketches: make(map[string]Sketch)}
+}
+
+// Add stores the sketch of a blob, replacing any previous sketch with the
+// same name.
+func (ix *Index) Add(name string, s Sketch) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.sketches[name] = s
+}
+
+// Remove forgets the sketch of a blob.
+func (ix *Index) Remove(name string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	delete(ix.sketches, name)
+}
+
+// Len returns the number of stored sketches.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.sketches)
+}
+
+// Candidates returns up to k stored blobs most similar to s, most similar
+// first. Blobs with a resemblance below minResemblance are not returned.
+// Ties are broken by name so that results are deterministic.
+func (ix *Index) Candidates(s Sketch, k int, minResemblance float64) []Candidate {
+	if k <= 0 {
+		return nil
+	}
+	ix.mu.RLock()
+	var candidates []Candidate
+	for name, stored := range ix.sketches {
+		r := Resemblance(s, stored)
+		if r > 0 && r >= minResemblance {
+			candidates = append(candidates, Candidate{Name: name, Resemblance: r})
+		}
+	}
+	ix.mu.RUnlock()
+
+	slices.SortFunc(candidates, func(a, b Candidate) int {
+		if c := cmp.Compare(b.Resemblance, a.Resemblance); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
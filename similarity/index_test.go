@@ -0,0 +1,61 @@
+package similarity
+
+import (
+	"testing"
+)
+
+func TestIndex_Candidates(t *testing.T) {
+	// Blob i shares features [0, 1000) and has 100*i distinct ones, so
+	// resemblance to the query falls as i grows.
+	features := func(i int) []uint64 {
+		var f []uint64
+		for j := 0; j < 1000; j++ {
+			f = append(f, uint64(j))
+		}
+		for j := 0; j < 100*i; j++ {
+			f = append(f, uint64(i)<<32|uint64(j))
+		}
+		return f
+	}
+	names := []string{"a", "b", "c", "d", "e"}
+	ix := NewIndex()
+	for i, name := range names {
+		ix.Add(name, FromFingerprints(features(i*5)))
+	}
+	var unrelated []uint64
+	for j := 0; j < 1000; j++ {
+		unrelated = append(unrelated, 1<<40|uint64(j))
+	}
+	ix.Add("unrelated", FromFingerprints(unrelated))
+
+	query := FromFingerprints(features(0))
+	got := ix.Candidates(query, 3, 0.1)
+	if len(got) != 3 {
+		t.Fatalf("Candidates() returned %d, want 3: %v", len(got), got)
+	}
+	for i, c := range got {
+		if c.Name != names[i] {
+			t.Errorf("candidate %d = %s, want %s", i, c.Name, names[i])
+		}
+	}
+	if got[0].Resemblance != 1 {
+		t.Errorf("resemblance of identical blob = %f, want 1", got[0].Resemblance)
+	}
+
+	for _, c := range ix.Candidates(query, 10, 0.1) {
+		if c.Name == "unrelated" {
+			t.Errorf("unrelated blob returned with resemblance %f", c.Resemblance)
+		}
+	}
+
+	ix.Remove("a")
+	if got := ix.Candidates(query, 1, 0); len(got) != 1 || got[0].Name != "b" {
+		t.Errorf("Candidates() after Remove = %v, want b", got)
+	}
+	if ix.Len() != 5 {
+		t.Errorf("Len() = %d, want 5", ix.Len())
+	}
+	if got := ix.Candidates(query, 0, 0); got != nil {
+		t.Errorf("Candidates(k=0) = %v, want nil", got)
+	}
+}
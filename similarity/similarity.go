@@ -0,0 +1,125 @@
+// Package similarity estimates how similar two chunked files are.
+//
+// Each file is summarized by a fixed-size min-hash Sketch over the features
+// of its chunks. Comparing two sketches estimates the Jaccard resemblance of
+// the files' chunk sets, which can be used to route similar artifacts to the
+// same delta-compression group without comparing their contents.
+package similarity
+
+import (
+	"encoding/hex"
+	"math"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// Size is the number of min-hash values in a Sketch. The standard error of
+// a resemblance estimate is about 1/sqrt(Size).
+const Size = 64
+
+// Sketch is a min-hash signature of a set of chunk features. The zero value
+// is not a valid sketch; use NewSketch.
+type Sketch [Size]uint64
+
+// NewSketch returns an empty sketch.
+func NewSketch() Sketch {
+	var s Sketch
+	for i := range s {
+		s[i] = math.MaxUint64
+	}
+	return s
+}
+
+// Add adds a chunk feature, such as a gear fingerprint, to the sketch.
+func (s *Sketch) Add(feature uint64) {
+	for i := range s {
+		if h := mix(feature ^ seeds[i]); h < s[i] {
+			s[i] = h
+		}
+	}
+}
+
+// Empty reports whether no features have been added to the sketch.
+func (s Sketch) Empty() bool {
+	return s == NewSketch()
+}
+
+// FromFingerprints returns the sketch of a set of chunk fingerprints, e.g.
+// fastcdc.Chunk Fingerprint values.
+func FromFingerprints(fingerprints []uint64) Sketch {
+	s := NewSketch()
+	for _, fp := range fingerprints {
+		s.Add(fp)
+	}
+	return s
+}
+
+// FromManifest returns the sketch of a manifest's chunks. Chunks are
+// identified by their digests rather than their fingerprints, since chunks
+// cut before the minimum size have no fingerprint.
+func FromManifest(m *manifest.Manifest) Sketch {
+	s := NewSketch()
+	for _, c := range m.Chunks {
+		s.Add(digestFeature(c.Digest))
+	}
+	return s
+}
+
+// Resemblance estimates the Jaccard resemblance of the feature sets behind
+// two sketches, from 0 (disjoint) to 1 (identical). Empty sketches resemble
+// nothing.
+func Resemblance(a, b Sketch) float64 {
+	if a.Empty() || b.Empty() {
+		return 0
+	}
+	var equal int
+	for i := range a {
+		if a[i] == b[i] {
+			equal++
+		}
+	}
+	return float64(equal) / Size
+}
+
+// digestFeature returns the leading 64 bits of a hex digest, or a hash of
+// the digest string if it is not hex.
+func digestFeature(digest string) uint64 {
+	var buf [8]byte
+	if len(digest) >= 16 {
+		if _, err := hex.Decode(buf[:], []byte(digest[:16])); err == nil {
+			var v uint64
+			for _, b := range buf {
+				v = v<<8 | uint64(b)
+			}
+			return v
+		}
+	}
+	// FNV-1a.
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(digest); i++ {
+		h ^= uint64(digest[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// seeds select Size independent hash functions.
+var seeds = func() [Size]uint64 {
+	var s [Size]uint64
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range s {
+		x = mix(x + uint64(i))
+		s[i] = x
+	}
+	return s
+}()
+
+// mix is the splitmix64 finalizer.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
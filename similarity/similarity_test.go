@@ -0,0 +1,68 @@
+package similarity
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+func TestResemblance(t *testing.T) {
+	features := func(from, to int) []uint64 {
+		var f []uint64
+		for i := from; i < to; i++ {
+			f = append(f, uint64(i)*0x100000001b3)
+		}
+		return f
+	}
+
+	for _, tc := range []struct {
+		name string
+		a, b []uint64
+		want float64
+	}{
+		{"identical", features(0, 1000), features(0, 1000), 1},
+		{"disjoint", features(0, 1000), features(1000, 2000), 0},
+		{"half overlap", features(0, 1000), features(500, 1500), 1.0 / 3},
+		{"empty", nil, features(0, 10), 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Resemblance(FromFingerprints(tc.a), FromFingerprints(tc.b))
+			if math.Abs(got-tc.want) > 0.15 {
+				t.Errorf("Resemblance() = %f, want about %f", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFromManifest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	base := make([]byte, 500000)
+	rng.Read(base)
+
+	// A small edit keeps most chunks.
+	edited := append([]byte(nil), base...)
+	copy(edited[250000:], []byte("an edit in the middle"))
+	unrelated := make([]byte, 500000)
+	rng.Read(unrelated)
+
+	sketch := func(data []byte) Sketch {
+		m, err := manifest.Build(bytes.NewReader(data), 4096)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return FromManifest(m)
+	}
+	s := sketch(base)
+	if r := Resemblance(s, sketch(edited)); r < 0.8 {
+		t.Errorf("resemblance of edited file = %f, want high", r)
+	}
+	if r := Resemblance(s, sketch(unrelated)); r > 0.1 {
+		t.Errorf("resemblance of unrelated file = %f, want low", r)
+	}
+	if s.Empty() || !FromManifest(&manifest.Manifest{}).Empty() {
+		t.Error("Empty() misreports sketch state")
+	}
+}
@@ -0,0 +1,138 @@
+// Package tarchunk chunks tar streams with boundaries aligned to tar entries.
+//
+// Content-defined chunking of a raw tar stream lets chunks straddle entry
+// headers, whose modification times and other metadata change between
+// otherwise identical archives. This package instead cuts the stream at every
+// entry: each entry's header blocks form their own chunk, and the entry's
+// contents are split by FastCDC independently of neighbouring entries. This
+// greatly improves deduplication of container layers and runfiles trees.
+package tarchunk
+
+import (
+	"archive/tar"
+	"io"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+)
+
+// Chunk is a chunk of a tar stream annotated with the entry containing it.
+type Chunk struct {
+	fastcdc.Chunk
+
+	// Path is the name of the entry the chunk belongs to. It is empty for
+	// the chunk holding the end-of-archive marker.
+	Path string
+
+	// Header reports whether the chunk holds header blocks rather than
+	// entry contents. Header chunks start with the padding of the preceding
+	// entry, and the final header chunk holds the end-of-archive marker.
+	Header bool
+}
+
+// Chunker splits a tar stream into chunks aligned to entry boundaries.
+// Concatenating the Data of all chunks reproduces the archive up to and
+// including its end-of-archive marker.
+type Chunker struct {
+	raw     *recordingReader
+	tr      *tar.Reader
+	chunker *fastcdc.Chunker
+
+	path      string
+	dataStart int64
+	inEntry   bool
+	done      bool
+}
+
+// NewChunker creates a Chunker reading a tar stream from r. The averageSize
+// and options configure the FastCDC chunker applied to entry contents, as for
+// fastcdc.NewChunker.
+func NewChunker(r io.Reader, averageSize int, opts ...fastcdc.Option) (*Chunker, error) {
+	chunker, err := fastcdc.NewChunker(nil, averageSize, opts...)
+	if err != nil {
+		return nil, err
+	}
+	raw := &recordingReader{r: r}
+	return &Chunker{
+		raw:     raw,
+		tr:      tar.NewReader(raw),
+		chunker: chunker,
+	}, nil
+}
+
+// Next returns the next chunk, or io.EOF when the archive is exhausted.
+// The chunk's Data slice is only valid until the next call to Next.
+func (c *Chunker) Next() (Chunk, error) {
+	if c.inEntry {
+		chunk, err := c.chunker.Next()
+		if err == nil {
+			chunk.Offset += int(c.dataStart)
+			return Chunk{Chunk: chunk, Path: c.path}, nil
+		}
+		if err != io.EOF {
+			return Chunk{}, err
+		}
+		c.inEntry = false
+	}
+	if c.done {
+		return Chunk{}, io.EOF
+	}
+
+	start := c.raw.n
+	c.raw.startRecording()
+	hdr, err := c.tr.Next()
+	headerData := c.raw.stopRecording()
+	if err != nil && err != io.EOF {
+		return Chunk{}, err
+	}
+
+	chunk := Chunk{
+		Chunk: fastcdc.Chunk{
+			Offset: int(start),
+			Length: len(headerData),
+			Data:   headerData,
+		},
+		Header: true,
+	}
+	if err == io.EOF {
+		c.done = true
+		if len(headerData) == 0 {
+			return Chunk{}, io.EOF
+		}
+		return chunk, nil
+	}
+
+	chunk.Path = hdr.Name
+	c.path = hdr.Name
+	c.dataStart = c.raw.n
+	c.inEntry = true
+	c.chunker.Reset(c.tr)
+	return chunk, nil
+}
+
+// recordingReader counts the bytes read through it and optionally keeps a
+// copy of them, which is used to capture raw header blocks.
+type recordingReader struct {
+	r         io.Reader
+	n         int64
+	recording bool
+	buf       []byte
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if r.recording {
+		r.buf = append(r.buf, p[:n]...)
+	}
+	return n, err
+}
+
+func (r *recordingReader) startRecording() {
+	r.recording = true
+	r.buf = r.buf[:0]
+}
+
+func (r *recordingReader) stopRecording() []byte {
+	r.recording = false
+	return r.buf
+}
@@ -0,0 +1,99 @@
+package tarchunk
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestChunker(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	files := []struct {
+		name string
+		size int
+	}{
+		{"small.txt", 10},
+		{"empty", 0},
+		{"large.bin", 300000},
+		{"dir/medium.bin", 5000},
+	}
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	contents := map[string][]byte{}
+	for _, f := range files {
+		data := make([]byte, f.size)
+		rng.Read(data)
+		contents[f.name] = data
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(f.size)}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	chunker, err := NewChunker(bytes.NewReader(archive.Bytes()), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		reassembled bytes.Buffer
+		headers     []string
+		entryData   = map[string][]byte{}
+	)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk.Offset != reassembled.Len() {
+			t.Fatalf("chunk offset = %d, want %d", chunk.Offset, reassembled.Len())
+		}
+		if chunk.Length != len(chunk.Data) {
+			t.Fatalf("chunk length %d does not match len(Data) %d", chunk.Length, len(chunk.Data))
+		}
+		reassembled.Write(chunk.Data)
+		if chunk.Header {
+			headers = append(headers, chunk.Path)
+			continue
+		}
+		if chunk.Length > 4*4096 {
+			t.Errorf("chunk of %s exceeds max size: %d", chunk.Path, chunk.Length)
+		}
+		entryData[chunk.Path] = append(entryData[chunk.Path], chunk.Data...)
+	}
+
+	if !bytes.Equal(reassembled.Bytes(), archive.Bytes()) {
+		t.Error("chunks do not reassemble to the original archive")
+	}
+	wantHeaders := []string{"small.txt", "empty", "large.bin", "dir/medium.bin", ""}
+	if len(headers) != len(wantHeaders) {
+		t.Fatalf("header chunks = %q, want %q", headers, wantHeaders)
+	}
+	for i := range wantHeaders {
+		if headers[i] != wantHeaders[i] {
+			t.Errorf("header chunk %d = %q, want %q", i, headers[i], wantHeaders[i])
+		}
+	}
+	for name, data := range contents {
+		if !bytes.Equal(entryData[name], data) {
+			t.Errorf("contents of %s do not match", name)
+		}
+	}
+}
+
+func TestChunker_InvalidOptions(t *testing.T) {
+	if _, err := NewChunker(bytes.NewReader(nil), 1000); err == nil {
+		t.Error("expected error for non-power-of-2 average size")
+	}
+}
@@ -0,0 +1,145 @@
+// Package tuner recommends chunking parameters for a corpus.
+//
+// It chunks a sample corpus under a grid of average sizes and normalization
+// levels and scores each combination by the storage it saves through
+// deduplication, net of a caller-supplied cost per chunk. This reproduces the
+// analysis behind the fastcdc default normalization level for any corpus.
+package tuner
+
+import (
+	"cmp"
+	"errors"
+	"io/fs"
+	"math"
+	"slices"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// Params is a combination of chunking parameters.
+type Params struct {
+	AverageSize   int
+	Normalization int
+}
+
+// Options returns the fastcdc options selecting p's normalization level. The
+// average size is passed to fastcdc.NewChunker separately.
+func (p Params) Options() []fastcdc.Option {
+	return []fastcdc.Option{fastcdc.WithNormalization(p.Normalization)}
+}
+
+// Grid lists the parameters to evaluate. Every average size is combined with
+// every normalization level.
+type Grid struct {
+	AverageSizes   []int
+	Normalizations []int
+}
+
+// DefaultGrid covers average sizes from 4KiB to 4MiB at every normalization
+// level.
+var DefaultGrid = Grid{
+	AverageSizes:   []int{4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20},
+	Normalizations: []int{0, 1, 2, 3},
+}
+
+// Objective weighs deduplication against per-chunk overhead. Costs are in
+// bytes, so that they can be compared with the bytes saved by deduplication.
+type Objective struct {
+	// ChunkCost is the cost of storing one unique chunk, e.g. object
+	// metadata or per-request overhead in the storage layer.
+	ChunkCost float64
+	// ReferenceCost is the cost of one chunk reference in a manifest.
+	ReferenceCost float64
+}
+
+// Result reports how a corpus chunks under one combination of parameters.
+type Result struct {
+	Params
+
+	Files        int
+	Chunks       int   // Chunk references across all files.
+	UniqueChunks int   // Distinct chunks across all files.
+	TotalBytes   int64 // Bytes across all files.
+	UniqueBytes  int64 // Bytes of distinct chunks.
+
+	// DedupRatio is the fraction of bytes saved by deduplication.
+	DedupRatio float64
+	// MeanChunkSize and StdDevChunkSize describe the chunk size
+	// distribution.
+	MeanChunkSize   float64
+	StdDevChunkSize float64
+
+	// Score is the bytes saved net of the objective's costs, as a fraction
+	// of TotalBytes. Higher is better.
+	Score float64
+}
+
+// Evaluate chunks every regular file of fsys under every combination of grid
+// and returns the results, best score first. Combinations rejected by
+// fastcdc.NewChunker are skipped.
+func Evaluate(fsys fs.FS, grid Grid, obj Objective) ([]Result, error) {
+	var results []Result
+	for _, avg := range grid.AverageSizes {
+		for _, norm := range grid.Normalizations {
+			p := Params{AverageSize: avg, Normalization: norm}
+			tc, err := manifest.NewTreeChunker(avg, 0, p.Options()...)
+			if err != nil {
+				continue
+			}
+			tree, err := tc.Chunk(fsys, ".")
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, NewResult(p, tree, obj))
+		}
+	}
+	slices.SortStableFunc(results, func(a, b Result) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return results, nil
+}
+
+// Recommend returns the best-scoring parameters for fsys.
+func Recommend(fsys fs.FS, grid Grid, obj Objective) (Result, error) {
+	results, err := Evaluate(fsys, grid, obj)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(results) == 0 {
+		return Result{}, errors.New("no valid parameters in grid")
+	}
+	return results[0], nil
+}
+
+// NewResult summarizes a tree chunked with parameters p, for callers that
+// chunk their corpus themselves.
+func NewResult(p Params, tree manifest.Tree, obj Objective) Result {
+	r := Result{Params: p, Files: len(tree)}
+	seen := make(map[string]bool)
+	var sumSquares float64
+	for _, m := range tree {
+		r.TotalBytes += m.Size
+		for _, c := range m.Chunks {
+			r.Chunks++
+			sumSquares += float64(c.Length) * float64(c.Length)
+			if !seen[c.Digest] {
+				seen[c.Digest] = true
+				r.UniqueChunks++
+				r.UniqueBytes += c.Length
+			}
+		}
+	}
+	if r.Chunks > 0 {
+		r.MeanChunkSize = float64(r.TotalBytes) / float64(r.Chunks)
+		variance := sumSquares/float64(r.Chunks) - r.MeanChunkSize*r.MeanChunkSize
+		r.StdDevChunkSize = math.Sqrt(max(variance, 0))
+	}
+	if r.TotalBytes > 0 {
+		saved := float64(r.TotalBytes - r.UniqueBytes)
+		r.DedupRatio = saved / float64(r.TotalBytes)
+		cost := obj.ChunkCost*float64(r.UniqueChunks) + obj.ReferenceCost*float64(r.Chunks)
+		r.Score = (saved - cost) / float64(r.TotalBytes)
+	}
+	return r
+}
@@ -0,0 +1,66 @@
+package tuner
+
+import (
+	"math/rand"
+	"testing"
+	"testing/fstest"
+)
+
+// corpus returns files that share most of their content with small edits,
+// like successive builds of an artifact.
+func corpus() fstest.MapFS {
+	rng := rand.New(rand.NewSource(1))
+	base := make([]byte, 1<<20)
+	rng.Read(base)
+	fsys := fstest.MapFS{}
+	for i := range 8 {
+		data := append([]byte(nil), base...)
+		for range 4 {
+			off := rng.Intn(len(data) - 100)
+			rng.Read(data[off : off+100])
+		}
+		fsys[string(rune('a'+i))] = &fstest.MapFile{Data: data}
+	}
+	return fsys
+}
+
+func TestEvaluate(t *testing.T) {
+	fsys := corpus()
+	grid := Grid{AverageSizes: []int{1 << 10, 16 << 10, 256 << 10}, Normalizations: []int{2}}
+
+	results, err := Evaluate(fsys, grid, Objective{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	for i, r := range results {
+		if r.Files != 8 || r.TotalBytes != 8<<20 {
+			t.Errorf("result %d covers %d files and %d bytes", i, r.Files, r.TotalBytes)
+		}
+		if i > 0 && r.Score > results[i-1].Score {
+			t.Errorf("results not sorted by score")
+		}
+	}
+	// Without chunk costs, the smallest chunks dedup best.
+	if best := results[0]; best.AverageSize != 1<<10 || best.DedupRatio < 0.8 {
+		t.Errorf("best = %+v, want 1KiB chunks with high dedup", best)
+	}
+
+	// A high per-chunk cost favors larger chunks.
+	best, err := Recommend(fsys, grid, Objective{ChunkCost: 4096, ReferenceCost: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if best.AverageSize == 1<<10 {
+		t.Errorf("Recommend() with high chunk cost = %+v, want larger chunks", best)
+	}
+}
+
+func TestRecommend_InvalidGrid(t *testing.T) {
+	_, err := Recommend(corpus(), Grid{AverageSizes: []int{1000}, Normalizations: []int{2}}, Objective{})
+	if err == nil {
+		t.Error("Recommend() with no valid parameters succeeded")
+	}
+}
@@ -0,0 +1,120 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// Client uploads blobs to a Handler, sending only the chunks it is missing.
+type Client struct {
+	// HTTP is the client used for requests. If nil, http.DefaultClient is
+	// used.
+	HTTP *http.Client
+	// URL is the URL the Handler is served at.
+	URL string
+	// AverageSize and Options are the chunking parameters, which must match
+	// those of the Handler for uploads to deduplicate against plain
+	// uploads.
+	AverageSize int
+	Options     []fastcdc.Option
+	// DigestFunction is the function chunks are digested with, which must
+	// match that of the Handler. The zero value means SHA-256.
+	DigestFunction manifest.DigestFunction
+}
+
+// Upload chunks the size bytes of ra, asks the server which chunks it is
+// missing, and uploads only those. It returns the manifest of the blob and
+// the number of chunk bytes sent.
+func (c *Client) Upload(ctx context.Context, ra io.ReaderAt, size int64) (*manifest.Manifest, int64, error) {
+	m, err := c.DigestFunction.Build(io.NewSectionReader(ra, 0, size), c.AverageSize, c.Options...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		digests []string
+		first   = make(map[string]manifest.Chunk)
+	)
+	for _, chunk := range m.Chunks {
+		if _, ok := first[chunk.Digest]; !ok {
+			first[chunk.Digest] = chunk
+			digests = append(digests, chunk.Digest)
+		}
+	}
+	var missing []string
+	if err := c.post(ctx, c.URL+"?"+missingQuery, "application/json", jsonBody(digests), &missing); err != nil {
+		return nil, 0, err
+	}
+
+	var sent int64
+	for _, d := range missing {
+		chunk, ok := first[d]
+		if !ok {
+			return nil, 0, fmt.Errorf("upload: server reported unknown chunk %s as missing", d)
+		}
+		sent += chunk.Length
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeSparse(pw, ra, m, missing, first))
+	}()
+	stored := &manifest.Manifest{}
+	err = c.post(ctx, c.URL, SparseContentType, pr, stored)
+	pr.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+	if stored.Digest != m.Digest {
+		return nil, 0, fmt.Errorf("upload: server stored digest %s, want %s", stored.Digest, m.Digest)
+	}
+	return m, sent, nil
+}
+
+// writeSparse writes the body of a sparse upload to w.
+func writeSparse(w io.Writer, ra io.ReaderAt, m *manifest.Manifest, included []string, chunks map[string]manifest.Chunk) error {
+	if err := json.NewEncoder(w).Encode(SparseUpload{Manifest: m, Included: included}); err != nil {
+		return err
+	}
+	for _, d := range included {
+		chunk := chunks[d]
+		if _, err := io.Copy(w, io.NewSectionReader(ra, chunk.Offset, chunk.Length)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// post sends body to url and decodes the JSON response into resp.
+func (c *Client) post(ctx context.Context, url, contentType string, body io.Reader, resp any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	hc := c.HTTP
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("upload: %s: %s: %s", url, res.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(res.Body).Decode(resp)
+}
+
+func jsonBody(v any) io.Reader {
+	b, _ := json.Marshal(v)
+	return bytes.NewReader(b)
+}
@@ -0,0 +1,247 @@
+// Package upload provides an HTTP endpoint for dedup-aware uploads.
+//
+// A Handler accepts uploads in two forms. A plain upload streams the whole
+// blob, which the server chunks and stores. A sparse upload, used by Client,
+// first asks the server which chunks it is missing and then sends the
+// blob's manifest followed by the data of just those chunks. Both forms
+// respond with the JSON-encoded manifest.Manifest of the blob.
+package upload
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+	"github.com/buildbuddy-io/fastcdc2020/pack"
+)
+
+// SparseContentType is the content type of a sparse upload: a JSON-encoded
+// SparseUpload and a newline, followed by the data of its included chunks
+// in order.
+const SparseContentType = "application/x-fastcdc-sparse"
+
+// missingQuery is the query parameter that selects the missing-chunks
+// request.
+const missingQuery = "missing"
+
+// Store holds uploaded chunks by digest. *pack.Dir implements Store.
+type Store interface {
+	Has(digest string) bool
+	Put(digest string, data []byte) (pack.Location, error)
+}
+
+// SparseUpload is the header of a sparse upload.
+type SparseUpload struct {
+	// Manifest describes the uploaded blob.
+	Manifest *manifest.Manifest `json:"manifest"`
+	// Included lists the digests of the chunks whose data follows, in
+	// order. Every other chunk of the manifest must already be stored.
+	Included []string `json:"included"`
+}
+
+// Handler is an http.Handler that chunks and stores uploads.
+//
+// It serves:
+//   - PUT or POST of a blob: chunks the body and stores new chunks.
+//   - PUT or POST with Content-Type SparseContentType: a sparse upload.
+//   - POST with the "missing" query parameter and a JSON array of digests:
+//     responds with the digests that are not stored.
+type Handler struct {
+	store       Store
+	averageSize int
+	opts        []fastcdc.Option
+	digest      manifest.DigestFunction
+}
+
+// NewHandler returns a handler storing chunks in store. Plain uploads are
+// chunked with the given average size and options, as for
+// fastcdc.NewChunker; clients must use the same parameters for their
+// sparse uploads to deduplicate against them.
+func NewHandler(store Store, averageSize int, opts ...fastcdc.Option) (*Handler, error) {
+	if _, err := fastcdc.NewChunker(nil, averageSize, opts...); err != nil {
+		return nil, err
+	}
+	return &Handler{store: store, averageSize: averageSize, opts: opts}, nil
+}
+
+// SetDigestFunction makes h digest chunks with f instead of SHA-256, and
+// accept only sparse uploads whose manifests use f. It returns
+// manifest.ErrUnsupportedDigestFunction if f cannot be computed.
+func (h *Handler) SetDigestFunction(f manifest.DigestFunction) error {
+	if !f.Supported() {
+		return fmt.Errorf("%w: %v", manifest.ErrUnsupportedDigestFunction, f)
+	}
+	h.digest = f
+	return nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		resp any
+		err  error
+	)
+	switch {
+	case r.Method == http.MethodPost && r.URL.Query().Has(missingQuery):
+		resp, err = h.missing(r.Body)
+	case r.Header.Get("Content-Type") == SparseContentType:
+		resp, err = h.putSparse(r.Body)
+	default:
+		resp, err = h.put(r.Body)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		var bad *badRequestError
+		if errors.As(err, &bad) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// missing returns the digests in the JSON array read from r that are not
+// stored.
+func (h *Handler) missing(r io.Reader) ([]string, error) {
+	var digests []string
+	if err := json.NewDecoder(r).Decode(&digests); err != nil {
+		return nil, &badRequestError{fmt.Errorf("decoding digests: %w", err)}
+	}
+	missing := []string{}
+	for _, d := range digests {
+		if !h.store.Has(d) {
+			missing = append(missing, d)
+		}
+	}
+	return missing, nil
+}
+
+// put chunks and stores a whole blob.
+func (h *Handler) put(r io.Reader) (*manifest.Manifest, error) {
+	chunker, err := fastcdc.NewChunker(r, h.averageSize, h.opts...)
+	if err != nil {
+		return nil, err
+	}
+	blobHash, err := h.digest.New()
+	if err != nil {
+		return nil, err
+	}
+	m := &manifest.Manifest{DigestFunction: h.digest}
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c, err := h.digest.NewChunk(chunk)
+		if err != nil {
+			return nil, err
+		}
+		blobHash.Write(chunk.Data)
+		if _, err := h.store.Put(c.Digest, chunk.Data); err != nil {
+			return nil, err
+		}
+		m.Chunks = append(m.Chunks, c)
+		m.Size += c.Length
+	}
+	m.Digest = hex.EncodeToString(blobHash.Sum(nil))
+	return m, nil
+}
+
+// putSparse reads a SparseUpload followed by the data of its included
+// chunks, verifies and stores those chunks, checks that every chunk of the
+// manifest is then stored, and returns the manifest.
+func (h *Handler) putSparse(r io.Reader) (*manifest.Manifest, error) {
+	br := bufio.NewReader(r)
+	dec := json.NewDecoder(br)
+	var req SparseUpload
+	if err := dec.Decode(&req); err != nil {
+		return nil, &badRequestError{fmt.Errorf("decoding upload: %w", err)}
+	}
+	m := req.Manifest
+	if m == nil {
+		return nil, &badRequestError{errors.New("upload has no manifest")}
+	}
+	if m.DigestFunction.Resolve() != h.digest.Resolve() {
+		return nil, &badRequestError{fmt.Errorf("manifest digest function %v, server uses %v", m.DigestFunction.Resolve(), h.digest.Resolve())}
+	}
+	// Chunk data follows the JSON value and its trailing newline.
+	data := io.MultiReader(dec.Buffered(), br)
+	if err := skipNewline(data); err != nil {
+		return nil, &badRequestError{err}
+	}
+
+	lengths := make(map[string]int64, len(m.Chunks))
+	var offset int64
+	for _, c := range m.Chunks {
+		if c.Offset != offset || c.Length <= 0 {
+			return nil, &badRequestError{fmt.Errorf("chunk at offset %d is not contiguous", c.Offset)}
+		}
+		offset += c.Length
+		lengths[c.Digest] = c.Length
+	}
+	if offset != m.Size {
+		return nil, &badRequestError{fmt.Errorf("chunks cover %d bytes, manifest size is %d", offset, m.Size)}
+	}
+
+	for _, digest := range req.Included {
+		length, ok := lengths[digest]
+		if !ok {
+			return nil, &badRequestError{fmt.Errorf("included chunk %s is not in the manifest", digest)}
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(data, buf); err != nil {
+			return nil, &badRequestError{fmt.Errorf("reading chunk %s: %w", digest, err)}
+		}
+		if got, err := m.DigestFunction.Digest(buf); err != nil || got != digest {
+			return nil, &badRequestError{fmt.Errorf("chunk data does not match digest %s", digest)}
+		}
+		if _, err := h.store.Put(digest, buf); err != nil {
+			return nil, err
+		}
+	}
+	if n, _ := io.Copy(io.Discard, data); n != 0 {
+		return nil, &badRequestError{fmt.Errorf("%d unexpected bytes after chunk data", n)}
+	}
+	for _, c := range m.Chunks {
+		if !h.store.Has(c.Digest) {
+			return nil, &badRequestError{fmt.Errorf("chunk %s is neither stored nor included", c.Digest)}
+		}
+	}
+	return m, nil
+}
+
+// skipNewline consumes the newline that json.Encoder writes after a value.
+func skipNewline(r io.Reader) error {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return fmt.Errorf("reading chunk data: %w", err)
+	}
+	if b[0] != '\n' {
+		return errors.New("manifest must be followed by a newline")
+	}
+	return nil
+}
+
+// badRequestError marks errors caused by a malformed request.
+type badRequestError struct {
+	err error
+}
+
+func (e *badRequestError) Error() string { return e.err.Error() }
+func (e *badRequestError) Unwrap() error { return e.err }
@@ -0,0 +1,196 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+	"github.com/buildbuddy-io/fastcdc2020/pack"
+)
+
+const averageSize = 4096
+
+func newServer(t *testing.T) (*httptest.Server, *pack.Dir) {
+	t.Helper()
+	store, err := pack.Open(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	h, err := NewHandler(store, averageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv, store
+}
+
+func randomData(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestHandler_Put(t *testing.T) {
+	srv, store := newServer(t)
+	data := randomData(1, 200000)
+	resp, err := http.Post(srv.URL, "application/octet-stream", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %s", resp.Status)
+	}
+	m := &manifest.Manifest{}
+	if err := json.NewDecoder(resp.Body).Decode(m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Size != int64(len(data)) || m.Digest != manifest.Digest(data) {
+		t.Errorf("manifest = size %d digest %s, want size %d digest %s", m.Size, m.Digest, len(data), manifest.Digest(data))
+	}
+	for _, c := range m.Chunks {
+		got, err := store.Get(c.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data[c.Offset:c.Offset+c.Length]) {
+			t.Errorf("stored chunk at offset %d differs", c.Offset)
+		}
+	}
+
+	resp, err = http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %s, want 405", resp.Status)
+	}
+}
+
+func TestClient_Upload(t *testing.T) {
+	srv, _ := newServer(t)
+	c := &Client{URL: srv.URL, AverageSize: averageSize}
+	ctx := context.Background()
+
+	data := randomData(2, 500000)
+	m, sent, err := c.Upload(ctx, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != int64(len(data)) || m.Digest != manifest.Digest(data) {
+		t.Errorf("first upload sent %d bytes, want %d", sent, len(data))
+	}
+
+	// An edited copy only needs the chunks around the edit.
+	edited := append([]byte(nil), data...)
+	copy(edited[250000:], "an edit in the middle")
+	if _, sent, err = c.Upload(ctx, bytes.NewReader(edited), int64(len(edited))); err != nil {
+		t.Fatal(err)
+	}
+	if sent == 0 || sent > 16*averageSize {
+		t.Errorf("edited upload sent %d bytes, want only the edited chunks", sent)
+	}
+
+	// Re-uploading is free.
+	if _, sent, err = c.Upload(ctx, bytes.NewReader(edited), int64(len(edited))); err != nil || sent != 0 {
+		t.Errorf("repeated upload sent %d bytes, err %v, want 0", sent, err)
+	}
+}
+
+func TestHandler_BadSparseUpload(t *testing.T) {
+	srv, _ := newServer(t)
+	data := randomData(3, 50000)
+	m, err := manifest.Build(bytes.NewReader(data), averageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		included []string
+		data     []byte
+	}{
+		{"missing chunks", nil, nil},
+		{"corrupt data", []string{m.Chunks[0].Digest}, make([]byte, m.Chunks[0].Length)},
+		{"short data", []string{m.Chunks[0].Digest}, data[:10]},
+		{"unknown chunk", []string{manifest.Digest([]byte("x"))}, []byte("x")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var body bytes.Buffer
+			json.NewEncoder(&body).Encode(SparseUpload{Manifest: m, Included: tc.included})
+			body.Write(tc.data)
+			resp, err := http.Post(srv.URL, SparseContentType, &body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("status = %s, want 400", resp.Status)
+			}
+		})
+	}
+
+	resp, err := http.Post(srv.URL+"?missing", "application/json", strings.NewReader("not json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("missing status = %s, want 400", resp.Status)
+	}
+}
+
+func TestHandler_DigestFunction(t *testing.T) {
+	store, err := pack.Open(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	h, err := NewHandler(store, averageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetDigestFunction(manifest.DigestSHA512); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	data := randomData(3, 200000)
+	want, err := manifest.DigestSHA512.Build(bytes.NewReader(data), averageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(srv.URL, "application/octet-stream", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	m := &manifest.Manifest{}
+	if err := json.NewDecoder(resp.Body).Decode(m); err != nil {
+		t.Fatal(err)
+	}
+	if m.DigestFunction != manifest.DigestSHA512 || m.Digest != want.Digest || len(m.Chunks) != len(want.Chunks) || m.Chunks[0] != want.Chunks[0] {
+		t.Errorf("plain upload manifest = %v %s, want SHA-512 manifest %s", m.DigestFunction, m.Digest, want.Digest)
+	}
+
+	c := &Client{URL: srv.URL, AverageSize: averageSize, DigestFunction: manifest.DigestSHA512}
+	edited := append([]byte(nil), data...)
+	copy(edited[100000:], "an edit in the middle")
+	if _, sent, err := c.Upload(context.Background(), bytes.NewReader(edited), int64(len(edited))); err != nil || sent == 0 || sent > 16*averageSize {
+		t.Errorf("SHA-512 sparse upload sent %d bytes, err %v", sent, err)
+	}
+	c.DigestFunction = manifest.DigestUnknown
+	if _, _, err := c.Upload(context.Background(), bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("SHA-256 upload to a SHA-512 handler succeeded")
+	}
+}
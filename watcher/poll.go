@@ -0,0 +1,70 @@
+package watcher
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// Poll returns events for the files under root that are created, removed,
+// or changed, as told by their manifest.FileKey, by walking the tree every
+// interval. It is a portable substitute for fsnotify. Changes are reported
+// relative to the tree as Poll finds it before returning. The channel is
+// closed once ctx is done.
+func Poll(ctx context.Context, root string, interval time.Duration) <-chan Event {
+	events := make(chan Event)
+	fsys := os.DirFS(root)
+	prev := scan(fsys)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			cur := scan(fsys)
+			var changed []string
+			for p, k := range cur {
+				if old, ok := prev[p]; !ok || old != k {
+					changed = append(changed, p)
+				}
+			}
+			for p := range prev {
+				if _, ok := cur[p]; !ok {
+					changed = append(changed, p)
+				}
+			}
+			prev = cur
+			for _, p := range changed {
+				select {
+				case events <- Event{Path: p}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+// scan returns the keys of the regular files of fsys. Files that cannot be
+// read are left out, and so reported as removed until they can be.
+func scan(fsys fs.FS) map[string]manifest.FileKey {
+	keys := map[string]manifest.FileKey{}
+	fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			keys[p] = manifest.NewFileKey(p, info)
+		}
+		return nil
+	})
+	return keys
+}
@@ -0,0 +1,223 @@
+// Package watcher keeps the manifests of a directory tree up to date as its
+// files change, the core loop of a continuous backup agent.
+//
+// A Watcher chunks the whole tree once and then consumes events naming the
+// paths that changed, from fsnotify, the USN journal, or Poll. Events are
+// debounced, so that a burst of writes to a file is chunked once, and every
+// batch of changes produces an updated Tree. Events that carry the byte
+// ranges a write touched re-chunk only those ranges with manifest.Rechunk;
+// others re-chunk the whole file. New chunks are passed to a put function,
+// typically storing them in a chunk store.
+package watcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/buildbuddy-io/fastcdc2020/fastcdc"
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// DefaultDebounce is the debounce delay used when Options.Debounce is zero.
+const DefaultDebounce = time.Second
+
+// Event reports that the file or directory at Path may have changed, been
+// created, or been removed.
+type Event struct {
+	// Path is the slash-separated path relative to the watched root, as
+	// accepted by fs.ValidPath.
+	Path string
+	// Dirty, if not nil, lists the byte ranges of the file that changed.
+	// Bytes outside them must be unchanged; a change of size needs no range
+	// of its own. If nil, the whole path is chunked again.
+	Dirty []manifest.Region
+}
+
+// Options configures a Watcher.
+type Options struct {
+	// Debounce is how long a batch of events must be quiet before its paths
+	// are chunked (default: DefaultDebounce).
+	Debounce time.Duration
+	// MaxDelay bounds how long a batch is held back by events that keep
+	// arriving (default: 10 * Debounce).
+	MaxDelay time.Duration
+	// Put, if not nil, is called with the digest and data of every chunk
+	// read, e.g. to store it. It must not retain data.
+	Put func(digest string, data []byte) error
+	// Cache, if not nil, lets the initial scan skip files chunked by a
+	// previous run; see manifest.TreeChunker.SetCache.
+	Cache *manifest.FileCache
+}
+
+// Watcher maintains the manifests of the files under a root directory.
+type Watcher struct {
+	fsys        fs.FS
+	tc          *manifest.TreeChunker
+	averageSize int
+	chunkerOpts []fastcdc.Option
+	opts        Options
+	tree        manifest.Tree
+}
+
+// New returns a Watcher of the directory root, chunking files with the
+// given average size and chunker options, as for fastcdc.NewChunker.
+func New(root string, averageSize int, opts Options, chunkerOpts ...fastcdc.Option) (*Watcher, error) {
+	if opts.Debounce < 0 || opts.MaxDelay < 0 {
+		return nil, errors.New("debounce delays must be non-negative")
+	}
+	if opts.Debounce == 0 {
+		opts.Debounce = DefaultDebounce
+	}
+	if opts.MaxDelay == 0 {
+		opts.MaxDelay = 10 * opts.Debounce
+	}
+	tc, err := manifest.NewTreeChunker(averageSize, 0, chunkerOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Cache != nil {
+		tc.SetCache(opts.Cache)
+	}
+	return &Watcher{
+		fsys:        os.DirFS(root),
+		tc:          tc,
+		averageSize: averageSize,
+		chunkerOpts: chunkerOpts,
+		opts:        opts,
+	}, nil
+}
+
+// Run chunks the whole tree and calls emit with its manifests, then applies
+// events until ctx is done or events is closed, calling emit with the
+// updated tree after every debounced batch. Trees passed to emit are not
+// modified afterwards. Run returns ctx.Err(), nil once events is closed and
+// the last batch is applied, or the first error of chunking or emit.
+//
+// Files that are re-chunked incrementally have an empty Digest in their
+// manifest, since computing it would take reading the whole file.
+func (w *Watcher) Run(ctx context.Context, events <-chan Event, emit func(manifest.Tree) error) error {
+	tree, err := w.tc.ChunkAndPut(w.fsys, ".", w.opts.Put)
+	if err != nil {
+		return err
+	}
+	w.tree = tree
+	if err := emit(maps.Clone(w.tree)); err != nil {
+		return err
+	}
+
+	pending := map[string][]manifest.Region{}
+	var first time.Time
+	timer := time.NewTimer(0)
+	<-timer.C
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		for p, dirty := range pending {
+			if err := w.apply(p, dirty); err != nil {
+				return err
+			}
+		}
+		clear(pending)
+		return emit(maps.Clone(w.tree))
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				timer.Stop()
+				return flush()
+			}
+			if !fs.ValidPath(ev.Path) {
+				continue
+			}
+			dirty, seen := pending[ev.Path]
+			switch {
+			case !seen:
+				pending[ev.Path] = ev.Dirty
+			case dirty != nil && ev.Dirty != nil:
+				pending[ev.Path] = append(dirty, ev.Dirty...)
+			default:
+				pending[ev.Path] = nil
+			}
+			if len(pending) == 1 && !seen {
+				first = time.Now()
+			}
+			wait := min(w.opts.Debounce, time.Until(first.Add(w.opts.MaxDelay)))
+			timer.Reset(max(wait, 0))
+		case <-timer.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// apply updates the tree for a change at path p.
+func (w *Watcher) apply(p string, dirty []manifest.Region) error {
+	info, err := fs.Lstat(w.fsys, p)
+	if errors.Is(err, fs.ErrNotExist) {
+		w.remove(p)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if old := w.tree[p]; info.Mode().IsRegular() && dirty != nil && old != nil {
+		return w.rechunk(p, old, info.Size(), dirty)
+	}
+	w.remove(p)
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return nil
+	}
+	sub, err := w.tc.ChunkAndPut(w.fsys, p, w.opts.Put)
+	if err != nil {
+		return err
+	}
+	maps.Copy(w.tree, sub)
+	return nil
+}
+
+// rechunk re-chunks the dirty ranges of the file at p.
+func (w *Watcher) rechunk(p string, old *manifest.Manifest, size int64, dirty []manifest.Region) error {
+	f, err := w.fsys.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		return errors.New("file does not support positioned reads")
+	}
+	m, _, err := manifest.Rechunk(old, ra, size, dirty, w.averageSize, w.opts.Put, w.chunkerOpts...)
+	if err != nil {
+		return err
+	}
+	w.tree[p] = m
+	return nil
+}
+
+// remove drops the manifests of p and everything below it.
+func (w *Watcher) remove(p string) {
+	if p == "." {
+		clear(w.tree)
+		return
+	}
+	delete(w.tree, p)
+	prefix := strings.TrimSuffix(path.Clean(p), "/") + "/"
+	for name := range w.tree {
+		if strings.HasPrefix(name, prefix) {
+			delete(w.tree, name)
+		}
+	}
+}
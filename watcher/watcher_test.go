@@ -0,0 +1,147 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+func randBytes(n int, seed int64) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func writeFile(t *testing.T, root, name string, data []byte) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runWatcher runs a watcher of root on events and returns a channel of the
+// trees it emits.
+func runWatcher(t *testing.T, root string, events <-chan Event, opts Options) <-chan manifest.Tree {
+	t.Helper()
+	w, err := New(root, 4096, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trees := make(chan manifest.Tree, 100)
+	done := make(chan error)
+	go func() {
+		done <- w.Run(context.Background(), events, func(tree manifest.Tree) error {
+			trees <- tree
+			return nil
+		})
+	}()
+	t.Cleanup(func() {
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	return trees
+}
+
+// next returns the next tree emitted, failing the test after a timeout.
+func next(t *testing.T, trees <-chan manifest.Tree) manifest.Tree {
+	t.Helper()
+	select {
+	case tree := <-trees:
+		return tree
+	case <-time.After(10 * time.Second):
+		t.Fatal("no tree emitted")
+		return nil
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "a", randBytes(100000, 1))
+	writeFile(t, root, "dir/b", randBytes(50000, 2))
+	writeFile(t, root, "dir/c", randBytes(50000, 3))
+
+	var stored atomic.Int64
+	events := make(chan Event)
+	trees := runWatcher(t, root, events, Options{
+		Debounce: 10 * time.Millisecond,
+		Put: func(digest string, data []byte) error {
+			stored.Add(1)
+			return nil
+		},
+	})
+	defer close(events)
+
+	tree := next(t, trees)
+	if len(tree) != 3 || stored.Load() == 0 {
+		t.Fatalf("initial tree has %d files, %d chunks stored", len(tree), stored.Load())
+	}
+
+	// A burst of events is applied as one batch.
+	writeFile(t, root, "a", randBytes(100000, 4))
+	writeFile(t, root, "new/d", randBytes(1000, 5))
+	if err := os.RemoveAll(filepath.Join(root, "dir")); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"a", "a", "new", "dir"} {
+		events <- Event{Path: p}
+	}
+	tree = next(t, trees)
+	if len(tree) != 2 || tree["new/d"] == nil || tree["a"].Digest != manifest.Digest(randBytes(100000, 4)) {
+		t.Errorf("tree after changes = %v", tree)
+	}
+
+	// Events with dirty ranges re-chunk only those ranges.
+	data := randBytes(100000, 4)
+	copy(data[40000:], randBytes(100, 6))
+	writeFile(t, root, "a", data)
+	stored.Store(0)
+	events <- Event{Path: "a", Dirty: []manifest.Region{{Offset: 40000, Length: 100}}}
+	tree = next(t, trees)
+	want, err := manifest.Build(bytes.NewReader(data), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tree["a"].Chunks, want.Chunks) || stored.Load() == 0 || stored.Load() >= int64(len(want.Chunks)) {
+		t.Errorf("incremental re-chunk stored %d of %d chunks, chunks equal %v", stored.Load(), len(want.Chunks), slices.Equal(tree["a"].Chunks, want.Chunks))
+	}
+}
+
+func TestPoll(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "a", randBytes(1000, 1))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	trees := runWatcher(t, root, Poll(ctx, root, 10*time.Millisecond), Options{Debounce: 10 * time.Millisecond})
+	if tree := next(t, trees); len(tree) != 1 {
+		t.Fatalf("initial tree has %d files", len(tree))
+	}
+
+	writeFile(t, root, "b", randBytes(1000, 2))
+	for {
+		if tree := next(t, trees); tree["b"] != nil {
+			break
+		}
+	}
+	if err := os.Remove(filepath.Join(root, "a")); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if tree := next(t, trees); tree["a"] == nil {
+			break
+		}
+	}
+	cancel()
+}
@@ -0,0 +1,176 @@
+// Package zsync reconstructs a remote file from a published manifest,
+// reusing chunks found in a local file and fetching only the missing byte
+// ranges over HTTP.
+//
+// The publisher serves the file and its JSON-encoded manifest.Manifest. A
+// client chunks its local copy with the same parameters, and Sync copies
+// every chunk whose digest is already present locally, downloading the rest
+// with HTTP Range requests.
+package zsync
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+// ErrDigestMismatch is returned when fetched data does not match the
+// manifest.
+var ErrDigestMismatch = errors.New("zsync: digest mismatch")
+
+// Stats summarizes a Sync.
+type Stats struct {
+	// LocalBytes is the number of bytes copied from the local file.
+	LocalBytes int64
+	// RemoteBytes is the number of bytes downloaded.
+	RemoteBytes int64
+	// Requests is the number of range requests made.
+	Requests int
+}
+
+// Client fetches manifests and missing chunks over HTTP.
+type Client struct {
+	// HTTP is the client used for requests. If nil, http.DefaultClient is
+	// used.
+	HTTP *http.Client
+}
+
+// FetchManifest downloads and decodes the JSON manifest at url.
+func (c *Client) FetchManifest(ctx context.Context, url string) (*manifest.Manifest, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("zsync: fetching manifest %s: %s", url, resp.Status)
+	}
+	m := &manifest.Manifest{}
+	if err := json.NewDecoder(resp.Body).Decode(m); err != nil {
+		return nil, fmt.Errorf("zsync: decoding manifest %s: %w", url, err)
+	}
+	return m, nil
+}
+
+// Sync writes the file described by remote to w. Chunks listed in
+// localManifest are read from local; all other chunks are fetched from url,
+// with adjacent missing chunks coalesced into a single range request. Every
+// chunk and the whole file are verified against remote.
+//
+// localManifest must have been built with the same chunking parameters and
+// digest function as remote for chunks to match. local may be nil if
+// localManifest is nil.
+func (c *Client) Sync(ctx context.Context, url string, remote *manifest.Manifest, local io.ReaderAt, localManifest *manifest.Manifest, w io.Writer) (Stats, error) {
+	fileHash, err := remote.DigestFunction.New()
+	if err != nil {
+		return Stats{}, fmt.Errorf("zsync: %w", err)
+	}
+	digest := remote.DigestFunction
+	have := make(map[string]manifest.Chunk)
+	if localManifest != nil && localManifest.DigestFunction.Resolve() == digest.Resolve() {
+		for _, chunk := range localManifest.Chunks {
+			have[chunk.Digest] = chunk
+		}
+	}
+	lookup := func(chunk manifest.Chunk) (manifest.Chunk, bool) {
+		src, ok := have[chunk.Digest]
+		return src, ok && src.Length == chunk.Length
+	}
+
+	var stats Stats
+	w = io.MultiWriter(w, fileHash)
+	chunks := remote.Chunks
+	for i := 0; i < len(chunks); {
+		if src, ok := lookup(chunks[i]); ok {
+			data := make([]byte, src.Length)
+			if _, err := local.ReadAt(data, src.Offset); err != nil {
+				return stats, fmt.Errorf("zsync: reading local chunk at offset %d: %w", src.Offset, err)
+			}
+			if err := writeChunk(w, digest, chunks[i], data); err != nil {
+				return stats, err
+			}
+			stats.LocalBytes += src.Length
+			i++
+			continue
+		}
+
+		// Coalesce the run of missing chunks starting at i.
+		j := i + 1
+		for j < len(chunks) {
+			if _, ok := lookup(chunks[j]); ok {
+				break
+			}
+			j++
+		}
+		if err := c.fetch(ctx, url, digest, chunks[i:j], w); err != nil {
+			return stats, err
+		}
+		for _, chunk := range chunks[i:j] {
+			stats.RemoteBytes += chunk.Length
+		}
+		stats.Requests++
+		i = j
+	}
+
+	if remote.Digest != "" && hex.EncodeToString(fileHash.Sum(nil)) != remote.Digest {
+		return stats, fmt.Errorf("%w: file %s", ErrDigestMismatch, remote.Digest)
+	}
+	return stats, nil
+}
+
+// fetch downloads the contiguous chunks with one range request and writes
+// them to w.
+func (c *Client) fetch(ctx context.Context, url string, digest manifest.DigestFunction, chunks []manifest.Chunk, w io.Writer) error {
+	first, last := chunks[0], chunks[len(chunks)-1]
+	start, end := first.Offset, last.Offset+last.Length
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("zsync: fetching bytes %d-%d of %s: %s", start, end-1, url, resp.Status)
+	}
+	for _, chunk := range chunks {
+		data := make([]byte, chunk.Length)
+		if _, err := io.ReadFull(resp.Body, data); err != nil {
+			return fmt.Errorf("zsync: reading bytes at offset %d of %s: %w", chunk.Offset, url, err)
+		}
+		if err := writeChunk(w, digest, chunk, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return http.DefaultClient
+}
+
+// writeChunk verifies data against chunk with the digest function of its
+// manifest and writes it to w.
+func writeChunk(w io.Writer, digest manifest.DigestFunction, chunk manifest.Chunk, data []byte) error {
+	if got, err := digest.Digest(data); err != nil || got != chunk.Digest {
+		return fmt.Errorf("%w: chunk at offset %d", ErrDigestMismatch, chunk.Offset)
+	}
+	_, err := w.Write(data)
+	return err
+}
@@ -0,0 +1,146 @@
+package zsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/buildbuddy-io/fastcdc2020/manifest"
+)
+
+const averageSize = 4096
+
+func newServer(t *testing.T, data []byte, m *manifest.Manifest) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	ranges := new(atomic.Int32)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			ranges.Add(1)
+		}
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(data))
+	})
+	mux.HandleFunc("/file.manifest", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(m)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, ranges
+}
+
+func build(t *testing.T, data []byte) *manifest.Manifest {
+	t.Helper()
+	m, err := manifest.Build(bytes.NewReader(data), averageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestSync(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	old := make([]byte, 1<<20)
+	rng.Read(old)
+	// The new version has one edit in the middle and appended data.
+	updated := append([]byte(nil), old...)
+	copy(updated[500000:], []byte("an edit in the middle"))
+	tail := make([]byte, 100000)
+	rng.Read(tail)
+	updated = append(updated, tail...)
+
+	srv, ranges := newServer(t, updated, build(t, updated))
+	c := &Client{}
+	ctx := context.Background()
+	remote, err := c.FetchManifest(ctx, srv.URL+"/file.manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	stats, err := c.Sync(ctx, srv.URL+"/file", remote, bytes.NewReader(old), build(t, old), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), updated) {
+		t.Fatal("reconstructed file differs")
+	}
+	if stats.LocalBytes+stats.RemoteBytes != int64(len(updated)) {
+		t.Errorf("stats = %+v, want %d bytes total", stats, len(updated))
+	}
+	if stats.RemoteBytes > int64(len(tail))+16*averageSize {
+		t.Errorf("downloaded %d bytes, want little more than the %d changed", stats.RemoteBytes, len(tail))
+	}
+	if stats.Requests != 2 || ranges.Load() != 2 {
+		t.Errorf("made %d range requests (server saw %d), want 2", stats.Requests, ranges.Load())
+	}
+}
+
+func TestSync_NoLocal(t *testing.T) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(2)).Read(data)
+	m := build(t, data)
+	srv, _ := newServer(t, data, m)
+
+	var out bytes.Buffer
+	stats, err := (&Client{}).Sync(context.Background(), srv.URL+"/file", m, nil, nil, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) || stats.Requests != 1 {
+		t.Errorf("Sync() = %+v, want whole file in one request", stats)
+	}
+}
+
+func TestSync_Corrupt(t *testing.T) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(3)).Read(data)
+	m := build(t, data)
+	corrupt := append([]byte(nil), data...)
+	corrupt[50000] ^= 1
+	srv, _ := newServer(t, corrupt, m)
+
+	_, err := (&Client{}).Sync(context.Background(), srv.URL+"/file", m, nil, nil, &bytes.Buffer{})
+	if !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Sync() error = %v, want ErrDigestMismatch", err)
+	}
+}
+
+func TestSync_DigestFunction(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	old := make([]byte, 200000)
+	rng.Read(old)
+	updated := append([]byte(nil), old...)
+	copy(updated[100000:], []byte("an edit in the middle"))
+	build512 := func(data []byte) *manifest.Manifest {
+		m, err := manifest.DigestSHA512.Build(bytes.NewReader(data), averageSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	remote := build512(updated)
+	srv, _ := newServer(t, updated, remote)
+
+	var out bytes.Buffer
+	stats, err := (&Client{}).Sync(context.Background(), srv.URL+"/file", remote, bytes.NewReader(old), build512(old), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), updated) || stats.LocalBytes == 0 {
+		t.Errorf("Sync() = %+v, want the file with local chunks reused", stats)
+	}
+
+	corrupt := append([]byte(nil), updated...)
+	corrupt[100000] ^= 1
+	srv, _ = newServer(t, corrupt, remote)
+	if _, err := (&Client{}).Sync(context.Background(), srv.URL+"/file", remote, nil, nil, &bytes.Buffer{}); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Sync() error = %v, want ErrDigestMismatch", err)
+	}
+}